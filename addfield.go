@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// processingTime is the processing timestamp of this run.
+var processingTime = time.Now().UTC()
+
+func parseAddFieldRules(flags []string) ([]AddFieldRule, error) {
+	var rules []AddFieldRule
+	for _, flag := range flags {
+		parts := strings.SplitN(flag, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%q: must be $.path:value", flag)
+		}
+		if isPointer(parts[0]) {
+			pointer, err := parsePointer(parts[0])
+			if err != nil {
+				return nil, fmt.Errorf("%q: %v", flag, err)
+			}
+			rules = append(rules, AddFieldRule{Pointer: pointer, Value: parts[1]})
+			continue
+		}
+		path, err := parseFieldPath(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", flag, err)
+		}
+		rules = append(rules, AddFieldRule{Path: path, Value: parts[1]})
+	}
+	return rules, nil
+}
+
+// parseFieldPath splits a dotted path such as $.meta.trace_id into its
+// field names.
+func parseFieldPath(str string) ([]string, error) {
+	if !strings.HasPrefix(str, "$.") {
+		return nil, fmt.Errorf("path must start with $.")
+	}
+	path := strings.Split(strings.TrimPrefix(str, "$."), ".")
+	for _, name := range path {
+		if name == "" {
+			return nil, fmt.Errorf("empty field name in path")
+		}
+	}
+	return path, nil
+}
+
+// addFields applies the addfield rules to each record of a processed
+// document: the elements of a top-level array, or the whole document.
+// Records that are not objects are left alone, as are paths running into
+// a value that is not an object. Rules with a JSON Pointer apply once to the
+// whole document instead, after the others.
+func addFields(doc interface{}, rules []AddFieldRule) interface{} {
+	doc = mapRecords(doc, func(record map[string]interface{}) map[string]interface{} {
+		for _, rule := range rules {
+			if rule.Pointer == nil {
+				record = setField(record, rule.Path, expandFieldValue(rule.Value))
+			}
+		}
+		return record
+	})
+	for _, rule := range rules {
+		if rule.Pointer != nil {
+			value := expandFieldValue(rule.Value)
+			doc = updatePointer(doc, rule.Pointer, true, func(interface{}, bool) (interface{}, bool) {
+				return value, true
+			})
+		}
+	}
+	return doc
+}
+
+// mapRecords applies fn to each object record of a document: the elements
+// of a top-level array, or the whole document.
+func mapRecords(doc interface{}, fn func(map[string]interface{}) map[string]interface{}) interface{} {
+	if obj, ok := doc.(map[string]interface{}); ok {
+		return fn(obj)
+	}
+	items, ok := doc.([]interface{})
+	if !ok {
+		return doc
+	}
+	result := make([]interface{}, len(items))
+	for i, item := range items {
+		if obj, ok := item.(map[string]interface{}); ok {
+			result[i] = fn(obj)
+		} else {
+			result[i] = item
+		}
+	}
+	return result
+}
+
+// setField returns a copy of obj with the field at path set to value,
+// creating missing objects along the way. obj itself is not modified, as it
+// may be shared with the input.
+func setField(obj map[string]interface{}, path []string, value interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(obj)+1)
+	for key, item := range obj {
+		result[key] = item
+	}
+	if len(path) == 1 {
+		result[path[0]] = value
+		return result
+	}
+
+	child, exists := obj[path[0]]
+	if !exists || child == nil {
+		child = map[string]interface{}{}
+	}
+	childObj, ok := child.(map[string]interface{})
+	if !ok {
+		return obj
+	}
+	result[path[0]] = setField(childObj, path[1:], value)
+	return result
+}
+
+// expandFieldValue replaces the placeholders of an addfield value.
+func expandFieldValue(value string) string {
+	if !strings.Contains(value, "{{") {
+		return value
+	}
+	value = strings.ReplaceAll(value, "{{now}}", processingTime.Format(time.RFC3339))
+	for strings.Contains(value, "{{uuid}}") {
+		value = strings.Replace(value, "{{uuid}}", newUUID(), 1)
+	}
+	return value
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestAddFields(t *testing.T) {
+	rules, err := parseAddFieldRules([]string{"$.trace_id:{{uuid}}", "$.meta.processed_at:{{now}}", "$.name.first:x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := map[string]interface{}{"name": "alice"}
+	input := []interface{}{first, map[string]interface{}{"meta": map[string]interface{}{"v": 1.0}}, "scalar"}
+	result := processDocument(input, "in.json", &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, &Transformations{AddFields: rules}).([]interface{})
+
+	a := result[0].(map[string]interface{})
+	b := result[1].(map[string]interface{})
+	if !uuidPattern.MatchString(a["trace_id"].(string)) {
+		t.Errorf("Expected a version 4 UUID, got %v", a["trace_id"])
+	}
+	if a["trace_id"] == b["trace_id"] {
+		t.Error("Expected each record to get its own UUID")
+	}
+	if a["name"] != "alice" {
+		t.Errorf("Expected a path through a non-object to be skipped, got %v", a["name"])
+	}
+
+	meta := b["meta"].(map[string]interface{})
+	if meta["v"] != 1.0 {
+		t.Errorf("Expected existing fields to be kept, got %v", meta)
+	}
+	if _, err := time.Parse(time.RFC3339, meta["processed_at"].(string)); err != nil {
+		t.Errorf("Expected an RFC 3339 timestamp, got %v", meta["processed_at"])
+	}
+	if result[2] != "scalar" {
+		t.Errorf("Expected non-object records to be left alone, got %v", result[2])
+	}
+	if _, exists := first["trace_id"]; exists {
+		t.Error("Expected the input to be left unmodified")
+	}
+}
+
+func TestAddFieldsInvalid(t *testing.T) {
+	for _, flag := range []string{"trace_id:{{uuid}}", "$.a..b:x", "$.a"} {
+		if _, err := parseAddFieldRules([]string{flag}); err == nil {
+			t.Errorf("Expected an error for %s", flag)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// AggregateRule sets the field at Field in every output record to the sum,
+// avg, min, max or count (Func) of the values Source selects in the record,
+// e.g. total=sum(items[*].price).
+type AggregateRule struct {
+	Field  []string
+	Func   string
+	Source []pathStep
+}
+
+// aggregateRegex matches an aggregate rule: field=func(path).
+var aggregateRegex = regexp.MustCompile(`^\s*([^=]+?)\s*=\s*(sum|avg|min|max|count)\((.+)\)\s*$`)
+
+func parseAggregateRules(flags []string) ([]AggregateRule, error) {
+	var rules []AggregateRule
+	for _, flag := range flags {
+		m := aggregateRegex.FindStringSubmatch(flag)
+		if m == nil {
+			return nil, fmt.Errorf("%q: must be field=func(path) with sum, avg, min, max or count", flag)
+		}
+		field := m[1]
+		if !strings.HasPrefix(field, "$.") {
+			field = "$." + field
+		}
+		path, err := parseFieldPath(field)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", flag, err)
+		}
+		source := m[3]
+		if !strings.HasPrefix(source, "$") {
+			source = "$." + source
+		}
+		steps, err := parseMaskPath(source)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", flag, err)
+		}
+		rules = append(rules, AggregateRule{Field: path, Func: m[2], Source: steps})
+	}
+	return rules, nil
+}
+
+// aggregateFields applies the aggregate rules to each record of a processed
+// document, like addfield.
+func aggregateFields(doc interface{}, rules []AggregateRule) interface{} {
+	return mapRecords(doc, func(record map[string]interface{}) map[string]interface{} {
+		for _, rule := range rules {
+			record = setField(record, rule.Field, aggregate(rule.Func, selectPath(record, rule.Source)))
+		}
+		return record
+	})
+}
+
+// selectPath returns the values path selects in doc.
+func selectPath(doc interface{}, path []pathStep) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{doc}
+	}
+	step, rest := path[0], path[1:]
+	var values []interface{}
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		if step.IsIndex {
+			return nil
+		}
+		for key, item := range v {
+			if matchKey(step.Key, key, false) {
+				values = append(values, selectPath(item, rest)...)
+			}
+		}
+	case []interface{}:
+		if !step.IsIndex {
+			return nil
+		}
+		for i, item := range v {
+			if step.Index < 0 || step.Index == i {
+				values = append(values, selectPath(item, rest)...)
+			}
+		}
+	}
+	return values
+}
+
+// aggregate computes an aggregate function over values. count counts the
+// values that are not null; the others only see numbers, and avg, min and max
+// of no numbers are null.
+func aggregate(fn string, values []interface{}) interface{} {
+	if fn == "count" {
+		count := 0
+		for _, value := range values {
+			if value != nil {
+				count++
+			}
+		}
+		return float64(count)
+	}
+
+	sum, count := 0.0, 0
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, value := range values {
+		num, ok := value.(float64)
+		if !ok {
+			continue
+		}
+		sum += num
+		count++
+		min, max = math.Min(min, num), math.Max(max, num)
+	}
+	switch {
+	case fn == "sum":
+		return sum
+	case count == 0:
+		return nil
+	case fn == "avg":
+		return sum / float64(count)
+	case fn == "min":
+		return min
+	default:
+		return max
+	}
+}
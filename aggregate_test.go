@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	input := []interface{}{
+		map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"price": 2.5, "qty": 2.0},
+				map[string]interface{}{"price": 7.5, "qty": nil},
+				map[string]interface{}{"price": "n/a"},
+			},
+		},
+		map[string]interface{}{"items": []interface{}{}},
+		"not a record",
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{
+		"-aggregate", "total=sum(items[*].price)",
+		"-aggregate", "summary.avg = avg(items[*].price)",
+		"-aggregate", "summary.max=max(items[].price)",
+		"-aggregate", "summary.min=min($.items[*].price)",
+		"-aggregate", "quantities=count(items[*].qty)",
+	})
+	expected := []interface{}{
+		map[string]interface{}{
+			"items":      input[0].(map[string]interface{})["items"],
+			"total":      10.0,
+			"summary":    map[string]interface{}{"avg": 5.0, "max": 7.5, "min": 2.5},
+			"quantities": 1.0,
+		},
+		map[string]interface{}{
+			"items":      []interface{}(nil),
+			"total":      0.0,
+			"summary":    map[string]interface{}{"avg": nil, "max": nil, "min": nil},
+			"quantities": 0.0,
+		},
+		"not a record",
+	}
+	if result := processDocument(input, "", filters, transforms); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected aggregate fields in every record, got %v", result)
+	}
+
+	for _, flag := range []string{"total", "total=median(items[*].price)", "=sum(x)", "total=sum(items[x])"} {
+		if _, err := parseAggregateRules([]string{flag}); err == nil {
+			t.Errorf("Expected -aggregate %q to be rejected", flag)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import "fmt"
+
+// setMatchMode sets what happens to objects and arrays failing the filters:
+// strict drops them with everything inside, ancestors keeps them, with just
+// the members and elements that pass, as long as anything inside passes.
+func setMatchMode(filters *Filters, mode string) error {
+	switch mode {
+	case "strict":
+		filters.RetainAncestors = false
+	case "ancestors":
+		filters.RetainAncestors = true
+	default:
+		return fmt.Errorf("must be strict or ancestors")
+	}
+	return nil
+}
+
+// retainsAncestor reports whether a member failing the filters is kept in
+// the ancestors match mode: its value must be an object or array, and its
+// key not one dropped with -dropkey, which always removes the whole member.
+func (f *Filters) retainsAncestor(key string, value interface{}) bool {
+	return f.RetainAncestors && isContainer(value) && !f.dropsKey(key)
+}
+
+// dropsKey reports whether key matches a -dropkey pattern.
+func (f *Filters) dropsKey(key string) bool {
+	for _, pattern := range f.DropKeys {
+		if matchKey(pattern, key, f.IgnoreKeyCase) {
+			return true
+		}
+	}
+	return false
+}
+
+// isContainer reports whether a value is an object or array.
+func isContainer(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// holdsMember reports whether a processed value has an object member left
+// in it. Array elements are not filtered by key or depth, so an array is
+// only kept for the objects inside it, not for its scalar elements.
+func holdsMember(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return len(v) > 0
+	case []interface{}:
+		for _, item := range v {
+			if holdsMember(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
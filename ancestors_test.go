@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchModeAncestors(t *testing.T) {
+	input := map[string]interface{}{
+		"user": map[string]interface{}{
+			"profile": map[string]interface{}{"email": "a@example.com", "x": 1.0},
+			"id":      2.0,
+		},
+		"rows":    []interface{}{map[string]interface{}{"id": 1.0, "label": "x"}},
+		"tags":    []interface{}{"a", "b"},
+		"version": 1.0,
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{"-minkeylen", "5"})
+	expected := map[string]interface{}{"version": 1.0}
+	if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected strict mode to drop short keys with their subtrees, got %v", result)
+	}
+
+	filters, transforms, _ = parseArgs("test", []string{"-minkeylen", "5", "-match-mode", "ancestors"})
+	expected = map[string]interface{}{
+		"user":    map[string]interface{}{"profile": map[string]interface{}{"email": "a@example.com"}},
+		"rows":    []interface{}{map[string]interface{}{"label": "x"}},
+		"version": 1.0,
+	}
+	if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected the ancestors of matching keys to be kept, got %v", result)
+	}
+
+	removed := removedDocument(input, filters, transforms)
+	expectedRemoved := map[string]interface{}{
+		"user": map[string]interface{}{"profile": map[string]interface{}{"x": 1.0}, "id": 2.0},
+		"rows": []interface{}{map[string]interface{}{"id": 1.0}},
+		"tags": []interface{}{"a", "b"},
+	}
+	if !reflect.DeepEqual(removed, expectedRemoved) {
+		t.Errorf("Expected -invert to mirror the ancestors mode, got %v", removed)
+	}
+
+	filters, transforms, _ = parseArgs("test", []string{"-dropkey", "user", "-match-mode", "ancestors"})
+	if _, ok := processJSON(input, filters, transforms, 1).(map[string]interface{})["user"]; ok {
+		t.Error("Expected -dropkey to remove the whole subtree in the ancestors mode")
+	}
+
+	if err := setMatchMode(&Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, "loose"); err == nil {
+		t.Error("Expected an unknown match mode to be rejected")
+	}
+}
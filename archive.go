@@ -0,0 +1,229 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// archiveEntry is a file or directory of a zip or tar.gz archive. Exactly
+// one of the headers is set, depending on the kind of archive.
+type archiveEntry struct {
+	Name      string
+	Data      []byte
+	zipHeader *zip.FileHeader
+	tarHeader *tar.Header
+}
+
+// archiveKind returns "zip" or "tar.gz" for the name of an archive, or ""
+// for any other file.
+func archiveKind(filename string) string {
+	lower := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	default:
+		return ""
+	}
+}
+
+// readArchive reads the entries of a zip or tar.gz archive in order.
+func readArchive(kind string, data []byte) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	if kind == "zip" {
+		r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range r.File {
+			rc, err := file.Open()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", file.Name, err)
+			}
+			content, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", file.Name, err)
+			}
+			header := file.FileHeader
+			entries = append(entries, archiveEntry{Name: file.Name, Data: content, zipHeader: &header})
+		}
+		return entries, nil
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	r := tar.NewReader(gz)
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", header.Name, err)
+		}
+		entries = append(entries, archiveEntry{Name: header.Name, Data: content, tarHeader: header})
+	}
+}
+
+// writeArchive writes entries as an archive of the same kind they were read
+// from, keeping their names, order, times and modes.
+func writeArchive(kind string, entries []archiveEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	if kind == "zip" {
+		w := zip.NewWriter(&buf)
+		for _, entry := range entries {
+			header := &zip.FileHeader{
+				Name:           entry.zipHeader.Name,
+				Comment:        entry.zipHeader.Comment,
+				Method:         entry.zipHeader.Method,
+				Modified:       entry.zipHeader.Modified,
+				ExternalAttrs:  entry.zipHeader.ExternalAttrs,
+				CreatorVersion: entry.zipHeader.CreatorVersion,
+			}
+			f, err := w.CreateHeader(header)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := f.Write(entry.Data); err != nil {
+				return nil, err
+			}
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := *entry.tarHeader
+		header.Size = int64(len(entry.Data))
+		if err := w.WriteHeader(&header); err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(entry.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// isJSONEntry reports whether an archive entry is a JSON file to process;
+// other entries are copied as they are.
+func isJSONEntry(entry archiveEntry) bool {
+	if entry.tarHeader != nil && entry.tarHeader.Typeflag != tar.TypeReg {
+		return false
+	}
+	return strings.EqualFold(path.Ext(entry.Name), ".json")
+}
+
+// processArchive applies the pipeline to every JSON entry of an archive,
+// with the same query, limits and assertions as a single input file. The
+// context's error is returned as it is when processing is stopped.
+func processArchive(ctx context.Context, pipeline *Pipeline, entries []archiveEntry, format *FormatOptions, limits *Limits, assertions *Assertions) ([]archiveEntry, error) {
+	result := make([]archiveEntry, len(entries))
+	var size int64
+	var violations []string
+	for i, entry := range entries {
+		result[i] = entry
+		if !isJSONEntry(entry) {
+			size += int64(len(entry.Data))
+			continue
+		}
+
+		if err := limits.checkJSONDepth(entry.Data); err != nil {
+			return nil, fmt.Errorf("%s: %v", entry.Name, err)
+		}
+		data, err := decodeJSON(entry.Data, entry.Name)
+		if err != nil {
+			return nil, err
+		}
+		processed, err := pipeline.ProcessContext(ctx, data, entry.Name)
+		if err != nil {
+			return nil, err
+		}
+		if processed, err = applyQuery(processed, format); err != nil {
+			return nil, fmt.Errorf("%s: %v", entry.Name, err)
+		}
+		for _, violation := range assertions.check(processed) {
+			violations = append(violations, entry.Name+": "+violation)
+		}
+		if result[i].Data, err = encodeOutput(processed, format); err != nil {
+			return nil, fmt.Errorf("%s: %v", entry.Name, err)
+		}
+		size += int64(len(result[i].Data))
+	}
+
+	if len(violations) > 0 {
+		return nil, fmt.Errorf("Assertion failed: %s\n%d assertion failures; no output written", strings.Join(violations, "\nAssertion failed: "), len(violations))
+	}
+	if err := limits.checkOutputSize(size); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// runArchive processes the JSON entries of an archive input file and writes
+// the sanitized archive to outputFile, or - for stdout.
+func runArchive(ctx context.Context, kind, inputFile, outputFile string, pipeline *Pipeline, format *FormatOptions, limits *Limits, assertions *Assertions) {
+	if outputFile != "-" && archiveKind(outputFile) != kind {
+		fmt.Fprintf(os.Stderr, "The output of a %s archive must be a %s archive too\n", kind, kind)
+		os.Exit(2)
+	}
+	if format.SplitByKey || format.ChunkSize > 0 || format.RemovedOut != "" || format.InFormat != "json" {
+		fmt.Fprintf(os.Stderr, "Archive input cannot be combined with split output, -removed-out or -informat\n")
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(inputFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input file: %v\n", err)
+		os.Exit(1)
+	}
+	entries, err := readArchive(kind, data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading archive %s: %v\n", inputFile, err)
+		os.Exit(1)
+	}
+
+	entries, err = processArchive(ctx, pipeline, entries, format, limits, assertions)
+	exitOnProcessError(err, limits)
+
+	output, err := writeArchive(kind, entries)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing archive: %v\n", err)
+		os.Exit(1)
+	}
+	if outputFile == "-" {
+		os.Stdout.Write(output)
+		return
+	}
+	if err := writeFileAtomic(outputFile, output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output file: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Processed %s archive written to %s\n", kind, outputFile)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestArchive(t *testing.T) {
+	for _, kind := range []string{"zip", "tar.gz"} {
+		t.Run(kind, func(t *testing.T) {
+			files := []struct{ name, content string }{
+				{"bundle/", ""},
+				{"bundle/users.json", `{"email": "a@example.com", "id": 1}`},
+				{"bundle/README.txt", `email: a@example.com`},
+			}
+			var entries []archiveEntry
+			for _, file := range files {
+				entry := archiveEntry{Name: file.name, Data: []byte(file.content)}
+				if kind == "zip" {
+					entry.zipHeader = &zip.FileHeader{Name: file.name, Method: zip.Deflate}
+				} else {
+					typeflag := byte(tar.TypeReg)
+					if strings.HasSuffix(file.name, "/") {
+						typeflag = tar.TypeDir
+					}
+					entry.tarHeader = &tar.Header{Name: file.name, Typeflag: typeflag, Mode: 0644}
+				}
+				entries = append(entries, entry)
+			}
+			data, err := writeArchive(kind, entries)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err = readArchive(kind, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			transforms := &Transformations{MaskVal: []MaskRule{{Pattern: "email", Mask: "***"}}}
+			filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}
+			pipeline, err := NewPipeline(filters, transforms)
+			if err != nil {
+				t.Fatal(err)
+			}
+			format := &FormatOptions{OutFormat: "json", InFormat: "json"}
+			processed, err := processArchive(context.Background(), pipeline, entries, format, &Limits{}, &Assertions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err = writeArchive(kind, processed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err = readArchive(kind, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 3 || entries[0].Name != "bundle/" || entries[2].Name != "bundle/README.txt" {
+				t.Fatalf("Expected the archive structure to be kept, got %v", entries)
+			}
+			var users map[string]interface{}
+			if err := json.Unmarshal(entries[1].Data, &users); err != nil {
+				t.Fatal(err)
+			}
+			if users["email"] != "***" || users["id"] != 1.0 {
+				t.Errorf("Expected the JSON entry to be processed, got %v", users)
+			}
+			if string(entries[2].Data) != files[2].content {
+				t.Errorf("Expected other entries to be copied as they are, got %q", entries[2].Data)
+			}
+
+			assertions := &Assertions{Present: []string{"$.name"}}
+			if _, err := processArchive(context.Background(), pipeline, entries, format, &Limits{}, assertions); err == nil || !strings.Contains(err.Error(), "bundle/users.json: $.name: missing") {
+				t.Errorf("Expected assertion failures naming the entry, got %v", err)
+			}
+		})
+	}
+
+	if archiveKind("support.TGZ") != "tar.gz" || archiveKind("data.json") != "" {
+		t.Error("Expected archives to be recognized by extension")
+	}
+}
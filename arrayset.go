@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SetRule keeps (arrayintersect) or removes (arraysubtract) the elements of
+// arrays of keys matching Pattern that are in the list loaded from File.
+// Scalar elements are matched by value, and object elements by their Field.
+type SetRule struct {
+	Pattern string
+	File    string
+	Field   string
+	set     map[string]bool
+	RuleOptions
+}
+
+// parseSetRules parses arrayintersect and arraysubtract rules,
+// key:file[:field] or the field form with key, file, field and under, and
+// loads their lists.
+func parseSetRules(flags []string) ([]SetRule, error) {
+	var rules []SetRule
+	for _, flag := range flags {
+		var rule SetRule
+		if fields, ok := parseRuleFields(flag, "key", "file", "field", "under"); ok {
+			rule = SetRule{
+				Pattern:     fields["key"],
+				File:        fields["file"],
+				Field:       fields["field"],
+				RuleOptions: RuleOptions{Under: fields["under"]},
+			}
+		} else {
+			parts := strings.Split(flag, ":")
+			if len(parts) < 2 || len(parts) > 3 {
+				return nil, fmt.Errorf("%q: must be key:file[:field]", flag)
+			}
+			rule = SetRule{Pattern: parts[0], File: parts[1]}
+			if len(parts) == 3 {
+				rule.Field = parts[2]
+			}
+		}
+		if rule.Pattern == "" || rule.File == "" {
+			return nil, fmt.Errorf("%q: needs a key and a file", flag)
+		}
+
+		set, err := loadSetList(rule.File, rule.Field)
+		if err != nil {
+			return nil, err
+		}
+		rule.set = set
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// loadSetList reads a JSON array of scalars, or of objects with field, into
+// a set. Values are compared as text, so the number 44 matches the ID "44".
+func loadSetList(filename, field string) (map[string]bool, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading list: %v", err)
+	}
+	var items []interface{}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, jsonParseError(data, "list "+filename, err)
+	}
+
+	set := make(map[string]bool, len(items))
+	for _, item := range items {
+		if id, ok := setMember(item, field); ok {
+			set[id] = true
+		}
+	}
+	return set, nil
+}
+
+// setMember returns the text an element is matched by: a scalar itself, or
+// the field of an object. It reports false for anything else, including
+// nulls.
+func setMember(item interface{}, field string) (string, bool) {
+	if obj, ok := item.(map[string]interface{}); ok {
+		if field == "" {
+			return "", false
+		}
+		item = obj[field]
+	}
+	if item == nil {
+		return "", false
+	}
+	return formatScalar(item)
+}
+
+// filterSet returns the elements of arr that are in the rule's list, or
+// with subtract the ones that are not.
+func filterSet(arr []interface{}, rule SetRule, subtract bool) []interface{} {
+	result := []interface{}{}
+	for _, item := range arr {
+		id, ok := setMember(item, rule.Field)
+		if (ok && rule.set[id]) != subtract {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestArraySets(t *testing.T) {
+	dir := t.TempDir()
+	consent := filepath.Join(dir, "consent.json")
+	if err := os.WriteFile(consent, []byte(`[1, "3", null]`), 0644); err != nil {
+		t.Fatalf("Failed to write list: %v", err)
+	}
+	blocked := filepath.Join(dir, "blocked.json")
+	if err := os.WriteFile(blocked, []byte(`[{"id": 2}, {"name": "x"}]`), 0644); err != nil {
+		t.Fatalf("Failed to write list: %v", err)
+	}
+	u1 := map[string]interface{}{"id": 1.0}
+	u2 := map[string]interface{}{"id": 2.0}
+	u3 := map[string]interface{}{"id": 3.0}
+	input := map[string]interface{}{
+		"ids":   []interface{}{1.0, 2.0, "3", nil},
+		"users": []interface{}{u1, u2, u3, map[string]interface{}{"name": "x"}},
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{
+		"-arrayintersect", "ids:" + consent,
+		"-arrayintersect", "users:" + consent + ":id",
+	})
+	expected := map[string]interface{}{
+		"ids":   []interface{}{1.0, "3"},
+		"users": []interface{}{u1, u3},
+	}
+	if result := processDocument(input, "", filters, transforms); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected only consenting IDs kept, got %v", result)
+	}
+
+	filters, transforms, _ = parseArgs("test", []string{"-arraysubtract", "key=users file=" + blocked + " field=id"})
+	expected = map[string]interface{}{
+		"ids":   []interface{}{1.0, 2.0, "3", nil},
+		"users": []interface{}{u1, u3, map[string]interface{}{"name": "x"}},
+	}
+	if result := processDocument(input, "", filters, transforms); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected blocked users removed, got %v", result)
+	}
+
+	for _, flag := range []string{"ids", ":" + consent, "ids:" + consent + ":id:x", "ids:" + filepath.Join(dir, "missing.json")} {
+		if _, err := parseSetRules([]string{flag}); err == nil {
+			t.Errorf("Expected %q to be rejected", flag)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// Assertions are checks on the processed output, for gating CI on redaction
+// having worked.
+type Assertions struct {
+	// Absent are patterns no key or scalar value of the output may match
+	Absent []*regexp.Regexp
+	// Present are key paths, as listed by the paths subcommand or with [*]
+	// for every element as in path rules, that must occur in the output
+	Present []string
+}
+
+// registerAssertFlags adds the assertion flags to a command's flag set.
+func registerAssertFlags(assertions *Assertions) func(*flag.FlagSet) {
+	return func(fs *flag.FlagSet) {
+		fs.Func("assert-absent", "Fail if a key or value of the output matches this regular expression", func(pattern string) error {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return err
+			}
+			assertions.Absent = append(assertions.Absent, re)
+			return nil
+		})
+		fs.Func("assert-present", "Fail unless the output has a value at this key path, e.g. $.users[*].id", func(path string) error {
+			if _, err := parseMaskPath(path); err != nil {
+				return err
+			}
+			assertions.Present = append(assertions.Present, path)
+			return nil
+		})
+	}
+}
+
+// check returns a message for every assertion the output violates, in path
+// order. Values in a record tagged by -lineage are reported with its ID.
+func (a *Assertions) check(doc interface{}) []string {
+	var violations []string
+	if len(a.Absent) > 0 {
+		walkExactPaths(doc, "$", func(path, key string, value interface{}) {
+			where := path
+			if id := recordLineage(doc, path); id != "" {
+				where = fmt.Sprintf("%s (record %s)", path, id)
+			}
+			for _, re := range a.Absent {
+				if key != "" && re.MatchString(key) {
+					violations = append(violations, fmt.Sprintf("%s: key matches %s", where, re))
+				}
+				if str, ok := formatScalar(value); ok && value != nil && re.MatchString(str) {
+					violations = append(violations, fmt.Sprintf("%s: value matches %s", where, re))
+				}
+			}
+		})
+		sort.Strings(violations)
+	}
+
+	for _, path := range a.Present {
+		steps, err := parseMaskPath(path)
+		if err != nil {
+			violations = append(violations, fmt.Sprintf("%s: %v", path, err))
+		} else if len(selectPath(doc, steps)) == 0 {
+			violations = append(violations, fmt.Sprintf("%s: missing", path))
+		}
+	}
+	return violations
+}
+
+// walkExactPaths calls fn for every value of a document with its path and,
+// for object members, its key.
+func walkExactPaths(value interface{}, path string, fn func(path, key string, value interface{})) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			itemPath := joinPath(path, key)
+			fn(itemPath, key, item)
+			walkExactPaths(item, itemPath, fn)
+		}
+	case []interface{}:
+		for i, item := range v {
+			itemPath := indexPath(path, i)
+			fn(itemPath, "", item)
+			walkExactPaths(item, itemPath, fn)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestAssertions(t *testing.T) {
+	var assertions Assertions
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	registerAssertFlags(&assertions)(fs)
+	if err := fs.Parse([]string{"-assert-absent", "(?i)password|ssn", "-assert-present", "$.users[].id", "-assert-present", "$.total"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Parse([]string{"-assert-absent", "("}); err == nil {
+		t.Error("Expected an invalid regular expression to be rejected")
+	}
+
+	doc := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"id": 1.0, "Password": "***"},
+			map[string]interface{}{"id": 2.0, "note": "ssn 123-45-6789"},
+		},
+	}
+	expected := []string{
+		`$.users[0].Password: key matches (?i)password|ssn`,
+		`$.users[1].note: value matches (?i)password|ssn`,
+		`$.total: missing`,
+	}
+	if got := assertions.check(doc); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	clean := map[string]interface{}{
+		"users": []interface{}{map[string]interface{}{"id": 1.0}},
+		"total": 1.0,
+	}
+	if got := assertions.check(clean); len(got) != 0 {
+		t.Errorf("Expected clean output to pass, got %q", got)
+	}
+
+	star := Assertions{Present: []string{"$.users[*].id", "$.users[0].id", "$.users[*].name"}}
+	if got := star.check(clean); !reflect.DeepEqual(got, []string{"$.users[*].name: missing"}) {
+		t.Errorf("Expected [*] and indexes to select elements, got %q", got)
+	}
+	if err := fs.Parse([]string{"-assert-present", "users.id"}); err == nil {
+		t.Error("Expected a path it cannot parse to be rejected")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// decodeMsgpack parses a MessagePack document into the generic tree.
+func decodeMsgpack(data []byte) (interface{}, error) {
+	var doc interface{}
+	if err := msgpack.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("Error parsing MessagePack: %v", err)
+	}
+	return fromBinary(doc), nil
+}
+
+// decodeCBOR parses a CBOR document into the generic tree.
+func decodeCBOR(data []byte) (interface{}, error) {
+	var doc interface{}
+	if err := cbor.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("Error parsing CBOR: %v", err)
+	}
+	return fromBinary(doc), nil
+}
+
+// fromBinary converts a value decoded from a binary format to the types the
+// pipeline works with, as for JSON: integers become float64, non-string map
+// keys are formatted as strings, byte strings are base64-encoded like
+// encoding/json does and timestamps become RFC 3339 strings.
+func fromBinary(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = fromBinary(item)
+		}
+		return v
+	case map[interface{}]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			obj[fmt.Sprint(key)] = fromBinary(item)
+		}
+		return obj
+	case []interface{}:
+		for i, item := range v {
+			v[i] = fromBinary(item)
+		}
+		return v
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case cbor.Tag:
+		return fromBinary(v.Content)
+	default:
+		return v
+	}
+}
+
+// encodeMsgpack writes a processed document as MessagePack with sorted map
+// keys. Whole numbers are written as integers.
+func encodeMsgpack(doc interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetSortMapKeys(true)
+	if err := enc.Encode(toBinary(doc)); err != nil {
+		return nil, fmt.Errorf("Error writing MessagePack: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeCBOR writes a processed document as canonical CBOR. Whole numbers are
+// written as integers.
+func encodeCBOR(doc interface{}) ([]byte, error) {
+	mode, err := cbor.CanonicalEncOptions().EncMode()
+	if err != nil {
+		return nil, err
+	}
+	output, err := mode.Marshal(toBinary(doc))
+	if err != nil {
+		return nil, fmt.Errorf("Error writing CBOR: %v", err)
+	}
+	return output, nil
+}
+
+func toBinary(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			obj[key] = toBinary(item)
+		}
+		return obj
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, item := range v {
+			arr[i] = toBinary(item)
+		}
+		return arr
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+		return v
+	default:
+		return v
+	}
+}
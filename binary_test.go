@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBinaryFormatsRoundTrip(t *testing.T) {
+	doc := map[string]interface{}{
+		"event": "login",
+		"count": 3.0,
+		"ratio": 0.25,
+		"ok":    true,
+		"meta":  nil,
+		"tags":  []interface{}{"a", 1.0, map[string]interface{}{"nested": "x"}},
+	}
+
+	codecs := map[string]struct {
+		encode func(interface{}) ([]byte, error)
+		decode func([]byte) (interface{}, error)
+	}{
+		"msgpack": {encodeMsgpack, decodeMsgpack},
+		"cbor":    {encodeCBOR, decodeCBOR},
+	}
+	for name, codec := range codecs {
+		data, err := codec.encode(doc)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		decoded, err := codec.decode(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(decoded, doc) {
+			t.Errorf("%s: expected %v, got %v", name, doc, decoded)
+		}
+	}
+}
+
+func TestFromBinary(t *testing.T) {
+	value := map[interface{}]interface{}{
+		1:       uint8(7),
+		"bytes": []byte("hi"),
+		"list":  []interface{}{int64(-2), float32(1.5)},
+	}
+	expected := map[string]interface{}{
+		"1":     7.0,
+		"bytes": "aGk=",
+		"list":  []interface{}{-2.0, 1.5},
+	}
+	if result := fromBinary(value); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// boundPolicies lists what -boundnum and -boundstrlen can do with values out
+// of bounds.
+var boundPolicies = []string{"clamp", "drop", "null", "error"}
+
+// clamps reports whether the rule is set and clamps values into its bounds,
+// rather than applying another policy once the value is processed.
+func (r *BoundRule) clamps() bool {
+	return r != nil && (r.Policy == "" || r.Policy == "clamp")
+}
+
+// violatedBound returns the bound a value is out of, with its flag name, if
+// that bound has a policy other than clamp.
+func (t *Transformations) violatedBound(value interface{}) (*BoundRule, string) {
+	switch v := value.(type) {
+	case float64:
+		if b := t.BoundNum; b != nil && !b.clamps() && (v < b.Min || v > b.Max) {
+			return b, "boundnum"
+		}
+	case string:
+		if b := t.BoundStrLen; b != nil && !b.clamps() {
+			if length := float64(stringLength(v, t.LenUnit)); length < b.Min || length > b.Max {
+				return b, "boundstrlen"
+			}
+		}
+	}
+	return nil, ""
+}
+
+// applyPolicy applies the rule's policy to a value out of its bounds,
+// reporting whether the value is kept. error returns the error that stops
+// the run.
+func (r *BoundRule) applyPolicy(value interface{}, name string) (interface{}, bool, error) {
+	switch r.Policy {
+	case "drop":
+		return nil, false, nil
+	case "error":
+		if str, ok := value.(string); ok {
+			value = strconv.Quote(str)
+		}
+		return nil, false, fmt.Errorf("Error: %v is out of the -%s bounds %v:%v", value, name, r.Min, r.Max)
+	}
+	return nil, true, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBoundPolicy(t *testing.T) {
+	input := map[string]interface{}{
+		"id":    12345678901.0,
+		"count": 5.0,
+		"ids":   []interface{}{1.0, 2000.0},
+		"code":  "ABCDEFGHIJ",
+		"name":  "Ada",
+	}
+
+	tests := []struct {
+		args     []string
+		expected map[string]interface{}
+	}{
+		{[]string{"-boundnum", "0:1000:policy=drop"}, map[string]interface{}{
+			"count": 5.0, "ids": []interface{}{1.0}, "code": "ABCDEFGHIJ", "name": "Ada",
+		}},
+		{[]string{"-boundnum", "0:1000:policy=null"}, map[string]interface{}{
+			"id": nil, "count": 5.0, "ids": []interface{}{1.0, nil}, "code": "ABCDEFGHIJ", "name": "Ada",
+		}},
+		{[]string{"-boundnum", "0:1000:policy=clamp"}, map[string]interface{}{
+			"id": 1000.0, "count": 5.0, "ids": []interface{}{1.0, 1000.0}, "code": "ABCDEFGHIJ", "name": "Ada",
+		}},
+		{[]string{"-boundstrlen", "0:8:policy=drop"}, map[string]interface{}{
+			"id": 12345678901.0, "count": 5.0, "ids": []interface{}{1.0, 2000.0}, "name": "Ada",
+		}},
+		{[]string{"-boundstrlen", "0:8:policy=null:ellipsis=true"}, map[string]interface{}{
+			"id": 12345678901.0, "count": 5.0, "ids": []interface{}{1.0, 2000.0}, "code": nil, "name": "Ada",
+		}},
+	}
+	for _, test := range tests {
+		filters, transforms, _ := parseArgs("test", test.args)
+		if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.args, test.expected, result)
+		}
+	}
+
+	// error stops processing and is returned rather than exiting
+	filters, transforms, _ := parseArgs("test", []string{"-boundnum", "0:1000:policy=error"})
+	pipeline, err := NewPipeline(filters, transforms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := pipeline.Process(input, "test")
+	if err == nil || !strings.Contains(err.Error(), "out of the -boundnum bounds 0:1000") || result != nil {
+		t.Errorf("Expected an out-of-bounds error and no result, got %v, %v", result, err)
+	}
+	if _, err := pipeline.Process(map[string]interface{}{"count": 5.0}, "test"); err != nil {
+		t.Errorf("Expected a document in bounds to pass after an error, got %v", err)
+	}
+
+	if _, err := parseBoundRule("0:10:policy=wrap", false); err == nil {
+		t.Error("Expected an unknown policy to be rejected")
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ellipsis ends the strings a BoundRule with Ellipsis truncates.
+const ellipsis = "…"
+
+// setStringOption sets a padchar, side or ellipsis option of a string
+// length bound.
+func (r *BoundRule) setStringOption(option string) error {
+	name, value, _ := strings.Cut(option, "=")
+	switch name {
+	case "padchar":
+		if utf8.RuneCountInString(value) != 1 {
+			return fmt.Errorf("padchar must be a single character")
+		}
+		r.PadChar = value
+	case "side":
+		if value != "left" && value != "right" && value != "both" {
+			return fmt.Errorf("side must be left, right or both")
+		}
+		r.PadSide = value
+	case "ellipsis":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("ellipsis must be true or false")
+		}
+		r.Ellipsis = b
+	default:
+		return fmt.Errorf("unknown option %q", option)
+	}
+	return nil
+}
+
+// pad lengthens str by at least n units of unit with the pad character.
+// Padding on both sides puts the odd character on the right.
+func (r *BoundRule) pad(str string, n int, unit string) string {
+	padChar := r.PadChar
+	if padChar == "" {
+		padChar = " "
+	}
+	width := stringLength(padChar, unit)
+	count := (n + width - 1) / width
+	switch r.PadSide {
+	case "left":
+		return strings.Repeat(padChar, count) + str
+	case "both":
+		return strings.Repeat(padChar, count/2) + str + strings.Repeat(padChar, count-count/2)
+	default:
+		return str + strings.Repeat(padChar, count)
+	}
+}
+
+// truncate shortens str to at most max units of unit, ending in an ellipsis
+// if the rule asks for one and it fits.
+func (r *BoundRule) truncate(str string, max int, unit string) string {
+	if width := stringLength(ellipsis, unit); r.Ellipsis && max >= width {
+		return truncateString(str, max-width, unit) + ellipsis
+	}
+	return truncateString(str, max, unit)
+}
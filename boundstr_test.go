@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBoundStrLenOptions(t *testing.T) {
+	input := map[string]interface{}{"id": "42", "code": "7", "name": "Ada Lovelace", "ok": "abcd"}
+
+	filters, transforms, _ := parseArgs("test", []string{"-boundstrlen", "4:8:padchar=0:side=left:ellipsis=true"})
+	expected := map[string]interface{}{"id": "0042", "code": "0007", "name": "Ada L…", "ok": "abcd"}
+	if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected left zero padding and an ellipsis, got %v", result)
+	}
+
+	filters, transforms, _ = parseArgs("test", []string{"-lenunit", "runes", "-boundstrlen", "5:8:padchar=*:side=both:ellipsis=true"})
+	expected = map[string]interface{}{"id": "*42**", "code": "**7**", "name": "Ada Lov…", "ok": "abcd*"}
+	if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected padding on both sides and an ellipsis counted as one rune, got %v", result)
+	}
+
+	for _, flag := range []string{"4:8:padchar=00", "4:8:side=up", "4:8:ellipsis=maybe", "4:8:color=red", "4"} {
+		if _, err := parseBoundRule(flag, true); err == nil {
+			t.Errorf("Expected -boundstrlen %q to be rejected", flag)
+		}
+	}
+	if _, err := parseBoundRule("0:10:side=left", false); err == nil {
+		t.Error("Expected string options to be rejected for -boundnum")
+	}
+}
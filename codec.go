@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// jsonCodec decodes JSON into the generic tree and encodes it back. Every
+// codec must behave like encoding/json: numbers decode to float64 and object
+// keys are written in sorted order.
+type jsonCodec interface {
+	Unmarshal(data []byte, v interface{}) error
+	Marshal(v interface{}) ([]byte, error)
+	MarshalIndent(v interface{}, prefix, indent string) ([]byte, error)
+}
+
+type stdCodec struct{}
+
+func (stdCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (stdCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (stdCodec) MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
+	return json.MarshalIndent(v, prefix, indent)
+}
+
+// jsoniterCodec uses json-iterator, whose own MarshalIndent misplaces the
+// indentation of nested values, so indentation is left to encoding/json.
+type jsoniterCodec struct{ jsoniter.API }
+
+func (c jsoniterCodec) MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
+	data, err := c.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, prefix, indent); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// jsonCodecs are the codecs selectable with -codec. The faster ones are
+// configured for compatibility with encoding/json. Builds with the sonic tag
+// add sonic.
+var jsonCodecs = map[string]jsonCodec{
+	"std":      stdCodec{},
+	"jsoniter": jsoniterCodec{jsoniter.ConfigCompatibleWithStandardLibrary},
+}
+
+// codec is the JSON codec used to read input and write output.
+var codec jsonCodec = stdCodec{}
+
+// setCodec selects the JSON codec by name.
+func setCodec(name string) error {
+	c, ok := jsonCodecs[name]
+	if !ok {
+		return fmt.Errorf("must be one of %s", strings.Join(codecNames(), ", "))
+	}
+	codec = c
+	return nil
+}
+
+// codecNames returns the names of the codecs in this build, sorted.
+func codecNames() []string {
+	names := make([]string, 0, len(jsonCodecs))
+	for name := range jsonCodecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,11 @@
+//go:build sonic
+
+package main
+
+import "github.com/bytedance/sonic"
+
+// sonic prints a warning on every run where its JIT does not support the
+// platform or toolchain, so it is only built in on request.
+func init() {
+	jsonCodecs["sonic"] = sonic.ConfigStd
+}
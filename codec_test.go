@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJSONCodecsAgree(t *testing.T) {
+	input := []byte(`{"b": [1, 2.5, "x", null, true], "a": {"nested": "<tag> & é"}, "big": 12345678901234567890}`)
+
+	var expected interface{}
+	if err := (stdCodec{}).Unmarshal(input, &expected); err != nil {
+		t.Fatal(err)
+	}
+	expectedOutput, _ := (stdCodec{}).MarshalIndent(expected, "", "  ")
+
+	for name, c := range jsonCodecs {
+		var doc interface{}
+		if err := c.Unmarshal(input, &doc); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(doc, expected) {
+			t.Errorf("%s: expected %v, got %v", name, expected, doc)
+		}
+
+		output, err := c.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if string(output) != string(expectedOutput) {
+			t.Errorf("%s: expected\n%s\ngot\n%s", name, expectedOutput, output)
+		}
+	}
+
+	if err := setCodec("fastest"); err == nil {
+		t.Error("Expected an error for an unknown codec")
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// ANSI escape sequences used for colorized output.
+const (
+	colorReset   = "\x1b[0m"
+	colorKey     = "\x1b[34m"
+	colorString  = "\x1b[32m"
+	colorNumber  = "\x1b[36m"
+	colorLiteral = "\x1b[35m"
+	colorChanged = "\x1b[1;30;43m"
+)
+
+// isTerminal reports whether f is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// changedPaths returns the paths of the values in result that differ from
+// the input document, i.e. that were masked, replaced or renamed.
+func changedPaths(input, result interface{}) map[string]bool {
+	changed := make(map[string]bool)
+	for _, entry := range diffJSON(input, result, "$") {
+		if entry.Op != "-" {
+			changed[entry.Path] = true
+		}
+	}
+	return changed
+}
+
+// colorizeJSON pretty-prints a document with syntax highlighting, using the
+// same layout and key order as json.MarshalIndent. Values at changed paths
+// are highlighted as a whole.
+func colorizeJSON(value interface{}, indent string, changed map[string]bool) string {
+	var b strings.Builder
+	writeColorJSON(&b, value, "$", "", indent, changed)
+	return b.String()
+}
+
+func writeColorJSON(b *strings.Builder, value interface{}, path, prefix, indent string, changed map[string]bool) {
+	if changed[path] {
+		b.WriteString(colorChanged)
+		b.WriteString(compactJSON(value))
+		b.WriteString(colorReset)
+		return
+	}
+
+	newline := func(level string) {
+		if indent != "" {
+			b.WriteString("\n" + level)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			b.WriteString("{}")
+			return
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		b.WriteString("{")
+		for i, key := range keys {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			newline(prefix + indent)
+			b.WriteString(colorKey + compactJSON(key) + colorReset + ":")
+			if indent != "" {
+				b.WriteString(" ")
+			}
+			writeColorJSON(b, v[key], joinPath(path, key), prefix+indent, indent, changed)
+		}
+		newline(prefix)
+		b.WriteString("}")
+
+	case []interface{}:
+		if len(v) == 0 {
+			b.WriteString("[]")
+			return
+		}
+		b.WriteString("[")
+		for i, item := range v {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			newline(prefix + indent)
+			writeColorJSON(b, item, indexPath(path, i), prefix+indent, indent, changed)
+		}
+		newline(prefix)
+		b.WriteString("]")
+
+	case string:
+		b.WriteString(colorString + compactJSON(v) + colorReset)
+	case float64:
+		b.WriteString(colorNumber + compactJSON(v) + colorReset)
+	default:
+		b.WriteString(colorLiteral + compactJSON(v) + colorReset)
+	}
+}
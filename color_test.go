@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestColorizeJSON(t *testing.T) {
+	input := map[string]interface{}{
+		"name":  "Alice",
+		"email": "alice@example.com",
+		"tags":  []interface{}{"a", 1.0, true, nil},
+		"empty": map[string]interface{}{},
+	}
+	transforms := &Transformations{MaskVal: parseMaskRules([]string{"email:***"})}
+	result := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1)
+
+	output := colorizeJSON(result, "  ", changedPaths(input, result))
+
+	// Without the escape sequences the layout matches MarshalIndent
+	plain := regexp.MustCompile("\x1b\\[[0-9;]*m").ReplaceAllString(output, "")
+	expected, _ := json.MarshalIndent(result, "", "  ")
+	if plain != string(expected) {
+		t.Errorf("Expected layout:\n%s\ngot:\n%s", expected, plain)
+	}
+
+	if !strings.Contains(output, colorChanged+`"***"`+colorReset) {
+		t.Errorf("Expected the masked value to be highlighted, got %q", output)
+	}
+	if !strings.Contains(output, colorString+`"Alice"`+colorReset) {
+		t.Errorf("Expected unchanged strings to be colored as strings, got %q", output)
+	}
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Config is a ruleset loaded with -config. Options holds flag values, written
+// as {"minkeylen": 4}, which apply unless the flag is given on the command
+// line. Rules holds transformation rules in the same syntax as their flags,
+// e.g. {"maskval": "email:***", "when": "country==\"EU\"", "priority": 10}.
+// Profiles holds named rulesets selected with -profile, which add their
+// options and rules to the shared ones. Stages holds rulesets applied in
+// order to the output of the ones before, after the shared ruleset. Include
+// lists config files layered underneath this one. Vars holds defaults for
+// ${name} references, overridden with -set name=value.
+type Config struct {
+	Include  []string               `json:"include"`
+	Vars     map[string]interface{} `json:"vars"`
+	Options  map[string]interface{} `json:"options"`
+	Rules    []ConfigRule           `json:"rules"`
+	Profiles map[string]Profile     `json:"profiles"`
+	Stages   []Stage                `json:"stages"`
+	// Patterns are named regular expressions, usable wherever a pattern
+	// name is, e.g. in strpattern
+	Patterns map[string]string `json:"patterns"`
+}
+
+// Profile is a named ruleset in the config file.
+type Profile struct {
+	Options map[string]interface{} `json:"options"`
+	Rules   []ConfigRule           `json:"rules"`
+}
+
+// Stage is a ruleset of a multi-stage pipeline, e.g. one normalizing keys
+// ahead of one masking values. Its options and rules are independent of the
+// command line and of the other stages.
+type Stage struct {
+	Name    string                 `json:"name"`
+	Options map[string]interface{} `json:"options"`
+	Rules   []ConfigRule           `json:"rules"`
+}
+
+// ConfigRule is a single transformation rule from the config file.
+type ConfigRule struct {
+	Name  string
+	Value string
+	RuleOptions
+}
+
+func (r *ConfigRule) UnmarshalJSON(data []byte) error {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	for name, value := range fields {
+		str, ok := formatScalar(value)
+		if !ok {
+			return fmt.Errorf("rule field %q must be a string", name)
+		}
+
+		switch name {
+		case "when":
+			r.When = str
+		case "under":
+			r.Under = str
+		case "priority":
+			priority, err := strconv.Atoi(str)
+			if err != nil {
+				return fmt.Errorf("rule field %q must be an integer", name)
+			}
+			r.Priority = priority
+		case "final":
+			final, err := strconv.ParseBool(str)
+			if err != nil {
+				return fmt.Errorf("rule field %q must be a boolean", name)
+			}
+			r.Final = final
+		default:
+			if r.Name != "" {
+				return fmt.Errorf("rule has more than one flag: %s and %s", r.Name, name)
+			}
+			r.Name = name
+			r.Value = str
+		}
+	}
+
+	if r.Name == "" {
+		return fmt.Errorf("rule has no flag")
+	}
+	return nil
+}
+
+// decodeConfig decodes a config file. Unknown keys are errors, like unknown
+// rules and options, so that a misspelt section such as "rule" is reported
+// rather than its rules silently left out.
+func decodeConfig(data []byte, config *Config) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(config); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected content after the config")
+	}
+	return nil
+}
+
+// readConfigFile reads and decodes a single config file, leaving its
+// includes unresolved.
+func readConfigFile(filename string) (*Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading config file: %v", err)
+	}
+
+	var config Config
+	if err := decodeConfig(data, &config); err != nil {
+		return nil, jsonParseError(data, "config file "+filename, err)
+	}
+	names := make(map[string]bool, len(config.Stages))
+	for i, stage := range config.Stages {
+		if stage.Name == "" {
+			return nil, fmt.Errorf("Error in config file %s: stage %d has no name", filename, i+1)
+		}
+		if names[stage.Name] {
+			return nil, fmt.Errorf("Error in config file %s: duplicate stage %q", filename, stage.Name)
+		}
+		names[stage.Name] = true
+	}
+	if err := config.checkVars(); err != nil {
+		return nil, fmt.Errorf("Error in config file %s: %v", filename, err)
+	}
+	if _, err := compilePatterns(config.Patterns); err != nil {
+		return nil, fmt.Errorf("Error in config file %s: %v", filename, err)
+	}
+	return &config, nil
+}
+
+// withProfile returns the config with the named profile applied: its options
+// override the shared ones and its rules follow them. An empty name selects
+// the shared options and rules only.
+func (c *Config) withProfile(name string) (*Config, error) {
+	if name == "" {
+		return c, nil
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(c.Profiles))
+		for name := range c.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("unknown profile %q: the config has no profiles", name)
+		}
+		return nil, fmt.Errorf("unknown profile %q: must be one of %s", name, strings.Join(names, ", "))
+	}
+
+	options := make(map[string]interface{}, len(c.Options)+len(profile.Options))
+	for key, value := range c.Options {
+		options[key] = value
+	}
+	for key, value := range profile.Options {
+		options[key] = value
+	}
+	rules := append(append([]ConfigRule(nil), c.Rules...), profile.Rules...)
+	return &Config{Vars: c.Vars, Options: options, Rules: rules, Stages: c.Stages, Patterns: c.Patterns}, nil
+}
+
+// configVariable matches a ${NAME} reference in a config value.
+var configVariable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolate replaces ${NAME} references in option values and in rule
+// values, when and under clauses, stages included, with the value lookup
+// returns for NAME. An
+// undefined name is an error rather than an empty string, so a missing
+// secret never turns into an empty mask or key.
+func (c *Config) interpolate(lookup func(string) (string, bool)) error {
+	var undefined []string
+	expand := func(str string) string {
+		return configVariable.ReplaceAllStringFunc(str, func(ref string) string {
+			name := configVariable.FindStringSubmatch(ref)[1]
+			value, ok := lookup(name)
+			if !ok {
+				undefined = append(undefined, name)
+			}
+			return value
+		})
+	}
+
+	expandRuleset := func(options map[string]interface{}, rules []ConfigRule) {
+		for name, value := range options {
+			switch v := value.(type) {
+			case string:
+				options[name] = expand(v)
+			case []interface{}:
+				expanded := make([]interface{}, len(v))
+				for i, item := range v {
+					if str, ok := item.(string); ok {
+						item = expand(str)
+					}
+					expanded[i] = item
+				}
+				options[name] = expanded
+			}
+		}
+		for i := range rules {
+			rules[i].Value = expand(rules[i].Value)
+			rules[i].When = expand(rules[i].When)
+			rules[i].Under = expand(rules[i].Under)
+		}
+	}
+
+	expandRuleset(c.Options, c.Rules)
+	for _, stage := range c.Stages {
+		expandRuleset(stage.Options, stage.Rules)
+	}
+
+	if len(undefined) > 0 {
+		return fmt.Errorf("undefined variable %s", strings.Join(undefined, ", "))
+	}
+	return nil
+}
+
+// loadSecrets reads a -secret-file of NAME=value lines. Blank lines and lines
+// starting with # are ignored.
+func loadSecrets(filename string) (map[string]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading secret file: %v", err)
+	}
+
+	secrets := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("Error in secret file %s: line %d is not NAME=value", filename, i+1)
+		}
+		secrets[strings.TrimSpace(name)] = value
+	}
+	return secrets, nil
+}
+
+// secretLookup looks names up in secrets first and then in the environment.
+func secretLookup(secrets map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		if value, ok := secrets[name]; ok {
+			return value, true
+		}
+		return os.LookupEnv(name)
+	}
+}
+
+// applyOptions sets the config options on fs, skipping flags already given on
+// the command line. Array values set a repeatable flag once per element.
+func (c *Config) applyOptions(fs *flag.FlagSet) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	for name, value := range c.Options {
+		if set[name] {
+			continue
+		}
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown option %q", name)
+		}
+
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+		for _, v := range values {
+			str, ok := formatScalar(v)
+			if !ok {
+				return fmt.Errorf("option %q must be a string, number or boolean", name)
+			}
+			if err := fs.Set(name, str); err != nil {
+				return fmt.Errorf("option %q: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// applyRules appends the config rules to transforms in file order, then
+// orders the rules of each kind by priority.
+func (c *Config) applyRules(transforms *Transformations) error {
+	for _, rule := range c.Rules {
+		if err := addRule(transforms, rule); err != nil {
+			return err
+		}
+	}
+	transforms.sortByPriority()
+	return nil
+}
+
+// addRule parses a single config rule with the parser of the matching flag
+// and appends the result, carrying over the rule options.
+func addRule(transforms *Transformations, rule ConfigRule) error {
+	values := []string{rule.Value}
+	added := 0
+
+	switch rule.Name {
+	case "replaceval":
+		for _, r := range parseReplaceRules(values) {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.ReplaceVal = append(transforms.ReplaceVal, r)
+			added++
+		}
+	case "replacekey":
+		for _, r := range parseReplaceRules(values) {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.ReplaceKey = append(transforms.ReplaceKey, r)
+			added++
+		}
+	case "defaultval":
+		for _, r := range parseDefaultRules(values) {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.DefaultVal = append(transforms.DefaultVal, r)
+			added++
+		}
+	case "renamekeydepth":
+		for _, r := range parseRenameDepthRules(values) {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.RenameKeyDepth = append(transforms.RenameKeyDepth, r)
+			added++
+		}
+	case "maskval":
+		for _, r := range parseMaskRules(values) {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.MaskVal = append(transforms.MaskVal, r)
+			added++
+		}
+	case "condreplace":
+		for _, r := range parseCondReplaceRules(values) {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.CondReplace = append(transforms.CondReplace, r)
+			added++
+		}
+	case "trimval", "lowerval", "upperval", "titleval":
+		for _, r := range parseStringOpRules(values, strings.TrimSuffix(rule.Name, "val")) {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.StringOps = append(transforms.StringOps, r)
+			added++
+		}
+	case "splitval":
+		for _, r := range parseDelimiterRules(values) {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.SplitVal = append(transforms.SplitVal, r)
+			added++
+		}
+	case "joinval":
+		for _, r := range parseDelimiterRules(values) {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.JoinVal = append(transforms.JoinVal, r)
+			added++
+		}
+	case "encodeval":
+		for _, r := range parseCodecRules(values) {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.EncodeVal = append(transforms.EncodeVal, r)
+			added++
+		}
+	case "decodeval":
+		for _, r := range parseCodecRules(values) {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.DecodeVal = append(transforms.DecodeVal, r)
+			added++
+		}
+	case "arraywhere":
+		for _, r := range parseArrayWhereRules(values) {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.ArrayWhere = append(transforms.ArrayWhere, r)
+			added++
+		}
+	case "arrayuniqueby":
+		for _, r := range parseFieldRules(values) {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.ArrayUniqueBy = append(transforms.ArrayUniqueBy, r)
+			added++
+		}
+	case "arrayflatten":
+		for _, r := range parseFlattenRules(values) {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.ArrayFlatten = append(transforms.ArrayFlatten, r)
+			added++
+		}
+	case "arraysample":
+		rules, err := parseSampleRules(values)
+		if err != nil {
+			return err
+		}
+		for _, r := range rules {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.ArraySample = append(transforms.ArraySample, r)
+			added++
+		}
+	case "arraytomap":
+		for _, r := range parseFieldRules(values) {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.ArrayToMap = append(transforms.ArrayToMap, r)
+			added++
+		}
+	case "maptoarray":
+		for _, r := range parseFieldRules(values) {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.MapToArray = append(transforms.MapToArray, r)
+			added++
+		}
+	case "execval":
+		for _, r := range parseExecRules(values) {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.ExecVal = append(transforms.ExecVal, r)
+			added++
+		}
+	case "lookup":
+		rules, err := parseLookupRules(values)
+		if err != nil {
+			return err
+		}
+		for _, r := range rules {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.Lookup = append(transforms.Lookup, r)
+			added++
+		}
+	case "httpenrich":
+		rules, err := parseHTTPRules(values)
+		if err != nil {
+			return err
+		}
+		for _, r := range rules {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.HTTPEnrich = append(transforms.HTTPEnrich, r)
+			added++
+		}
+	case "pseudonymize":
+		rules, err := parsePseudonymRules(values)
+		if err != nil {
+			return err
+		}
+		for _, r := range rules {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.Pseudonymize = append(transforms.Pseudonymize, r)
+			added++
+		}
+	case "arrayintersect", "arraysubtract":
+		rules, err := parseSetRules(values)
+		if err != nil {
+			return err
+		}
+		for _, r := range rules {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			if rule.Name == "arrayintersect" {
+				transforms.ArrayIntersect = append(transforms.ArrayIntersect, r)
+			} else {
+				transforms.ArraySubtract = append(transforms.ArraySubtract, r)
+			}
+			added++
+		}
+	case "join":
+		rules, err := parseJoinRules(values)
+		if err != nil {
+			return err
+		}
+		for _, r := range rules {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.Join = append(transforms.Join, r)
+			added++
+		}
+	case "groupby":
+		rules, err := parseGroupRules(values)
+		if err != nil {
+			return err
+		}
+		for _, r := range rules {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.GroupBy = append(transforms.GroupBy, r)
+			added++
+		}
+	case "parsenum":
+		rules, err := parseParseNumRules(values)
+		if err != nil {
+			return err
+		}
+		for _, r := range rules {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.ParseNum = append(transforms.ParseNum, r)
+			added++
+		}
+	case "scalenum":
+		rules, err := parseScaleRules(values)
+		if err != nil {
+			return err
+		}
+		for _, r := range rules {
+			r.RuleOptions = mergeRuleOptions(r.RuleOptions, rule.RuleOptions)
+			transforms.ScaleNum = append(transforms.ScaleNum, r)
+			added++
+		}
+	default:
+		return fmt.Errorf("unknown rule %q", rule.Name)
+	}
+
+	if added == 0 {
+		return fmt.Errorf("invalid %s rule %q", rule.Name, rule.Value)
+	}
+	return nil
+}
+
+// mergeRuleOptions overrides the options parsed from a rule value with those
+// set on the config rule itself.
+func mergeRuleOptions(parsed, config RuleOptions) RuleOptions {
+	if config.When != "" {
+		parsed.When = config.When
+	}
+	if config.Under != "" {
+		parsed.Under = config.Under
+	}
+	if config.Priority != 0 {
+		parsed.Priority = config.Priority
+	}
+	if config.Final {
+		parsed.Final = true
+	}
+	return parsed
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWhenGuard(t *testing.T) {
+	input := []interface{}{
+		map[string]interface{}{"country": "EU", "email": "a@example.com"},
+		map[string]interface{}{"country": "US", "email": "b@example.com"},
+		map[string]interface{}{"email": "c@example.com"},
+	}
+
+	transforms := &Transformations{
+		MaskVal: []MaskRule{
+			{Pattern: "email", Mask: "***", RuleOptions: RuleOptions{When: `country == "EU"`}},
+		},
+	}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}
+
+	result := processJSON(input, filters, transforms, 1).([]interface{})
+
+	expected := []string{"***", "b@example.com", "c@example.com"}
+	for i, email := range expected {
+		record := result[i].(map[string]interface{})
+		if record["email"] != email {
+			t.Errorf("Expected record %d email to be %s, got %v", i, email, record["email"])
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "rules.json")
+	config := `{
+  "options": {"minkeylen": 4, "novaltype": ["null"]},
+  "rules": [
+    {"maskval": "email:***", "when": "country==\"EU\""},
+    {"replacekey": "score:points"}
+  ]
+}`
+	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{"-config", configFile, "-minkeylen", "2"})
+
+	if filters.MinKeyLen != 2 {
+		t.Errorf("Expected command line minkeylen 2 to take precedence, got %d", filters.MinKeyLen)
+	}
+	if len(filters.NoValTypes) != 1 || filters.NoValTypes[0] != "null" {
+		t.Errorf("Expected novaltype null from config, got %v", filters.NoValTypes)
+	}
+	if len(transforms.MaskVal) != 1 || transforms.MaskVal[0].When != `country=="EU"` {
+		t.Errorf("Expected guarded mask rule, got %v", transforms.MaskVal)
+	}
+	if len(transforms.ReplaceKey) != 1 || transforms.ReplaceKey[0].Replacement != "points" {
+		t.Errorf("Expected replacekey rule, got %v", transforms.ReplaceKey)
+	}
+}
+
+func TestConfigUnknownKeys(t *testing.T) {
+	for config, key := range map[string]string{
+		`{"dropkey": ["c"], "rules": []}`:                     "dropkey",
+		`{"rule": [{"maskval": "email:***"}]}`:                "rule",
+		`{"stages": [{"name": "mask", "rule": []}]}`:          "rule",
+		`{"profiles": {"eu": {"option": {"minkeylen": 4}}}}`:  "option",
+		`{"rules": [{"maskval": "email:***"}]} {"rules": []}`: "after the config",
+	} {
+		configFile := filepath.Join(t.TempDir(), "rules.json")
+		if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		if _, err := readConfigFile(configFile); err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("Expected %s to be rejected naming %q, got %v", config, key, err)
+		}
+	}
+}
+
+func TestRulePriority(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "rules.json")
+	config := `{
+  "rules": [
+    {"maskval": "email:config"},
+    {"maskval": "email:urgent", "priority": 10},
+    {"maskval": "email:fallback", "priority": -1}
+  ]
+}`
+	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	_, transforms, _ := parseArgs("test", []string{"-config", configFile, "-maskval", "email:flag"})
+
+	var masks []string
+	for _, rule := range transforms.MaskVal {
+		masks = append(masks, rule.Mask)
+	}
+	expected := []string{"urgent", "flag", "config", "fallback"}
+	if strings.Join(masks, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected mask rules in order %v, got %v", expected, masks)
+	}
+
+	result := processJSON(map[string]interface{}{"email": "a@example.com"}, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1).(map[string]interface{})
+	if result["email"] != "urgent" {
+		t.Errorf("Expected the highest priority rule to apply, got %v", result["email"])
+	}
+}
+
+func TestRulePriorityInvalid(t *testing.T) {
+	var rule ConfigRule
+	if err := rule.UnmarshalJSON([]byte(`{"maskval": "email:***", "priority": "high"}`)); err == nil {
+		t.Error("Expected an error for a non-integer priority")
+	}
+}
+
+func TestFinalRule(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "rules.json")
+	config := `{
+  "options": {"boundstrlen": "0:4"},
+  "rules": [
+    {"maskval": "ssn:XXX-XX-XXXX", "final": true},
+    {"maskval": "pin:********"},
+    {"replacekey": "user:account", "final": true},
+    {"renamekeydepth": "1:top_"}
+  ]
+}`
+	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{"-config", configFile})
+	input := map[string]interface{}{"ssn": "123-45-6789", "pin": "1234", "user": "alice", "name": "Alice"}
+	result := processJSON(input, filters, transforms, 1).(map[string]interface{})
+
+	expected := map[string]interface{}{
+		"top_ssn":  "XXX-XX-XXXX",
+		"top_pin":  "****",
+		"account":  "alic",
+		"top_name": "Alic",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestConfigProfiles(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "rules.json")
+	config := `{
+  "options": {"minkeylen": 2},
+  "rules": [{"maskval": "password:***"}],
+  "profiles": {
+    "dev": {},
+    "partner-export": {
+      "options": {"minkeylen": 3},
+      "rules": [{"maskval": "email:***"}]
+    }
+  }
+}`
+	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{"-config", configFile, "-profile", "partner-export"})
+	if filters.MinKeyLen != 3 {
+		t.Errorf("Expected profile minkeylen 3 to override the shared option, got %d", filters.MinKeyLen)
+	}
+	if len(transforms.MaskVal) != 2 || transforms.MaskVal[0].Pattern != "password" || transforms.MaskVal[1].Pattern != "email" {
+		t.Errorf("Expected shared and profile mask rules, got %v", transforms.MaskVal)
+	}
+
+	filters, transforms, _ = parseArgs("test", []string{"-config", configFile})
+	if filters.MinKeyLen != 2 || len(transforms.MaskVal) != 1 {
+		t.Errorf("Expected only the shared ruleset without -profile, got minkeylen %d and %v", filters.MinKeyLen, transforms.MaskVal)
+	}
+
+	loaded, err := loadConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loaded.withProfile("prod"); err == nil || !strings.Contains(err.Error(), "dev, partner-export") {
+		t.Errorf("Expected an unknown profile error listing the profiles, got %v", err)
+	}
+}
+
+func TestConfigInterpolation(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "rules.json")
+	config := `{
+  "options": {"dropkey": ["${DROP_KEY}"]},
+  "rules": [
+    {"maskval": "email:${EMAIL_MASK}"},
+    {"replaceval": "upper:${REPLACEMENT}"}
+  ]
+}`
+	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	secretFile := filepath.Join(dir, "secrets.env")
+	if err := os.WriteFile(secretFile, []byte("# masks\nEMAIL_MASK=[secret]\nDROP_KEY=from-file\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+	t.Setenv("DROP_KEY", "internal")
+	t.Setenv("REPLACEMENT", "REDACTED")
+
+	filters, transforms, _ := parseArgs("test", []string{"-config", configFile, "-secret-file", secretFile})
+	if len(transforms.MaskVal) != 1 || transforms.MaskVal[0].Mask != "[secret]" {
+		t.Errorf("Expected the mask from the secret file, got %v", transforms.MaskVal)
+	}
+	if len(transforms.ReplaceVal) != 1 || transforms.ReplaceVal[0].Replacement != "REDACTED" {
+		t.Errorf("Expected the replacement from the environment, got %v", transforms.ReplaceVal)
+	}
+	if len(filters.DropKeys) != 1 || filters.DropKeys[0] != "from-file" {
+		t.Errorf("Expected the secret file to take precedence over the environment, got %v", filters.DropKeys)
+	}
+
+	loaded, err := loadConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = loaded.interpolate(func(string) (string, bool) { return "", false })
+	if err == nil || !strings.Contains(err.Error(), "EMAIL_MASK") {
+		t.Errorf("Expected an undefined variable error, got %v", err)
+	}
+}
+
+func TestConfigStages(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "pipeline.json")
+	config := `{
+  "options": {"dropkey": ["debug"]},
+  "stages": [
+    {"name": "normalize", "rules": [{"replacekey": "Email:email"}]},
+    {"name": "mask", "rules": [{"maskval": "email:***"}]},
+    {"name": "project", "options": {"dropkey": ["internal"]}}
+  ]
+}`
+	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{"-config", configFile})
+	if len(transforms.Stages) != 3 || len(transforms.MaskVal) != 0 {
+		t.Fatalf("Expected three stages apart from the shared ruleset, got %d", len(transforms.Stages))
+	}
+	pipeline, err := NewPipeline(filters, transforms)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := map[string]interface{}{"Email": "a@example.com", "internal": 1.0, "debug": true, "id": 1.0}
+	expected := map[string]interface{}{"email": "***", "id": 1.0}
+	if result, _ := pipeline.Process(input, "test"); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected the stages applied in order, got %v", result)
+	}
+
+	// Masking ahead of normalizing misses the renamed key
+	transforms.Stages[0], transforms.Stages[1] = transforms.Stages[1], transforms.Stages[0]
+	if result, _ := pipeline.Process(input, "test"); result.(map[string]interface{})["email"] != "a@example.com" {
+		t.Errorf("Expected stage order to matter, got %v", result)
+	}
+
+	// Parsing the stages keeps the run-wide settings of the command line
+	parseArgs("test", []string{"-config", configFile, "-exectimeout", "1s", "-execlimit", "2", "-httptimeout", "3s"})
+	if execTimeout != time.Second || cap(execSlots) != 2 || httpClient.Timeout != 3*time.Second {
+		t.Errorf("Expected the command line timeouts and limit kept, got %v, %d, %v", execTimeout, cap(execSlots), httpClient.Timeout)
+	}
+	parseArgs("test", nil)
+
+	duplicate := filepath.Join(t.TempDir(), "duplicate.json")
+	if err := os.WriteFile(duplicate, []byte(`{"stages": [{"name": "a"}, {"name": "a"}]}`), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if _, err := loadConfig(duplicate); err == nil || !strings.Contains(err.Error(), `duplicate stage "a"`) {
+		t.Errorf("Expected a duplicate stage error, got %v", err)
+	}
+}
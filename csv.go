@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+)
+
+// encodeCSV writes a document of records as CSV with a header row. The
+// document must be an object or an array of objects. Nested objects are
+// flattened into dotted column names such as address.city, arrays are written
+// as compact JSON and nulls as empty fields.
+func encodeCSV(doc interface{}, delimiter rune, columns []string) ([]byte, error) {
+	records, keys, err := flatRecords(doc, "CSV")
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		columns = keys
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = delimiter
+	w.Write(columns)
+	for _, record := range records {
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = csvField(record[column])
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("Error writing CSV: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeCSV reads CSV with a header row into an array of objects keyed by
+// the header names. Fields are strings unless inferTypes is set, in which case
+// they are read with parseValue and empty fields become null.
+func decodeCSV(data []byte, delimiter rune, inferTypes bool) (interface{}, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = delimiter
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing CSV: %v", err)
+	}
+
+	records := []interface{}{}
+	if len(rows) == 0 {
+		return records, nil
+	}
+	header := rows[0]
+	for _, row := range rows[1:] {
+		record := make(map[string]interface{}, len(header))
+		for i, column := range header {
+			var value interface{} = row[i]
+			if inferTypes {
+				if row[i] == "" {
+					value = nil
+				} else {
+					value = parseValue(row[i])
+				}
+			}
+			record[column] = value
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// flatRecords flattens an object, or each object of an array, for the
+// output format named, returning the records and their keys in order of
+// first appearance, the new keys of each record sorted.
+func flatRecords(doc interface{}, format string) ([]map[string]interface{}, []string, error) {
+	var records []map[string]interface{}
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		records = append(records, flattenRecord(v, "", map[string]interface{}{}))
+	case []interface{}:
+		for i, item := range v {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, nil, fmt.Errorf("%s output requires an array of objects; element %d is %s", format, i, getValueType(item))
+			}
+			records = append(records, flattenRecord(obj, "", map[string]interface{}{}))
+		}
+	default:
+		return nil, nil, fmt.Errorf("%s output requires an object or an array of objects, got %s", format, getValueType(doc))
+	}
+
+	var columns []string
+	seen := make(map[string]bool)
+	for _, record := range records {
+		keys := make([]string, 0, len(record))
+		for key := range record {
+			if !seen[key] {
+				keys = append(keys, key)
+				seen[key] = true
+			}
+		}
+		sort.Strings(keys)
+		columns = append(columns, keys...)
+	}
+	return records, columns, nil
+}
+
+// flattenRecord copies the leaves of obj into flat, joining nested keys with
+// dots.
+func flattenRecord(obj map[string]interface{}, prefix string, flat map[string]interface{}) map[string]interface{} {
+	for key, value := range obj {
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			flattenRecord(nested, prefix+key+".", flat)
+		} else {
+			flat[prefix+key] = value
+		}
+	}
+	return flat
+}
+
+func csvField(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if str, ok := formatScalar(value); ok {
+		return str
+	}
+	return compactJSON(value)
+}
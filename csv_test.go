@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEncodeCSV(t *testing.T) {
+	doc := []interface{}{
+		map[string]interface{}{
+			"name":    "Alice",
+			"age":     30.0,
+			"address": map[string]interface{}{"city": "Paris, FR"},
+			"tags":    []interface{}{"a", "b"},
+		},
+		map[string]interface{}{"name": "Bob", "active": true, "age": nil},
+	}
+
+	output, err := encodeCSV(doc, ',', nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "address.city,age,name,tags,active\n" +
+		"\"Paris, FR\",30,Alice,\"[\"\"a\"\",\"\"b\"\"]\",\n" +
+		",,Bob,,true\n"
+	if string(output) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, output)
+	}
+
+	output, err = encodeCSV(doc, ';', []string{"name", "address.city"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "name;address.city\nAlice;Paris, FR\nBob;\n"
+	if string(output) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, output)
+	}
+
+	if _, err := encodeCSV([]interface{}{1.0, 2.0}, ',', nil); err == nil {
+		t.Error("Expected an error for an array of numbers")
+	}
+}
+
+func TestDecodeCSV(t *testing.T) {
+	data := []byte("name;age;active;note\nAlice;30;true;\"a;b\"\nBob;;false;007\n")
+
+	doc, err := decodeCSV(data, ';', false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{
+		map[string]interface{}{"name": "Alice", "age": "30", "active": "true", "note": "a;b"},
+		map[string]interface{}{"name": "Bob", "age": "", "active": "false", "note": "007"},
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Expected %v, got %v", expected, doc)
+	}
+
+	doc, err = decodeCSV(data, ';', true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []interface{}{
+		map[string]interface{}{"name": "Alice", "age": 30.0, "active": true, "note": "a;b"},
+		map[string]interface{}{"name": "Bob", "age": nil, "active": false, "note": 7.0},
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Expected %v, got %v", expected, doc)
+	}
+
+	if _, err := decodeCSV([]byte("a,b\n1\n"), ',', false); err == nil {
+		t.Error("Expected an error for a short row")
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+// aboveDepthRoot reports whether the value being processed lies outside the
+// -depthroot subtree, on the path to it or beside it. Depths count as 0 there,
+// and depth filters do not apply.
+func (t *Transformations) aboveDepthRoot() bool {
+	return len(t.DepthRoot) > 0 || t.offDepthRoot
+}
+
+// descendDepthRoot returns a copy of the transformations for the member key
+// of an object above the -depthroot subtree. Arrays are passed through, so
+// $.payload is the payload of every record of a top-level array.
+func (t *Transformations) descendDepthRoot(key string) *Transformations {
+	child := *t
+	if !t.offDepthRoot && key == t.DepthRoot[0] {
+		child.DepthRoot = t.DepthRoot[1:]
+	} else {
+		child.DepthRoot, child.offDepthRoot = nil, true
+	}
+	return &child
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDepthRoot(t *testing.T) {
+	input := map[string]interface{}{
+		"version": 1.0,
+		"meta":    map[string]interface{}{"trace": map[string]interface{}{"id": "t1"}},
+		"payload": map[string]interface{}{
+			"user": map[string]interface{}{"name": "Ada", "address": map[string]interface{}{"city": "London"}},
+			"id":   7.0,
+		},
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{"-depthroot", "$.payload", "-maxdepth", "2", "-renamekeydepth", "1:top_"})
+	expected := map[string]interface{}{
+		"version": 1.0,
+		"meta":    map[string]interface{}{"trace": map[string]interface{}{"id": "t1"}},
+		"payload": map[string]interface{}{
+			"top_user": map[string]interface{}{"name": "Ada", "address": map[string]interface{}{}},
+			"top_id":   7.0,
+		},
+	}
+	if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected depths counted from $.payload, got %v", result)
+	}
+
+	records := []interface{}{
+		map[string]interface{}{"payload": map[string]interface{}{"a": map[string]interface{}{"b": 1.0}}},
+	}
+	filters, transforms, _ = parseArgs("test", []string{"-depthroot", "$.payload", "-mindepth", "2"})
+	expectedRecords := []interface{}{
+		map[string]interface{}{"payload": map[string]interface{}{}},
+	}
+	if result := processJSON(records, filters, transforms, 1); !reflect.DeepEqual(result, expectedRecords) {
+		t.Errorf("Expected -depthroot to pass through arrays, got %v", result)
+	}
+}
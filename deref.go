@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// derefDocument replaces the internal references of a document, objects
+// such as {"$ref": "#/components/schemas/User"}, with a copy of the value
+// they point to, so that rules see the data behind them. References inside
+// the copies are resolved in turn, up to maxDepth levels deep. References
+// that are deeper, point back into a value being expanded, or do not
+// resolve are left as they are, as are external ones. Other members beside
+// a $ref are merged into an object it points to, overriding its fields.
+func derefDocument(doc interface{}, maxDepth int) interface{} {
+	expanding := make(map[string]bool)
+	var resolve func(value interface{}, depth int) interface{}
+	resolve = func(value interface{}, depth int) interface{} {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok && strings.HasPrefix(ref, "#") {
+				if depth >= maxDepth || expanding[ref] {
+					return v
+				}
+				target, ok := resolveReference(doc, ref)
+				if !ok {
+					return v
+				}
+				expanding[ref] = true
+				target = resolve(target, depth+1)
+				delete(expanding, ref)
+				if len(v) == 1 {
+					return target
+				}
+				fields, ok := target.(map[string]interface{})
+				if !ok {
+					return v
+				}
+				merged := make(map[string]interface{}, len(fields)+len(v))
+				for key, item := range fields {
+					merged[key] = item
+				}
+				for key, item := range v {
+					if key != "$ref" {
+						merged[key] = resolve(item, depth)
+					}
+				}
+				return merged
+			}
+			result := make(map[string]interface{}, len(v))
+			for key, item := range v {
+				result[key] = resolve(item, depth)
+			}
+			return result
+		case []interface{}:
+			result := make([]interface{}, len(v))
+			for i, item := range v {
+				result[i] = resolve(item, depth)
+			}
+			return result
+		}
+		return value
+	}
+	return resolve(doc, 0)
+}
+
+// resolveReference returns the value an internal reference, a URI fragment
+// holding a JSON Pointer such as #/definitions/Pet, addresses in doc.
+func resolveReference(doc interface{}, ref string) (interface{}, bool) {
+	fragment, err := url.PathUnescape(strings.TrimPrefix(ref, "#"))
+	if err != nil {
+		return nil, false
+	}
+	if fragment == "" {
+		return doc, true
+	}
+	pointer, err := parsePointer(fragment)
+	if err != nil {
+		return nil, false
+	}
+	for _, token := range pointer {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			item, exists := v[token]
+			if !exists {
+				return nil, false
+			}
+			doc = item
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			doc = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDeref(t *testing.T) {
+	parse := func(str string) interface{} {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(str), &doc); err != nil {
+			t.Fatal(err)
+		}
+		return doc
+	}
+	input := parse(`{
+		"paths": {"/users": {"schema": {"$ref": "#/definitions/User"}}},
+		"definitions": {
+			"User": {"properties": {"ssn": {"example": "123-45-6789"}, "friend": {"$ref": "#/definitions/User"}}},
+			"Note": {"$ref": "#/definitions/User", "title": "note"},
+			"Remote": {"$ref": "other.json#/User"}
+		}
+	}`)
+
+	filters, transforms, _ := parseArgs("test", []string{"-deref", "5", "-maskval", "example:***"})
+	result := processDocument(input, "", filters, transforms).(map[string]interface{})
+	user := map[string]interface{}{"properties": map[string]interface{}{
+		"ssn":    map[string]interface{}{"example": "***"},
+		"friend": map[string]interface{}{"$ref": "#/definitions/User"},
+	}}
+	schema := result["paths"].(map[string]interface{})["/users"].(map[string]interface{})["schema"]
+	if !reflect.DeepEqual(schema, user) {
+		t.Errorf("Expected the reference expanded and masked, stopping at the cycle, got %v", schema)
+	}
+	definitions := result["definitions"].(map[string]interface{})
+	if note := definitions["Note"].(map[string]interface{}); note["title"] != "note" || note["properties"] == nil {
+		t.Errorf("Expected the sibling merged into the expanded reference, got %v", note)
+	}
+	if !reflect.DeepEqual(definitions["Remote"], map[string]interface{}{"$ref": "other.json#/User"}) {
+		t.Errorf("Expected the external reference kept, got %v", definitions["Remote"])
+	}
+
+	nested := parse(`{"a": {"$ref": "#/b"}, "b": {"c": {"$ref": "#/d"}}, "d": 1}`)
+	expected := map[string]interface{}{
+		"a": map[string]interface{}{"c": map[string]interface{}{"$ref": "#/d"}},
+		"b": map[string]interface{}{"c": 1.0},
+		"d": 1.0,
+	}
+	if result := derefDocument(nested, 1); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected one level of references expanded, got %v", result)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// DiffEntry describes a single difference between two documents.
+type DiffEntry struct {
+	Op   string // "+" added, "-" removed, "~" changed
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+// runDiff implements the diff subcommand. Both documents are processed with
+// the same filters and transformations before being compared. The exit code
+// follows diff(1): 0 when equal, 1 when different, 2 on error.
+func runDiff(arguments []string) {
+	filters, transforms, args := parseArgs("diff", arguments)
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s diff [options] a.json b.json\n", os.Args[0])
+		os.Exit(2)
+	}
+	pipeline, err := NewPipeline(filters, transforms)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	var docs [2]interface{}
+	for i, filename := range args {
+		data, err := readJSON(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		if docs[i], err = pipeline.Process(data, filename); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	entries := diffJSON(docs[0], docs[1], "$")
+	for _, entry := range entries {
+		fmt.Println(formatDiffEntry(entry))
+	}
+	if len(entries) > 0 {
+		os.Exit(1)
+	}
+}
+
+// diffJSON compares two decoded documents and returns their differences in
+// path order. Arrays are compared element by element.
+func diffJSON(a, b interface{}, path string) []DiffEntry {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := make([]string, 0, len(av)+len(bv))
+		for key := range av {
+			keys = append(keys, key)
+		}
+		for key := range bv {
+			if _, exists := av[key]; !exists {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		var entries []DiffEntry
+		for _, key := range keys {
+			childPath := joinPath(path, key)
+			aChild, inA := av[key]
+			bChild, inB := bv[key]
+			switch {
+			case !inB:
+				entries = append(entries, DiffEntry{Op: "-", Path: childPath, Old: aChild})
+			case !inA:
+				entries = append(entries, DiffEntry{Op: "+", Path: childPath, New: bChild})
+			default:
+				entries = append(entries, diffJSON(aChild, bChild, childPath)...)
+			}
+		}
+		return entries
+
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+
+		var entries []DiffEntry
+		for i := 0; i < len(av) || i < len(bv); i++ {
+			childPath := indexPath(path, i)
+			switch {
+			case i >= len(bv):
+				entries = append(entries, DiffEntry{Op: "-", Path: childPath, Old: av[i]})
+			case i >= len(av):
+				entries = append(entries, DiffEntry{Op: "+", Path: childPath, New: bv[i]})
+			default:
+				entries = append(entries, diffJSON(av[i], bv[i], childPath)...)
+			}
+		}
+		return entries
+
+	default:
+		if getValueType(a) == getValueType(b) && a == b {
+			return nil
+		}
+	}
+
+	return []DiffEntry{{Op: "~", Path: path, Old: a, New: b}}
+}
+
+func formatDiffEntry(entry DiffEntry) string {
+	switch entry.Op {
+	case "-":
+		return fmt.Sprintf("- %s: %s", entry.Path, compactJSON(entry.Old))
+	case "+":
+		return fmt.Sprintf("+ %s: %s", entry.Path, compactJSON(entry.New))
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", entry.Path, compactJSON(entry.Old), compactJSON(entry.New))
+	}
+}
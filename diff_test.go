@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDiffJSON(t *testing.T) {
+	a := createTestInput()
+	b := createTestInput()
+	b["age"] = 31.0
+	delete(b, "zero")
+	b["arr"] = []interface{}{1.0, 2.0, 3.0, 4.0}
+	b["meta"].(map[string]interface{})["profile"].(map[string]interface{})["bio"] = "Lead DEV!"
+	b["new key"] = true
+
+	entries := diffJSON(a, b, "$")
+
+	expected := []DiffEntry{
+		{Op: "~", Path: "$.age", Old: 30.0, New: 31.0},
+		{Op: "+", Path: "$.arr[3]", New: 4.0},
+		{Op: "~", Path: "$.meta.profile.bio", Old: "Senior DEV!", New: "Lead DEV!"},
+		{Op: "+", Path: `$["new key"]`, New: true},
+		{Op: "-", Path: "$.zero", Old: 0.0},
+	}
+
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d differences, got %d: %v", len(expected), len(entries), entries)
+	}
+	for i, entry := range entries {
+		if entry != expected[i] {
+			t.Errorf("Expected entry %d to be %v, got %v", i, expected[i], entry)
+		}
+	}
+}
+
+func TestDiffJSONWithRules(t *testing.T) {
+	a := createTestInput()
+	b := createTestInput()
+	b["email"] = "BOB@EXAMPLE.COM"
+
+	transforms := &Transformations{
+		MaskVal: []MaskRule{
+			{Pattern: "email", Mask: "***MASKED***"},
+		},
+	}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}
+
+	entries := diffJSON(processJSON(a, filters, transforms, 1), processJSON(b, filters, transforms, 1), "$")
+	if len(entries) != 0 {
+		t.Errorf("Expected masked documents to be equal, got %v", entries)
+	}
+}
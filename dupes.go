@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// detectDupes is the -detect-dupes mode, "warn" or "error"; duplicate keys
+// go unnoticed when it is empty.
+var detectDupes string
+
+// setDetectDupes sets detectDupes from the -detect-dupes flag.
+func setDetectDupes(mode string) error {
+	if mode != "warn" && mode != "error" {
+		return fmt.Errorf("must be warn or error")
+	}
+	detectDupes = mode
+	return nil
+}
+
+// checkDuplicateKeys reports the duplicate keys of a JSON document as
+// -detect-dupes says: as warnings on stderr, or as an error.
+func checkDuplicateKeys(data []byte, filename string) error {
+	if detectDupes == "" {
+		return nil
+	}
+	paths, err := duplicateKeys(data)
+	if err != nil || len(paths) == 0 {
+		return err
+	}
+	if detectDupes == "error" {
+		return fmt.Errorf("Duplicate keys in %s: %v", filename, paths)
+	}
+	for _, path := range paths {
+		fmt.Fprintf(os.Stderr, "Warning: duplicate key %s in %s\n", path, filename)
+	}
+	return nil
+}
+
+// duplicateKeys scans a JSON document token by token and returns the path of
+// every key repeated within the same object, which decoding would otherwise
+// collapse into the last value.
+func duplicateKeys(data []byte) ([]string, error) {
+	type frame struct {
+		path string
+		// keys holds the keys seen so far; it is nil for arrays
+		keys    map[string]bool
+		key     string
+		wantKey bool
+		index   int
+	}
+	var stack []*frame
+	var paths []string
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return paths, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		path := "$"
+		var top *frame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+			if top.keys == nil {
+				path = indexPath(top.path, top.index)
+			} else {
+				path = joinPath(top.path, top.key)
+			}
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			stack = append(stack, &frame{path: path, keys: map[string]bool{}, wantKey: true})
+			continue
+		case json.Delim('['):
+			stack = append(stack, &frame{path: path})
+			continue
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				continue
+			}
+			top = stack[len(stack)-1]
+		default:
+			if top != nil && top.wantKey {
+				key := tok.(string)
+				if top.keys[key] {
+					paths = append(paths, joinPath(top.path, key))
+				}
+				top.keys[key] = true
+				top.key, top.wantKey = key, false
+				continue
+			}
+		}
+
+		// A complete value has been read
+		if top != nil {
+			if top.keys == nil {
+				top.index++
+			} else {
+				top.wantKey = true
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDuplicateKeys(t *testing.T) {
+	input := `{
+		"user": {"name": "a", "ssn": "123", "name": "b"},
+		"list": [{"id": 1, "id": 2}, {"id": 3}, [{"x": 1, "x": 2}]],
+		"my key": 1,
+		"my key": {"ok": true},
+		"ssn": "456"
+	}`
+	paths, err := duplicateKeys([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{`$.user.name`, `$.list[0].id`, `$.list[2][0].x`, `$["my key"]`}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected %v, got %v", expected, paths)
+	}
+
+	if paths, err := duplicateKeys([]byte(`[{"a": {"a": 1}}, {"a": 2}]`)); err != nil || len(paths) != 0 {
+		t.Errorf("Expected no duplicates, got %v (%v)", paths, err)
+	}
+}
+
+func TestDetectDupes(t *testing.T) {
+	defer func() { detectDupes = "" }()
+	filename := filepath.Join(t.TempDir(), "in.json")
+	if err := os.WriteFile(filename, []byte(`{"a": 1, "a": 2}`), 0644); err != nil {
+		t.Fatalf("Failed to write input: %v", err)
+	}
+
+	if _, err := readJSON(filename); err != nil {
+		t.Errorf("Expected duplicates to be ignored by default, got %v", err)
+	}
+	if err := setDetectDupes("error"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readJSON(filename); err == nil {
+		t.Error("Expected an error with -detect-dupes error")
+	}
+	if err := setDetectDupes("fail"); err == nil {
+		t.Error("Expected an error for an invalid mode")
+	}
+}
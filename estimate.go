@@ -0,0 +1,479 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Estimate is the extrapolated cost of running the pipeline over a corpus.
+type Estimate struct {
+	Files        int
+	Bytes        int64
+	SampledFiles int
+	SampledBytes int64
+	Duration     time.Duration
+	PeakMemory   int64
+	OutputBytes  int64
+	RuleShares   []RuleShare
+}
+
+// RuleShare is the fraction of processing time attributed to a rule group.
+type RuleShare struct {
+	Rule  string
+	Share float64
+}
+
+// ruleGroup is a set of related rules that can be removed from a pipeline to
+// measure how much of the processing time they account for.
+type ruleGroup struct {
+	name   string
+	active func(f *Filters, t *Transformations) bool
+	remove func(f *Filters, t *Transformations)
+}
+
+var costGroups = []ruleGroup{
+	{"keepif",
+		func(f *Filters, t *Transformations) bool { return f.KeepIf != nil },
+		func(f *Filters, t *Transformations) { f.KeepIf = nil }},
+	{"dropkey",
+		func(f *Filters, t *Transformations) bool { return len(f.DropKeys) > 0 },
+		func(f *Filters, t *Transformations) { f.DropKeys = nil }},
+	{"haskey",
+		func(f *Filters, t *Transformations) bool { return f.hasKeyFilters() },
+		func(f *Filters, t *Transformations) { f.HasKeys, f.NotHasKeys = nil, nil }},
+	{"where",
+		func(f *Filters, t *Transformations) bool { return len(f.Where) > 0 },
+		func(f *Filters, t *Transformations) { f.Where = nil }},
+	{"strpattern",
+		func(f *Filters, t *Transformations) bool { return len(f.StrPattern)+len(f.NoStrPattern) > 0 },
+		func(f *Filters, t *Transformations) { f.StrPattern, f.NoStrPattern = nil, nil }},
+	{"novaltype",
+		func(f *Filters, t *Transformations) bool { return len(f.NoValTypes) > 0 },
+		func(f *Filters, t *Transformations) { f.NoValTypes = nil }},
+	{"minnum/maxnum/boolval/minstrlen/maxstrlen",
+		func(f *Filters, t *Transformations) bool {
+			return f.MinNum != nil || f.MaxNum != nil || f.BoolVal != nil || f.MinStrLen > 0 || f.MaxStrLen < 999999
+		},
+		func(f *Filters, t *Transformations) {
+			f.MinNum, f.MaxNum, f.BoolVal, f.MinStrLen, f.MaxStrLen = nil, nil, nil, 0, 999999
+		}},
+	{"replaceval",
+		func(f *Filters, t *Transformations) bool { return len(t.ReplaceVal) > 0 },
+		func(f *Filters, t *Transformations) { t.ReplaceVal = nil }},
+	{"replacekey",
+		func(f *Filters, t *Transformations) bool { return len(t.ReplaceKey) > 0 },
+		func(f *Filters, t *Transformations) { t.ReplaceKey = nil }},
+	{"boundnum",
+		func(f *Filters, t *Transformations) bool { return t.BoundNum != nil },
+		func(f *Filters, t *Transformations) { t.BoundNum = nil }},
+	{"boundstrlen",
+		func(f *Filters, t *Transformations) bool { return t.BoundStrLen != nil },
+		func(f *Filters, t *Transformations) { t.BoundStrLen = nil }},
+	{"defaultval",
+		func(f *Filters, t *Transformations) bool { return len(t.DefaultVal) > 0 },
+		func(f *Filters, t *Transformations) { t.DefaultVal = nil }},
+	{"arrayfilter",
+		func(f *Filters, t *Transformations) bool { return len(t.ArrayFilter) > 0 },
+		func(f *Filters, t *Transformations) { t.ArrayFilter = nil }},
+	{"arraywhere",
+		func(f *Filters, t *Transformations) bool { return len(t.ArrayWhere) > 0 },
+		func(f *Filters, t *Transformations) { t.ArrayWhere = nil }},
+	{"arrayuniqueby",
+		func(f *Filters, t *Transformations) bool { return len(t.ArrayUniqueBy) > 0 },
+		func(f *Filters, t *Transformations) { t.ArrayUniqueBy = nil }},
+	{"arrayflatten",
+		func(f *Filters, t *Transformations) bool { return len(t.ArrayFlatten) > 0 },
+		func(f *Filters, t *Transformations) { t.ArrayFlatten = nil }},
+	{"arraysample",
+		func(f *Filters, t *Transformations) bool { return len(t.ArraySample) > 0 },
+		func(f *Filters, t *Transformations) { t.ArraySample = nil }},
+	{"arraytomap/maptoarray",
+		func(f *Filters, t *Transformations) bool { return len(t.ArrayToMap)+len(t.MapToArray) > 0 },
+		func(f *Filters, t *Transformations) { t.ArrayToMap, t.MapToArray = nil, nil }},
+	{"pseudonymize",
+		func(f *Filters, t *Transformations) bool { return len(t.Pseudonymize) > 0 },
+		func(f *Filters, t *Transformations) { t.Pseudonymize = nil }},
+	{"arrayintersect/arraysubtract",
+		func(f *Filters, t *Transformations) bool { return len(t.ArrayIntersect)+len(t.ArraySubtract) > 0 },
+		func(f *Filters, t *Transformations) { t.ArrayIntersect, t.ArraySubtract = nil, nil }},
+	{"join",
+		func(f *Filters, t *Transformations) bool { return len(t.Join) > 0 },
+		func(f *Filters, t *Transformations) { t.Join = nil }},
+	{"groupby",
+		func(f *Filters, t *Transformations) bool { return len(t.GroupBy) > 0 },
+		func(f *Filters, t *Transformations) { t.GroupBy = nil }},
+	{"renamekeydepth",
+		func(f *Filters, t *Transformations) bool { return len(t.RenameKeyDepth) > 0 },
+		func(f *Filters, t *Transformations) { t.RenameKeyDepth = nil }},
+	{"nulls/emptystrings/nonfinite",
+		func(f *Filters, t *Transformations) bool {
+			return t.Nulls != nil || t.EmptyStrings != nil || t.NonFinite != ""
+		},
+		func(f *Filters, t *Transformations) { t.Nulls, t.EmptyStrings, t.NonFinite = nil, nil, "" }},
+	{"truncate-depth",
+		func(f *Filters, t *Transformations) bool { return t.Truncate != nil },
+		func(f *Filters, t *Transformations) { t.Truncate = nil }},
+	{"stringops",
+		func(f *Filters, t *Transformations) bool { return t.Trim || len(t.StringOps) > 0 },
+		func(f *Filters, t *Transformations) { t.Trim, t.StringOps = false, nil }},
+	{"normalize",
+		func(f *Filters, t *Transformations) bool { return t.Normalize != "" },
+		func(f *Filters, t *Transformations) { t.Normalize, t.NormalizeKeys = "", false }},
+	{"splitval/joinval",
+		func(f *Filters, t *Transformations) bool { return len(t.SplitVal)+len(t.JoinVal) > 0 },
+		func(f *Filters, t *Transformations) { t.SplitVal, t.JoinVal = nil, nil }},
+	{"lookup",
+		func(f *Filters, t *Transformations) bool { return len(t.Lookup) > 0 },
+		func(f *Filters, t *Transformations) { t.Lookup = nil }},
+	{"parsenum",
+		func(f *Filters, t *Transformations) bool { return len(t.ParseNum) > 0 },
+		func(f *Filters, t *Transformations) { t.ParseNum = nil }},
+	{"scalenum",
+		func(f *Filters, t *Transformations) bool { return len(t.ScaleNum) > 0 },
+		func(f *Filters, t *Transformations) { t.ScaleNum = nil }},
+	{"tfsensitive",
+		func(f *Filters, t *Transformations) bool { return t.TFSensitive != "" },
+		func(f *Filters, t *Transformations) { t.TFSensitive = "" }},
+	{"deref",
+		func(f *Filters, t *Transformations) bool { return t.Deref > 0 },
+		func(f *Filters, t *Transformations) { t.Deref = 0 }},
+	{"aggregate",
+		func(f *Filters, t *Transformations) bool { return len(t.Aggregates) > 0 },
+		func(f *Filters, t *Transformations) { t.Aggregates = nil }},
+	{"addfield",
+		func(f *Filters, t *Transformations) bool { return len(t.AddFields) > 0 },
+		func(f *Filters, t *Transformations) { t.AddFields = nil }},
+	{"lineage",
+		func(f *Filters, t *Transformations) bool { return t.Lineage != nil },
+		func(f *Filters, t *Transformations) { t.Lineage = nil }},
+	{"stamp",
+		func(f *Filters, t *Transformations) bool { return t.Stamp != nil },
+		func(f *Filters, t *Transformations) { t.Stamp = nil }},
+	{"plugin",
+		func(f *Filters, t *Transformations) bool { return len(t.Plugins) > 0 },
+		func(f *Filters, t *Transformations) { t.Plugins = nil }},
+	{"script",
+		func(f *Filters, t *Transformations) bool { return t.Script != nil },
+		func(f *Filters, t *Transformations) { t.Script = nil }},
+	{"encodeval/decodeval",
+		func(f *Filters, t *Transformations) bool { return len(t.EncodeVal)+len(t.DecodeVal) > 0 },
+		func(f *Filters, t *Transformations) { t.EncodeVal, t.DecodeVal = nil, nil }},
+	{"extjson",
+		func(f *Filters, t *Transformations) bool { return t.ExtJSON != "" },
+		func(f *Filters, t *Transformations) { t.ExtJSON = "" }},
+	{"maskval",
+		func(f *Filters, t *Transformations) bool { return len(t.MaskVal) > 0 },
+		func(f *Filters, t *Transformations) { t.MaskVal = nil }},
+	{"condreplace",
+		func(f *Filters, t *Transformations) bool { return len(t.CondReplace) > 0 },
+		func(f *Filters, t *Transformations) { t.CondReplace = nil }},
+	{"pointer",
+		func(f *Filters, t *Transformations) bool { return len(t.Pointers) > 0 },
+		func(f *Filters, t *Transformations) { t.Pointers = nil }},
+	{"stages",
+		func(f *Filters, t *Transformations) bool { return len(t.Stages) > 0 },
+		func(f *Filters, t *Transformations) { t.Stages = nil }},
+}
+
+// sideEffectGroups are the rule groups that reach outside the process,
+// running commands or making requests. Estimating leaves them out rather than
+// repeat their effects on every run over the sample.
+var sideEffectGroups = []ruleGroup{
+	{"execval",
+		func(f *Filters, t *Transformations) bool { return len(t.ExecVal) > 0 },
+		func(f *Filters, t *Transformations) { t.ExecVal = nil }},
+	{"httpenrich",
+		func(f *Filters, t *Transformations) bool { return len(t.HTTPEnrich) > 0 },
+		func(f *Filters, t *Transformations) { t.HTTPEnrich = nil }},
+}
+
+// withoutSideEffects removes the rules with side effects from transforms and
+// its stages, and returns the names of the groups it removed.
+func withoutSideEffects(filters *Filters, transforms *Transformations) []string {
+	var skipped []string
+	for _, group := range sideEffectGroups {
+		if group.active(filters, transforms) {
+			group.remove(filters, transforms)
+			skipped = append(skipped, group.name)
+		}
+	}
+
+	stages := make([]*Pipeline, len(transforms.Stages))
+	for i, stage := range transforms.Stages {
+		stages[i] = stage
+		stageFilters, stageTransforms := *stage.Filters, *stage.Transforms
+		names := withoutSideEffects(&stageFilters, &stageTransforms)
+		if len(names) == 0 {
+			continue
+		}
+		if pipeline, err := NewPipeline(&stageFilters, &stageTransforms); err == nil {
+			stages[i] = pipeline
+		}
+		for _, name := range names {
+			if !containsString(skipped, name) {
+				skipped = append(skipped, name)
+			}
+		}
+	}
+	transforms.Stages = stages
+	return skipped
+}
+
+// dominantShare is the fraction of processing time above which a rule group
+// is reported as dominating the cost.
+const dominantShare = 0.25
+
+// runEstimate implements the estimate subcommand.
+func runEstimate(arguments []string) {
+	var sampleSize int
+	var format FormatOptions
+	registerFormat, validateFormat := registerFormatFlags(&format)
+	filters, transforms, args := parseArgs("estimate", arguments, registerFormat, func(fs *flag.FlagSet) {
+		fs.IntVar(&sampleSize, "samplesize", 20, "Number of files to sample from the corpus")
+	})
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s estimate [options] dir\n", os.Args[0])
+		os.Exit(1)
+	}
+	if err := validateFormat(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	skipped := withoutSideEffects(filters, transforms)
+	pipeline, err := NewPipeline(filters, transforms)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	estimate, err := estimateCorpus(args[0], pipeline, &format, sampleSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Corpus:                %d files, %s\n", estimate.Files, formatBytes(estimate.Bytes))
+	fmt.Printf("Sampled:               %d files, %s\n", estimate.SampledFiles, formatBytes(estimate.SampledBytes))
+	precision := time.Millisecond
+	if estimate.Duration < time.Second {
+		precision = time.Microsecond
+	}
+	fmt.Printf("Estimated time:        %s\n", estimate.Duration.Round(precision))
+	fmt.Printf("Estimated peak memory: %s\n", formatBytes(estimate.PeakMemory))
+	fmt.Printf("Estimated output size: %s\n", formatBytes(estimate.OutputBytes))
+	for _, share := range estimate.RuleShares {
+		if share.Share >= dominantShare {
+			fmt.Printf("Warning: %s accounts for ~%.0f%% of processing time\n", share.Rule, share.Share*100)
+		}
+	}
+	if len(skipped) > 0 {
+		fmt.Printf("Warning: rules with side effects not run, so not estimated: %s\n", strings.Join(skipped, ", "))
+	}
+}
+
+// estimateCorpus samples up to sampleSize files of the input format under
+// dir, runs the pipeline on them and extrapolates to the whole corpus. Time
+// and output size scale with input bytes; peak memory scales with the largest
+// file, since files are processed one at a time.
+func estimateCorpus(dir string, pipeline *Pipeline, format *FormatOptions, sampleSize int) (*Estimate, error) {
+	files, sizes, err := corpusFiles(dir, formatExtensions[format.InFormat])
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No %s files found in %s", format.InFormat, dir)
+	}
+
+	estimate := &Estimate{Files: len(files)}
+	var largest int64
+	for _, size := range sizes {
+		estimate.Bytes += size
+		if size > largest {
+			largest = size
+		}
+	}
+
+	var docs []interface{}
+	var sources []string
+	var elapsed time.Duration
+	var outputBytes int64
+	var memoryRatio float64
+	for _, i := range sampleIndexes(len(files), sampleSize) {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		start := time.Now()
+		data, err := readInput(files[i], format, &Limits{})
+		if err != nil {
+			return nil, err
+		}
+		result, err := processSample(pipeline, data, files[i], format)
+		if err != nil {
+			return nil, err
+		}
+		output, err := encodeOutput(result, format)
+		if err != nil {
+			return nil, err
+		}
+		elapsed += time.Since(start)
+
+		runtime.ReadMemStats(&after)
+		if sizes[i] > 0 && after.HeapAlloc > before.HeapAlloc {
+			ratio := float64(after.HeapAlloc-before.HeapAlloc) / float64(sizes[i])
+			if ratio > memoryRatio {
+				memoryRatio = ratio
+			}
+		}
+
+		docs = append(docs, data)
+		sources = append(sources, files[i])
+		outputBytes += int64(len(output))
+		estimate.SampledFiles++
+		estimate.SampledBytes += sizes[i]
+	}
+
+	if estimate.SampledBytes > 0 {
+		scale := float64(estimate.Bytes) / float64(estimate.SampledBytes)
+		estimate.Duration = time.Duration(float64(elapsed) * scale)
+		estimate.OutputBytes = int64(float64(outputBytes) * scale)
+	}
+	estimate.PeakMemory = int64(memoryRatio * float64(largest))
+	estimate.RuleShares = ruleShares(docs, sources, pipeline)
+	return estimate, nil
+}
+
+// processSample runs the pipeline and the -query over a sampled document,
+// each document of a YAML stream on its own.
+func processSample(pipeline *Pipeline, data interface{}, source string, format *FormatOptions) (interface{}, error) {
+	docs, ok := data.(yamlStream)
+	if !ok {
+		processed, err := pipeline.Process(data, source)
+		if err != nil {
+			return nil, err
+		}
+		return applyQuery(processed, format)
+	}
+	result := make(yamlStream, len(docs))
+	for i, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		processed, err := pipeline.Process(doc, source)
+		if err == nil {
+			processed, err = applyQuery(processed, format)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %v", i+1, err)
+		}
+		result[i] = processed
+	}
+	return result, nil
+}
+
+// ruleShares attributes processing time to rule groups by timing the sample
+// with each active group removed in turn, which takes a pipeline prepared
+// without the group and a few runs over the decoded sample per group.
+func ruleShares(docs []interface{}, sources []string, pipeline *Pipeline) []RuleShare {
+	measure := func(p *Pipeline) time.Duration {
+		// Take the fastest of a few runs to reduce noise
+		var best time.Duration
+		for run := 0; run < 3; run++ {
+			start := time.Now()
+			for i, doc := range docs {
+				processSample(p, doc, sources[i], &FormatOptions{})
+			}
+			if d := time.Since(start); run == 0 || d < best {
+				best = d
+			}
+		}
+		return best
+	}
+
+	total := measure(pipeline)
+	if total <= 0 {
+		return nil
+	}
+
+	var shares []RuleShare
+	for _, group := range costGroups {
+		if !group.active(pipeline.Filters, pipeline.Transforms) {
+			continue
+		}
+		f, t := *pipeline.Filters, *pipeline.Transforms
+		group.remove(&f, &t)
+		without, err := NewPipeline(&f, &t)
+		if err != nil {
+			continue
+		}
+		saved := total - measure(without)
+		if saved < 0 {
+			saved = 0
+		}
+		shares = append(shares, RuleShare{Rule: group.name, Share: float64(saved) / float64(total)})
+	}
+
+	sort.SliceStable(shares, func(i, j int) bool {
+		return shares[i].Share > shares[j].Share
+	})
+	return shares
+}
+
+// corpusFiles lists the files under dir with one of the extensions in lexical
+// order with their sizes.
+func corpusFiles(dir string, extensions []string) ([]string, []int64, error) {
+	var files []string
+	var sizes []int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !containsString(extensions, strings.ToLower(filepath.Ext(path))) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, path)
+		sizes = append(sizes, info.Size())
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error reading corpus: %v", err)
+	}
+	return files, sizes, nil
+}
+
+// sampleIndexes picks up to n indexes spread evenly over [0, total) so the
+// sample is deterministic and covers the whole corpus.
+func sampleIndexes(total, n int) []int {
+	if n <= 0 || n > total {
+		n = total
+	}
+	indexes := make([]int, n)
+	for i := range indexes {
+		indexes[i] = i * total / n
+	}
+	return indexes
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
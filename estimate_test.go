@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEstimateCorpus(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 5; i++ {
+		if err := writeJSONFile(filepath.Join(dir, fmt.Sprintf("doc_%d.json", i)), createTestInput()); err != nil {
+			t.Fatalf("Failed to write corpus file: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not json"), 0644); err != nil {
+		t.Fatalf("Failed to write corpus file: %v", err)
+	}
+
+	transforms := &Transformations{
+		MaskVal: []MaskRule{
+			{Pattern: "email", Mask: "***MASKED***"},
+		},
+	}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}
+
+	pipeline, err := NewPipeline(filters, transforms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	format := &FormatOptions{InFormat: "json", OutFormat: "json", Indent: "  "}
+	estimate, err := estimateCorpus(dir, pipeline, format, 2)
+	if err != nil {
+		t.Fatalf("Failed to estimate corpus: %v", err)
+	}
+
+	if estimate.Files != 5 {
+		t.Errorf("Expected 5 JSON files, got %d", estimate.Files)
+	}
+	if estimate.SampledFiles != 2 {
+		t.Errorf("Expected 2 sampled files, got %d", estimate.SampledFiles)
+	}
+	if estimate.OutputBytes <= 0 {
+		t.Errorf("Expected a positive output size estimate, got %d", estimate.OutputBytes)
+	}
+	if len(estimate.RuleShares) != 1 || estimate.RuleShares[0].Rule != "maskval" {
+		t.Errorf("Expected a share for maskval only, got %v", estimate.RuleShares)
+	}
+}
+
+func TestCostGroups(t *testing.T) {
+	for _, test := range []struct {
+		args  []string
+		group string
+	}{
+		{[]string{"-normalize", "nfc", "-normalizekeys"}, "normalize"},
+		{[]string{"-extjson", "plain"}, "extjson"},
+		{[]string{"-novaltype", "number"}, "novaltype"},
+		{[]string{"-minnum", "1"}, "minnum/maxnum/boolval/minstrlen/maxstrlen"},
+		{[]string{"-boolval", "true"}, "minnum/maxnum/boolval/minstrlen/maxstrlen"},
+		{[]string{"-maxstrlen", "10"}, "minnum/maxnum/boolval/minstrlen/maxstrlen"},
+		{[]string{"-lineage"}, "lineage"},
+		{[]string{"-stamp"}, "stamp"},
+	} {
+		filters, transforms, _ := parseArgs("test", test.args)
+		var active []string
+		for _, group := range costGroups {
+			if group.active(filters, transforms) {
+				active = append(active, group.name)
+				group.remove(filters, transforms)
+				if group.active(filters, transforms) {
+					t.Errorf("%v: expected %s inactive once removed", test.args, group.name)
+				}
+			}
+		}
+		if fmt.Sprint(active) != "["+test.group+"]" {
+			t.Errorf("%v: expected the %s group active, got %v", test.args, test.group, active)
+		}
+	}
+}
+
+func TestEstimateFormats(t *testing.T) {
+	dir := t.TempDir()
+	stream := "name: a\nemail: a@example.com\n---\nname: b\n"
+	for _, name := range []string{"one.yaml", "two.yml", "skip.json"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(stream), 0644); err != nil {
+			t.Fatalf("Failed to write corpus file: %v", err)
+		}
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{"-maskval", "email:***"})
+	pipeline, err := NewPipeline(filters, transforms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	format := &FormatOptions{InFormat: "yaml", OutFormat: "yaml"}
+	estimate, err := estimateCorpus(dir, pipeline, format, 10)
+	if err != nil {
+		t.Fatalf("Failed to estimate corpus: %v", err)
+	}
+	if estimate.Files != 2 || estimate.OutputBytes <= 0 {
+		t.Errorf("Expected the two YAML files estimated, got %d files and %d bytes of output", estimate.Files, estimate.OutputBytes)
+	}
+
+	for _, name := range formats {
+		if len(formatExtensions[name]) == 0 {
+			t.Errorf("Expected file extensions for %s", name)
+		}
+	}
+}
+
+func TestEstimateSideEffects(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "doc.json"), []byte(`{"name": "a", "id": 1, "email": "a@example.com"}`), 0644); err != nil {
+		t.Fatalf("Failed to write corpus file: %v", err)
+	}
+	marker := filepath.Join(t.TempDir(), "ran")
+	filters, transforms, _ := parseArgs("test", []string{
+		"-execval", "name:sh -c \"echo > " + marker + "\"",
+		"-httpenrich", "id:user:http://127.0.0.1:1/{value}",
+		"-maskval", "email:***",
+	})
+	skipped := withoutSideEffects(filters, transforms)
+	if fmt.Sprint(skipped) != "[execval httpenrich]" {
+		t.Errorf("Expected execval and httpenrich skipped, got %v", skipped)
+	}
+	if len(transforms.ExecVal) != 0 || len(transforms.HTTPEnrich) != 0 || len(transforms.MaskVal) != 1 {
+		t.Errorf("Expected only the rules with side effects removed, got %+v", transforms)
+	}
+
+	pipeline, err := NewPipeline(filters, transforms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := estimateCorpus(dir, pipeline, &FormatOptions{InFormat: "json", OutFormat: "json"}, 1); err != nil {
+		t.Fatalf("Failed to estimate corpus: %v", err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Expected the execval command not to run")
+	}
+}
+
+func TestSampleIndexes(t *testing.T) {
+	indexes := sampleIndexes(10, 4)
+	expected := []int{0, 2, 5, 7}
+	if fmt.Sprint(indexes) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, indexes)
+	}
+
+	if len(sampleIndexes(3, 10)) != 3 {
+		t.Error("Expected sample to be capped at the corpus size")
+	}
+}
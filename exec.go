@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// execTimeout is the time limit for each execval command.
+var execTimeout = 10 * time.Second
+
+// execWaitDelay is how long a killed command's output is waited for, should
+// a process it started still hold it open.
+const execWaitDelay = time.Second
+
+// execSlots limits the number of execval commands running at once.
+var execSlots = make(chan struct{}, runtime.NumCPU())
+
+// registerRunFlags adds the flags for how execval commands and httpenrich
+// requests run. They set package state, so they belong to the command line
+// alone: parsing the rulesets of config stages must not reset them.
+func registerRunFlags(fs *flag.FlagSet) {
+	execSlots = make(chan struct{}, runtime.NumCPU())
+	fs.DurationVar(&execTimeout, "exectimeout", 10*time.Second, "Time limit for each execval command")
+	fs.Func("execlimit", fmt.Sprintf("Maximum number of execval commands running at once (default %d)", runtime.NumCPU()), func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		if n < 1 {
+			return fmt.Errorf("must be at least 1")
+		}
+		execSlots = make(chan struct{}, n)
+		return nil
+	})
+	fs.DurationVar(&httpClient.Timeout, "httptimeout", 5*time.Second, "Time limit for each httpenrich request")
+}
+
+// execValue pipes a scalar value through the rule's command and returns its
+// output without the trailing newline. Null, objects and arrays are left as
+// they are. A failing command returns the error that stops the run, so that
+// values it should have scrubbed are never written as is.
+func execValue(ctx context.Context, value interface{}, rule ExecRule) (interface{}, error) {
+	str, ok := formatScalar(value)
+	if !ok || value == nil {
+		return value, nil
+	}
+
+	output, err := runCommand(ctx, rule.Command, str)
+	if ctx.Err() != nil {
+		// Processing was canceled, so the value will not be written
+		return value, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error in execval %s: %v", rule.Pattern, err)
+	}
+	return output, nil
+}
+
+// runCommand runs command with input on stdin within execTimeout, waiting
+// for a free slot first. Canceling ctx kills the command and the processes it
+// started.
+func runCommand(ctx context.Context, command, input string) (string, error) {
+	args := splitArgs(command)
+	if len(args) == 0 {
+		return "", fmt.Errorf("empty command")
+	}
+
+	select {
+	case execSlots <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	defer func() { <-execSlots }()
+
+	ctx, cancel := context.WithTimeout(ctx, execTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	killProcessGroup(cmd)
+	cmd.WaitDelay = execWaitDelay
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("%s timed out after %v", args[0], execTimeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %v: %s", args[0], err, msg)
+		}
+		return "", fmt.Errorf("%s: %v", args[0], err)
+	}
+
+	output := strings.TrimSuffix(stdout.String(), "\n")
+	return strings.TrimSuffix(output, "\r"), nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// killProcessGroup leaves cmd as it is where there are no process groups;
+// the WaitDelay of runCommand still bounds the wait for its children.
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecVal(t *testing.T) {
+	if _, err := exec.LookPath("tr"); err != nil {
+		t.Skip("tr not available")
+	}
+
+	input := map[string]interface{}{
+		"name":  "alice",
+		"count": 3.0,
+		"notes": nil,
+		"other": "bob",
+	}
+	transforms := &Transformations{ExecVal: parseExecRules([]string{"name:tr a-z A-Z", "key=count command=\"tr 3 4\""})}
+	resultMap := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1).(map[string]interface{})
+
+	if resultMap["name"] != "ALICE" {
+		t.Errorf("Expected name to be piped through tr, got %v", resultMap["name"])
+	}
+	if resultMap["count"] != "4" {
+		t.Errorf("Expected count to be piped as text, got %v", resultMap["count"])
+	}
+	if resultMap["other"] != "bob" || resultMap["notes"] != nil {
+		t.Errorf("Expected other values to be left alone, got %v", resultMap)
+	}
+
+	// A failing command stops processing with an error
+	pipeline, err := NewPipeline(&Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, &Transformations{ExecVal: parseExecRules([]string{"name:false"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := pipeline.Process(input, "test")
+	if err == nil || !strings.Contains(err.Error(), "Error in execval name") || result != nil {
+		t.Errorf("Expected a failing command to stop processing, got %v, %v", result, err)
+	}
+}
+
+func TestRunCommandErrors(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep not available")
+	}
+
+	defer func(timeout time.Duration) { execTimeout = timeout }(execTimeout)
+	execTimeout = 50 * time.Millisecond
+
+	if _, err := runCommand(context.Background(), "sleep 5", ""); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected a timeout error, got %v", err)
+	}
+
+	// A child holding the output open is killed along with the command
+	start := time.Now()
+	if _, err := runCommand(context.Background(), `sh -c "sleep 5; echo done"`, ""); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > execWaitDelay {
+		t.Errorf("Expected the command's children killed on timeout, took %v", elapsed)
+	}
+	if _, err := runCommand(context.Background(), "false", ""); err == nil {
+		t.Error("Expected an error for a failing command")
+	}
+}
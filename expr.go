@@ -0,0 +1,501 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// filterExpr is a parsed -keepif expression. It is evaluated for each
+// key-value pair in an object, e.g. (type==string AND len>5) OR depth==1.
+type filterExpr interface {
+	eval(env exprEnv) bool
+}
+
+// exprEnv holds the attributes a filter expression can refer to.
+type exprEnv struct {
+	key     string
+	value   interface{}
+	depth   int
+	lenUnit string
+}
+
+// exprAttributes lists the attributes available in filter expressions.
+var exprAttributes = map[string]func(env exprEnv) interface{}{
+	"key":    func(env exprEnv) interface{} { return env.key },
+	"keylen": func(env exprEnv) interface{} { return float64(len(env.key)) },
+	"depth":  func(env exprEnv) interface{} { return float64(env.depth) },
+	"type":   func(env exprEnv) interface{} { return getValueType(env.value) },
+	"value":  func(env exprEnv) interface{} { return env.value },
+	"len": func(env exprEnv) interface{} {
+		switch v := env.value.(type) {
+		case string:
+			return float64(stringLength(v, env.lenUnit))
+		case []interface{}:
+			return float64(len(v))
+		case map[string]interface{}:
+			return float64(len(v))
+		default:
+			return nil
+		}
+	},
+}
+
+type orExpr struct{ left, right filterExpr }
+type andExpr struct{ left, right filterExpr }
+type notExpr struct{ operand filterExpr }
+
+type compareExpr struct {
+	attribute string
+	op        string
+	literal   interface{}
+}
+
+func (e orExpr) eval(env exprEnv) bool  { return e.left.eval(env) || e.right.eval(env) }
+func (e andExpr) eval(env exprEnv) bool { return e.left.eval(env) && e.right.eval(env) }
+func (e notExpr) eval(env exprEnv) bool { return !e.operand.eval(env) }
+
+func (e compareExpr) eval(env exprEnv) bool {
+	return compareValues(exprAttributes[e.attribute](env), e.op, e.literal)
+}
+
+// symbolOperators and wordOperators are the comparison operators shared by
+// conditions, when clauses and filter expressions. Longer symbols come first
+// so that >= is not read as >.
+var (
+	symbolOperators = []string{"==", "!=", ">=", "<=", ">", "<"}
+	wordOperators   = []string{"contains", "startswith", "endswith", "matches"}
+)
+
+func isWordOperator(op string) bool {
+	for _, word := range wordOperators {
+		if op == word {
+			return true
+		}
+	}
+	return false
+}
+
+// compareValues applies a comparison operator. Numbers compare numerically
+// and strings lexically; values of different types are never equal and
+// never ordered. The word operators apply to strings only, with matches
+// taking a compiled regular expression.
+func compareValues(actual interface{}, op string, expected interface{}) bool {
+	if op == "!=" {
+		return !compareValues(actual, "==", expected)
+	}
+
+	if op == "matches" {
+		a, ok1 := actual.(string)
+		re, ok2 := expected.(*regexp.Regexp)
+		return ok1 && ok2 && re.MatchString(a)
+	}
+	if isWordOperator(op) {
+		a, ok1 := actual.(string)
+		b, ok2 := expected.(string)
+		if !ok1 || !ok2 {
+			return false
+		}
+		switch op {
+		case "contains":
+			return strings.Contains(a, b)
+		case "startswith":
+			return strings.HasPrefix(a, b)
+		default:
+			return strings.HasSuffix(a, b)
+		}
+	}
+
+	switch a := actual.(type) {
+	case float64:
+		if b, ok := expected.(float64); ok {
+			return compareOrdered(a, op, b)
+		}
+	case string:
+		if b, ok := expected.(string); ok {
+			return compareOrdered(a, op, b)
+		}
+	case bool:
+		if b, ok := expected.(bool); ok {
+			return op == "==" && a == b
+		}
+	case nil:
+		return op == "==" && expected == nil
+	}
+	return false
+}
+
+// comparison is a parsed <op><literal> comparison. Quoted literals are
+// strings; unquoted ones are read with parseValue, but still match a string
+// value with the same text under == and != so that value==Alice keeps
+// working. The is op is a type predicate on the type named by raw, and the
+// pattern of matches is compiled into re.
+type comparison struct {
+	op      string
+	raw     string
+	literal interface{}
+	quoted  bool
+	re      *regexp.Regexp
+}
+
+// parseComparison parses a comparison such as =="Alice", >= 100 or
+// matches "^a". The pattern of matches is compiled here so that an invalid
+// one is reported once, up front.
+func parseComparison(text string) (*comparison, error) {
+	trimmed := strings.TrimSpace(text)
+	op := ""
+	for _, symbol := range symbolOperators {
+		if strings.HasPrefix(trimmed, symbol) {
+			op = symbol
+			break
+		}
+	}
+	if op == "" {
+		for _, word := range wordOperators {
+			if len(trimmed) > len(word) && strings.EqualFold(trimmed[:len(word)], word) &&
+				strings.ContainsRune(" \t\"", rune(trimmed[len(word)])) {
+				op = word
+				break
+			}
+		}
+	}
+	if op == "" {
+		return nil, fmt.Errorf("missing comparison operator in %q", trimmed)
+	}
+
+	c := &comparison{op: op, raw: strings.TrimSpace(trimmed[len(op):])}
+	if len(c.raw) >= 2 && c.raw[0] == '"' && c.raw[len(c.raw)-1] == '"' {
+		c.quoted = true
+		if str, err := strconv.Unquote(c.raw); err == nil {
+			c.raw = str
+		} else {
+			c.raw = c.raw[1 : len(c.raw)-1]
+		}
+	}
+	c.literal = parseValue(c.raw)
+
+	if op == "matches" {
+		var err error
+		if c.re, err = regexp.Compile(c.raw); err != nil {
+			return nil, fmt.Errorf("invalid pattern in %q: %v", trimmed, err)
+		}
+	}
+	return c, nil
+}
+
+func (c *comparison) eval(value interface{}) bool {
+	if c.op == "is" {
+		return getValueType(value) == c.raw
+	}
+	if c.op == "matches" {
+		return compareValues(value, c.op, c.re)
+	}
+	if c.quoted {
+		return compareValues(value, c.op, c.raw)
+	}
+	if _, ok := value.(string); ok && (c.op == "==" || c.op == "!=") || isWordOperator(c.op) {
+		return compareValues(value, c.op, c.raw)
+	}
+	return compareValues(value, c.op, c.literal)
+}
+
+// evaluateComparison applies a comparison written as <op><literal> to value.
+// An invalid comparison never holds.
+func evaluateComparison(value interface{}, text string) bool {
+	c, err := parseComparison(text)
+	return err == nil && c.eval(value)
+}
+
+// valueCondition is a condreplace condition on the value alone: a
+// comparison or a type predicate.
+type valueCondition struct{ c *comparison }
+
+func (e valueCondition) eval(env exprEnv) bool { return e.c.eval(env.value) }
+
+// parseReplaceCondition parses a condreplace condition. Conditions on the
+// value alone, value<op><literal> or a type predicate such as
+// isstring(value), are comparisons; others, combining comparisons with AND,
+// OR and NOT or referring to the key or depth, e.g.
+// key=="status" && value=="inactive", are filter expressions.
+func parseReplaceCondition(condition string) (filterExpr, error) {
+	var expr filterExpr
+	if isValueCondition(condition) {
+		c, err := parseCondition(condition)
+		if err != nil {
+			return nil, err
+		}
+		expr = valueCondition{c}
+	} else {
+		var err error
+		if expr, err = parseFilterExpr(condition); err != nil {
+			return nil, fmt.Errorf("condition %q: %v", condition, err)
+		}
+	}
+	return expr, nil
+}
+
+// isValueCondition reports whether a condition tests the value alone, as
+// opposed to a filter expression.
+func isValueCondition(condition string) bool {
+	condition = strings.TrimSpace(condition)
+	if typePredicate.MatchString(condition) {
+		return true
+	}
+	if !strings.HasPrefix(condition, "value") {
+		return false
+	}
+	tokens, err := tokenizeExpr(condition)
+	if err != nil {
+		return true
+	}
+	for _, token := range tokens {
+		if token.quoted {
+			continue
+		}
+		switch strings.ToUpper(token.text) {
+		case "&&", "||", "!", "(", ")", "AND", "OR", "NOT":
+			return false
+		}
+	}
+	return true
+}
+
+// holds evaluates the rule's condition for a value and its key and depth:
+// the one NewPipeline parsed, or else the condition parsed on the spot.
+// Filter expressions never hold without a key, so that they apply to object
+// members only, once. An invalid condition never holds.
+func (r *CondReplaceRule) holds(env exprEnv) bool {
+	expr := r.expr
+	if expr == nil {
+		var err error
+		if expr, err = parseReplaceCondition(r.Condition); err != nil {
+			return false
+		}
+	}
+	if _, ok := expr.(valueCondition); !ok && env.key == "" {
+		return false
+	}
+	return expr.eval(env)
+}
+
+func compareOrdered[T float64 | string](a T, op string, b T) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	default:
+		return false
+	}
+}
+
+// parseFilterExpr parses a filter expression. Comparisons have the form
+// <attribute> <op> <literal> and are combined with AND, OR, NOT (or &&, ||,
+// !) and parentheses. Unquoted literals are read with parseValue, except for
+// the string-valued key and type attributes.
+func parseFilterExpr(input string) (filterExpr, error) {
+	tokens, err := tokenizeExpr(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return expr, nil
+}
+
+type exprToken struct {
+	text   string
+	quoted bool
+}
+
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")"}
+
+func tokenizeExpr(input string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(input); {
+		c := input[i]
+		if unicode.IsSpace(rune(c)) {
+			i++
+			continue
+		}
+
+		if c == '"' {
+			end := i + 1
+			for end < len(input) && input[end] != '"' {
+				if input[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(input) {
+				return nil, fmt.Errorf("unterminated string in %q", input)
+			}
+			str, err := strconv.Unquote(input[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s", input[i:end+1])
+			}
+			tokens = append(tokens, exprToken{text: str, quoted: true})
+			i = end + 1
+			continue
+		}
+
+		matched := false
+		for _, op := range exprOperators {
+			if strings.HasPrefix(input[i:], op) {
+				tokens = append(tokens, exprToken{text: op})
+				i += len(op)
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+
+		end := i
+		for end < len(input) && !unicode.IsSpace(rune(input[end])) && !strings.ContainsRune(`"&|=!<>()`, rune(input[end])) {
+			end++
+		}
+		tokens = append(tokens, exprToken{text: input[i:end]})
+		i = end
+	}
+	return tokens, nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+// accept consumes the next token if it is one of the given operators or
+// keywords. Keywords match case-insensitively.
+func (p *exprParser) accept(words ...string) bool {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].quoted {
+		return false
+	}
+	for _, word := range words {
+		if strings.EqualFold(p.tokens[p.pos].text, word) {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) next() (exprToken, error) {
+	if p.pos >= len(p.tokens) {
+		return exprToken{}, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+func (p *exprParser) parseOr() (filterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("OR", "||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (filterExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("AND", "&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (filterExpr, error) {
+	if p.accept("NOT", "!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{operand}, nil
+	}
+
+	if p.accept("(") {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return expr, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (filterExpr, error) {
+	attr, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	name := strings.ToLower(attr.text)
+	if _, ok := exprAttributes[name]; !ok || attr.quoted {
+		return nil, fmt.Errorf("unknown attribute %q", attr.text)
+	}
+
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	opText := strings.ToLower(op.text)
+	valid := isWordOperator(opText)
+	for _, symbol := range symbolOperators {
+		valid = valid || opText == symbol
+	}
+	if !valid || op.quoted {
+		return nil, fmt.Errorf("expected comparison operator after %s, got %q", attr.text, op.text)
+	}
+
+	lit, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	// key and type are always strings, so their literals are never parsed,
+	// and neither are the operands of the string operators
+	var literal interface{} = lit.text
+	if !lit.quoted && name != "key" && name != "type" && !isWordOperator(opText) {
+		literal = parseValue(lit.text)
+	}
+	if opText == "matches" {
+		if literal, err = regexp.Compile(lit.text); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", lit.text, err)
+		}
+	}
+
+	return compareExpr{attribute: name, op: opText, literal: literal}, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestKeepIf(t *testing.T) {
+	input := createTestInput()
+
+	expr, err := parseFilterExpr(`(type==string AND len>5) OR depth==1`)
+	if err != nil {
+		t.Fatalf("Failed to parse expression: %v", err)
+	}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999, KeepIf: expr}
+
+	result := processJSON(input, filters, &Transformations{}, 1)
+	resultMap, ok := result.(map[string]interface{})
+	if !ok {
+		t.Fatal("Result is not a map")
+	}
+
+	// Everything at depth 1 is kept
+	if len(resultMap) != len(input) {
+		t.Errorf("Expected all %d top-level keys, got %d", len(input), len(resultMap))
+	}
+
+	// Below depth 1 only strings longer than 5 characters survive
+	meta := resultMap["meta"].(map[string]interface{})
+	if len(meta) != 0 {
+		t.Errorf("Expected meta to be empty, got %v", meta)
+	}
+}
+
+func TestKeepIfNot(t *testing.T) {
+	input := createTestInput()
+
+	expr, err := parseFilterExpr(`NOT (type == null || key == "SYM") && !(value < 10)`)
+	if err != nil {
+		t.Fatalf("Failed to parse expression: %v", err)
+	}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999, KeepIf: expr}
+
+	resultMap := processJSON(input, filters, &Transformations{}, 1).(map[string]interface{})
+
+	for _, key := range []string{"notes", "SYM", "zero"} {
+		if _, exists := resultMap[key]; exists {
+			t.Errorf("Expected %s to be filtered out", key)
+		}
+	}
+	for _, key := range []string{"Name", "age", "meta"} {
+		if _, exists := resultMap[key]; !exists {
+			t.Errorf("Expected %s to be kept", key)
+		}
+	}
+}
+
+func TestParseFilterExprErrors(t *testing.T) {
+	for _, input := range []string{"", "size>3", "len>", "(depth==1", "depth==1 OR", `key=="open`} {
+		if _, err := parseFilterExpr(input); err == nil {
+			t.Errorf("Expected an error for %q", input)
+		}
+	}
+}
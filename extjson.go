@@ -0,0 +1,169 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// extJSONModes lists the -extjson modes: plain writes the logical values of
+// Extended JSON wrappers, canonical wraps them again.
+var extJSONModes = []string{"plain", "canonical"}
+
+// extJSONDate is the form of dates unwrapped from Extended JSON.
+const extJSONDate = "2006-01-02T15:04:05.999Z07:00"
+
+// unwrapExtJSON replaces the MongoDB Extended JSON wrappers of a document,
+// objects with the single key $oid, $date, $numberLong, $numberInt,
+// $numberDouble or $numberDecimal, with their logical value: the ObjectId's
+// hex string, the date as an RFC 3339 string, or the number, so that rules
+// see it. It returns the paths of the unwrapped values with the wrapper key
+// each had. Numbers beyond 2^53 lose precision.
+func unwrapExtJSON(doc interface{}) (interface{}, map[string]string) {
+	wrapped := make(map[string]string)
+	var unwrap func(value interface{}, path string) interface{}
+	unwrap = func(value interface{}, path string) interface{} {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if logical, kind, ok := extJSONValue(v); ok {
+				wrapped[path] = kind
+				return logical
+			}
+			result := make(map[string]interface{}, len(v))
+			for key, item := range v {
+				result[key] = unwrap(item, joinPath(path, key))
+			}
+			return result
+		case []interface{}:
+			result := make([]interface{}, len(v))
+			for i, item := range v {
+				result[i] = unwrap(item, indexPath(path, i))
+			}
+			return result
+		}
+		return value
+	}
+	return unwrap(doc, "$"), wrapped
+}
+
+// extJSONValue returns the logical value of an Extended JSON wrapper and its
+// key. It reports false for other objects and malformed wrappers.
+func extJSONValue(obj map[string]interface{}) (interface{}, string, bool) {
+	if len(obj) != 1 {
+		return nil, "", false
+	}
+	for kind, inner := range obj {
+		switch kind {
+		case "$oid":
+			if str, ok := inner.(string); ok {
+				return str, kind, true
+			}
+		case "$date":
+			// Relaxed dates are strings, canonical ones milliseconds since the epoch
+			if str, ok := inner.(string); ok {
+				if t, err := time.Parse(time.RFC3339Nano, str); err == nil {
+					return t.UTC().Format(extJSONDate), kind, true
+				}
+				return nil, "", false
+			}
+			var millis interface{} = inner
+			if wrapper, ok := inner.(map[string]interface{}); ok {
+				if n, kind, ok := extJSONValue(wrapper); ok && kind == "$numberLong" {
+					millis = n
+				}
+			}
+			if n, ok := millis.(float64); ok {
+				return time.UnixMilli(int64(n)).UTC().Format(extJSONDate), kind, true
+			}
+		case "$numberLong", "$numberInt", "$numberDouble", "$numberDecimal":
+			str, ok := inner.(string)
+			if !ok {
+				return nil, "", false
+			}
+			switch str {
+			case "Infinity":
+				return math.Inf(1), kind, true
+			case "-Infinity":
+				return math.Inf(-1), kind, true
+			case "NaN":
+				return math.NaN(), kind, true
+			}
+			if n, err := strconv.ParseFloat(str, 64); err == nil {
+				return n, kind, true
+			}
+		}
+	}
+	return nil, "", false
+}
+
+// rewrapExtJSON wraps the values at the paths of wrapped again, in canonical
+// Extended JSON. Values whose type no longer fits their wrapper, such as a
+// masked number, stay plain, as do values that rules moved elsewhere.
+func rewrapExtJSON(doc interface{}, wrapped map[string]string) interface{} {
+	var rewrap func(value interface{}, path string) interface{}
+	rewrap = func(value interface{}, path string) interface{} {
+		if kind, ok := wrapped[path]; ok {
+			if wrapper, ok := extJSONWrapper(value, kind); ok {
+				return wrapper
+			}
+			return value
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			result := make(map[string]interface{}, len(v))
+			for key, item := range v {
+				result[key] = rewrap(item, joinPath(path, key))
+			}
+			return result
+		case []interface{}:
+			result := make([]interface{}, len(v))
+			for i, item := range v {
+				result[i] = rewrap(item, indexPath(path, i))
+			}
+			return result
+		}
+		return value
+	}
+	return rewrap(doc, "$")
+}
+
+// extJSONWrapper returns the canonical Extended JSON wrapper of a value.
+func extJSONWrapper(value interface{}, kind string) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		switch kind {
+		case "$oid":
+			return map[string]interface{}{kind: v}, true
+		case "$date":
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, false
+			}
+			millis := map[string]interface{}{"$numberLong": strconv.FormatInt(t.UnixMilli(), 10)}
+			return map[string]interface{}{kind: millis}, true
+		}
+	case float64:
+		switch kind {
+		case "$numberLong", "$numberInt":
+			if v != math.Trunc(v) || math.IsInf(v, 0) {
+				return nil, false
+			}
+			return map[string]interface{}{kind: strconv.FormatFloat(v, 'f', 0, 64)}, true
+		case "$numberDouble", "$numberDecimal":
+			str := strconv.FormatFloat(v, 'g', -1, 64)
+			switch {
+			case math.IsInf(v, 1):
+				str = "Infinity"
+			case math.IsInf(v, -1):
+				str = "-Infinity"
+			case math.IsNaN(v):
+				str = "NaN"
+			case kind == "$numberDouble" && !strings.ContainsAny(str, ".eE"):
+				str += ".0"
+			}
+			return map[string]interface{}{kind: str}, true
+		}
+	}
+	return nil, false
+}
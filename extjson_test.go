@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestExtJSON(t *testing.T) {
+	var input interface{}
+	if err := json.Unmarshal([]byte(`{
+		"_id": {"$oid": "5f1d7f3e9b1e8a3c4d5e6f70"},
+		"created": {"$date": {"$numberLong": "1577836800000"}},
+		"updated": {"$date": "2020-06-01T12:00:00.5Z"},
+		"views": {"$numberLong": "1500"},
+		"score": {"$numberDouble": "2.0"},
+		"ssn": {"$numberLong": "123456789"},
+		"note": {"$oid": "x", "extra": 1}
+	}`), &input); err != nil {
+		t.Fatal(err)
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{"-extjson", "plain", "-maxnum", "1000", "-maskval", "ssn:***"})
+	expected := map[string]interface{}{
+		"_id":     "5f1d7f3e9b1e8a3c4d5e6f70",
+		"created": "2020-01-01T00:00:00Z",
+		"updated": "2020-06-01T12:00:00.5Z",
+		"score":   2.0,
+		"ssn":     "***",
+		"note":    map[string]interface{}{"$oid": "x", "extra": 1.0},
+	}
+	if result := processDocument(input, "", filters, transforms); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected rules applied to the logical values, got %v", result)
+	}
+
+	filters, transforms, _ = parseArgs("test", []string{"-extjson", "canonical", "-maskval", "ssn:***"})
+	expected = map[string]interface{}{
+		"_id":     map[string]interface{}{"$oid": "5f1d7f3e9b1e8a3c4d5e6f70"},
+		"created": map[string]interface{}{"$date": map[string]interface{}{"$numberLong": "1577836800000"}},
+		"updated": map[string]interface{}{"$date": map[string]interface{}{"$numberLong": "1591012800500"}},
+		"views":   map[string]interface{}{"$numberLong": "1500"},
+		"score":   map[string]interface{}{"$numberDouble": "2.0"},
+		"ssn":     "***",
+		"note":    map[string]interface{}{"$oid": "x", "extra": 1.0},
+	}
+	if result := processDocument(input, "", filters, transforms); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected canonical Extended JSON written, got %v", result)
+	}
+}
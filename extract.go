@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Finding is a value left in a processed document, with its path and, for
+// several input files, the file it was found in.
+type Finding struct {
+	File  string      `json:"file,omitempty"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// runExtract implements the extract subcommand. Each input file is
+// processed, and instead of the rewritten document the scalar values it
+// still contains are written as a JSON array of findings, so that e.g.
+// -strpattern sym -novaltype number lists every string with a symbol along
+// with its path.
+func runExtract(arguments []string) {
+	filters, transforms, args := parseArgs("extract", arguments)
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s extract [options] input.json...\n", os.Args[0])
+		os.Exit(2)
+	}
+	pipeline, err := NewPipeline(filters, transforms)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	findings := []Finding{}
+	for _, filename := range args {
+		data, err := readJSON(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		processed, err := pipeline.Process(data, filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		for _, finding := range extractValues(processed, "$") {
+			if len(args) > 1 {
+				finding.File = filename
+			}
+			findings = append(findings, finding)
+		}
+	}
+
+	output, err := codec.MarshalIndent(findings, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshaling JSON: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(output))
+}
+
+// extractValues lists the scalar values of a document in path order.
+func extractValues(value interface{}, path string) []Finding {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var findings []Finding
+		for _, key := range keys {
+			findings = append(findings, extractValues(v[key], joinPath(path, key))...)
+		}
+		return findings
+	case []interface{}:
+		var findings []Finding
+		for i, item := range v {
+			findings = append(findings, extractValues(item, indexPath(path, i))...)
+		}
+		return findings
+	default:
+		return []Finding{{Path: path, Value: v}}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractValues(t *testing.T) {
+	input := map[string]interface{}{
+		"user":  map[string]interface{}{"email": "ann@example.com", "name": "Ann"},
+		"cc":    []interface{}{"bob@example.com", "n/a"},
+		"empty": map[string]interface{}{},
+		"age":   30.0,
+	}
+	filters, transforms, _ := parseArgs("extract", []string{"-strpattern", "sym", "-novaltype", "number"})
+	pipeline, err := NewPipeline(filters, transforms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	processed, err := pipeline.Process(input, "in.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings := extractValues(processed, "$")
+	expected := []Finding{
+		{Path: "$.cc[0]", Value: "bob@example.com"},
+		{Path: "$.cc[1]", Value: "n/a"},
+		{Path: "$.user.email", Value: "ann@example.com"},
+	}
+	if !reflect.DeepEqual(findings, expected) {
+		t.Errorf("Expected %v, got %v", expected, findings)
+	}
+}
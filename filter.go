@@ -1,13 +1,28 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
 )
 
 type Filters struct {
@@ -18,11 +33,32 @@ type Filters struct {
 	NoValTypes   []string
 	MinNum       *float64
 	MaxNum       *float64
+	BoolVal      *bool
 	MinStrLen    int
 	MaxStrLen    int
 	StrPattern   []string
 	NoStrPattern []string
 	IgnoreCase   bool
+	KeepIf       filterExpr
+	DropKeys     []string
+	// HasKeys and NotHasKeys keep only the object array elements with, or
+	// without, a matching field
+	HasKeys    []string
+	NotHasKeys []string
+	// Where keeps only the object array elements satisfying every clause
+	Where []WhereClause
+	// IgnoreKeyCase makes key name matching case-insensitive
+	IgnoreKeyCase bool
+	// LenUnit is the unit string lengths are counted in, "bytes" or "runes"
+	LenUnit string
+	// Invert outputs what the filters remove instead of what they keep
+	Invert bool
+	// RetainAncestors keeps objects and arrays failing the filters along
+	// with whatever inside them passes, rather than dropping them whole
+	RetainAncestors bool
+	// Patterns are the user-defined named patterns of StrPattern and
+	// NoStrPattern, compiled
+	Patterns map[string]*regexp.Regexp
 }
 
 type Transformations struct {
@@ -35,89 +71,769 @@ type Transformations struct {
 	RenameKeyDepth []RenameDepthRule
 	MaskVal        []MaskRule
 	CondReplace    []CondReplaceRule
+	Lineage        *LineageRule
+	Truncate       *TruncateRule
+	AddFields      []AddFieldRule
+	Aggregates     []AggregateRule
+	Stamp          *StampRule
+	// Pointers are the rules addressing a value by JSON Pointer
+	Pointers []PointerRule
+	// Deref is the depth to which internal $ref references are resolved
+	// inline before the other rules apply; 0 leaves them alone
+	Deref int
+	// TFSensitive masks the attributes Terraform state instances list in
+	// their sensitive_attributes before the other rules apply; empty leaves
+	// them alone
+	TFSensitive string
+	// ExtJSON unwraps MongoDB Extended JSON values for the rules, writing
+	// them plain or canonical; empty leaves the wrappers alone
+	ExtJSON string
+	// PseudonymSalt is the secret HMAC key from which the pseudonymize
+	// rules derive their fake values
+	PseudonymSalt string
+	// Nulls and EmptyStrings are the policies for null and empty string
+	// values, applied after all other transformations
+	Nulls        *ValuePolicy
+	EmptyStrings *ValuePolicy
+	// NonFinite is the policy for NaN and infinite numbers: drop, null,
+	// clamp or error; they are left alone by default
+	NonFinite string
+	// IgnoreKeyCase makes key name matching case-insensitive
+	IgnoreKeyCase bool
+	// LenUnit is the unit string lengths are counted in, "bytes" or "runes"
+	LenUnit string
+	// Normalize is the Unicode normalization form applied to string values,
+	// "nfc" or "nfkc", and to keys as well when NormalizeKeys is set
+	Normalize      string
+	NormalizeKeys  bool
+	Trim           bool
+	StringOps      []StringOpRule
+	SplitVal       []DelimiterRule
+	JoinVal        []DelimiterRule
+	EncodeVal      []CodecRule
+	DecodeVal      []CodecRule
+	ArrayWhere     []ArrayWhereRule
+	ArrayUniqueBy  []FieldRule
+	ArrayFlatten   []FlattenRule
+	ArraySample    []SampleRule
+	ArrayToMap     []FieldRule
+	GroupBy        []GroupRule
+	Join           []JoinRule
+	ArrayIntersect []SetRule
+	ArraySubtract  []SetRule
+	Pseudonymize   []PseudonymRule
+	MapToArray     []FieldRule
+	ExecVal        []ExecRule
+	Lookup         []LookupRule
+	HTTPEnrich     []HTTPRule
+	ScaleNum       []ScaleRule
+	ParseNum       []ParseNumRule
+	// Patterns are the user-defined named patterns of ReplaceVal and
+	// MaskVal, compiled
+	Patterns map[string]*regexp.Regexp
+	// Plugins are the custom transformations loaded with -plugin
+	Plugins []Transformer
+	// Script is the Starlark transform loaded with -script
+	Script *Script
+	// Path is the JSONPath-style path of the value being processed, empty
+	// for the document root; it is only tracked for plugins and scripts
+	Path string
+	// Stages are the pipelines of the config file stages, applied in order
+	// to the result of this ruleset
+	Stages []*Pipeline
+	// DepthRoot are the field names leading from the value being processed
+	// to the -depthroot subtree, while above it
+	DepthRoot []string
+	// offDepthRoot is set outside the -depthroot subtree and the path to it
+	offDepthRoot bool
+	// source is the input file being processed; it is set by
+	// processDocument
+	source *SourceInfo
+	// ctx cancels processing, and cancel stops it with an error; they are
+	// set by Pipeline.ProcessContext
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+}
+
+// RuleOptions holds settings shared by all rule kinds. When guards a rule with
+// a condition on a sibling field, e.g. country=="EU"; it is set from the
+// config file. Under limits a rule to the subtree below the named key.
+// Priority orders the rules of one kind, highest first, and Final stops any
+// further transformation of a value or key once the rule has matched it; both
+// are also set from the config file. NewPipeline parses When into when.
+type RuleOptions struct {
+	When     string
+	Under    string
+	Priority int
+	Final    bool
+	when     *whenClause
 }
 
 type ReplaceRule struct {
 	Pattern     string
 	Replacement string
+	RuleOptions
 }
 
+// BoundRule bounds numbers, or string lengths, to Min and Max. Strings
+// shorter than Min are padded with PadChar, a space by default, on PadSide:
+// right (the default), left or both. With Ellipsis, strings truncated to
+// Max end in an ellipsis. Policy says what to do with values out of bounds
+// instead: clamp them (the default), drop them, null them or stop the run
+// with an error.
 type BoundRule struct {
-	Min float64
-	Max float64
+	Min      float64
+	Max      float64
+	PadChar  string
+	PadSide  string
+	Ellipsis bool
+	Policy   string
 }
 
 type DefaultRule struct {
 	Type  string
 	Value interface{}
+	RuleOptions
 }
 
+// ArrayFilterRule applies value filters, written like their flags (e.g.
+// "-minnum 10 -maxnum 20"), to array elements of the given type. With -field,
+// object elements are judged by the value of that field.
 type ArrayFilterRule struct {
-	Type   string
-	Filter string
+	Type    string
+	Filter  string
+	filters *Filters
+	field   string
 }
 
+// RenameDepthRule adds Prefix and Suffix to the keys at Depth, or at every
+// depth from Depth to MaxDepth when MaxDepth is above it. Key, when set, is a
+// regular expression limiting the rule to the keys it matches.
 type RenameDepthRule struct {
-	Depth  int
-	Prefix string
+	Depth    int
+	MaxDepth int
+	Prefix   string
+	Suffix   string
+	Key      string
+	RuleOptions
+	re *regexp.Regexp // Key, compiled by NewPipeline
 }
 
+// MaskRule replaces the values of keys matching Pattern. By default the
+// value becomes Mask; Mode "length" instead replaces every character with the
+// first rune of Mask, and "structure" replaces only letters and digits,
+// keeping separators so that 555-1234 becomes ###-####. An object or array
+// value is replaced as a whole, unless Deep is set, in which case every leaf
+// inside it is masked and the structure is kept. Mode "hash" replaces the
+// value with its SHA-256 hash, "keep-last" masks all but the last Keep
+// characters, and "null" replaces it with null. Value, when set, names a
+// pattern the value must be a string matching.
 type MaskRule struct {
 	Pattern string
 	Mask    string
+	Mode    string
+	Keep    int
+	Deep    bool
+	Value   string
+	RuleOptions
 }
 
 type CondReplaceRule struct {
 	Condition   string
 	Replacement interface{}
+	RuleOptions
+	expr filterExpr // Condition, parsed by NewPipeline
+}
+
+// StringOpRule applies a string cleanup (trim, lower, upper or title) to the
+// string values of keys matching Pattern.
+type StringOpRule struct {
+	Pattern string
+	Op      string
+	RuleOptions
+}
+
+// DelimiterRule converts the values of keys matching Pattern between a
+// delimited string and an array.
+type DelimiterRule struct {
+	Pattern   string
+	Delimiter string
+	RuleOptions
+}
+
+// CodecRule encodes or decodes the values of keys matching Pattern with
+// base64 or URL encoding. With ParseJSON, decoded content is parsed as JSON
+// and merged into the tree so the rest of the ruleset applies to it.
+type CodecRule struct {
+	Pattern   string
+	Encoding  string
+	ParseJSON bool
+	RuleOptions
+}
+
+// ArrayWhereRule keeps only the elements of arrays under keys matching
+// Pattern that are objects whose field satisfies Condition, written like a
+// when clause, e.g. status=="shipped".
+type ArrayWhereRule struct {
+	Pattern   string
+	Condition string
+	RuleOptions
+	condition *whenClause // Condition, parsed by NewPipeline
+}
+
+// FieldRule applies to the values of keys matching Pattern and names the
+// field of their object elements the rule works with.
+type FieldRule struct {
+	Pattern string
+	Field   string
+	RuleOptions
+}
+
+// FlattenRule flattens nested arrays under keys matching Pattern into a
+// single array, up to Depth levels of nesting.
+type FlattenRule struct {
+	Pattern string
+	Depth   int
+	RuleOptions
+}
+
+// SampleRule keeps a random subset of the elements of arrays under keys
+// matching Pattern: Count elements, or Percent of them when Percent is not
+// negative.
+type SampleRule struct {
+	Pattern string
+	Count   int
+	Percent float64
+	RuleOptions
+}
+
+// ExecRule pipes the values of keys matching Pattern through an external
+// command, given with its arguments, and substitutes its output.
+type ExecRule struct {
+	Pattern string
+	Command string
+	RuleOptions
+}
+
+// LookupRule substitutes the values of keys matching Pattern with their
+// entry in a table loaded from File, mapping the From column to the To
+// column. Missing says what happens to values not in the table: keep, null
+// or error. With Into, the entry is added under that sibling key instead and
+// the value is kept.
+type LookupRule struct {
+	Pattern string
+	File    string
+	From    string
+	To      string
+	Missing string
+	Into    string
+	table   map[string]interface{}
+	RuleOptions
+}
+
+// HTTPRule requests URL, with {value} replaced by the value of a key
+// matching Pattern, and inserts the JSON response under the sibling key
+// Into. OnError is the failure policy: skip, null or error.
+type HTTPRule struct {
+	Pattern string
+	URL     string
+	Into    string
+	OnError string
+	RuleOptions
+}
+
+type LineageRule struct {
+	Field string
+}
+
+// AddFieldRule sets the field at Path, e.g. $.meta.trace_id, in every
+// output record to Value, in which {{uuid}} is replaced by a new random UUID
+// and {{now}} by the processing timestamp.
+type AddFieldRule struct {
+	Path []string
+	// Pointer is set instead of Path for a JSON Pointer into the document
+	// as a whole, which can end in - to append to an array
+	Pointer []string
+	Value   string
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		case "estimate":
+			runEstimate(os.Args[2:])
+			return
+		case "extract":
+			runExtract(os.Args[2:])
+			return
+		case "paths":
+			runPaths(os.Args[2:])
+			return
+		case "stats":
+			runStats(os.Args[2:])
+			return
+		case "schema-diff":
+			runSchemaDiff(os.Args[2:])
+			return
+		}
+	}
+
+	var format FormatOptions
+	var limits Limits
+	var assertions Assertions
+	registerFormat, validateFormat := registerFormatFlags(&format)
+	filters, transforms, args := parseArgs(os.Args[0], os.Args[1:], registerFormat, registerLimitFlags(&limits), registerAssertFlags(&assertions))
+	if err := validateFormat(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	if filters.Invert && format.RemovedOut != "" {
+		fmt.Fprintf(os.Stderr, "-invert and -removed-out cannot be combined\n")
+		os.Exit(2)
+	}
+	pipeline, err := NewPipeline(filters, transforms)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	// Get input and output file names
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] input.json output.json|-\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s diff [options] a.json b.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s estimate [options] dir\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s extract [options] input.json...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s paths [options] input.json...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s stats [options] input.json...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s schema-diff [options] a.json b.json\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	inputFile := args[0]
+	outputFile, err := expandOutputName(args[1], newSourceInfo(inputFile))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	if outputFile != args[1] {
+		if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Transformations and filters stop on SIGINT or SIGTERM or once the
+	// -timeout has passed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+
+	// Archives are processed entry by entry into an archive of the same kind
+	if kind := archiveKind(inputFile); kind != "" {
+		runArchive(ctx, kind, inputFile, outputFile, pipeline, &format, &limits, &assertions)
+		return
+	}
+
+	// Read the input document
+	jsonData, err := readInput(inputFile, &format, &limits)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	// The documents of a YAML stream are processed one by one
+	if docs, ok := jsonData.(yamlStream); ok {
+		runYAMLStream(ctx, docs, inputFile, outputFile, pipeline, &format, &limits, &assertions)
+		return
+	}
+	// JSON input was checked as it was read
+	if format.InFormat != "json" {
+		if err := limits.checkDepth(jsonData); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	result, err := pipeline.ProcessContext(ctx, jsonData, inputFile)
+	exitOnProcessError(err, &limits)
+
+	// Write what the filters removed for review, in the output format but
+	// without the query or template
+	if format.RemovedOut != "" {
+		removedFormat := format
+		removedFormat.Template = nil
+		removed, err := pipeline.RemovedContext(ctx, jsonData, inputFile)
+		exitOnProcessError(err, &limits)
+		output, err := encodeOutput(removed, &removedFormat)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		if err := writeFileAtomic(format.RemovedOut, output); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing removed output file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Select the part of the result to output
+	result, err = applyQuery(result, &format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	// Output that fails an assertion is not written
+	if violations := assertions.check(result); len(violations) > 0 {
+		for _, violation := range violations {
+			fmt.Fprintf(os.Stderr, "Assertion failed: %s\n", violation)
+		}
+		fmt.Fprintf(os.Stderr, "%d assertion failures; no output written\n", len(violations))
+		os.Exit(1)
+	}
+
+	// SQLite output is inserted into a table of a database file
+	if format.OutFormat == "sqlite" {
+		dbFile := format.SQLiteFile
+		if dbFile == "" {
+			dbFile = outputFile
+		}
+		if dbFile == "-" {
+			fmt.Fprintf(os.Stderr, "SQLite output requires a database file, not stdout\n")
+			os.Exit(2)
+		}
+		n, err := writeSQLite(result, dbFile, format.SQLTable)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Processed %d rows written to table %s of %s\n", n, format.SQLTable, dbFile)
+		return
+	}
+
+	// Write each part of split output to its own file
+	if format.SplitByKey || format.ChunkSize > 0 {
+		parts, err := splitOutput(result, outputFile, &format)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		// Every part is encoded before any is written, so that the size
+		// limit applies to the output as a whole
+		outputs := make([][]byte, len(parts))
+		var size int64
+		for i, part := range parts {
+			output, err := encodeOutput(part.Value, &format)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			outputs[i] = output
+			size += int64(len(output))
+		}
+		if err := limits.checkOutputSize(size); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		for i, part := range parts {
+			if ctx.Err() == context.Canceled {
+				fmt.Fprintf(os.Stderr, "Interrupted after writing %d of %d files\n", i, len(parts))
+				os.Exit(exitInterrupted)
+			}
+			if err := writeFileAtomic(part.Filename, outputs[i]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output file: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		fmt.Printf("Processed %s written to %d files\n", strings.ToUpper(format.OutFormat), len(parts))
+		return
+	}
+
+	// Write the output in the requested format
+	output, err := encodeOutput(result, &format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if err := limits.checkOutputSize(int64(len(output))); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	// An output file of - writes to stdout, colorized on a terminal
+	if outputFile == "-" {
+		if format.Color && format.OutFormat == "json" && isTerminal(os.Stdout) {
+			// Paths in a query result no longer match the input
+			changed := map[string]bool{}
+			if format.Query == nil {
+				changed = changedPaths(jsonData, result)
+			}
+			fmt.Println(colorizeJSON(result, format.Indent, changed))
+		} else {
+			os.Stdout.Write(output)
+		}
+		return
+	}
+
+	if err := writeFileAtomic(outputFile, output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output file: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Processed %s written to %s\n", strings.ToUpper(format.OutFormat), outputFile)
+}
+
+// parseArgs parses the filter and transformation flags shared by the default
+// command and the subcommands, returning the remaining positional arguments.
+// Subcommands pass register functions to add flags of their own.
+func parseArgs(name string, arguments []string, register ...func(*flag.FlagSet)) (*Filters, *Transformations, []string) {
+	return parseRuleset(name, arguments, nil, append([]func(*flag.FlagSet){registerRunFlags}, register...)...)
+}
+
+// parseRuleset is parseArgs, but with the config options and rules taken
+// from preset, when not nil, instead of a -config file. Stages are parsed
+// this way, as rulesets of their own.
+func parseRuleset(name string, arguments []string, preset *Config, register ...func(*flag.FlagSet)) (*Filters, *Transformations, []string) {
 	var filters Filters
 	var transforms Transformations
 	var noValTypeFlags arrayFlag
+	var dropKeyFlags arrayFlag
+	var hasKeyFlags arrayFlag
+	var notHasKeyFlags arrayFlag
+	var whereFlags arrayFlag
 	var replaceValFlags arrayFlag
 	var replaceKeyFlags arrayFlag
 	var defaultValFlags arrayFlag
 	var arrayFilterFlags arrayFlag
+	var arrayWhereFlags arrayFlag
+	var arrayUniqueByFlags arrayFlag
+	var arrayFlattenFlags arrayFlag
+	var arrayToMapFlags arrayFlag
+	var groupByFlags arrayFlag
+	var joinFlags arrayFlag
+	var arrayIntersectFlags arrayFlag
+	var arraySubtractFlags arrayFlag
+	var pseudonymizeFlags arrayFlag
+	var mapToArrayFlags arrayFlag
 	var renameKeyDepthFlags arrayFlag
 	var maskValFlags arrayFlag
 	var condReplaceFlags arrayFlag
+	var trimValFlags arrayFlag
+	var lowerValFlags arrayFlag
+	var upperValFlags arrayFlag
+	var titleValFlags arrayFlag
+	var splitValFlags arrayFlag
+	var joinValFlags arrayFlag
+	var encodeValFlags arrayFlag
+	var decodeValFlags arrayFlag
+	var arraySampleFlags arrayFlag
+	var execValFlags arrayFlag
+	var lookupFlags arrayFlag
+	var httpEnrichFlags arrayFlag
+	var scaleNumFlags arrayFlag
+	var parseNumFlags arrayFlag
+	var addFieldFlags arrayFlag
+	var aggregateFlags arrayFlag
+	var stampFlag bool
+	var truncateDepthFlag string
+	var depthRootFlag string
+	var nullsFlag, emptyStringsFlag string
+	var stampPathFlag string
 
 	var strPatternFlag string
 	var noStrPatternFlag string
 	var boundNumFlag string
 	var boundStrLenFlag string
+	var lineageFlag bool
+	var lineageFieldFlag string
+	var configFlag, profileFlag, presetFlag, secretFileFlag, scriptFlag string
+	var setFlags arrayFlag
+	var pluginFlags arrayFlag
+	var keepIfFlag string
+	var normalizeFlag string
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
 
 	// Existing flags
-	flag.IntVar(&filters.MinDepth, "mindepth", 0, "Include only keys at least at depth n")
-	flag.IntVar(&filters.MaxDepth, "maxdepth", 999999, "Include only keys at most at depth n")
-	flag.IntVar(&filters.MinKeyLen, "minkeylen", 0, "Include only keys with at least n characters")
-	flag.IntVar(&filters.MaxKeyLen, "maxkeylen", 999999, "Include only keys with at most n characters")
-	flag.Var(&noValTypeFlags, "novaltype", "Exclude keys with values of the given type")
-
-	var minNumStr, maxNumStr string
-	flag.StringVar(&minNumStr, "minnum", "", "For numeric values, include only if value >= n")
-	flag.StringVar(&maxNumStr, "maxnum", "", "For numeric values, include only if value <= n")
-
-	flag.IntVar(&filters.MinStrLen, "minstrlen", 0, "For string values, include only if length >= n")
-	flag.IntVar(&filters.MaxStrLen, "maxstrlen", 999999, "For string values, include only if length <= n")
-	flag.StringVar(&strPatternFlag, "strpattern", "", "For string values, include only if they match the pattern")
-	flag.StringVar(&noStrPatternFlag, "nostrpattern", "", "Exclude strings matching the pattern")
-	flag.BoolVar(&filters.IgnoreCase, "ignorecase", false, "Make string pattern filters case-insensitive")
+	fs.IntVar(&filters.MinDepth, "mindepth", 0, "Include only keys at least at depth n")
+	fs.IntVar(&filters.MaxDepth, "maxdepth", 999999, "Include only keys at most at depth n")
+	fs.IntVar(&filters.MinKeyLen, "minkeylen", 0, "Include only keys with at least n characters")
+	fs.IntVar(&filters.MaxKeyLen, "maxkeylen", 999999, "Include only keys with at most n characters")
+	fs.Var(&noValTypeFlags, "novaltype", "Exclude keys with values of the given type")
+	fs.Var(&dropKeyFlags, "dropkey", "Exclude keys matching the name; * and ? are wildcards")
+	fs.Var(&hasKeyFlags, "haskey", "Keep only the object array elements with a field matching the name (can be repeated)")
+	fs.Var(&notHasKeyFlags, "nothaskey", "Keep only the object array elements without a field matching the name (can be repeated)")
+	fs.Var(&whereFlags, "where", "Keep only the object array elements whose field equals the value, as field=value (can be repeated)")
+	fs.Func("match-mode", "What happens to objects and arrays failing the filters: strict drops them whole, ancestors keeps them for whatever inside passes", func(mode string) error {
+		return setMatchMode(&filters, mode)
+	})
+	fs.BoolVar(&filters.IgnoreKeyCase, "ignorekeycase", false, "Match key names in key-based rules and filters case-insensitively")
+
+	var minNumStr, maxNumStr, boolValStr string
+	fs.StringVar(&minNumStr, "minnum", "", "For numeric values, include only if value >= n")
+	fs.StringVar(&maxNumStr, "maxnum", "", "For numeric values, include only if value <= n")
+	fs.StringVar(&boolValStr, "boolval", "", "For boolean values, include only if value is true or false")
+
+	fs.IntVar(&filters.MinStrLen, "minstrlen", 0, "For string values, include only if length >= n")
+	fs.IntVar(&filters.MaxStrLen, "maxstrlen", 999999, "For string values, include only if length <= n")
+	fs.StringVar(&strPatternFlag, "strpattern", "", "For string values, include only if they match the pattern")
+	fs.StringVar(&noStrPatternFlag, "nostrpattern", "", "Exclude strings matching the pattern")
+	fs.BoolVar(&filters.IgnoreCase, "ignorecase", false, "Make string pattern filters case-insensitive")
+	fs.StringVar(&filters.LenUnit, "lenunit", "bytes", "Count string lengths in bytes or runes (Unicode code points)")
+	fs.BoolVar(&filters.Invert, "invert", false, "Output only what the filters would remove, e.g. to find sensitive data")
+	fs.StringVar(&keepIfFlag, "keepif", "", "Include only key-value pairs matching a boolean expression, e.g. (type==string AND len>5) OR depth==1")
 
 	// New transformation flags
-	flag.Var(&replaceValFlags, "replaceval", "Replace string values matching pattern with replacement")
-	flag.Var(&replaceKeyFlags, "replacekey", "Replace key names matching pattern with replacement")
-	flag.StringVar(&boundNumFlag, "boundnum", "", "Bound numeric values between min:max")
-	flag.StringVar(&boundStrLenFlag, "boundstrlen", "", "Bound string length between min:max")
-	flag.Var(&defaultValFlags, "defaultval", "Replace null/empty values with default")
-	flag.Var(&arrayFilterFlags, "arrayfilter", "Apply filters to array elements")
-	flag.Var(&renameKeyDepthFlags, "renamekeydepth", "Rename keys at specific depth")
-	flag.Var(&maskValFlags, "maskval", "Mask values matching pattern")
-	flag.Var(&condReplaceFlags, "condreplace", "Conditionally replace values")
-
-	flag.Parse()
+	fs.Var(&replaceValFlags, "replaceval", "Replace string values matching pattern with replacement")
+	fs.Var(&replaceKeyFlags, "replacekey", "Replace key names matching pattern with replacement")
+	fs.StringVar(&boundNumFlag, "boundnum", "", "Bound numeric values between min:max, clamping them unless a policy is given (min:max[:policy=clamp|drop|null|error])")
+	fs.StringVar(&boundStrLenFlag, "boundstrlen", "", "Bound string length between min:max, padding and truncating as the options say (min:max[:padchar=c][:side=left|right|both][:ellipsis=true][:policy=clamp|drop|null|error])")
+	fs.Var(&defaultValFlags, "defaultval", "Replace null/empty values with default")
+	fs.StringVar(&nullsFlag, "nulls", "", "What to do with null values after all transformations: drop, keep or default:<value>")
+	fs.StringVar(&transforms.NonFinite, "nonfinite", "", "What to do with NaN and infinite numbers: drop, null, clamp or error")
+	fs.StringVar(&emptyStringsFlag, "emptystrings", "", "What to do with empty string values after all transformations: drop, keep or default:<value>")
+	fs.Var(&arrayFilterFlags, "arrayfilter", "Apply filters to array elements")
+	fs.Var(&arrayWhereFlags, "arraywhere", "Keep only array elements whose field matches a condition (key:field op value)")
+	fs.Var(&arrayUniqueByFlags, "arrayuniqueby", "Keep only the first array element per distinct field value (key:field)")
+	fs.Var(&arrayFlattenFlags, "arrayflatten", "Flatten nested arrays of matching keys up to a depth, 1 by default (key[:depth])")
+	fs.Var(&arraySampleFlags, "arraysample", "Keep a random sample of the elements of arrays under matching keys (key:n or key:n%)")
+	fs.Func("seed", "Seed for -arraysample, to draw the same sample on every run", setSampleSeed)
+	fs.Var(&arrayToMapFlags, "arraytomap", "Turn an array of objects into an object keyed by a field (key:field)")
+	fs.Var(&pseudonymizeFlags, "pseudonymize", "Replace strings with consistent fake values of a kind: name, first, last, email, phone or username (key[:kind])")
+	fs.StringVar(&transforms.PseudonymSalt, "pseudonymize-salt", "", "Secret salt of -pseudonymize; the same salt gives the same fake values")
+	fs.Var(&arrayIntersectFlags, "arrayintersect", "Keep the array elements in a JSON list, objects matched by a field (key:file[:field])")
+	fs.Var(&arraySubtractFlags, "arraysubtract", "Remove the array elements in a JSON list, objects matched by a field (key:file[:field])")
+	fs.Var(&joinFlags, "join", "Left-join the object elements of an array with the records of a JSON file (key:with=file:on=field[:as=name])")
+	fs.Var(&groupByFlags, "groupby", "Group an array of objects into an object of arrays keyed by a field, optionally with counts (key:by=field[:counts])")
+	fs.Var(&mapToArrayFlags, "maptoarray", "Turn an object of objects into an array, storing each key in a field (key:field)")
+	fs.Var(&renameKeyDepthFlags, "renamekeydepth", "Prefix keys at a depth or range of depths (depth:prefix, e.g. 2-4:sub_)")
+	fs.StringVar(&transforms.ExtJSON, "extjson", "", "Unwrap MongoDB Extended JSON values such as {\"$oid\": ...} for the rules, writing them plain or canonical")
+	fs.StringVar(&transforms.TFSensitive, "tfsensitive", "", "Replace with this mask the attributes that Terraform state instances list in their sensitive_attributes")
+	fs.IntVar(&transforms.Deref, "deref", 0, "Resolve internal $ref references inline before filtering, expanding at most n levels of them (0 to leave them)")
+	fs.StringVar(&depthRootFlag, "depthroot", "", "Count depths from the subtree at this path, e.g. $.payload, leaving the rest out of depth filters")
+	fs.StringVar(&truncateDepthFlag, "truncate-depth", "", "Replace objects and arrays with members deeper than n with a placeholder (n[:placeholder])")
+	fs.Var(&maskValFlags, "maskval", "Mask values matching pattern")
+	fs.Var(&condReplaceFlags, "condreplace", "Conditionally replace values")
+	fs.StringVar(&normalizeFlag, "normalize", "", "Unicode-normalize string values to nfc or nfkc")
+	fs.BoolVar(&transforms.NormalizeKeys, "normalizekeys", false, "Also normalize keys with the -normalize form")
+	fs.BoolVar(&transforms.Trim, "trim", false, "Trim surrounding whitespace from all string values")
+	fs.Var(&trimValFlags, "trimval", "Trim surrounding whitespace from string values of matching keys")
+	fs.Var(&lowerValFlags, "lowerval", "Lowercase string values of matching keys")
+	fs.Var(&upperValFlags, "upperval", "Uppercase string values of matching keys")
+	fs.Var(&titleValFlags, "titleval", "Title-case string values of matching keys")
+	fs.Var(&splitValFlags, "splitval", "Split string values of matching keys into arrays (key:delimiter)")
+	fs.Var(&joinValFlags, "joinval", "Join array values of matching keys into strings (key:delimiter)")
+	fs.Var(&encodeValFlags, "encodeval", "Encode values of matching keys after processing (key:base64|url)")
+	fs.Var(&decodeValFlags, "decodeval", "Decode values of matching keys, optionally parsing JSON (key:base64|url[:json])")
+	fs.Var(&execValFlags, "execval", "Pipe values of matching keys through an external command (key:command args)")
+	fs.Var(&lookupFlags, "lookup", "Substitute values of matching keys from a CSV or JSON table (key:file:from:to[:keep|null|error])")
+	fs.Var(&parseNumFlags, "parsenum", "Convert numeric strings of matching keys, such as 1.234,56 for de, into numbers (key[:en|de|fr|ch|in])")
+	fs.Var(&scaleNumFlags, "scalenum", "Multiply, divide, add to or subtract from numbers of matching keys, e.g. for unit conversions (key:*0.001, key:+273.15)")
+	fs.Var(&httpEnrichFlags, "httpenrich", "Insert the JSON response for values of matching keys under a sibling key (key:into:url with {value})")
+	fs.Var(&addFieldFlags, "addfield", "Set a field in every output record; {{uuid}} and {{now}} are replaced ($.path:value)")
+	fs.Var(&aggregateFlags, "aggregate", "Set a field in every output record to the sum, avg, min, max or count of values in it (field=func(path), e.g. total=sum(items[*].price))")
+	fs.BoolVar(&stampFlag, "stamp", false, "Add a provenance object with version, ruleset hash, timestamp and rule counts to the output")
+	fs.StringVar(&stampPathFlag, "stamppath", "$._filtering", "Path of the -stamp object in each output record")
+	fs.BoolVar(&lineageFlag, "lineage", false, "Tag each record with a lineage ID derived from source file and offset")
+	fs.StringVar(&lineageFieldFlag, "lineagefield", "", "Use this existing field as the lineage ID when present")
+	fs.StringVar(&configFlag, "config", "", "Load options and rules from a JSON config file")
+	fs.StringVar(&profileFlag, "profile", "", "Apply the named profile of the config file")
+	fs.StringVar(&presetFlag, "preset", "", "Apply a built-in ruleset, underneath any -config file: "+strings.Join(presetNames(), ", "))
+	fs.StringVar(&scriptFlag, "script", "", "Call the transform function of a Starlark script for every key-value pair")
+	fs.Var(&pluginFlags, "plugin", "Load a custom transformation from a Go plugin (.so) file")
+	fs.StringVar(&secretFileFlag, "secret-file", "", "File of NAME=value secrets for ${NAME} references in the config file")
+	fs.Var(&setFlags, "set", "Set a config file var for ${name} references, as name=value (can be repeated)")
+	fs.Func("codec", "JSON codec for input and output: "+strings.Join(codecNames(), ", "), setCodec)
+	fs.Func("detect-dupes", "Report duplicate keys in JSON input, which are otherwise silently collapsed: warn or error", setDetectDupes)
+
+	// The flags defined so far make up the ruleset, apart from those naming
+	// where it comes from or how the output is stamped
+	ruleFlags := make(map[string]bool)
+	fs.VisitAll(func(f *flag.Flag) {
+		switch f.Name {
+		case "config", "profile", "preset", "secret-file", "set", "stamp", "stamppath", "codec", "detect-dupes", "pseudonymize-salt":
+		default:
+			ruleFlags[f.Name] = true
+		}
+	})
+
+	for _, r := range register {
+		r(fs)
+	}
+
+	fs.Parse(arguments)
+
+	// Options from the config file apply unless set on the command line
+	var config *Config
+	configName := "config file " + configFlag
+	var builtin *Config
+	if presetFlag != "" && preset == nil {
+		var err error
+		if builtin, err = loadPreset(presetFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+	}
+	if preset != nil {
+		if configFlag != "" || profileFlag != "" || presetFlag != "" || secretFileFlag != "" || len(setFlags) > 0 {
+			fmt.Fprintf(os.Stderr, "%s: -config, -profile, -preset, -secret-file and -set cannot be set in a stage\n", name)
+			os.Exit(2)
+		}
+		config, configName = preset, name
+		if err := config.applyOptions(fs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in %s: %v\n", name, err)
+			os.Exit(2)
+		}
+	} else if configFlag != "" {
+		var err error
+		if config, err = loadConfig(configFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		// The config file is layered over the preset, as over an include
+		if builtin != nil {
+			config = builtin.layer(config)
+		}
+		if config, err = config.withProfile(profileFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in config file %s: %v\n", configFlag, err)
+			os.Exit(2)
+		}
+		var secrets map[string]string
+		if secretFileFlag != "" {
+			if secrets, err = loadSecrets(secretFileFlag); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(2)
+			}
+		}
+		setVars, err := parseSetVars(setFlags)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -set %v\n", err)
+			os.Exit(2)
+		}
+		if err := config.interpolate(config.varLookup(setVars, secretLookup(secrets))); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in config file %s: %v\n", configFlag, err)
+			os.Exit(2)
+		}
+		if err := config.applyOptions(fs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in config file %s: %v\n", configFlag, err)
+			os.Exit(2)
+		}
+	} else if profileFlag != "" || secretFileFlag != "" || len(setFlags) > 0 {
+		fmt.Fprintf(os.Stderr, "-profile, -secret-file and -set require -config\n")
+		os.Exit(2)
+	} else if builtin != nil {
+		config, configName = builtin, "preset "+presetFlag
+		if err := config.applyOptions(fs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in %s: %v\n", configName, err)
+			os.Exit(2)
+		}
+	}
 
 	// Parse existing filters
 	if minNumStr != "" {
@@ -130,6 +846,14 @@ func main() {
 			filters.MaxNum = &val
 		}
 	}
+	if boolValStr != "" {
+		val, err := strconv.ParseBool(boolValStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -boolval %q: must be true or false\n", boolValStr)
+			os.Exit(2)
+		}
+		filters.BoolVal = &val
+	}
 
 	if strPatternFlag != "" {
 		filters.StrPattern = strings.Split(strPatternFlag, ",")
@@ -138,63 +862,318 @@ func main() {
 		filters.NoStrPattern = strings.Split(noStrPatternFlag, ",")
 	}
 	filters.NoValTypes = []string(noValTypeFlags)
+	filters.DropKeys = []string(dropKeyFlags)
+	filters.HasKeys = []string(hasKeyFlags)
+	filters.NotHasKeys = []string(notHasKeyFlags)
+	where, err := parseWhereClauses(whereFlags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -where %v\n", err)
+		os.Exit(2)
+	}
+	filters.Where = where
+	transforms.IgnoreKeyCase = filters.IgnoreKeyCase
+	if filters.LenUnit != "bytes" && filters.LenUnit != "runes" {
+		fmt.Fprintf(os.Stderr, "Invalid -lenunit %q: must be bytes or runes\n", filters.LenUnit)
+		os.Exit(2)
+	}
+	transforms.LenUnit = filters.LenUnit
+	if keepIfFlag != "" {
+		expr, err := parseFilterExpr(keepIfFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -keepif expression: %v\n", err)
+			os.Exit(2)
+		}
+		filters.KeepIf = expr
+	}
 
 	// Parse transformations
 	transforms.ReplaceVal = parseReplaceRules(replaceValFlags)
 	transforms.ReplaceKey = parseReplaceRules(replaceKeyFlags)
 
 	if boundNumFlag != "" {
-		transforms.BoundNum = parseBoundRule(boundNumFlag)
+		bound, err := parseBoundRule(boundNumFlag, false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -boundnum %v\n", err)
+			os.Exit(2)
+		}
+		transforms.BoundNum = bound
 	}
 	if boundStrLenFlag != "" {
-		transforms.BoundStrLen = parseBoundRule(boundStrLenFlag)
+		bound, err := parseBoundRule(boundStrLenFlag, true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -boundstrlen %v\n", err)
+			os.Exit(2)
+		}
+		transforms.BoundStrLen = bound
 	}
 
 	transforms.DefaultVal = parseDefaultRules(defaultValFlags)
-	transforms.ArrayFilter = parseArrayFilterRules(arrayFilterFlags)
+	for _, policy := range []struct {
+		name, flag string
+		target     **ValuePolicy
+	}{
+		{"nulls", nullsFlag, &transforms.Nulls},
+		{"emptystrings", emptyStringsFlag, &transforms.EmptyStrings},
+	} {
+		if policy.flag == "" {
+			continue
+		}
+		p, err := parseValuePolicy(policy.flag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -%s %v\n", policy.name, err)
+			os.Exit(2)
+		}
+		*policy.target = p
+	}
+	if transforms.ExtJSON != "" && !containsString(extJSONModes, transforms.ExtJSON) {
+		fmt.Fprintf(os.Stderr, "Invalid -extjson %q: must be one of %s\n", transforms.ExtJSON, strings.Join(extJSONModes, ", "))
+		os.Exit(2)
+	}
+	if transforms.NonFinite != "" && !containsString(nonFiniteActions, transforms.NonFinite) {
+		fmt.Fprintf(os.Stderr, "Invalid -nonfinite %q: must be one of %s\n", transforms.NonFinite, strings.Join(nonFiniteActions, ", "))
+		os.Exit(2)
+	}
+	arrayFilters, err := parseArrayFilterRules(arrayFilterFlags, filters.LenUnit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -arrayfilter %v\n", err)
+		os.Exit(2)
+	}
+	transforms.ArrayFilter = arrayFilters
+	transforms.ArrayWhere = parseArrayWhereRules(arrayWhereFlags)
+	transforms.ArrayUniqueBy = parseFieldRules(arrayUniqueByFlags)
+	transforms.ArrayFlatten = parseFlattenRules(arrayFlattenFlags)
+	samples, err := parseSampleRules(arraySampleFlags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -arraysample %v\n", err)
+		os.Exit(2)
+	}
+	transforms.ArraySample = samples
+	transforms.ArrayToMap = parseFieldRules(arrayToMapFlags)
+	groupRules, err := parseGroupRules(groupByFlags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -groupby %v\n", err)
+		os.Exit(2)
+	}
+	transforms.GroupBy = groupRules
+	joins, err := parseJoinRules(joinFlags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -join %v\n", err)
+		os.Exit(2)
+	}
+	transforms.Join = joins
+	intersects, err := parseSetRules(arrayIntersectFlags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -arrayintersect %v\n", err)
+		os.Exit(2)
+	}
+	transforms.ArrayIntersect = intersects
+	subtracts, err := parseSetRules(arraySubtractFlags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -arraysubtract %v\n", err)
+		os.Exit(2)
+	}
+	transforms.ArraySubtract = subtracts
+	pseudonyms, err := parsePseudonymRules(pseudonymizeFlags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -pseudonymize %v\n", err)
+		os.Exit(2)
+	}
+	transforms.Pseudonymize = pseudonyms
+	transforms.MapToArray = parseFieldRules(mapToArrayFlags)
 	transforms.RenameKeyDepth = parseRenameDepthRules(renameKeyDepthFlags)
+	if truncateDepthFlag != "" {
+		truncate, err := parseTruncateRule(truncateDepthFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -truncate-depth %v\n", err)
+			os.Exit(2)
+		}
+		transforms.Truncate = truncate
+	}
+	if depthRootFlag != "" {
+		root, err := parseFieldPath(depthRootFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -depthroot %v\n", err)
+			os.Exit(2)
+		}
+		transforms.DepthRoot = root
+	}
 	transforms.MaskVal = parseMaskRules(maskValFlags)
 	transforms.CondReplace = parseCondReplaceRules(condReplaceFlags)
+	transforms.StringOps = append(transforms.StringOps, parseStringOpRules(trimValFlags, "trim")...)
+	transforms.StringOps = append(transforms.StringOps, parseStringOpRules(lowerValFlags, "lower")...)
+	transforms.StringOps = append(transforms.StringOps, parseStringOpRules(upperValFlags, "upper")...)
+	transforms.StringOps = append(transforms.StringOps, parseStringOpRules(titleValFlags, "title")...)
+	transforms.SplitVal = parseDelimiterRules(splitValFlags)
+	transforms.JoinVal = parseDelimiterRules(joinValFlags)
+	transforms.EncodeVal = parseCodecRules(encodeValFlags)
+	transforms.DecodeVal = parseCodecRules(decodeValFlags)
+	transforms.ExecVal = parseExecRules(execValFlags)
+	lookups, err := parseLookupRules(lookupFlags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -lookup %v\n", err)
+		os.Exit(2)
+	}
+	transforms.Lookup = lookups
+	httpRules, err := parseHTTPRules(httpEnrichFlags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -httpenrich %v\n", err)
+		os.Exit(2)
+	}
+	transforms.HTTPEnrich = httpRules
+	scaleRules, err := parseScaleRules(scaleNumFlags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -scalenum %v\n", err)
+		os.Exit(2)
+	}
+	transforms.ScaleNum = scaleRules
+	parseNumRules, err := parseParseNumRules(parseNumFlags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -parsenum %v\n", err)
+		os.Exit(2)
+	}
+	transforms.ParseNum = parseNumRules
+	addFields, err := parseAddFieldRules(addFieldFlags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -addfield %v\n", err)
+		os.Exit(2)
+	}
+	transforms.AddFields = addFields
+	aggregates, err := parseAggregateRules(aggregateFlags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -aggregate %v\n", err)
+		os.Exit(2)
+	}
+	transforms.Aggregates = aggregates
 
-	// Get input and output file names
-	args := flag.Args()
-	if len(args) != 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] input.json output.json\n", os.Args[0])
-		os.Exit(1)
+	switch normalizeFlag {
+	case "", "nfc", "nfkc":
+		transforms.Normalize = normalizeFlag
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid -normalize %q: must be nfc or nfkc\n", normalizeFlag)
+		os.Exit(2)
 	}
 
-	inputFile := args[0]
-	outputFile := args[1]
+	if lineageFlag || lineageFieldFlag != "" {
+		transforms.Lineage = &LineageRule{Field: lineageFieldFlag}
+	}
+
+	for _, filename := range pluginFlags {
+		p, err := loadPlugin(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		transforms.Plugins = append(transforms.Plugins, p)
+	}
+	if scriptFlag != "" {
+		script, err := loadScript(scriptFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		transforms.Script = script
+	}
+
+	if config != nil {
+		if err := config.applyRules(&transforms); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in %s: %v\n", configName, err)
+			os.Exit(2)
+		}
+		if err := setPatterns(&filters, &transforms, config.Patterns); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in %s: %v\n", configName, err)
+			os.Exit(2)
+		}
+	}
+	if err := extractPointerRules(&filters, &transforms); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid %v\n", err)
+		os.Exit(2)
+	}
+	if config != nil {
+		for _, stage := range config.Stages {
+			stageName := fmt.Sprintf("stage %q of %s", stage.Name, configName)
+			f, t, _ := parseRuleset(stageName, nil, &Config{Options: stage.Options, Rules: stage.Rules, Patterns: config.Patterns})
+			pipeline, err := NewPipeline(f, t)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error in %s: %v\n", stageName, err)
+				os.Exit(2)
+			}
+			transforms.Stages = append(transforms.Stages, pipeline)
+		}
+	}
+
+	if stampFlag {
+		path, err := parseFieldPath(stampPathFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -stamppath %q: %v\n", stampPathFlag, err)
+			os.Exit(2)
+		}
+		transforms.Stamp = &StampRule{Path: path, RulesetHash: rulesetHash(fs, ruleFlags, config)}
+	}
+
+	return &filters, &transforms, fs.Args()
+}
 
-	// Read input JSON
-	data, err := os.ReadFile(inputFile)
+// readJSON reads and decodes a JSON document from the given file.
+func readJSON(filename string) (interface{}, error) {
+	data, err := os.ReadFile(filename)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading input file: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("Error reading input file: %v", err)
 	}
+	return decodeJSON(data, filename)
+}
 
+// decodeJSON decodes a JSON document read from the given file.
+func decodeJSON(data []byte, filename string) (interface{}, error) {
 	var jsonData interface{}
-	if err := json.Unmarshal(data, &jsonData); err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing JSON: %v\n", err)
-		os.Exit(1)
+	if err := codec.Unmarshal(data, &jsonData); err != nil {
+		return nil, jsonParseError(data, "JSON in "+filename, err)
+	}
+	if err := checkDuplicateKeys(data, filename); err != nil {
+		return nil, err
 	}
+	return jsonData, nil
+}
 
-	// Apply transformations and filters
-	result := processJSON(jsonData, &filters, &transforms, 1)
+// exitInterrupted is the exit status of a run stopped by SIGINT or SIGTERM.
+const exitInterrupted = 130
 
-	// Write output JSON
-	output, err := json.MarshalIndent(result, "", "  ")
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error marshaling JSON: %v\n", err)
+// exitOnProcessError exits if processing stopped: on the -timeout, on SIGINT
+// or SIGTERM, or with the error of a rule.
+func exitOnProcessError(err error, limits *Limits) {
+	if err == context.DeadlineExceeded {
+		fmt.Fprintf(os.Stderr, "Processing timed out after %v; no output written\n", limits.Timeout)
+		os.Exit(1)
+	} else if err == context.Canceled {
+		fmt.Fprintf(os.Stderr, "Interrupted; no output written\n")
+		os.Exit(exitInterrupted)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
+}
 
-	if err := os.WriteFile(outputFile, output, 0644); err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing output file: %v\n", err)
-		os.Exit(1)
+// writeFileAtomic writes data to a temporary file next to filename and then
+// renames it into place, so that an interrupted run never leaves a truncated
+// output file behind.
+func writeFileAtomic(filename string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
 	}
+	defer os.Remove(tmp.Name())
 
-	fmt.Printf("Processed JSON written to %s\n", outputFile)
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
 }
 
 // Custom flag type for handling multiple flags
@@ -209,9 +1188,71 @@ func (a *arrayFlag) Set(value string) error {
 	return nil
 }
 
+// parseRuleFields parses the alternative name=value form of a rule flag, e.g.
+// "under=billing key=number mask=****". Fields are separated by spaces and
+// values may be double-quoted. It reports false unless every field is one of
+// names, so that the usual colon syntax is left alone.
+func parseRuleFields(flag string, names ...string) (map[string]string, bool) {
+	var tokens []string
+	var current strings.Builder
+	inQuotes := false
+	for _, r := range flag {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			current.WriteRune(r)
+		case r == ' ' && !inQuotes:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	if len(tokens) == 0 {
+		return nil, false
+	}
+
+	fields := make(map[string]string)
+	for _, token := range tokens {
+		name, value, ok := strings.Cut(token, "=")
+		if !ok || !containsString(names, name) {
+			return nil, false
+		}
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+		}
+		fields[name] = value
+	}
+	return fields, true
+}
+
+func containsString(list []string, str string) bool {
+	for _, item := range list {
+		if item == str {
+			return true
+		}
+	}
+	return false
+}
+
 func parseReplaceRules(flags []string) []ReplaceRule {
 	var rules []ReplaceRule
 	for _, flag := range flags {
+		if fields, ok := parseRuleFields(flag, "pattern", "replacement", "under"); ok {
+			rules = append(rules, ReplaceRule{
+				Pattern:     fields["pattern"],
+				Replacement: fields["replacement"],
+				RuleOptions: RuleOptions{Under: fields["under"]},
+			})
+			continue
+		}
 		parts := strings.SplitN(flag, ":", 2)
 		if len(parts) == 2 {
 			rules = append(rules, ReplaceRule{
@@ -223,21 +1264,48 @@ func parseReplaceRules(flags []string) []ReplaceRule {
 	return rules
 }
 
-func parseBoundRule(flag string) *BoundRule {
-	parts := strings.SplitN(flag, ":", 2)
-	if len(parts) == 2 {
-		min, err1 := strconv.ParseFloat(parts[0], 64)
-		max, err2 := strconv.ParseFloat(parts[1], 64)
-		if err1 == nil && err2 == nil {
-			return &BoundRule{Min: min, Max: max}
+// parseBoundRule parses a min:max bound, followed by a policy=name option
+// and, for string lengths, the padding options, e.g. 4:8:padchar=0:side=left.
+func parseBoundRule(flag string, forStrings bool) (*BoundRule, error) {
+	parts := strings.Split(flag, ":")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("%q: must be min:max", flag)
+	}
+	min, err1 := strconv.ParseFloat(parts[0], 64)
+	max, err2 := strconv.ParseFloat(parts[1], 64)
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("%q: min and max must be numbers", flag)
+	}
+	rule := &BoundRule{Min: min, Max: max}
+	for _, option := range parts[2:] {
+		if policy, ok := strings.CutPrefix(option, "policy="); ok {
+			if !containsString(boundPolicies, policy) {
+				return nil, fmt.Errorf("%q: policy must be one of %s", flag, strings.Join(boundPolicies, ", "))
+			}
+			rule.Policy = policy
+			continue
+		}
+		if !forStrings {
+			return nil, fmt.Errorf("%q: unknown option %q", flag, option)
+		}
+		if err := rule.setStringOption(option); err != nil {
+			return nil, fmt.Errorf("%q: %v", flag, err)
 		}
 	}
-	return nil
+	return rule, nil
 }
 
 func parseDefaultRules(flags []string) []DefaultRule {
 	var rules []DefaultRule
 	for _, flag := range flags {
+		if fields, ok := parseRuleFields(flag, "type", "value", "under"); ok {
+			rules = append(rules, DefaultRule{
+				Type:        fields["type"],
+				Value:       parseValue(fields["value"]),
+				RuleOptions: RuleOptions{Under: fields["under"]},
+			})
+			continue
+		}
 		parts := strings.SplitN(flag, ":", 2)
 		if len(parts) == 2 {
 			value := parseValue(parts[1])
@@ -250,308 +1318,1543 @@ func parseDefaultRules(flags []string) []DefaultRule {
 	return rules
 }
 
-func parseArrayFilterRules(flags []string) []ArrayFilterRule {
+func parseArrayFilterRules(flags []string, lenUnit string) ([]ArrayFilterRule, error) {
 	var rules []ArrayFilterRule
 	for _, flag := range flags {
 		parts := strings.SplitN(flag, ":", 2)
 		if len(parts) == 2 {
+			filters, field, err := parseElementFilter(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("%q: %v", flag, err)
+			}
+			filters.LenUnit = lenUnit
 			rules = append(rules, ArrayFilterRule{
-				Type:   parts[0],
-				Filter: parts[1],
+				Type:    parts[0],
+				Filter:  parts[1],
+				filters: filters,
+				field:   field,
 			})
 		}
 	}
-	return rules
+	return rules, nil
 }
 
-func parseRenameDepthRules(flags []string) []RenameDepthRule {
-	var rules []RenameDepthRule
+// parseElementFilter parses the filter of an array filter rule. It accepts
+// the value filter flags, plus -field to select the field of object elements
+// the filters are applied to.
+func parseElementFilter(filter string) (*Filters, string, error) {
+	filters := &Filters{}
+	var noValTypes arrayFlag
+	var strPattern, noStrPattern, field string
+
+	fs := flag.NewFlagSet("arrayfilter", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Func("minnum", "", func(s string) error {
+		val, err := strconv.ParseFloat(s, 64)
+		filters.MinNum = &val
+		return err
+	})
+	fs.Func("maxnum", "", func(s string) error {
+		val, err := strconv.ParseFloat(s, 64)
+		filters.MaxNum = &val
+		return err
+	})
+	fs.Func("boolval", "", func(s string) error {
+		val, err := strconv.ParseBool(s)
+		filters.BoolVal = &val
+		return err
+	})
+	fs.IntVar(&filters.MinStrLen, "minstrlen", 0, "")
+	fs.IntVar(&filters.MaxStrLen, "maxstrlen", 999999, "")
+	fs.StringVar(&strPattern, "strpattern", "", "")
+	fs.StringVar(&noStrPattern, "nostrpattern", "", "")
+	fs.Var(&noValTypes, "novaltype", "")
+	fs.BoolVar(&filters.IgnoreCase, "ignorecase", false, "")
+	fs.StringVar(&field, "field", "", "")
+
+	if err := fs.Parse(splitArgs(filter)); err != nil {
+		return nil, "", err
+	}
+	if fs.NArg() > 0 {
+		return nil, "", fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	if strPattern != "" {
+		filters.StrPattern = strings.Split(strPattern, ",")
+	}
+	if noStrPattern != "" {
+		filters.NoStrPattern = strings.Split(noStrPattern, ",")
+	}
+	filters.NoValTypes = []string(noValTypes)
+	return filters, field, nil
+}
+
+// splitArgs splits a string into arguments at spaces. Double quotes group
+// words into a single argument and are removed.
+func splitArgs(str string) []string {
+	var args []string
+	var current strings.Builder
+	inQuotes, started := false, false
+	for _, r := range str {
+		switch {
+		case r == '"':
+			inQuotes, started = !inQuotes, true
+		case unicode.IsSpace(r) && !inQuotes:
+			if started {
+				args = append(args, current.String())
+				current.Reset()
+				started = false
+			}
+		default:
+			current.WriteRune(r)
+			started = true
+		}
+	}
+	if started {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+func parseArrayWhereRules(flags []string) []ArrayWhereRule {
+	var rules []ArrayWhereRule
 	for _, flag := range flags {
+		if fields, ok := parseRuleFields(flag, "key", "where", "under"); ok {
+			rules = append(rules, ArrayWhereRule{
+				Pattern:     fields["key"],
+				Condition:   fields["where"],
+				RuleOptions: RuleOptions{Under: fields["under"]},
+			})
+			continue
+		}
 		parts := strings.SplitN(flag, ":", 2)
 		if len(parts) == 2 {
-			depth, err := strconv.Atoi(parts[0])
+			rules = append(rules, ArrayWhereRule{
+				Pattern:   parts[0],
+				Condition: parts[1],
+			})
+		}
+	}
+	return rules
+}
+
+func parseFieldRules(flags []string) []FieldRule {
+	var rules []FieldRule
+	for _, flag := range flags {
+		if fields, ok := parseRuleFields(flag, "key", "field", "under"); ok {
+			rules = append(rules, FieldRule{
+				Pattern:     fields["key"],
+				Field:       fields["field"],
+				RuleOptions: RuleOptions{Under: fields["under"]},
+			})
+			continue
+		}
+		parts := strings.SplitN(flag, ":", 2)
+		if len(parts) == 2 {
+			rules = append(rules, FieldRule{
+				Pattern: parts[0],
+				Field:   parts[1],
+			})
+		}
+	}
+	return rules
+}
+
+func parseFlattenRules(flags []string) []FlattenRule {
+	var rules []FlattenRule
+	for _, flag := range flags {
+		rule := FlattenRule{Pattern: flag, Depth: 1}
+		if fields, ok := parseRuleFields(flag, "key", "depth", "under"); ok {
+			rule = FlattenRule{Pattern: fields["key"], Depth: 1, RuleOptions: RuleOptions{Under: fields["under"]}}
+			if depth, err := strconv.Atoi(fields["depth"]); err == nil {
+				rule.Depth = depth
+			}
+		} else if i := strings.LastIndex(flag, ":"); i >= 0 {
+			if depth, err := strconv.Atoi(flag[i+1:]); err == nil {
+				rule.Pattern, rule.Depth = flag[:i], depth
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func parseRenameDepthRules(flags []string) []RenameDepthRule {
+	var rules []RenameDepthRule
+	for _, flag := range flags {
+		if fields, ok := parseRuleFields(flag, "depth", "prefix", "suffix", "key", "under"); ok {
+			if depth, maxDepth, err := parseDepthRange(fields["depth"]); err == nil {
+				rules = append(rules, RenameDepthRule{
+					Depth:       depth,
+					MaxDepth:    maxDepth,
+					Prefix:      fields["prefix"],
+					Suffix:      fields["suffix"],
+					Key:         fields["key"],
+					RuleOptions: RuleOptions{Under: fields["under"]},
+				})
+			}
+			continue
+		}
+		parts := strings.SplitN(flag, ":", 2)
+		if len(parts) == 2 {
+			depth, maxDepth, err := parseDepthRange(parts[0])
 			if err == nil {
 				rules = append(rules, RenameDepthRule{
-					Depth:  depth,
-					Prefix: parts[1],
+					Depth:    depth,
+					MaxDepth: maxDepth,
+					Prefix:   parts[1],
 				})
 			}
 		}
 	}
-	return rules
-}
+	return rules
+}
+
+func parseMaskRules(flags []string) []MaskRule {
+	var rules []MaskRule
+	for _, flag := range flags {
+		if fields, ok := parseRuleFields(flag, "key", "mask", "mode", "strategy", "deep", "value", "under"); ok {
+			rule := MaskRule{
+				Pattern:     fields["key"],
+				Mask:        fields["mask"],
+				Mode:        fields["mode"],
+				Deep:        fields["deep"] == "true",
+				Value:       fields["value"],
+				RuleOptions: RuleOptions{Under: fields["under"]},
+			}
+			// A rule for values of a pattern applies to any key by default
+			if _, ok := fields["key"]; !ok && rule.Value != "" {
+				rule.Pattern = "*"
+			}
+			if strategy, ok := fields["strategy"]; ok {
+				rule.Mode, rule.Keep = parseMaskStrategy(strategy)
+			}
+			rules = append(rules, rule)
+			continue
+		}
+		parts := strings.SplitN(flag, ":", 2)
+		if len(parts) == 2 {
+			rule := MaskRule{
+				Pattern: parts[0],
+				Mask:    parts[1],
+			}
+			// A trailing strategy=name, after the mask if any, selects the
+			// mask strategy
+			if i := strings.Index(rule.Mask, "strategy="); i == 0 || (i > 0 && rule.Mask[i-1] == ':') {
+				rule.Mode, rule.Keep = parseMaskStrategy(rule.Mask[i+len("strategy="):])
+				rule.Mask = strings.TrimSuffix(rule.Mask[:i], ":")
+				rules = append(rules, rule)
+				continue
+			}
+			// Trailing :length or :structure select the mask mode and
+			// :deep masks the leaves of objects and arrays
+			for i := strings.LastIndex(rule.Mask, ":"); i >= 0; i = strings.LastIndex(rule.Mask, ":") {
+				option := rule.Mask[i+1:]
+				if option == "length" || option == "structure" {
+					rule.Mode = option
+				} else if option == "deep" {
+					rule.Deep = true
+				} else {
+					break
+				}
+				rule.Mask = rule.Mask[:i]
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func parseCondReplaceRules(flags []string) []CondReplaceRule {
+	var rules []CondReplaceRule
+	for _, flag := range flags {
+		if fields, ok := parseRuleFields(flag, "condition", "replacement", "under"); ok {
+			rules = append(rules, CondReplaceRule{
+				Condition:   fields["condition"],
+				Replacement: parseTypedValue(fields["replacement"]),
+				RuleOptions: RuleOptions{Under: fields["under"]},
+			})
+			continue
+		}
+		parts := strings.SplitN(flag, ":", 2)
+		if len(parts) == 2 {
+			rules = append(rules, CondReplaceRule{
+				Condition:   parts[0],
+				Replacement: parseTypedValue(parts[1]),
+			})
+		}
+	}
+	return rules
+}
+
+func parseStringOpRules(flags []string, op string) []StringOpRule {
+	var rules []StringOpRule
+	for _, flag := range flags {
+		if fields, ok := parseRuleFields(flag, "key", "under"); ok {
+			rules = append(rules, StringOpRule{
+				Pattern:     fields["key"],
+				Op:          op,
+				RuleOptions: RuleOptions{Under: fields["under"]},
+			})
+			continue
+		}
+		if flag != "" {
+			rules = append(rules, StringOpRule{Pattern: flag, Op: op})
+		}
+	}
+	return rules
+}
+
+func parseDelimiterRules(flags []string) []DelimiterRule {
+	var rules []DelimiterRule
+	for _, flag := range flags {
+		if fields, ok := parseRuleFields(flag, "key", "delimiter", "under"); ok {
+			rules = append(rules, DelimiterRule{
+				Pattern:     fields["key"],
+				Delimiter:   fields["delimiter"],
+				RuleOptions: RuleOptions{Under: fields["under"]},
+			})
+			continue
+		}
+		parts := strings.SplitN(flag, ":", 2)
+		if len(parts) == 2 {
+			rules = append(rules, DelimiterRule{
+				Pattern:   parts[0],
+				Delimiter: parts[1],
+			})
+		}
+	}
+	return rules
+}
+
+func parseCodecRules(flags []string) []CodecRule {
+	var rules []CodecRule
+	for _, flag := range flags {
+		if fields, ok := parseRuleFields(flag, "key", "encoding", "json", "under"); ok {
+			rules = append(rules, CodecRule{
+				Pattern:     fields["key"],
+				Encoding:    fields["encoding"],
+				ParseJSON:   fields["json"] == "true",
+				RuleOptions: RuleOptions{Under: fields["under"]},
+			})
+			continue
+		}
+		parts := strings.SplitN(flag, ":", 3)
+		if len(parts) >= 2 && (parts[1] == "base64" || parts[1] == "url") {
+			rules = append(rules, CodecRule{
+				Pattern:   parts[0],
+				Encoding:  parts[1],
+				ParseJSON: len(parts) == 3 && parts[2] == "json",
+			})
+		}
+	}
+	return rules
+}
+
+func parseExecRules(flags []string) []ExecRule {
+	var rules []ExecRule
+	for _, flag := range flags {
+		if fields, ok := parseRuleFields(flag, "key", "command", "under"); ok {
+			rules = append(rules, ExecRule{
+				Pattern:     fields["key"],
+				Command:     fields["command"],
+				RuleOptions: RuleOptions{Under: fields["under"]},
+			})
+			continue
+		}
+		parts := strings.SplitN(flag, ":", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[1]) != "" {
+			rules = append(rules, ExecRule{
+				Pattern: parts[0],
+				Command: parts[1],
+			})
+		}
+	}
+	return rules
+}
+
+func parseValue(str string) interface{} {
+	if str == "null" {
+		return nil
+	}
+	if str == "true" {
+		return true
+	}
+	if str == "false" {
+		return false
+	}
+	if num, err := strconv.ParseFloat(str, 64); err == nil {
+		return num
+	}
+	return str
+}
+
+// parseTypedValue reads a value written as JSON, keeping its declared type:
+// "123" is a string, 123 a number and {"a": 1} an object. Text that is not
+// JSON is read with parseValue, so a bare word is a string.
+func parseTypedValue(str string) interface{} {
+	var value interface{}
+	if err := json.Unmarshal([]byte(str), &value); err == nil {
+		return value
+	}
+	return parseValue(str)
+}
+
+// formatScalar is the inverse of parseValue for strings, numbers, booleans
+// and null. It reports false for objects and arrays.
+func formatScalar(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "null", true
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		return "", false
+	}
+}
+
+// processDocument applies filters and transformations to a whole document
+// read from source, including record-level rules such as lineage tagging.
+func processDocument(data interface{}, source string, filters *Filters, transforms *Transformations) interface{} {
+	withSource := *transforms
+	withSource.source = newSourceInfo(source)
+	transforms = &withSource
+
+	var wrapped map[string]string
+	if transforms.ExtJSON != "" {
+		data, wrapped = unwrapExtJSON(data)
+	}
+	if transforms.Deref > 0 {
+		data = derefDocument(data, transforms.Deref)
+	}
+	if transforms.TFSensitive != "" {
+		data = maskSensitiveAttributes(data, transforms.TFSensitive)
+	}
+	if len(transforms.Pointers) > 0 {
+		data = applyPointerRules(data, transforms.Pointers)
+	}
+
+	var result interface{}
+	switch {
+	case filters.Invert && transforms.Lineage != nil:
+		result = removedRecords(data, source, filters, transforms)
+	case filters.Invert:
+		result = removedDocument(data, filters, transforms)
+	case transforms.Lineage != nil:
+		result = processRecords(data, source, filters, transforms)
+	default:
+		result = processJSON(data, filters, transforms, 1)
+	}
+	for _, stage := range transforms.Stages {
+		stageTransforms := *stage.Transforms
+		stageTransforms.ctx, stageTransforms.cancel = transforms.ctx, transforms.cancel
+		result = processDocument(result, source, stage.Filters, &stageTransforms)
+	}
+	if len(transforms.AddFields) > 0 {
+		result = addFields(result, transforms.AddFields)
+	}
+	if len(transforms.Aggregates) > 0 {
+		result = aggregateFields(result, transforms.Aggregates)
+	}
+	if transforms.Stamp != nil {
+		result = stampDocument(result, transforms.Stamp, transforms)
+	}
+	if transforms.ExtJSON == "canonical" {
+		result = rewrapExtJSON(result, wrapped)
+	}
+	return result
+}
+
+func processJSON(data interface{}, filters *Filters, transforms *Transformations, depth int) interface{} {
+	// First apply any transformations to the data
+	if data == nil {
+		result, _ := transformValue("", data, transforms.scopedTo(nil), depth)
+		return result
+	}
+
+	// Once processing is canceled, the rest of the document is left as is
+	if transforms.ctx != nil && transforms.ctx.Err() != nil {
+		return data
+	}
+
+	// Depths only count from the -depthroot subtree
+	if transforms.aboveDepthRoot() {
+		depth = 0
+	}
+
+	// Subtrees beyond the truncation depth are replaced as a whole
+	if transforms.Truncate.truncates(data, depth) {
+		return transforms.Truncate.Placeholder
+	}
+
+	switch v := data.(type) {
+	case map[string]interface{}:
+		// The result is only allocated once a member changes, so untouched
+		// objects are returned as they are instead of being copied
+		var result map[string]interface{}
+		// renamed holds the keys written by renames, which must not be
+		// dropped when the member originally under that key is
+		var renamed map[string]bool
+
+		// Guarded rules apply to this object's members only if their
+		// condition holds on it
+		scoped := transforms.scopedTo(v)
+
+		// Enriching lookups and HTTP responses add sibling keys, which are
+		// then processed like the others
+		if len(scoped.Lookup)+len(scoped.HTTPEnrich) > 0 {
+			v = enrichObject(v, scoped)
+		}
+
+		// Process each key-value pair
+		for key, value := range v {
+			newKey, newValue, include, final, partial := processMember(key, value, filters, scoped, depth)
+
+			// Values of final rules are kept as the rule left them
+			processedValue := newValue
+			if include && !final {
+				// Recursively process nested structures
+				processedValue = processJSON(newValue, filters, transforms.descend(key), depth+1)
+
+				// A member kept for what passes inside it goes if nothing does
+				if partial && !holdsMember(processedValue) {
+					include = false
+				}
+
+				// Encode values only once their subtree has been processed
+				processedValue = encodeValue(key, processedValue, scoped)
+			}
+			if include && result == nil && newKey == key && sameValue(processedValue, value) {
+				continue // Unchanged so far
+			}
+
+			if result == nil {
+				// Every member seen so far is unchanged, so start from a copy
+				result = make(map[string]interface{}, len(v))
+				for k, item := range v {
+					result[k] = item
+				}
+			}
+			if !renamed[key] {
+				delete(result, key)
+			}
+			if !include {
+				continue // Skip this key-value pair
+			}
+
+			// Add to the result
+			result[newKey] = processedValue
+			if newKey != key {
+				if renamed == nil {
+					renamed = make(map[string]bool)
+				}
+				renamed[newKey] = true
+			}
+		}
+
+		if result == nil {
+			return v
+		}
+		return result
+
+	case []interface{}:
+		var result []interface{}
+		changed := false
+		scoped := transforms.scopedTo(nil)
+
+		// Transform each array element
+		for i, item := range v {
+			processedItem, include, _ := processElement(i, item, filters, transforms, scoped, depth)
+			if !changed {
+				if include && sameValue(processedItem, item) {
+					continue // Unchanged so far
+				}
+				changed = true
+				result = append(result, v[:i]...)
+			}
+			if include {
+				result = append(result, processedItem)
+			}
+		}
+
+		// Empty arrays come out as null, as they always have; sameValue tells
+		// this nil from the empty array so that the parent takes it
+		if !changed && len(v) > 0 {
+			return v
+		}
+		return result
+
+	default:
+		// For primitive values, just apply transformations
+		result, _ := transformValue("", v, transforms.scopedTo(nil), depth)
+		return result
+	}
+}
+
+// processMember transforms a key-value pair of an object whose members scoped
+// applies to and decides whether it passes the filters. The value has not
+// been processed recursively yet; final reports that it must be kept as is,
+// and partial that it is an object or array failing the filters, included
+// in the ancestors match mode for whatever inside it passes.
+func processMember(key string, value interface{}, filters *Filters, scoped *Transformations, depth int) (newKey string, newValue interface{}, include, final, partial bool) {
+	// First apply any key transformations
+	newKey = transformKey(key, scoped, depth)
+
+	// Apply masking and other value transformations
+	newValue, final = transformValueWithKey(key, value, scoped, depth)
+
+	// The script may drop the pair or replace its value
+	keep := true
+	if scoped.Script != nil && !final {
+		var err error
+		if newValue, keep, err = scoped.Script.decide(scoped.memberPath(key), key, newValue, depth); err != nil {
+			scoped.stop(err)
+		}
+	}
+
+	// Then the null and empty string policies
+	if keep && !final {
+		newValue, keep = scoped.applyValuePolicies(newValue)
+	}
+
+	// Check whether this key-value pair passes the key-specific and
+	// value-specific filters and the combined filter expression
+	include = keep && shouldIncludeKey(newKey, filters, depth) &&
+		shouldIncludeValue(newValue, filters) &&
+		(filters.KeepIf == nil || filters.KeepIf.eval(exprEnv{key: newKey, value: newValue, depth: depth, lenUnit: filters.LenUnit}))
+	if !include && keep && !final && filters.retainsAncestor(newKey, newValue) {
+		return newKey, newValue, true, false, true
+	}
+	return newKey, newValue, include, final, false
+}
+
+// processElement fully processes element i of an array and decides whether
+// it is kept. final reports that a final rule replaced the element.
+func processElement(i int, item interface{}, filters *Filters, transforms, scoped *Transformations, depth int) (processed interface{}, include, final bool) {
+	// Transform the item first
+	processed, final = transformValue("", item, scoped, depth)
+
+	// Process it recursively
+	if !final {
+		elem := transforms
+		if transforms.tracksPath() {
+			elem = transforms.withPath(transforms.elementPath(i))
+		}
+		processed = processJSON(processed, filters, elem, depth+1)
+	}
+
+	// Apply the null and empty string policies and array-specific filters
+	include = true
+	if !final {
+		processed, include = scoped.applyValuePolicies(processed)
+	}
+	include = include && shouldIncludeArrayElement(processed, transforms) && filters.keepsElement(processed)
+	return processed, include, final
+}
+
+// sameValue reports whether processing left a value as it was. Objects and
+// arrays are compared by identity, which processJSON preserves for subtrees
+// it did not modify; the nil an empty array is processed into differs from
+// that array.
+func sameValue(a, b interface{}) bool {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		return ok && reflect.ValueOf(x).UnsafePointer() == reflect.ValueOf(y).UnsafePointer()
+	case []interface{}:
+		y, ok := b.([]interface{})
+		return ok && (x == nil) == (y == nil) && len(x) == len(y) && (len(x) == 0 || &x[0] == &y[0])
+	default:
+		// Transformations may produce other types, which need not be
+		// comparable
+		if t := reflect.TypeOf(a); t != nil && !t.Comparable() {
+			return false
+		}
+		return a == b
+	}
+}
+
+// Split filtering into key-specific and value-specific checks
+func shouldIncludeKey(key string, filters *Filters, depth int) bool {
+	// Always include all keys if there are no key-specific filters
+	if filters.MinDepth <= 1 &&
+		filters.MaxDepth >= 999999 &&
+		filters.MinKeyLen <= 0 &&
+		filters.MaxKeyLen >= 999999 &&
+		len(filters.DropKeys) == 0 {
+		return true
+	}
+
+	// Check dropped key names
+	if filters.dropsKey(key) {
+		return false
+	}
+
+	// Check depth, except above and beside the -depthroot subtree
+	if depth > 0 && (depth < filters.MinDepth || depth > filters.MaxDepth) {
+		return false
+	}
+
+	// Check key length
+	keyLen := len(key)
+	if keyLen < filters.MinKeyLen || keyLen > filters.MaxKeyLen {
+		return false
+	}
+
+	return true
+}
+
+func shouldIncludeValue(value interface{}, filters *Filters) bool {
+	// Always include if no value-specific filters are specified
+	if len(filters.NoValTypes) == 0 &&
+		filters.MinNum == nil && filters.MaxNum == nil && filters.BoolVal == nil &&
+		filters.MinStrLen <= 0 && filters.MaxStrLen >= 999999 &&
+		len(filters.StrPattern) == 0 && len(filters.NoStrPattern) == 0 {
+		return true
+	}
+
+	// Check value type filters
+	if len(filters.NoValTypes) > 0 {
+		valueType := getValueType(value)
+		for _, noType := range filters.NoValTypes {
+			if valueType == noType {
+				return false
+			}
+		}
+	}
+
+	// Check numeric value filters
+	if num, ok := value.(float64); ok {
+		if filters.MinNum != nil && num < *filters.MinNum {
+			return false
+		}
+		if filters.MaxNum != nil && num > *filters.MaxNum {
+			return false
+		}
+	}
+
+	// Check boolean value filters
+	if b, ok := value.(bool); ok && filters.BoolVal != nil && b != *filters.BoolVal {
+		return false
+	}
+
+	// Check string value filters - only apply to strings
+	if str, ok := value.(string); ok {
+		strLen := stringLength(str, filters.LenUnit)
+		if strLen < filters.MinStrLen || strLen > filters.MaxStrLen {
+			return false
+		}
+
+		if len(filters.StrPattern) > 0 && !matchesPattern(str, filters.StrPattern, filters.IgnoreCase, filters.Patterns) {
+			return false
+		}
+
+		if len(filters.NoStrPattern) > 0 && matchesPattern(str, filters.NoStrPattern, filters.IgnoreCase, filters.Patterns) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// shouldIncludeArrayElement reports whether element passes every array
+// filter for its type. Elements of other types are always included.
+func shouldIncludeArrayElement(element interface{}, transforms *Transformations) bool {
+	if len(transforms.ArrayFilter) == 0 {
+		return true // No array filters specified, include all elements
+	}
+
+	elementType := getValueType(element)
+	for _, rule := range transforms.ArrayFilter {
+		if elementType != rule.Type {
+			continue
+		}
+
+		filters, field := rule.filters, rule.field
+		if filters == nil {
+			var err error
+			if filters, field, err = parseElementFilter(rule.Filter); err != nil {
+				return false // An invalid filter excludes every element it applies to
+			}
+			filters.LenUnit = transforms.LenUnit
+			filters.Patterns = transforms.Patterns
+		}
+
+		value := element
+		if field != "" {
+			obj, ok := element.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			if value, ok = obj[field]; !ok {
+				return false // A missing field never passes the filter
+			}
+		}
+		if !shouldIncludeValue(value, filters) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Helper function to process nested structures recursively
+func processNestedStructure(data interface{}, filters *Filters, transforms *Transformations, depth int) interface{} {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		// Recursively process the map
+		return processJSON(v, filters, transforms, depth)
+	case []interface{}:
+		// Recursively process the array
+		return processJSON(v, filters, transforms, depth)
+	default:
+		// For primitive values, just return as is
+		return data
+	}
+}
+
+func valueFilteredOut(value interface{}) bool {
+	// Only consider truly empty structures as filtered out
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
+
+// scopedTo returns the transformations that apply to the members of obj.
+// Rules guarded by a when clause are kept only if the condition holds on obj;
+// outside of an object (obj == nil) they never apply. Rules scoped under a key
+// that has not been entered yet are left out.
+func (t *Transformations) scopedTo(obj map[string]interface{}) *Transformations {
+	if !t.hasScopedRules() {
+		return t
+	}
+
+	scoped := *t
+	scoped.ReplaceVal = activeRules(t.ReplaceVal, obj, t.source)
+	scoped.ReplaceKey = activeRules(t.ReplaceKey, obj, t.source)
+	scoped.DefaultVal = activeRules(t.DefaultVal, obj, t.source)
+	scoped.RenameKeyDepth = activeRules(t.RenameKeyDepth, obj, t.source)
+	scoped.MaskVal = activeRules(t.MaskVal, obj, t.source)
+	scoped.CondReplace = activeRules(t.CondReplace, obj, t.source)
+	scoped.StringOps = activeRules(t.StringOps, obj, t.source)
+	scoped.EncodeVal = activeRules(t.EncodeVal, obj, t.source)
+	scoped.DecodeVal = activeRules(t.DecodeVal, obj, t.source)
+	scoped.SplitVal = activeRules(t.SplitVal, obj, t.source)
+	scoped.JoinVal = activeRules(t.JoinVal, obj, t.source)
+	scoped.ArrayWhere = activeRules(t.ArrayWhere, obj, t.source)
+	scoped.ArrayUniqueBy = activeRules(t.ArrayUniqueBy, obj, t.source)
+	scoped.ArrayFlatten = activeRules(t.ArrayFlatten, obj, t.source)
+	scoped.ArraySample = activeRules(t.ArraySample, obj, t.source)
+	scoped.ArrayToMap = activeRules(t.ArrayToMap, obj, t.source)
+	scoped.GroupBy = activeRules(t.GroupBy, obj, t.source)
+	scoped.Join = activeRules(t.Join, obj, t.source)
+	scoped.ArrayIntersect = activeRules(t.ArrayIntersect, obj, t.source)
+	scoped.ArraySubtract = activeRules(t.ArraySubtract, obj, t.source)
+	scoped.Pseudonymize = activeRules(t.Pseudonymize, obj, t.source)
+	scoped.MapToArray = activeRules(t.MapToArray, obj, t.source)
+	scoped.ExecVal = activeRules(t.ExecVal, obj, t.source)
+	scoped.Lookup = activeRules(t.Lookup, obj, t.source)
+	scoped.HTTPEnrich = activeRules(t.HTTPEnrich, obj, t.source)
+	scoped.ScaleNum = activeRules(t.ScaleNum, obj, t.source)
+	scoped.ParseNum = activeRules(t.ParseNum, obj, t.source)
+	return &scoped
+}
+
+// descend returns the transformations for the value of key: rules scoped
+// under key become active for the whole subtree below it.
+func (t *Transformations) descend(key string) *Transformations {
+	if t.aboveDepthRoot() {
+		t = t.descendDepthRoot(key)
+	}
+	if !t.hasScopedRules() {
+		if t.tracksPath() {
+			return t.withPath(t.memberPath(key))
+		}
+		return t
+	}
+
+	scoped := *t
+	if t.tracksPath() {
+		scoped.Path = t.memberPath(key)
+	}
+	scoped.ReplaceVal = descendRules(t.ReplaceVal, key, t.IgnoreKeyCase)
+	scoped.ReplaceKey = descendRules(t.ReplaceKey, key, t.IgnoreKeyCase)
+	scoped.DefaultVal = descendRules(t.DefaultVal, key, t.IgnoreKeyCase)
+	scoped.RenameKeyDepth = descendRules(t.RenameKeyDepth, key, t.IgnoreKeyCase)
+	scoped.MaskVal = descendRules(t.MaskVal, key, t.IgnoreKeyCase)
+	scoped.CondReplace = descendRules(t.CondReplace, key, t.IgnoreKeyCase)
+	scoped.StringOps = descendRules(t.StringOps, key, t.IgnoreKeyCase)
+	scoped.EncodeVal = descendRules(t.EncodeVal, key, t.IgnoreKeyCase)
+	scoped.DecodeVal = descendRules(t.DecodeVal, key, t.IgnoreKeyCase)
+	scoped.SplitVal = descendRules(t.SplitVal, key, t.IgnoreKeyCase)
+	scoped.JoinVal = descendRules(t.JoinVal, key, t.IgnoreKeyCase)
+	scoped.ArrayWhere = descendRules(t.ArrayWhere, key, t.IgnoreKeyCase)
+	scoped.ArrayUniqueBy = descendRules(t.ArrayUniqueBy, key, t.IgnoreKeyCase)
+	scoped.ArrayFlatten = descendRules(t.ArrayFlatten, key, t.IgnoreKeyCase)
+	scoped.ArraySample = descendRules(t.ArraySample, key, t.IgnoreKeyCase)
+	scoped.ArrayToMap = descendRules(t.ArrayToMap, key, t.IgnoreKeyCase)
+	scoped.GroupBy = descendRules(t.GroupBy, key, t.IgnoreKeyCase)
+	scoped.Join = descendRules(t.Join, key, t.IgnoreKeyCase)
+	scoped.ArrayIntersect = descendRules(t.ArrayIntersect, key, t.IgnoreKeyCase)
+	scoped.ArraySubtract = descendRules(t.ArraySubtract, key, t.IgnoreKeyCase)
+	scoped.Pseudonymize = descendRules(t.Pseudonymize, key, t.IgnoreKeyCase)
+	scoped.MapToArray = descendRules(t.MapToArray, key, t.IgnoreKeyCase)
+	scoped.ExecVal = descendRules(t.ExecVal, key, t.IgnoreKeyCase)
+	scoped.Lookup = descendRules(t.Lookup, key, t.IgnoreKeyCase)
+	scoped.HTTPEnrich = descendRules(t.HTTPEnrich, key, t.IgnoreKeyCase)
+	scoped.ScaleNum = descendRules(t.ScaleNum, key, t.IgnoreKeyCase)
+	scoped.ParseNum = descendRules(t.ParseNum, key, t.IgnoreKeyCase)
+	return &scoped
+}
+
+func (t *Transformations) hasScopedRules() bool {
+	return hasScope(t.ReplaceVal) || hasScope(t.ReplaceKey) || hasScope(t.DefaultVal) ||
+		hasScope(t.RenameKeyDepth) || hasScope(t.MaskVal) || hasScope(t.CondReplace) ||
+		hasScope(t.StringOps) || hasScope(t.SplitVal) || hasScope(t.JoinVal) ||
+		hasScope(t.EncodeVal) || hasScope(t.DecodeVal) || hasScope(t.ArrayWhere) ||
+		hasScope(t.ArrayUniqueBy) || hasScope(t.ArrayFlatten) || hasScope(t.ArraySample) || hasScope(t.ArrayToMap) ||
+		hasScope(t.MapToArray) || hasScope(t.ExecVal) || hasScope(t.Lookup) ||
+		hasScope(t.HTTPEnrich) || hasScope(t.ScaleNum) || hasScope(t.ParseNum) ||
+		hasScope(t.GroupBy) || hasScope(t.Join) || hasScope(t.ArrayIntersect) ||
+		hasScope(t.ArraySubtract) || hasScope(t.Pseudonymize)
+}
+
+func (o *RuleOptions) options() *RuleOptions {
+	return o
+}
+
+// sortByPriority orders the rules of each kind by descending priority. Rules
+// of equal priority keep their order: command line flags first, then config
+// rules in file order.
+func (t *Transformations) sortByPriority() {
+	sortRules(t.ReplaceVal)
+	sortRules(t.ReplaceKey)
+	sortRules(t.DefaultVal)
+	sortRules(t.RenameKeyDepth)
+	sortRules(t.MaskVal)
+	sortRules(t.CondReplace)
+	sortRules(t.StringOps)
+	sortRules(t.EncodeVal)
+	sortRules(t.DecodeVal)
+	sortRules(t.SplitVal)
+	sortRules(t.JoinVal)
+	sortRules(t.ArrayWhere)
+	sortRules(t.ArrayUniqueBy)
+	sortRules(t.ArrayFlatten)
+	sortRules(t.ArraySample)
+	sortRules(t.ArrayToMap)
+	sortRules(t.GroupBy)
+	sortRules(t.Join)
+	sortRules(t.ArrayIntersect)
+	sortRules(t.ArraySubtract)
+	sortRules(t.Pseudonymize)
+	sortRules(t.MapToArray)
+	sortRules(t.ExecVal)
+	sortRules(t.Lookup)
+	sortRules(t.HTTPEnrich)
+	sortRules(t.ScaleNum)
+	sortRules(t.ParseNum)
+}
+
+func sortRules[T any, P ruleWithOptions[T]](rules []T) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		return P(&rules[i]).options().Priority > P(&rules[j]).options().Priority
+	})
+}
+
+// ruleWithOptions is satisfied by pointers to the rule types embedding
+// RuleOptions.
+type ruleWithOptions[T any] interface {
+	*T
+	options() *RuleOptions
+}
+
+func hasScope[T any, P ruleWithOptions[T]](rules []T) bool {
+	for i := range rules {
+		if opts := P(&rules[i]).options(); opts.When != "" || opts.Under != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func activeRules[T any, P ruleWithOptions[T]](rules []T, obj map[string]interface{}, source *SourceInfo) []T {
+	var active []T
+	for i := range rules {
+		opts := P(&rules[i]).options()
+		if opts.Under != "" {
+			continue
+		}
+		if opts.When == "" || (obj != nil && evaluateWhen(obj, opts.when, opts.When, source)) {
+			active = append(active, rules[i])
+		}
+	}
+	return active
+}
+
+func descendRules[T any, P ruleWithOptions[T]](rules []T, key string, ignoreCase bool) []T {
+	result := rules
+	copied := false
+	for i := range rules {
+		if under := P(&rules[i]).options().Under; under == "" || !matchKey(under, key, ignoreCase) {
+			continue
+		}
+		// Copy before clearing the scope so the caller's rules are unchanged
+		if !copied {
+			result = append([]T(nil), rules...)
+			copied = true
+		}
+		P(&result[i]).options().Under = ""
+	}
+	return result
+}
+
+// whenClause is a parsed when clause: a comparison applied to a field.
+type whenClause struct {
+	field string
+	c     *comparison
+}
+
+// evaluateWhen evaluates a when clause such as country=="EU" by applying the
+// comparison to the named field of obj: the clause NewPipeline parsed, or
+// else the text parsed on the spot. A missing field compares as null.
+// Fields starting with $ are those of the source file instead.
+func evaluateWhen(obj map[string]interface{}, prepared *whenClause, when string, source *SourceInfo) bool {
+	if prepared == nil {
+		var err error
+		if prepared, err = parseWhen(when); err != nil {
+			return false
+		}
+	}
+	if strings.HasPrefix(prepared.field, "$") {
+		return prepared.c.eval(source.field(prepared.field))
+	}
+	return prepared.c.eval(obj[prepared.field])
+}
+
+// parseWhen splits a when clause into the field name and its comparison.
+func parseWhen(when string) (*whenClause, error) {
+	when = strings.TrimSpace(when)
+	end := strings.IndexAny(when, "=!<> \t")
+	if end <= 0 {
+		return nil, fmt.Errorf("missing field name in %q", when)
+	}
+	c, err := parseComparison(when[end:])
+	if err != nil {
+		return nil, err
+	}
+	return &whenClause{field: when[:end], c: c}, nil
+}
+
+func transformKey(key string, transforms *Transformations, depth int) string {
+	newKey := key
+
+	// Normalize the key before any matching
+	if transforms.NormalizeKeys {
+		newKey = normalizeString(newKey, transforms.Normalize)
+	}
+
+	// Apply key replacements
+	for _, rule := range transforms.ReplaceKey {
+		if matchKey(rule.Pattern, newKey, transforms.IgnoreKeyCase) {
+			newKey = rule.Replacement
+			if rule.Final {
+				return newKey
+			}
+		}
+	}
+
+	// Apply depth-based renaming
+	for _, rule := range transforms.RenameKeyDepth {
+		if rule.renames(newKey, depth) {
+			newKey = rule.Prefix + newKey + rule.Suffix
+			if rule.Final {
+				return newKey
+			}
+		}
+	}
+
+	return newKey
+}
+
+// Function that handles masking and other transformations based on the original key.
+// It also reports whether a final rule matched, in which case the value must
+// not be transformed any further.
+func transformValueWithKey(key string, value interface{}, transforms *Transformations, depth int) (interface{}, bool) {
+	// First apply masking based on key
+	for _, rule := range transforms.MaskVal {
+		if matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) && rule.masksValue(value, transforms.Patterns) {
+			return applyMask(value, rule), rule.Final
+		}
+	}
+
+	// Clean up strings before the other transformations see them
+	if str, ok := value.(string); ok {
+		for _, rule := range transforms.StringOps {
+			if matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+				str = applyStringOp(str, rule.Op)
+				if rule.Final {
+					return str, true
+				}
+			}
+		}
+		value = str
+
+		// Replace personal data with consistent fake values
+		for _, rule := range transforms.Pseudonymize {
+			if matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+				return pseudonymize(str, rule, transforms.PseudonymSalt), rule.Final
+			}
+		}
+
+		// Read numbers written as strings
+		for _, rule := range transforms.ParseNum {
+			if !matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+				continue
+			}
+			if num, ok := parseLocaleNumber(str, rule.Locale); ok {
+				value = num
+				if rule.Final {
+					return value, true
+				}
+			}
+			break
+		}
+	}
+
+	// Pipe values through external commands
+	for _, rule := range transforms.ExecVal {
+		if matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+			var err error
+			if value, err = execValue(transforms.runContext(), value, rule); err != nil {
+				transforms.stop(err)
+			}
+			if rule.Final {
+				return value, true
+			}
+		}
+	}
+
+	// Substitute values from lookup tables
+	for _, rule := range transforms.Lookup {
+		if rule.Into == "" && matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+			var err error
+			if value, err = lookupValue(value, rule); err != nil {
+				transforms.stop(err)
+			}
+			if rule.Final {
+				return value, true
+			}
+			break
+		}
+	}
+
+	// Decode embedded content and convert between delimited strings and arrays
+	var final bool
+	if value, final = decodeValue(key, value, transforms); final {
+		return value, true
+	}
+	if value, final = splitOrJoin(key, value, transforms); final {
+		return value, true
+	}
+
+	// Select the elements of arrays of records and reshape them
+	if value, final = applyArrayRules(key, value, transforms); final {
+		return value, true
+	}
+
+	// Convert the units of numbers
+	for _, rule := range transforms.ScaleNum {
+		if matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+			value = scaleValue(value, rule)
+			if rule.Final {
+				return value, true
+			}
+		}
+	}
 
-func parseMaskRules(flags []string) []MaskRule {
-	var rules []MaskRule
-	for _, flag := range flags {
-		parts := strings.SplitN(flag, ":", 2)
-		if len(parts) == 2 {
-			rules = append(rules, MaskRule{
-				Pattern: parts[0],
-				Mask:    parts[1],
-			})
-		}
+	// Then apply other transformations
+	if value, final = transformValue(key, value, transforms, depth); final {
+		return value, true
 	}
-	return rules
+
+	// Custom transformations see the result of the built-in ones
+	if len(transforms.Plugins) > 0 {
+		value = transforms.applyPlugins(transforms.memberPath(key), key, value)
+	}
+	return value, false
 }
 
-func parseCondReplaceRules(flags []string) []CondReplaceRule {
-	var rules []CondReplaceRule
-	for _, flag := range flags {
-		parts := strings.SplitN(flag, ":", 2)
-		if len(parts) == 2 {
-			rules = append(rules, CondReplaceRule{
-				Condition:   parts[0],
-				Replacement: parseValue(parts[1]),
-			})
+// applyMask returns the masked form of value. Objects and arrays are replaced
+// by the literal mask, or have each of their leaves masked for deep rules.
+func applyMask(value interface{}, rule MaskRule) interface{} {
+	if rule.Deep {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			masked := make(map[string]interface{}, len(v))
+			for key, item := range v {
+				masked[key] = applyMask(item, rule)
+			}
+			return masked
+		case []interface{}:
+			masked := make([]interface{}, len(v))
+			for i, item := range v {
+				masked[i] = applyMask(item, rule)
+			}
+			return masked
 		}
 	}
-	return rules
-}
 
-func parseValue(str string) interface{} {
-	if str == "null" {
+	if rule.Mode == "null" {
 		return nil
 	}
-	if str == "true" {
-		return true
+	str, ok := formatScalar(value)
+	if rule.Mode == "" || !ok || value == nil {
+		return rule.Mask
 	}
-	if str == "false" {
-		return false
+
+	maskRune := '*'
+	if r, size := utf8.DecodeRuneInString(rule.Mask); size > 0 {
+		maskRune = r
 	}
-	if num, err := strconv.ParseFloat(str, 64); err == nil {
-		return num
+	switch rule.Mode {
+	case "hash":
+		return hashMask(str)
+	case "keep-last":
+		return keepLast(str, rule.Keep, maskRune)
 	}
-	return str
-}
 
-func processJSON(data interface{}, filters *Filters, transforms *Transformations, depth int) interface{} {
-	// First apply any transformations to the data
-	if data == nil {
-		return transformValue(data, transforms, depth)
+	var masked strings.Builder
+	for _, r := range str {
+		if rule.Mode == "structure" && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			masked.WriteRune(r)
+		} else {
+			masked.WriteRune(maskRune)
+		}
 	}
+	return masked.String()
+}
 
-	switch v := data.(type) {
-	case map[string]interface{}:
-		result := make(map[string]interface{})
-
-		// Process each key-value pair
-		for key, value := range v {
-			// First apply any key transformations
-			newKey := transformKey(key, transforms, depth)
-
-			// Apply masking and other value transformations
-			newValue := transformValueWithKey(key, value, transforms, depth)
+// decodeValue decodes a string value for the first matching decode rule,
+// parsing the result as JSON if the rule asks for it. Values that fail to
+// decode are left unchanged. It reports whether the rule was final.
+func decodeValue(key string, value interface{}, transforms *Transformations) (interface{}, bool) {
+	str, ok := value.(string)
+	if !ok {
+		return value, false
+	}
 
-			// Check if this key-value pair should be included based on key-specific filters
-			if !shouldIncludeKey(newKey, filters, depth) {
-				continue // Skip this key-value pair
-			}
+	for _, rule := range transforms.DecodeVal {
+		if !matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+			continue
+		}
 
-			// Check if the value should be filtered out based on value-specific filters
-			if !shouldIncludeValue(newValue, filters) {
-				continue // Skip this key-value pair
+		decoded, err := decodeString(str, rule.Encoding)
+		if err != nil {
+			return value, false
+		}
+		if rule.ParseJSON {
+			var parsed interface{}
+			if err := json.Unmarshal([]byte(decoded), &parsed); err == nil {
+				return parsed, rule.Final
 			}
-
-			// Recursively process nested structures
-			processedValue := processJSON(newValue, filters, transforms, depth+1)
-
-			// Add to the result
-			result[newKey] = processedValue
 		}
+		return decoded, rule.Final
+	}
+	return value, false
+}
 
-		return result
-
-	case []interface{}:
-		var result []interface{}
-
-		// Transform each array element
-		for _, item := range v {
-			// Transform the item first
-			transformedItem := transformValue(item, transforms, depth)
+// encodeValue encodes a value for the first matching encode rule. Values
+// other than strings are encoded as compact JSON.
+func encodeValue(key string, value interface{}, transforms *Transformations) interface{} {
+	for _, rule := range transforms.EncodeVal {
+		if !matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+			continue
+		}
 
-			// Process it recursively
-			processedItem := processJSON(transformedItem, filters, transforms, depth+1)
+		str, ok := value.(string)
+		if !ok {
+			str = compactJSON(value)
+		}
+		switch rule.Encoding {
+		case "base64":
+			return base64.StdEncoding.EncodeToString([]byte(str))
+		case "url":
+			return url.QueryEscape(str)
+		}
+	}
+	return value
+}
 
-			// Apply array-specific filters
-			if shouldIncludeArrayElement(processedItem, transforms) {
-				result = append(result, processedItem)
+func decodeString(str, encoding string) (string, error) {
+	switch encoding {
+	case "base64":
+		// Accept padded and unpadded, standard and URL-safe alphabets
+		var err error
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+			var data []byte
+			if data, err = enc.DecodeString(str); err == nil {
+				return string(data), nil
 			}
 		}
-
-		return result
-
+		return "", err
+	case "url":
+		return url.QueryUnescape(str)
 	default:
-		// For primitive values, just apply transformations
-		return transformValue(v, transforms, depth)
+		return "", fmt.Errorf("unknown encoding %q", encoding)
 	}
 }
 
-// Split filtering into key-specific and value-specific checks
-func shouldIncludeKey(key string, filters *Filters, depth int) bool {
-	// Always include all keys if there are no key-specific filters
-	if filters.MinDepth <= 1 &&
-		filters.MaxDepth >= 999999 &&
-		filters.MinKeyLen <= 0 &&
-		filters.MaxKeyLen >= 999999 {
-		return true
+// splitOrJoin splits a string value into an array, or joins an array of
+// scalars into a string, for the first matching split or join rule. It
+// reports whether the rule was final.
+func splitOrJoin(key string, value interface{}, transforms *Transformations) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		for _, rule := range transforms.SplitVal {
+			if matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+				parts := []interface{}{}
+				if v != "" {
+					for _, part := range strings.Split(v, rule.Delimiter) {
+						parts = append(parts, part)
+					}
+				}
+				return parts, rule.Final
+			}
+		}
+	case []interface{}:
+		for _, rule := range transforms.JoinVal {
+			if !matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+				continue
+			}
+			parts := make([]string, 0, len(v))
+			for _, item := range v {
+				part, ok := formatScalar(item)
+				if !ok {
+					// Arrays of objects or arrays cannot be joined
+					return value, false
+				}
+				parts = append(parts, part)
+			}
+			return strings.Join(parts, rule.Delimiter), rule.Final
+		}
 	}
+	return value, false
+}
 
-	// Check depth
-	if depth < filters.MinDepth || depth > filters.MaxDepth {
-		return false
+// applyArrayRules applies the array rules for key to a value. An object is
+// first turned into an array by maptoarray. Nested arrays are then flattened.
+// Every matching where condition must hold for an element to be kept;
+// elements that are not objects never satisfy one. Deduplication keeps the
+// first element per distinct field value, along with elements lacking the
+// field. Finally arraytomap turns the array into an object. It reports
+// whether any of the matching rules was final.
+func applyArrayRules(key string, value interface{}, transforms *Transformations) (interface{}, bool) {
+	final := false
+	if obj, ok := value.(map[string]interface{}); ok {
+		for _, rule := range transforms.MapToArray {
+			if matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+				value = mapToArray(obj, rule.Field)
+				final = rule.Final
+				break
+			}
+		}
 	}
 
-	// Check key length
-	keyLen := len(key)
-	if keyLen < filters.MinKeyLen || keyLen > filters.MaxKeyLen {
-		return false
+	arr, ok := value.([]interface{})
+	if !ok {
+		return value, final
 	}
 
-	return true
-}
-
-func shouldIncludeValue(value interface{}, filters *Filters) bool {
-	// Always include if no value-specific filters are specified
-	if len(filters.NoValTypes) == 0 &&
-		filters.MinNum == nil && filters.MaxNum == nil &&
-		filters.MinStrLen <= 0 && filters.MaxStrLen >= 999999 &&
-		len(filters.StrPattern) == 0 && len(filters.NoStrPattern) == 0 {
-		return true
+	for _, rule := range transforms.ArrayFlatten {
+		if matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+			arr = flattenArray(arr, rule.Depth)
+			final = final || rule.Final
+		}
 	}
 
-	// Check value type filters
-	if len(filters.NoValTypes) > 0 {
-		valueType := getValueType(value)
-		for _, noType := range filters.NoValTypes {
-			if valueType == noType {
-				return false
-			}
+	for _, rule := range transforms.Join {
+		if matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+			arr = joinArray(arr, rule)
+			final = final || rule.Final
 		}
 	}
 
-	// Check numeric value filters
-	if num, ok := value.(float64); ok {
-		if filters.MinNum != nil && num < *filters.MinNum {
-			return false
+	for _, rule := range transforms.ArrayWhere {
+		if !matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+			continue
 		}
-		if filters.MaxNum != nil && num > *filters.MaxNum {
-			return false
+		final = final || rule.Final
+		result := []interface{}{}
+		for _, item := range arr {
+			if obj, ok := item.(map[string]interface{}); ok && evaluateWhen(obj, rule.condition, rule.Condition, transforms.source) {
+				result = append(result, item)
+			}
 		}
+		arr = result
 	}
 
-	// Check string value filters - only apply to strings
-	if str, ok := value.(string); ok {
-		strLen := len(str)
-		if strLen < filters.MinStrLen || strLen > filters.MaxStrLen {
-			return false
+	for _, rule := range transforms.ArrayIntersect {
+		if matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+			arr = filterSet(arr, rule, false)
+			final = final || rule.Final
 		}
+	}
 
-		if len(filters.StrPattern) > 0 && !matchesPattern(str, filters.StrPattern, filters.IgnoreCase) {
-			return false
+	for _, rule := range transforms.ArraySubtract {
+		if matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+			arr = filterSet(arr, rule, true)
+			final = final || rule.Final
 		}
+	}
 
-		if len(filters.NoStrPattern) > 0 && matchesPattern(str, filters.NoStrPattern, filters.IgnoreCase) {
-			return false
+	for _, rule := range transforms.ArrayUniqueBy {
+		if !matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+			continue
 		}
+		final = final || rule.Final
+		result := []interface{}{}
+		seen := make(map[string]bool)
+		for _, item := range arr {
+			if obj, ok := item.(map[string]interface{}); ok {
+				if field, exists := obj[rule.Field]; exists {
+					// Compare as JSON so that 1 and "1" stay distinct
+					id := compactJSON(field)
+					if seen[id] {
+						continue
+					}
+					seen[id] = true
+				}
+			}
+			result = append(result, item)
+		}
+		arr = result
 	}
 
-	return true
-}
+	for _, rule := range transforms.ArraySample {
+		if matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+			arr = sampleArray(key, arr, rule)
+			final = final || rule.Final
+		}
+	}
 
-func shouldIncludeArrayElement(element interface{}, transforms *Transformations) bool {
-	if len(transforms.ArrayFilter) == 0 {
-		return true // No array filters specified, include all elements
+	for _, rule := range transforms.GroupBy {
+		if matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+			return groupArray(arr, rule), final || rule.Final
+		}
 	}
 
-	elementType := getValueType(element)
-	for _, rule := range transforms.ArrayFilter {
-		if elementType == rule.Type {
-			if rule.Filter == "-minnum 10" {
-				if num, ok := element.(float64); ok {
-					return num >= 10 // Only include if number >= 10
-				}
-			}
-			// Add other filter types here as needed
-			return false // Filtered out by default for matching type
+	for _, rule := range transforms.ArrayToMap {
+		if matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+			return arrayToMap(arr, rule.Field), final || rule.Final
 		}
 	}
 
-	return true // No filter for this element type, include it
+	return arr, final
 }
 
-// Helper function to process nested structures recursively
-func processNestedStructure(data interface{}, filters *Filters, transforms *Transformations, depth int) interface{} {
-	switch v := data.(type) {
-	case map[string]interface{}:
-		// Recursively process the map
-		return processJSON(v, filters, transforms, depth)
-	case []interface{}:
-		// Recursively process the array
-		return processJSON(v, filters, transforms, depth)
-	default:
-		// For primitive values, just return as is
-		return data
+// arrayToMap keys the object elements of arr by the value of field. The first
+// element wins for a repeated value; elements that are not objects or lack a
+// scalar field value are dropped.
+func arrayToMap(arr []interface{}, field string) map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, item := range arr {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, ok := formatScalar(obj[field])
+		if !ok || obj[field] == nil {
+			continue
+		}
+		if _, exists := result[id]; !exists {
+			result[id] = item
+		}
 	}
+	return result
 }
 
-func valueFilteredOut(value interface{}) bool {
-	// Only consider truly empty structures as filtered out
-	switch v := value.(type) {
-	case map[string]interface{}:
-		return len(v) == 0
-	case []interface{}:
-		return len(v) == 0
-	default:
-		return false
+// mapToArray is the inverse of arrayToMap: it lists the object values of obj
+// in key order, storing each key in field. Values that are not objects are
+// dropped.
+func mapToArray(obj map[string]interface{}, field string) []interface{} {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
 	}
-}
-
-func transformKey(key string, transforms *Transformations, depth int) string {
-	newKey := key
+	sort.Strings(keys)
 
-	// Apply key replacements
-	for _, rule := range transforms.ReplaceKey {
-		if newKey == rule.Pattern {
-			newKey = rule.Replacement
+	result := []interface{}{}
+	for _, key := range keys {
+		item, ok := obj[key].(map[string]interface{})
+		if !ok {
+			continue
 		}
-	}
-
-	// Apply depth-based renaming
-	for _, rule := range transforms.RenameKeyDepth {
-		if depth == rule.Depth {
-			newKey = rule.Prefix + newKey
+		element := make(map[string]interface{}, len(item)+1)
+		for k, v := range item {
+			element[k] = v
 		}
+		element[field] = key
+		result = append(result, element)
 	}
-
-	return newKey
+	return result
 }
 
-// Function that handles masking and other transformations based on the original key
-func transformValueWithKey(key string, value interface{}, transforms *Transformations, depth int) interface{} {
-	// First apply masking based on key
-	for _, rule := range transforms.MaskVal {
-		if key == rule.Pattern {
-			return rule.Mask
+// flattenArray replaces array elements of arr with their own elements, down
+// to depth levels of nesting.
+func flattenArray(arr []interface{}, depth int) []interface{} {
+	result := []interface{}{}
+	for _, item := range arr {
+		if nested, ok := item.([]interface{}); ok && depth > 0 {
+			result = append(result, flattenArray(nested, depth-1)...)
+		} else {
+			result = append(result, item)
 		}
 	}
+	return result
+}
 
-	// Then apply other transformations
-	return transformValue(value, transforms, depth)
+func applyStringOp(str, op string) string {
+	switch op {
+	case "trim":
+		return strings.TrimSpace(str)
+	case "lower":
+		return strings.ToLower(str)
+	case "upper":
+		return strings.ToUpper(str)
+	case "title":
+		return cases.Title(language.Und).String(str)
+	default:
+		return str
+	}
 }
 
-func transformValue(value interface{}, transforms *Transformations, depth int) interface{} {
+// transformValue applies the value transformations to the value of key, which
+// is empty for array elements, the document root and scalars already
+// transformed as members. Conditions referring to the key or depth only
+// apply to object members.
+func transformValue(key string, value interface{}, transforms *Transformations, depth int) (interface{}, bool) {
 	// Apply conditional replacements first
+	env := exprEnv{key: key, value: value, depth: depth, lenUnit: transforms.LenUnit}
 	for _, rule := range transforms.CondReplace {
-		if evaluateCondition(value, rule.Condition) {
-			return rule.Replacement
+		if rule.holds(env) {
+			return rule.Replacement, rule.Final
 		}
 	}
 
 	// Apply default value replacements
 	for _, rule := range transforms.DefaultVal {
 		if shouldApplyDefault(value, rule.Type) {
-			return rule.Value
+			return rule.Value, rule.Final
 		}
 	}
 
@@ -560,44 +2863,90 @@ func transformValue(value interface{}, transforms *Transformations, depth int) i
 	case string:
 		return transformString(v, transforms)
 	case float64:
-		return transformNumber(v, transforms)
+		return transformNumber(v, transforms), false
 	default:
-		return value
+		return value, false
 	}
 }
 
-func transformString(str string, transforms *Transformations) interface{} {
-	result := str
+func transformString(str string, transforms *Transformations) (interface{}, bool) {
+	result := normalizeString(str, transforms.Normalize)
+	if transforms.Trim {
+		result = strings.TrimSpace(result)
+	}
 
 	// Apply string value replacements
 	for _, rule := range transforms.ReplaceVal {
-		if matchesStringPattern(result, rule.Pattern) {
-			return rule.Replacement
+		if matchesStringPattern(result, rule.Pattern, transforms.Patterns) {
+			return rule.Replacement, rule.Final
 		}
 	}
 
 	// Apply string length bounds
-	if transforms.BoundStrLen != nil {
+	if transforms.BoundStrLen.clamps() {
 		minLen := int(transforms.BoundStrLen.Min)
 		maxLen := int(transforms.BoundStrLen.Max)
 
-		if len(result) < minLen {
-			// Pad with spaces
-			result = result + strings.Repeat(" ", minLen-len(result))
-		} else if len(result) > maxLen {
-			// Truncate
-			result = result[:maxLen]
+		if length := stringLength(result, transforms.LenUnit); length < minLen {
+			result = transforms.BoundStrLen.pad(result, minLen-length, transforms.LenUnit)
+		} else if length > maxLen {
+			result = transforms.BoundStrLen.truncate(result, maxLen, transforms.LenUnit)
 		}
 	}
 
-	return result
+	return result, false
+}
+
+// normalizeString applies the Unicode normalization form ("nfc" or "nfkc")
+// to str. Any other form leaves it unchanged.
+func normalizeString(str, form string) string {
+	switch form {
+	case "nfc":
+		return norm.NFC.String(str)
+	case "nfkc":
+		return norm.NFKC.String(str)
+	default:
+		return str
+	}
+}
+
+// stringLength returns the length of str in the given unit: Unicode code
+// points for "runes", bytes otherwise.
+func stringLength(str, unit string) int {
+	if unit == "runes" {
+		return utf8.RuneCountInString(str)
+	}
+	return len(str)
+}
+
+// truncateString shortens str to at most max units without splitting a
+// multi-byte character.
+func truncateString(str string, max int, unit string) string {
+	if unit == "runes" {
+		count := 0
+		for i := range str {
+			if count == max {
+				return str[:i]
+			}
+			count++
+		}
+		return str
+	}
+
+	if len(str) <= max {
+		return str
+	}
+	for max > 0 && !utf8.RuneStart(str[max]) {
+		max--
+	}
+	return str[:max]
 }
 
 func transformNumber(num float64, transforms *Transformations) float64 {
 	result := num
 
 	// Apply numeric bounds
-	if transforms.BoundNum != nil {
+	if transforms.BoundNum.clamps() {
 		if result < transforms.BoundNum.Min {
 			result = transforms.BoundNum.Min
 		} else if result > transforms.BoundNum.Max {
@@ -622,35 +2971,53 @@ func shouldApplyDefault(value interface{}, valueType string) bool {
 	}
 }
 
+// evaluateCondition evaluates a condition of the form value<op><literal>, e.g.
+// value=="Alice", value>=100, value!=null or value startswith "tmp_".
 func evaluateCondition(value interface{}, condition string) bool {
-	// Simple condition evaluation
-	if strings.HasPrefix(condition, "value==") {
-		expected := strings.Trim(condition[7:], "\"")
-		if expected == "null" {
-			return value == nil
-		}
-		if str, ok := value.(string); ok {
-			return str == expected
-		}
+	c, err := parseCondition(condition)
+	return err == nil && c.eval(value)
+}
+
+// typePredicate matches a type predicate condition such as isstring(value).
+var typePredicate = regexp.MustCompile(`^is(string|number|bool|boolean|null|array|object)\(\s*value\s*\)$`)
+
+// parseCondition parses a value<op><literal> condition, or a type predicate,
+// into its comparison.
+func parseCondition(condition string) (*comparison, error) {
+	condition = strings.TrimSpace(condition)
+	if m := typePredicate.FindStringSubmatch(condition); m != nil {
+		return &comparison{op: "is", raw: strings.TrimSuffix(m[1], "ean")}, nil
 	}
-	return false
+	if !strings.HasPrefix(condition, "value") {
+		return nil, fmt.Errorf("condition %q must start with value", condition)
+	}
+	return parseComparison(condition[len("value"):])
 }
 
-func matchesStringPattern(str, pattern string) bool {
-	switch pattern {
-	case "upper":
-		return regexp.MustCompile(`[A-Z]`).MatchString(str)
-	case "lower":
-		return regexp.MustCompile(`[a-z]`).MatchString(str)
-	case "num":
-		return regexp.MustCompile(`[0-9]`).MatchString(str)
-	case "sym":
-		return regexp.MustCompile(`[^A-Za-z0-9\s]`).MatchString(str)
-	case "email":
-		return strings.Contains(str, "@")
-	default:
-		return str == pattern
+// patternClasses are the built-in named patterns, compiled once: what a
+// string contains, such as an upper case letter or an @ for email, and
+// formats it is in as a whole, such as emailaddr for a full address.
+var patternClasses = map[string]*regexp.Regexp{
+	"upper":     regexp.MustCompile(`[A-Z]`),
+	"lower":     regexp.MustCompile(`[a-z]`),
+	"num":       regexp.MustCompile(`[0-9]`),
+	"sym":       regexp.MustCompile(`[^A-Za-z0-9\s]`),
+	"email":     regexp.MustCompile(`@`),
+	"emailaddr": regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`),
+	"uuid":      regexp.MustCompile(`^[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}$`),
+	"ipv4":      regexp.MustCompile(`^((25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])\.){3}(25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])$`),
+	"ipv6":      regexp.MustCompile(`^(([0-9A-Fa-f]{1,4}:){7}[0-9A-Fa-f]{1,4}|(([0-9A-Fa-f]{1,4}:){0,6}[0-9A-Fa-f]{1,4})?::(([0-9A-Fa-f]{1,4}:){0,6}[0-9A-Fa-f]{1,4})?)$`),
+	"phone":     regexp.MustCompile(`^\+?[0-9][0-9 ().-]{5,}[0-9]$`),
+	"iban":      regexp.MustCompile(`^[A-Z]{2}[0-9]{2}( ?[A-Z0-9]){11,30}$`),
+}
+
+// matchesStringPattern reports whether str matches the named pattern, or
+// equals pattern if no pattern has that name.
+func matchesStringPattern(str, pattern string, patterns map[string]*regexp.Regexp) bool {
+	if re, ok := lookupPattern(pattern, patterns); ok {
+		return re.MatchString(str)
 	}
+	return str == pattern
 }
 
 func shouldIncludeKV(key string, value interface{}, filters *Filters, depth int) bool {
@@ -685,6 +3052,11 @@ func shouldIncludeKV(key string, value interface{}, filters *Filters, depth int)
 		}
 	}
 
+	// Check boolean value filters
+	if b, ok := value.(bool); ok && filters.BoolVal != nil && b != *filters.BoolVal {
+		return false
+	}
+
 	// Check string value filters
 	if str, ok := value.(string); ok {
 		strLen := len(str)
@@ -692,11 +3064,11 @@ func shouldIncludeKV(key string, value interface{}, filters *Filters, depth int)
 			return false
 		}
 
-		if len(filters.StrPattern) > 0 && !matchesPattern(str, filters.StrPattern, filters.IgnoreCase) {
+		if len(filters.StrPattern) > 0 && !matchesPattern(str, filters.StrPattern, filters.IgnoreCase, filters.Patterns) {
 			return false
 		}
 
-		if len(filters.NoStrPattern) > 0 && matchesPattern(str, filters.NoStrPattern, filters.IgnoreCase) {
+		if len(filters.NoStrPattern) > 0 && matchesPattern(str, filters.NoStrPattern, filters.IgnoreCase, filters.Patterns) {
 			return false
 		}
 	}
@@ -724,7 +3096,7 @@ func getValueType(value interface{}) string {
 	}
 }
 
-func matchesPattern(str string, patterns []string, ignoreCase bool) bool {
+func matchesPattern(str string, patterns []string, ignoreCase bool, named map[string]*regexp.Regexp) bool {
 	testStr := str
 	if ignoreCase {
 		testStr = strings.ToLower(str)
@@ -732,24 +3104,74 @@ func matchesPattern(str string, patterns []string, ignoreCase bool) bool {
 
 	for _, pattern := range patterns {
 		pattern = strings.TrimSpace(pattern)
-		if !hasPattern(testStr, pattern) {
+		if !hasPattern(testStr, pattern, named) {
 			return false
 		}
 	}
 	return true
 }
 
-func hasPattern(str, pattern string) bool {
-	switch pattern {
-	case "upper":
-		return regexp.MustCompile(`[A-Z]`).MatchString(str)
-	case "lower":
-		return regexp.MustCompile(`[a-z]`).MatchString(str)
-	case "num":
-		return regexp.MustCompile(`[0-9]`).MatchString(str)
-	case "sym":
-		return regexp.MustCompile(`[^A-Za-z0-9\s]`).MatchString(str)
-	default:
-		return false
+func hasPattern(str, pattern string, named map[string]*regexp.Regexp) bool {
+	re, ok := lookupPattern(pattern, named)
+	return ok && re.MatchString(str)
+}
+
+// matchKey reports whether key matches a key pattern, where * matches any
+// run of characters and ? matches a single character.
+func matchKey(pattern, key string, ignoreCase bool) bool {
+	if ignoreCase {
+		pattern, key = strings.ToLower(pattern), strings.ToLower(key)
 	}
+	if !strings.ContainsAny(pattern, "*?") {
+		return pattern == key
+	}
+
+	p, k := []rune(pattern), []rune(key)
+	i, j := 0, 0
+	// Where the last * was seen, to let it absorb more characters on mismatch
+	starP, starK := -1, 0
+	for j < len(k) {
+		switch {
+		case i < len(p) && p[i] == '*':
+			starP, starK = i, j
+			i++
+		case i < len(p) && (p[i] == '?' || p[i] == k[j]):
+			i++
+			j++
+		case starP >= 0:
+			starK++
+			i, j = starP+1, starK
+		default:
+			return false
+		}
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
+
+// compactJSON renders a value as single-line JSON.
+func compactJSON(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+var identifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// joinPath appends an object key to a JSONPath-style path such as $.meta.tags.
+// Keys that are not plain identifiers are written in bracket notation.
+func joinPath(path, key string) string {
+	if identifierRegex.MatchString(key) {
+		return path + "." + key
+	}
+	return path + "[" + strconv.Quote(key) + "]"
+}
+
+// indexPath appends an array index to a JSONPath-style path.
+func indexPath(path string, index int) string {
+	return path + "[" + strconv.Itoa(index) + "]"
 }
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"unicode/utf8"
 )
 
 // Test helper functions
@@ -196,6 +200,197 @@ func TestBoundStrLen(t *testing.T) {
 	}
 }
 
+func TestLenUnitRunes(t *testing.T) {
+	input := map[string]interface{}{
+		"city":  "Zürich",
+		"greek": "αβγδεζηθ",
+		"emoji": "🙂🙂",
+	}
+
+	transforms := &Transformations{
+		BoundStrLen: &BoundRule{Min: 3, Max: 4},
+		LenUnit:     "runes",
+	}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999, MinStrLen: 2, LenUnit: "runes"}
+
+	resultMap := processJSON(input, filters, transforms, 1).(map[string]interface{})
+
+	if resultMap["city"] != "Züri" {
+		t.Errorf("Expected city to be truncated to 4 runes, got %q", resultMap["city"])
+	}
+	if resultMap["greek"] != "αβγδ" {
+		t.Errorf("Expected greek to be truncated to 4 runes, got %q", resultMap["greek"])
+	}
+	if resultMap["emoji"] != "🙂🙂 " {
+		t.Errorf("Expected emoji to be padded to 3 runes, got %q", resultMap["emoji"])
+	}
+}
+
+func TestBoundStrLenBytesKeepsUTF8(t *testing.T) {
+	transforms := &Transformations{
+		BoundStrLen: &BoundRule{Min: 0, Max: 3},
+	}
+
+	result, _ := transformString("Zürich", transforms)
+	if result != "Zü" {
+		t.Errorf("Expected truncation at a character boundary, got %q", result)
+	}
+	if !utf8.ValidString(result.(string)) {
+		t.Errorf("Expected valid UTF-8, got %q", result)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	decomposed := "Cafe\u0301"
+	input := map[string]interface{}{
+		decomposed: decomposed,
+		"width":    "ｆｕｌｌ",
+	}
+
+	transforms := &Transformations{Normalize: "nfc", NormalizeKeys: true}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999, StrPattern: []string{"upper"}}
+
+	resultMap := processJSON(input, filters, transforms, 1).(map[string]interface{})
+	if resultMap["Café"] != "Café" {
+		t.Errorf("Expected NFC-composed key and value, got %q", resultMap)
+	}
+	if _, exists := resultMap["width"]; exists {
+		t.Error("Expected fullwidth value to have no ASCII uppercase under NFC")
+	}
+
+	transforms = &Transformations{Normalize: "nfkc"}
+	resultMap = processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1).(map[string]interface{})
+	if resultMap["width"] != "full" {
+		t.Errorf("Expected NFKC to fold fullwidth characters, got %q", resultMap["width"])
+	}
+	if _, exists := resultMap[decomposed]; !exists {
+		t.Error("Expected keys to be left alone without NormalizeKeys")
+	}
+}
+
+func TestStringOps(t *testing.T) {
+	input := map[string]interface{}{
+		"email": "  Alice@Example.COM ",
+		"code":  " ab-12 ",
+		"name":  "ada lovelace",
+		"notes": "  keep  ",
+		"profile": map[string]interface{}{
+			"name": "grace hopper",
+		},
+	}
+
+	transforms := &Transformations{
+		StringOps: append(append(append(
+			parseStringOpRules([]string{"email", "code"}, "trim"),
+			parseStringOpRules([]string{"email"}, "lower")...),
+			parseStringOpRules([]string{"code"}, "upper")...),
+			parseStringOpRules([]string{"under=profile key=name"}, "title")...),
+	}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}
+
+	resultMap := processJSON(input, filters, transforms, 1).(map[string]interface{})
+
+	expected := map[string]interface{}{
+		"email": "alice@example.com",
+		"code":  "AB-12",
+		"name":  "ada lovelace",
+		"notes": "  keep  ",
+	}
+	for key, value := range expected {
+		if resultMap[key] != value {
+			t.Errorf("Expected %s to be %q, got %q", key, value, resultMap[key])
+		}
+	}
+	profile := resultMap["profile"].(map[string]interface{})
+	if profile["name"] != "Grace Hopper" {
+		t.Errorf("Expected profile name to be title-cased, got %q", profile["name"])
+	}
+
+	// -trim applies to every string value
+	resultMap = processJSON(input, filters, &Transformations{Trim: true}, 1).(map[string]interface{})
+	if resultMap["notes"] != "keep" {
+		t.Errorf("Expected notes to be trimmed, got %q", resultMap["notes"])
+	}
+}
+
+func TestSplitJoinVal(t *testing.T) {
+	input := map[string]interface{}{
+		"tags": "a,b,c",
+		"items": []interface{}{
+			map[string]interface{}{"tags": []interface{}{"x", 1.0, true}},
+			map[string]interface{}{"tags": ""},
+		},
+		"labels": []interface{}{"red", "green"},
+		"nested": []interface{}{map[string]interface{}{}},
+	}
+
+	transforms := &Transformations{
+		SplitVal: parseDelimiterRules([]string{"tags:,"}),
+		JoinVal:  parseDelimiterRules([]string{"labels:|", "nested:|"}),
+	}
+
+	resultMap := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1).(map[string]interface{})
+
+	if fmt.Sprint(resultMap["tags"]) != "[a b c]" {
+		t.Errorf("Expected tags to be split, got %v", resultMap["tags"])
+	}
+	items := resultMap["items"].([]interface{})
+	if fmt.Sprint(items[0].(map[string]interface{})["tags"]) != "[x 1 true]" {
+		t.Errorf("Expected array tags to stay an array, got %v", items[0])
+	}
+	if tags := items[1].(map[string]interface{})["tags"].([]interface{}); len(tags) != 0 {
+		t.Errorf("Expected empty string to split into an empty array, got %v", tags)
+	}
+	if resultMap["labels"] != "red|green" {
+		t.Errorf("Expected labels to be joined, got %v", resultMap["labels"])
+	}
+	if _, ok := resultMap["nested"].([]interface{}); !ok {
+		t.Errorf("Expected array of objects not to be joined, got %v", resultMap["nested"])
+	}
+}
+
+func TestDecodeEncodeVal(t *testing.T) {
+	blob := base64.StdEncoding.EncodeToString([]byte(`{"user":"alice","password":"hunter2"}`))
+	input := map[string]interface{}{
+		"payload": blob,
+		"query":   "a%20b%26c",
+		"broken":  "not base64!",
+	}
+
+	transforms := &Transformations{
+		DecodeVal: parseCodecRules([]string{"payload:base64:json", "query:url", "broken:base64"}),
+		MaskVal:   []MaskRule{{Pattern: "password", Mask: "***"}},
+	}
+
+	resultMap := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1).(map[string]interface{})
+
+	payload, ok := resultMap["payload"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected payload to be merged as an object, got %v", resultMap["payload"])
+	}
+	if payload["password"] != "***" || payload["user"] != "alice" {
+		t.Errorf("Expected decoded payload to be sanitized, got %v", payload)
+	}
+	if resultMap["query"] != "a b&c" {
+		t.Errorf("Expected query to be URL-decoded, got %v", resultMap["query"])
+	}
+	if resultMap["broken"] != "not base64!" {
+		t.Errorf("Expected undecodable value to be unchanged, got %v", resultMap["broken"])
+	}
+
+	// Decoding and re-encoding the same key sanitizes the embedded document
+	transforms.EncodeVal = parseCodecRules([]string{"payload:base64"})
+	resultMap = processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1).(map[string]interface{})
+
+	decoded, err := base64.StdEncoding.DecodeString(resultMap["payload"].(string))
+	if err != nil {
+		t.Fatalf("Expected payload to be base64 encoded, got %v", resultMap["payload"])
+	}
+	if string(decoded) != `{"password":"***","user":"alice"}` {
+		t.Errorf("Expected re-encoded sanitized payload, got %s", decoded)
+	}
+}
+
 func TestDefaultVal(t *testing.T) {
 	input := createTestInput()
 
@@ -263,6 +458,231 @@ func TestMaskVal(t *testing.T) {
 	}
 }
 
+func TestMaskValUnder(t *testing.T) {
+	input := map[string]interface{}{
+		"number": "555-0100",
+		"billing": map[string]interface{}{
+			"number": "4111111111111111",
+			"cards": []interface{}{
+				map[string]interface{}{"number": "5500000000000004"},
+			},
+		},
+		"shipping": map[string]interface{}{
+			"number": "42",
+		},
+	}
+
+	transforms := &Transformations{
+		MaskVal: parseMaskRules([]string{"under=billing key=number mask=****"}),
+	}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}
+
+	resultMap := processJSON(input, filters, transforms, 1).(map[string]interface{})
+
+	if resultMap["number"] != "555-0100" {
+		t.Errorf("Expected top-level number to be unchanged, got %v", resultMap["number"])
+	}
+	billing := resultMap["billing"].(map[string]interface{})
+	if billing["number"] != "****" {
+		t.Errorf("Expected billing number to be masked, got %v", billing["number"])
+	}
+	card := billing["cards"].([]interface{})[0].(map[string]interface{})
+	if card["number"] != "****" {
+		t.Errorf("Expected nested card number to be masked, got %v", card["number"])
+	}
+	shipping := resultMap["shipping"].(map[string]interface{})
+	if shipping["number"] != "42" {
+		t.Errorf("Expected shipping number to be unchanged, got %v", shipping["number"])
+	}
+
+	// The caller's rules are not modified while descending
+	if transforms.MaskVal[0].Under != "billing" {
+		t.Errorf("Expected rule to stay scoped under billing, got %q", transforms.MaskVal[0].Under)
+	}
+}
+
+func TestParseRuleFields(t *testing.T) {
+	rules := parseCondReplaceRules([]string{`value=="Alice":User`, `condition="value startswith \"A\"" replacement=null`})
+	if len(rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %v", rules)
+	}
+	if rules[0].Condition != `value=="Alice"` || rules[0].Replacement != "User" {
+		t.Errorf("Expected colon syntax to be parsed as before, got %v", rules[0])
+	}
+	if rules[1].Condition != `value startswith "A"` || rules[1].Replacement != nil {
+		t.Errorf("Expected field syntax to be parsed, got %v", rules[1])
+	}
+}
+
+func TestMatchKey(t *testing.T) {
+	cases := []struct {
+		pattern, key string
+		match        bool
+	}{
+		{"email", "email", true},
+		{"email", "emails", false},
+		{"secret_*", "secret_token", true},
+		{"secret_*", "secret_", true},
+		{"secret_*", "my_secret_token", false},
+		{"*_internal", "user_internal", true},
+		{"*_internal", "internal", false},
+		{"a*b*c", "aXXbYYbc", true},
+		{"a*b*c", "aXXbYYbcd", false},
+		{"id?", "id1", true},
+		{"id?", "id", false},
+		{"*", "", true},
+		{"k?y", "kéy", true},
+	}
+
+	for _, c := range cases {
+		if got := matchKey(c.pattern, c.key, false); got != c.match {
+			t.Errorf("matchKey(%q, %q) = %v, expected %v", c.pattern, c.key, got, c.match)
+		}
+	}
+}
+
+func TestIgnoreKeyCase(t *testing.T) {
+	input := map[string]interface{}{
+		"Email":    "a@example.com",
+		"EMAIL":    "b@example.com",
+		"Password": "hunter2",
+		"Billing": map[string]interface{}{
+			"Number": "4111",
+		},
+	}
+
+	transforms := &Transformations{
+		MaskVal:       parseMaskRules([]string{"email:***", "under=billing key=number mask=####"}),
+		ReplaceKey:    []ReplaceRule{{Pattern: "EMAIL", Replacement: "contact"}},
+		IgnoreKeyCase: true,
+	}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999, DropKeys: []string{"pass*"}, IgnoreKeyCase: true}
+
+	resultMap := processJSON(input, filters, transforms, 1).(map[string]interface{})
+
+	if resultMap["contact"] != "***" {
+		t.Errorf("Expected email variants to be masked and renamed, got %v", resultMap)
+	}
+	if _, exists := resultMap["Password"]; exists {
+		t.Error("Expected Password to be dropped")
+	}
+	billing := resultMap["Billing"].(map[string]interface{})
+	if billing["Number"] != "####" {
+		t.Errorf("Expected Billing.Number to be masked, got %v", billing["Number"])
+	}
+
+	if matchKey("email", "Email", false) {
+		t.Error("Expected key matching to be case-sensitive by default")
+	}
+}
+
+func TestGlobKeyRules(t *testing.T) {
+	input := map[string]interface{}{
+		"secret_token":  "abc",
+		"secret_key":    "def",
+		"public":        "ghi",
+		"user_internal": 1.0,
+		"meta": map[string]interface{}{
+			"debug_internal": true,
+			"email_address":  "a@example.com",
+		},
+	}
+
+	transforms := &Transformations{
+		MaskVal:    []MaskRule{{Pattern: "secret_*", Mask: "***"}},
+		ReplaceKey: []ReplaceRule{{Pattern: "email_*", Replacement: "contact"}},
+	}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999, DropKeys: []string{"*_internal"}}
+
+	resultMap := processJSON(input, filters, transforms, 1).(map[string]interface{})
+
+	if resultMap["secret_token"] != "***" || resultMap["secret_key"] != "***" {
+		t.Errorf("Expected secret_* values to be masked, got %v", resultMap)
+	}
+	if resultMap["public"] != "ghi" {
+		t.Errorf("Expected public to be unchanged, got %v", resultMap["public"])
+	}
+	if _, exists := resultMap["user_internal"]; exists {
+		t.Error("Expected user_internal to be dropped")
+	}
+
+	meta := resultMap["meta"].(map[string]interface{})
+	if _, exists := meta["debug_internal"]; exists {
+		t.Error("Expected nested debug_internal to be dropped")
+	}
+	if meta["contact"] != "a@example.com" {
+		t.Errorf("Expected email_address to be renamed to contact, got %v", meta)
+	}
+}
+
+func TestMaskValModes(t *testing.T) {
+	input := map[string]interface{}{
+		"phone":  "555-1234",
+		"name":   "Zoë",
+		"pin":    1234.0,
+		"secret": "a:b",
+		"card":   map[string]interface{}{"number": "4111"},
+	}
+
+	transforms := &Transformations{
+		MaskVal: parseMaskRules([]string{
+			"phone:#:structure",
+			"name:*:length",
+			"key=pin mask=X mode=length",
+			"secret:***:***",
+			"card:#:structure",
+		}),
+	}
+
+	resultMap := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1).(map[string]interface{})
+
+	expected := map[string]interface{}{
+		"phone":  "###-####",
+		"name":   "***",
+		"pin":    "XXXX",
+		"secret": "***:***",
+		"card":   "#",
+	}
+	for key, value := range expected {
+		if resultMap[key] != value {
+			t.Errorf("Expected %s to be %q, got %v", key, value, resultMap[key])
+		}
+	}
+}
+
+func TestMaskValDeep(t *testing.T) {
+	credentials := map[string]interface{}{
+		"user":   "admin",
+		"tokens": []interface{}{"abc-1", 42.0},
+	}
+	input := map[string]interface{}{
+		"credentials": credentials,
+		"secrets":     credentials,
+	}
+
+	transforms := &Transformations{
+		MaskVal: parseMaskRules([]string{"credentials:#:structure:deep", "secrets:[REDACTED]"}),
+	}
+
+	resultMap := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1).(map[string]interface{})
+
+	if resultMap["secrets"] != "[REDACTED]" {
+		t.Errorf("Expected secrets subtree to be replaced by the placeholder, got %v", resultMap["secrets"])
+	}
+
+	masked, ok := resultMap["credentials"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected credentials to keep its structure, got %v", resultMap["credentials"])
+	}
+	if masked["user"] != "#####" {
+		t.Errorf("Expected user to be masked, got %v", masked["user"])
+	}
+	tokens := masked["tokens"].([]interface{})
+	if tokens[0] != "###-#" || tokens[1] != "##" {
+		t.Errorf("Expected every token to be masked, got %v", tokens)
+	}
+}
+
 func TestCondReplace(t *testing.T) {
 	input := createTestInput()
 
@@ -297,6 +717,128 @@ func TestCondReplace(t *testing.T) {
 	}
 }
 
+func TestCondReplaceOperators(t *testing.T) {
+	input := createTestInput()
+
+	transforms := &Transformations{
+		CondReplace: []CondReplaceRule{
+			{Condition: "value>=99", Replacement: "HIGH"},
+			{Condition: "value < 1", Replacement: "LOW"},
+			{Condition: `value startswith "lower"`, Replacement: "PREFIX"},
+			{Condition: `value matches "^[A-Z]+@"`, Replacement: "EMAIL"},
+			{Condition: `value contains "DEV"`, Replacement: "DEV"},
+		},
+	}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}
+
+	result := processJSON(input, filters, transforms, 1)
+	resultMap, ok := result.(map[string]interface{})
+	if !ok {
+		t.Fatal("Result is not a map")
+	}
+
+	expected := map[string]interface{}{
+		"score": "HIGH",
+		"zero":  "LOW",
+		"lower": "PREFIX",
+		"email": "EMAIL",
+		"Name":  "Alice",
+	}
+	for key, value := range expected {
+		if resultMap[key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, resultMap[key])
+		}
+	}
+
+	meta := resultMap["meta"].(map[string]interface{})
+	profile := meta["profile"].(map[string]interface{})
+	if profile["bio"] != "DEV" {
+		t.Errorf("Expected bio to be DEV, got %v", profile["bio"])
+	}
+
+	// Inequality holds across types
+	if !evaluateCondition(false, "value!=true") || evaluateCondition(true, "value != true") {
+		t.Error("Expected value!=true to match only non-true values")
+	}
+	if !evaluateCondition("Bob", `value!="Alice"`) || !evaluateCondition(nil, "value!=Alice") {
+		t.Error(`Expected value!="Alice" to match other values`)
+	}
+}
+
+func TestCondReplaceTypes(t *testing.T) {
+	rules := parseCondReplaceRules([]string{
+		`value>=100:{"capped": true}`,
+		`isnull(value):0`,
+		`isarray( value ):"list"`,
+		`value==99:"99"`,
+	})
+	transforms := &Transformations{CondReplace: rules}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}
+	input := map[string]interface{}{
+		"active": false,
+		"score":  250.0,
+		"notes":  nil,
+		"tags":   []interface{}{1.0},
+		"answer": 99.0,
+	}
+
+	result := processJSON(input, filters, transforms, 1).(map[string]interface{})
+	expected := map[string]interface{}{
+		"active": false,
+		"score":  map[string]interface{}{"capped": true},
+		"notes":  0.0,
+		"tags":   "list",
+		"answer": "99",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+
+	if !evaluateCondition(map[string]interface{}{}, "isobject(value)") || evaluateCondition("1", "isnumber(value)") ||
+		!evaluateCondition(true, "isboolean(value)") || !evaluateCondition("x", "isstring(value)") {
+		t.Error("Expected type predicates to test the value type")
+	}
+	if _, err := parseCondition("isdate(value)"); err == nil {
+		t.Error("Expected an unknown type predicate to be rejected")
+	}
+}
+
+func TestCondReplaceKeyConditions(t *testing.T) {
+	transforms := &Transformations{
+		CondReplace: parseCondReplaceRules([]string{
+			`key=="status" && value=="inactive":"disabled"`,
+			`depth>1 AND (value=="n/a" OR value==""):null`,
+			`value=="a && b":"quoted"`,
+		}),
+	}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}
+	if _, err := NewPipeline(filters, transforms); err != nil {
+		t.Fatal(err)
+	}
+	input := map[string]interface{}{
+		"status": "inactive",
+		"reason": "inactive",
+		"note":   "n/a",
+		"meta":   map[string]interface{}{"note": "n/a", "raw": "a && b"},
+	}
+
+	result := processJSON(input, filters, transforms, 1)
+	expected := map[string]interface{}{
+		"status": "disabled",
+		"reason": "inactive",
+		"note":   "n/a",
+		"meta":   map[string]interface{}{"note": nil, "raw": "quoted"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+
+	transforms.CondReplace = []CondReplaceRule{{Condition: `key== && value`, Replacement: "x"}}
+	if _, err := NewPipeline(filters, transforms); err == nil {
+		t.Error("Expected an invalid condition expression to be rejected")
+	}
+}
+
 func TestRenameKeyDepth(t *testing.T) {
 	input := createTestInput()
 
@@ -365,6 +907,247 @@ func TestArrayFilter(t *testing.T) {
 	}
 }
 
+func TestBoolVal(t *testing.T) {
+	filters, transforms, _ := parseArgs("test", []string{"-boolval", "true"})
+	input := map[string]interface{}{
+		"beta":    true,
+		"legacy":  false,
+		"name":    "flags",
+		"history": []interface{}{true, false, 1.0},
+	}
+	expected := map[string]interface{}{
+		"beta":    true,
+		"name":    "flags",
+		"history": []interface{}{true, false, 1.0},
+	}
+	if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected false flags to be dropped, got %v", result)
+	}
+
+	elements, _, err := parseElementFilter("-boolval false")
+	if err != nil || elements.BoolVal == nil || *elements.BoolVal {
+		t.Errorf("Expected -boolval in array filters, got %v", err)
+	}
+	if !shouldIncludeValue(false, elements) || shouldIncludeValue(true, elements) || !shouldIncludeValue(1.0, elements) {
+		t.Error("Expected -boolval false to keep only false among booleans")
+	}
+}
+
+func TestArrayFilterSyntax(t *testing.T) {
+	input := map[string]interface{}{
+		"nums":  []interface{}{5.0, 12.0, 25.0, true},
+		"names": []interface{}{"al", "alice", "Bob"},
+		"orders": []interface{}{
+			map[string]interface{}{"id": "a", "total": 5.0},
+			map[string]interface{}{"id": "b", "total": 50.0},
+			map[string]interface{}{"id": "c"},
+		},
+	}
+
+	rules, err := parseArrayFilterRules([]string{
+		"number:-minnum 10 -maxnum 20",
+		"string:-minstrlen 3 -nostrpattern upper",
+		"object:-field total -minnum 10",
+	}, "bytes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resultMap := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, &Transformations{ArrayFilter: rules}, 1).(map[string]interface{})
+
+	if nums := resultMap["nums"].([]interface{}); !reflect.DeepEqual(nums, []interface{}{12.0, true}) {
+		t.Errorf("Expected numbers outside 10..20 to be removed, got %v", nums)
+	}
+	if names := resultMap["names"].([]interface{}); !reflect.DeepEqual(names, []interface{}{"alice"}) {
+		t.Errorf("Expected short and capitalized names to be removed, got %v", names)
+	}
+	orders := resultMap["orders"].([]interface{})
+	if len(orders) != 1 || orders[0].(map[string]interface{})["id"] != "b" {
+		t.Errorf("Expected only the order with total >= 10, got %v", orders)
+	}
+
+	if _, err := parseArrayFilterRules([]string{"number:-minnum ten"}, "bytes"); err == nil {
+		t.Error("Expected an error for an invalid -minnum value")
+	}
+	if _, err := parseArrayFilterRules([]string{"number:-unknown 1"}, "bytes"); err == nil {
+		t.Error("Expected an error for an unknown filter flag")
+	}
+}
+
+func TestArrayWhere(t *testing.T) {
+	input := map[string]interface{}{
+		"orders": []interface{}{
+			map[string]interface{}{"id": "a", "status": "shipped", "total": 5.0},
+			map[string]interface{}{"id": "b", "status": "pending", "total": 50.0},
+			map[string]interface{}{"id": "c", "status": "shipped", "total": 80.0},
+			"not an order",
+		},
+		"returns": []interface{}{
+			map[string]interface{}{"id": "d", "status": "pending"},
+		},
+	}
+
+	transforms := &Transformations{
+		ArrayWhere: parseArrayWhereRules([]string{
+			`orders:status=="shipped"`,
+			"key=orders where=\"total >= 10\"",
+		}),
+	}
+
+	resultMap := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1).(map[string]interface{})
+
+	orders := resultMap["orders"].([]interface{})
+	if len(orders) != 1 || orders[0].(map[string]interface{})["id"] != "c" {
+		t.Errorf("Expected only shipped orders with total >= 10, got %v", orders)
+	}
+	if returns := resultMap["returns"].([]interface{}); len(returns) != 1 {
+		t.Errorf("Expected arrays under other keys to be left alone, got %v", returns)
+	}
+}
+
+func TestArrayUniqueBy(t *testing.T) {
+	input := map[string]interface{}{
+		"events": []interface{}{
+			map[string]interface{}{"id": 1.0, "seq": "first"},
+			map[string]interface{}{"id": "1", "seq": "string id"},
+			map[string]interface{}{"id": 1.0, "seq": "duplicate"},
+			map[string]interface{}{"seq": "no id"},
+			map[string]interface{}{"id": 2.0, "seq": "second"},
+		},
+	}
+
+	transforms := &Transformations{ArrayUniqueBy: parseFieldRules([]string{"events:id"})}
+	resultMap := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1).(map[string]interface{})
+
+	var seqs []interface{}
+	for _, event := range resultMap["events"].([]interface{}) {
+		seqs = append(seqs, event.(map[string]interface{})["seq"])
+	}
+	expected := []interface{}{"first", "string id", "no id", "second"}
+	if !reflect.DeepEqual(seqs, expected) {
+		t.Errorf("Expected %v, got %v", expected, seqs)
+	}
+}
+
+func TestArrayFlatten(t *testing.T) {
+	nested := []interface{}{
+		[]interface{}{1.0, []interface{}{2.0, []interface{}{3.0}}},
+		4.0,
+	}
+	input := map[string]interface{}{"once": nested, "twice": nested, "all": nested}
+
+	transforms := &Transformations{
+		ArrayFlatten: parseFlattenRules([]string{"once", "twice:2", "key=all depth=10"}),
+	}
+	resultMap := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1).(map[string]interface{})
+
+	tests := map[string][]interface{}{
+		"once":  {1.0, []interface{}{2.0, []interface{}{3.0}}, 4.0},
+		"twice": {1.0, 2.0, []interface{}{3.0}, 4.0},
+		"all":   {1.0, 2.0, 3.0, 4.0},
+	}
+	for key, expected := range tests {
+		if !reflect.DeepEqual(resultMap[key], expected) {
+			t.Errorf("%s: expected %v, got %v", key, expected, resultMap[key])
+		}
+	}
+}
+
+func TestArrayToMapAndBack(t *testing.T) {
+	users := []interface{}{
+		map[string]interface{}{"id": "u1", "name": "Alice"},
+		map[string]interface{}{"id": 2.0, "name": "Bob"},
+		map[string]interface{}{"id": "u1", "name": "Duplicate"},
+		map[string]interface{}{"name": "No id"},
+	}
+	input := map[string]interface{}{"users": users}
+
+	transforms := &Transformations{ArrayToMap: parseFieldRules([]string{"users:id"})}
+	resultMap := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1).(map[string]interface{})
+
+	expected := map[string]interface{}{
+		"u1": map[string]interface{}{"id": "u1", "name": "Alice"},
+		"2":  map[string]interface{}{"id": 2.0, "name": "Bob"},
+	}
+	if !reflect.DeepEqual(resultMap["users"], expected) {
+		t.Errorf("Expected %v, got %v", expected, resultMap["users"])
+	}
+
+	transforms = &Transformations{MapToArray: parseFieldRules([]string{"users:key"})}
+	resultMap = processJSON(map[string]interface{}{"users": expected}, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1).(map[string]interface{})
+
+	back := []interface{}{
+		map[string]interface{}{"id": 2.0, "name": "Bob", "key": "2"},
+		map[string]interface{}{"id": "u1", "name": "Alice", "key": "u1"},
+	}
+	if !reflect.DeepEqual(resultMap["users"], back) {
+		t.Errorf("Expected %v, got %v", back, resultMap["users"])
+	}
+	if _, exists := expected["u1"].(map[string]interface{})["key"]; exists {
+		t.Error("Expected the input objects to be left unmodified")
+	}
+}
+
+func TestUntouchedSubtreesShared(t *testing.T) {
+	untouched := map[string]interface{}{"name": "Alice", "tags": []interface{}{"a", "b"}}
+	changed := map[string]interface{}{"password": "secret", "id": 1.0}
+	list := []interface{}{1.0, 2.0}
+	input := map[string]interface{}{"user": untouched, "auth": changed, "list": list}
+
+	transforms := &Transformations{MaskVal: []MaskRule{{Pattern: "password", Mask: "***"}}}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}
+	resultMap := processJSON(input, filters, transforms, 1).(map[string]interface{})
+
+	if !sameValue(resultMap["user"], untouched) {
+		t.Error("Expected the untouched object to be returned as it is")
+	}
+	if !sameValue(resultMap["list"], list) {
+		t.Error("Expected the untouched array to be returned as it is")
+	}
+	if sameValue(resultMap["auth"], changed) {
+		t.Error("Expected the changed object to be copied")
+	}
+	if changed["password"] != "secret" {
+		t.Errorf("Expected the input to be left unmodified, got %v", changed["password"])
+	}
+	if sameValue(resultMap, input) {
+		t.Error("Expected the parent of a changed object to be copied")
+	}
+
+	// Nothing changes anywhere, so the whole document is shared
+	if result := processJSON(input, filters, &Transformations{}, 1); !sameValue(result, input) {
+		t.Error("Expected an unmodified document to be returned as it is")
+	}
+
+	// A dropped element copies the array up to it
+	rules, err := parseArrayFilterRules([]string{"number:-maxnum 1"}, "bytes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resultMap = processJSON(input, filters, &Transformations{ArrayFilter: rules}, 1).(map[string]interface{})
+	if !reflect.DeepEqual(resultMap["list"], []interface{}{1.0}) || len(list) != 2 {
+		t.Errorf("Expected [1] with the input left unmodified, got %v", resultMap["list"])
+	}
+}
+
+func TestEmptyArraysNull(t *testing.T) {
+	// Whether the sibling changes before or after the empty array is
+	// visited, the array comes out as null
+	filters, transforms, _ := parseArgs("test", []string{"-upperval", "x"})
+	expected := map[string]interface{}{"l": []interface{}(nil), "x": "A"}
+	for i := 0; i < 50; i++ {
+		input := map[string]interface{}{"l": []interface{}{}, "x": "a"}
+		if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, expected) {
+			t.Fatalf("Expected %v, got %#v", expected, result)
+		}
+	}
+
+	input := []interface{}{[]interface{}{}, 1.0}
+	if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, []interface{}{[]interface{}(nil), 1.0}) {
+		t.Errorf("Expected an empty element to come out as null, got %#v", result)
+	}
+}
+
 func TestCombinedTransformations(t *testing.T) {
 	input := createTestInput()
 
@@ -413,6 +1196,7 @@ func TestFilteringWithTransformations(t *testing.T) {
 		MinKeyLen:  4,
 		NoValTypes: []string{"null"},
 		MaxDepth:   999999,
+		MaxKeyLen:  999999,
 		MaxStrLen:  999999,
 	}
 
@@ -531,3 +1315,36 @@ func TestMain(m *testing.M) {
 	code := m.Run()
 	os.Exit(code)
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "out.json")
+	if err := os.WriteFile(filename, []byte(`{"old": true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(filename, []byte(`{"new": true}`)); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filename); string(data) != `{"new": true}` {
+		t.Errorf("Expected the new content, got %s", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected no temporary files to be left, got %v", entries)
+	}
+}
+
+func TestZeroLimits(t *testing.T) {
+	input := map[string]interface{}{"name": "Ann", "empty": "", "n": 1.0}
+
+	filters, transforms, _ := parseArgs("test", []string{"-maxstrlen", "0"})
+	expected := map[string]interface{}{"empty": "", "n": 1.0}
+	if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected -maxstrlen 0 to drop non-empty strings, got %v", result)
+	}
+
+	filters, transforms, _ = parseArgs("test", []string{"-maxdepth", "0"})
+	if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, map[string]interface{}{}) {
+		t.Errorf("Expected -maxdepth 0 to drop every key, got %v", result)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/jmespath/go-jmespath"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// FormatOptions selects how the input document is read and the processed
+// document is written.
+type FormatOptions struct {
+	InFormat  string
+	OutFormat string
+	// InferTypes reads CSV fields that look like numbers, booleans or null
+	// as such instead of as strings
+	InferTypes bool
+	// Delimiter separates CSV fields
+	Delimiter rune
+	// Columns is the CSV header order; by default every field is written in
+	// order of first appearance
+	Columns []string
+	// ProtoType is the message type of protobuf input and output
+	ProtoType protoreflect.MessageDescriptor
+	// Indent is the JSON indentation per level; empty for compact output
+	Indent          string
+	TrailingNewline bool
+	// Color highlights JSON written to a terminal, marking changed values
+	Color bool
+	// SplitByKey and ChunkSize write the output to several files named
+	// after SplitTemplate
+	SplitByKey    bool
+	ChunkSize     int
+	SplitTemplate string
+	// RemovedOut is the file receiving what the filters removed
+	RemovedOut string
+	// Template renders the output instead of the output format
+	Template *template.Template
+	// Query is a JMESPath expression applied to the processed document
+	// before it is written
+	Query *jmespath.JMESPath
+	// SQLTable is the table of sql and sqlite output, and SQLiteFile the
+	// database file of sqlite output, the output file when empty
+	SQLTable   string
+	SQLiteFile string
+}
+
+// formats lists the supported input and output formats.
+var formats = []string{"json", "csv", "toml", "yaml", "msgpack", "cbor", "proto"}
+
+// formatExtensions are the file extensions of the input formats, for
+// commands that read every file of a format in a directory.
+var formatExtensions = map[string][]string{
+	"json":    {".json"},
+	"csv":     {".csv"},
+	"toml":    {".toml"},
+	"yaml":    {".yaml", ".yml"},
+	"msgpack": {".msgpack", ".mpk"},
+	"cbor":    {".cbor"},
+	"proto":   {".pb", ".bin"},
+}
+
+// registerFormatFlags adds the format flags to a command's flag set. The
+// second returned function validates them once the flags have been parsed.
+func registerFormatFlags(opts *FormatOptions) (func(*flag.FlagSet), func() error) {
+	var delimiter, columns, protoDesc, protoType, indent, templateFile, query string
+	var compact bool
+	register := func(fs *flag.FlagSet) {
+		fs.StringVar(&opts.InFormat, "informat", "json", "Input format: json, csv, toml, yaml, msgpack, cbor or proto")
+		fs.StringVar(&opts.OutFormat, "outformat", "json", "Output format: json, csv, toml, yaml, msgpack, cbor, proto, parquet, sql:table or sqlite:[file.db:]table")
+		fs.StringVar(&delimiter, "csvdelimiter", ",", "Field delimiter for CSV input and output; tab or \\t for tabs")
+		fs.BoolVar(&opts.InferTypes, "csvinfer", false, "Read CSV fields that look like numbers, booleans or null as such")
+		fs.StringVar(&columns, "csvcolumns", "", "Comma-separated CSV header order; other fields are left out")
+		fs.StringVar(&protoDesc, "proto-desc", "", "Compiled FileDescriptorSet for protobuf input and output")
+		fs.StringVar(&protoType, "proto-type", "", "Full name of the protobuf message type, e.g. my.pkg.Event")
+		fs.BoolVar(&compact, "compact", false, "Write JSON on a single line without indentation")
+		fs.StringVar(&indent, "indent", "2", "JSON indentation: a number of spaces or tab")
+		fs.BoolVar(&opts.TrailingNewline, "trailing-newline", false, "End JSON output with a newline")
+		fs.BoolVar(&opts.Color, "color", false, "Colorize JSON written to a terminal and highlight changed values")
+		fs.BoolVar(&opts.SplitByKey, "split-by-key", false, "Write the value of each top-level key to its own file")
+		fs.IntVar(&opts.ChunkSize, "chunk-size", 0, "Split a top-level array into files of n elements each")
+		fs.StringVar(&opts.SplitTemplate, "split-template", "", "File name template for split output, with {key} or {n}")
+		fs.StringVar(&opts.RemovedOut, "removed-out", "", "Also write everything the filters removed, in its original structure, to this file")
+		fs.StringVar(&templateFile, "template", "", "Render the output through a Go text/template file instead")
+		fs.StringVar(&query, "query", "", "Apply a JMESPath expression to the processed document before output")
+	}
+
+	validate := func() error {
+		if !containsString(formats, opts.InFormat) {
+			return fmt.Errorf("Invalid -informat %q: must be one of %s", opts.InFormat, strings.Join(formats, ", "))
+		}
+		if name, table, ok := strings.Cut(opts.OutFormat, ":"); ok && containsString(tableFormats, name) {
+			opts.OutFormat, opts.SQLTable = name, table
+			if file, rest, ok := strings.Cut(table, ":"); ok && name == "sqlite" {
+				opts.SQLiteFile, opts.SQLTable = file, rest
+			}
+			if opts.SQLTable == "" {
+				return fmt.Errorf("Invalid -outformat %s: missing table name", name)
+			}
+		} else if !containsString(formats, opts.OutFormat) && opts.OutFormat != "parquet" {
+			return fmt.Errorf("Invalid -outformat %q: must be one of %s, parquet, sql:table or sqlite:[file.db:]table", opts.OutFormat, strings.Join(formats, ", "))
+		}
+
+		if delimiter == "tab" || delimiter == `\t` {
+			delimiter = "\t"
+		}
+		runes := []rune(delimiter)
+		if len(runes) != 1 {
+			return fmt.Errorf("Invalid -csvdelimiter %q: must be a single character", delimiter)
+		}
+		opts.Delimiter = runes[0]
+
+		if columns != "" {
+			opts.Columns = strings.Split(columns, ",")
+		}
+
+		switch n, err := strconv.Atoi(indent); {
+		case compact:
+			opts.Indent = ""
+		case indent == "tab":
+			opts.Indent = "\t"
+		case err == nil && n >= 0:
+			opts.Indent = strings.Repeat(" ", n)
+		default:
+			return fmt.Errorf("Invalid -indent %q: must be a number of spaces or tab", indent)
+		}
+
+		if opts.OutFormat == "sqlite" && (opts.SplitByKey || opts.ChunkSize > 0 || opts.RemovedOut != "" || templateFile != "") {
+			return fmt.Errorf("SQLite output cannot be combined with split output, -removed-out or -template")
+		}
+		if opts.SplitByKey && opts.ChunkSize > 0 {
+			return fmt.Errorf("-split-by-key and -chunk-size cannot be combined")
+		}
+		if opts.ChunkSize < 0 {
+			return fmt.Errorf("Invalid -chunk-size %d: must be positive", opts.ChunkSize)
+		}
+
+		if query != "" {
+			compiled, err := jmespath.Compile(query)
+			if err != nil {
+				return fmt.Errorf("Invalid -query: %v", err)
+			}
+			opts.Query = compiled
+		}
+
+		if templateFile != "" {
+			tmpl, err := loadTemplate(templateFile)
+			if err != nil {
+				return err
+			}
+			opts.Template = tmpl
+		}
+
+		if opts.InFormat == "proto" || opts.OutFormat == "proto" {
+			if protoDesc == "" || protoType == "" {
+				return fmt.Errorf("Protobuf input and output require -proto-desc and -proto-type")
+			}
+			desc, err := loadProtoType(protoDesc, protoType)
+			if err != nil {
+				return err
+			}
+			opts.ProtoType = desc
+		}
+		return nil
+	}
+
+	return register, validate
+}
+
+// readInput reads and decodes the input document in the input format. YAML
+// input with several documents gives a yamlStream. JSON input is checked
+// against the depth limit before it is decoded; other formats are checked by
+// the caller once decoded.
+func readInput(filename string, opts *FormatOptions, limits *Limits) (interface{}, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading input file: %v", err)
+	}
+	switch opts.InFormat {
+	case "json":
+		if err := limits.checkJSONDepth(data); err != nil {
+			return nil, err
+		}
+		return decodeJSON(data, filename)
+	case "toml":
+		return decodeTOML(data)
+	case "yaml":
+		return decodeYAML(data)
+	case "msgpack":
+		return decodeMsgpack(data)
+	case "cbor":
+		return decodeCBOR(data)
+	case "proto":
+		return decodeProto(data, opts.ProtoType)
+	default:
+		return decodeCSV(data, opts.Delimiter, opts.InferTypes)
+	}
+}
+
+// applyQuery applies the -query expression, if any, to the processed document.
+func applyQuery(result interface{}, opts *FormatOptions) (interface{}, error) {
+	if opts.Query == nil {
+		return result, nil
+	}
+	queried, err := opts.Query.Search(result)
+	if err != nil {
+		return nil, fmt.Errorf("Error evaluating -query: %v", err)
+	}
+	return queried, nil
+}
+
+// templateFuncs are the functions available to output templates besides the
+// text/template builtins.
+var templateFuncs = template.FuncMap{
+	"json":   compactJSON,
+	"join":   strings.Join,
+	"upper":  strings.ToUpper,
+	"lower":  strings.ToLower,
+	"scalar": func(value interface{}) string { str, _ := formatScalar(value); return str },
+}
+
+// loadTemplate parses an output template file.
+func loadTemplate(filename string) (*template.Template, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading template: %v", err)
+	}
+	tmpl, err := template.New(filename).Funcs(templateFuncs).Option("missingkey=zero").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// encodeOutput serializes the processed document in the output format, or
+// renders it through the output template.
+func encodeOutput(result interface{}, opts *FormatOptions) ([]byte, error) {
+	if opts.Template != nil {
+		var buf bytes.Buffer
+		if err := opts.Template.Execute(&buf, result); err != nil {
+			return nil, fmt.Errorf("Error rendering template: %v", err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	switch opts.OutFormat {
+	case "csv":
+		return encodeCSV(result, opts.Delimiter, opts.Columns)
+	case "toml":
+		return encodeTOML(result)
+	case "parquet":
+		return encodeParquet(result)
+	case "sql":
+		return encodeSQL(result, opts.SQLTable)
+	case "sqlite":
+		return nil, fmt.Errorf("SQLite output can only be written to a database file")
+	case "yaml":
+		return encodeYAML(result)
+	case "msgpack":
+		return encodeMsgpack(result)
+	case "cbor":
+		return encodeCBOR(result)
+	case "proto":
+		return encodeProto(result, opts.ProtoType)
+	default:
+		var output []byte
+		var err error
+		if opts.Indent == "" {
+			output, err = codec.Marshal(result)
+		} else {
+			output, err = codec.MarshalIndent(result, "", opts.Indent)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error marshaling JSON: %v", err)
+		}
+		if opts.TrailingNewline {
+			output = append(output, '\n')
+		}
+		return output, nil
+	}
+}
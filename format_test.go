@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestJSONOutputFormatting(t *testing.T) {
+	doc := map[string]interface{}{"a": []interface{}{1.0}}
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "{\n  \"a\": [\n    1\n  ]\n}"},
+		{[]string{"-compact", "-trailing-newline"}, "{\"a\":[1]}\n"},
+		{[]string{"-indent", "tab"}, "{\n\t\"a\": [\n\t\t1\n\t]\n}"},
+		{[]string{"-indent", "4"}, "{\n    \"a\": [\n        1\n    ]\n}"},
+	}
+	for _, test := range tests {
+		var opts FormatOptions
+		register, validate := registerFormatFlags(&opts)
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		register(fs)
+		if err := fs.Parse(test.args); err != nil {
+			t.Fatal(err)
+		}
+		if err := validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		output, err := encodeOutput(doc, &opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(output) != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.args, test.expected, output)
+		}
+	}
+
+	var opts FormatOptions
+	register, validate := registerFormatFlags(&opts)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	register(fs)
+	fs.Parse([]string{"-indent", "wide"})
+	if err := validate(); err == nil {
+		t.Error("Expected an error for an invalid -indent")
+	}
+}
+
+func TestTemplateOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.tmpl")
+	tmpl := `{{range .users}}{{.name | upper}} ({{scalar .age}}){{if .tags}}: {{json .tags}}{{end}}
+{{end}}`
+	if err := os.WriteFile(path, []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := loadTemplate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"name": "alice", "age": 30.0, "tags": []interface{}{"a"}},
+			map[string]interface{}{"name": "bob", "age": 25.5},
+		},
+	}
+
+	output, err := encodeOutput(doc, &FormatOptions{Template: parsed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "ALICE (30): [\"a\"]\nBOB (25.5)\n"
+	if string(output) != expected {
+		t.Errorf("Expected %q, got %q", expected, output)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	var opts FormatOptions
+	register, validate := registerFormatFlags(&opts)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	register(fs)
+	fs.Parse([]string{"-query", "orders[?total > `10`].id"})
+	if err := validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := map[string]interface{}{
+		"orders": []interface{}{
+			map[string]interface{}{"id": "a", "total": 5.0},
+			map[string]interface{}{"id": "b", "total": 50.0},
+		},
+	}
+	result, err := applyQuery(doc, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, []interface{}{"b"}) {
+		t.Errorf("Expected [b], got %v", result)
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	register(fs)
+	fs.Parse([]string{"-query", "orders[?"})
+	if err := validate(); err == nil {
+		t.Error("Expected an error for an invalid query")
+	}
+}
@@ -1,3 +1,31 @@
 module filter
 
 go 1.23.2
+
+require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/bytedance/sonic v1.15.0
+	github.com/fxamacker/cbor/v2 v2.7.0
+	github.com/jmespath/go-jmespath v0.4.0
+	github.com/json-iterator/go v1.1.12
+	github.com/mattn/go-sqlite3 v1.14.33
+	github.com/tetratelabs/wazero v1.9.0
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	go.starlark.net v0.0.0-20240725214946-42030a7cedce
+	golang.org/x/text v0.28.0
+	google.golang.org/protobuf v1.36.9
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/bytedance/gopkg v0.1.3 // indirect
+	github.com/bytedance/sonic/loader v0.5.0 // indirect
+	github.com/cloudwego/base64x v0.1.6 // indirect
+	github.com/klauspost/cpuid/v2 v2.2.9 // indirect
+	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
+	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+)
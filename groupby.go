@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GroupRule turns the arrays of keys matching Pattern into an object keyed
+// by the values of Field in their object elements, each key holding the
+// elements with that value in order. With Counts, each key holds an object
+// with the count of its elements and the elements as items instead.
+type GroupRule struct {
+	Pattern string
+	Field   string
+	Counts  bool
+	RuleOptions
+}
+
+// parseGroupRules parses -groupby rules of the form key:by=field, followed
+// by :counts for per-group counts.
+func parseGroupRules(flags []string) ([]GroupRule, error) {
+	var rules []GroupRule
+	for _, flag := range flags {
+		if fields, ok := parseRuleFields(flag, "key", "by", "counts", "under"); ok {
+			counts, err := strconv.ParseBool(fields["counts"])
+			if fields["counts"] != "" && err != nil {
+				return nil, fmt.Errorf("%q: counts must be true or false", flag)
+			}
+			if fields["by"] == "" {
+				return nil, fmt.Errorf("%q: missing by field", flag)
+			}
+			rules = append(rules, GroupRule{
+				Pattern:     fields["key"],
+				Field:       fields["by"],
+				Counts:      counts,
+				RuleOptions: RuleOptions{Under: fields["under"]},
+			})
+			continue
+		}
+		pattern, rest, _ := strings.Cut(flag, ":by=")
+		field, option, _ := strings.Cut(rest, ":")
+		if field == "" || (option != "" && option != "counts") {
+			return nil, fmt.Errorf("%q: must be key:by=field[:counts]", flag)
+		}
+		rules = append(rules, GroupRule{Pattern: pattern, Field: field, Counts: option == "counts"})
+	}
+	return rules, nil
+}
+
+// groupArray groups the object elements of arr by the value of the rule's
+// field. Elements that are not objects or lack a scalar field value are
+// dropped, as in arraytomap.
+func groupArray(arr []interface{}, rule GroupRule) map[string]interface{} {
+	groups := make(map[string][]interface{})
+	for _, item := range arr {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, ok := formatScalar(obj[rule.Field])
+		if !ok || obj[rule.Field] == nil {
+			continue
+		}
+		groups[id] = append(groups[id], item)
+	}
+
+	result := make(map[string]interface{}, len(groups))
+	for id, items := range groups {
+		if rule.Counts {
+			result[id] = map[string]interface{}{"count": float64(len(items)), "items": items}
+		} else {
+			result[id] = items
+		}
+	}
+	return result
+}
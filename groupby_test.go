@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupBy(t *testing.T) {
+	click := map[string]interface{}{"type": "click", "id": 1.0}
+	view := map[string]interface{}{"type": "view", "id": 2.0}
+	click2 := map[string]interface{}{"type": "click", "id": 3.0}
+	input := map[string]interface{}{
+		"events": []interface{}{click, view, "noise", map[string]interface{}{"id": 4.0}, click2},
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{"-groupby", "events:by=type"})
+	expected := map[string]interface{}{
+		"events": map[string]interface{}{
+			"click": []interface{}{click, click2},
+			"view":  []interface{}{view},
+		},
+	}
+	if result := processDocument(input, "", filters, transforms); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected events grouped by type, got %v", result)
+	}
+
+	filters, transforms, _ = parseArgs("test", []string{"-groupby", "key=events by=type counts=true"})
+	expected = map[string]interface{}{
+		"events": map[string]interface{}{
+			"click": map[string]interface{}{"count": 2.0, "items": []interface{}{click, click2}},
+			"view":  map[string]interface{}{"count": 1.0, "items": []interface{}{view}},
+		},
+	}
+	if result := processDocument(input, "", filters, transforms); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected groups with counts, got %v", result)
+	}
+
+	for _, flag := range []string{"events", "events:by=", "events:by=type:total"} {
+		if _, err := parseGroupRules([]string{flag}); err == nil {
+			t.Errorf("Expected -groupby %q to be rejected", flag)
+		}
+	}
+}
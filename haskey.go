@@ -0,0 +1,45 @@
+package main
+
+// hasKeyFilters reports whether filters select array elements by the
+// presence of a field.
+func (f *Filters) hasKeyFilters() bool {
+	return len(f.HasKeys)+len(f.NotHasKeys) > 0
+}
+
+// keepsElement reports whether an array element passes the record
+// selectors: objects must have a field matching every -haskey name, none
+// matching a -nothaskey name, and satisfy every -where clause. Elements that
+// are not objects are not affected.
+func (f *Filters) keepsElement(element interface{}) bool {
+	obj, ok := element.(map[string]interface{})
+	if !ok || !f.hasKeyFilters() && len(f.Where) == 0 {
+		return true
+	}
+	if !f.matchesWhere(obj) {
+		return false
+	}
+	for _, pattern := range f.HasKeys {
+		if !hasMatchingKey(obj, pattern, f.IgnoreKeyCase) {
+			return false
+		}
+	}
+	for _, pattern := range f.NotHasKeys {
+		if hasMatchingKey(obj, pattern, f.IgnoreKeyCase) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasMatchingKey reports whether obj has a key matching pattern.
+func hasMatchingKey(obj map[string]interface{}, pattern string, ignoreCase bool) bool {
+	if _, ok := obj[pattern]; ok {
+		return true
+	}
+	for key := range obj {
+		if matchKey(pattern, key, ignoreCase) {
+			return true
+		}
+	}
+	return false
+}
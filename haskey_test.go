@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHasKey(t *testing.T) {
+	input := map[string]interface{}{
+		"meta": map[string]interface{}{"count": 3.0},
+		"records": []interface{}{
+			map[string]interface{}{"id": 1.0, "error": "timeout"},
+			map[string]interface{}{"id": 2.0},
+			map[string]interface{}{"id": 3.0, "error": nil, "retry_at": "soon"},
+			"not an object",
+		},
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{"-haskey", "error"})
+	expected := map[string]interface{}{
+		"meta": map[string]interface{}{"count": 3.0},
+		"records": []interface{}{
+			map[string]interface{}{"id": 1.0, "error": "timeout"},
+			map[string]interface{}{"id": 3.0, "error": nil, "retry_at": "soon"},
+			"not an object",
+		},
+	}
+	if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected only records with an error field, got %v", result)
+	}
+
+	filters, transforms, _ = parseArgs("test", []string{"-nothaskey", "retry_*", "-nothaskey", "error"})
+	records := processJSON(input, filters, transforms, 1).(map[string]interface{})["records"]
+	expectedRecords := []interface{}{map[string]interface{}{"id": 2.0}, "not an object"}
+	if !reflect.DeepEqual(records, expectedRecords) {
+		t.Errorf("Expected only records without error or retry fields, got %v", records)
+	}
+
+	filters = &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999, HasKeys: []string{"ERROR"}, IgnoreKeyCase: true}
+	if !filters.keepsElement(map[string]interface{}{"error": 1.0}) {
+		t.Error("Expected -ignorekeycase to apply to -haskey")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpFailures lists the failure policies of httpenrich rules.
+var httpFailures = []string{"skip", "null", "error"}
+
+// httpClient makes the httpenrich requests; -httptimeout sets its timeout.
+var httpClient = &http.Client{Timeout: 5 * time.Second}
+
+// httpCache holds the result of every URL requested so far, so each one is
+// requested only once per run.
+var httpCache sync.Map
+
+// httpResult is a cached httpenrich response.
+type httpResult struct {
+	value interface{}
+	err   error
+}
+
+// parseHTTPRules parses httpenrich rules, key:into:url or the field form
+// with key, url, into, onerror and under.
+func parseHTTPRules(flags []string) ([]HTTPRule, error) {
+	var rules []HTTPRule
+	for _, flag := range flags {
+		var rule HTTPRule
+		if fields, ok := parseRuleFields(flag, "key", "url", "into", "onerror", "under"); ok {
+			rule = HTTPRule{
+				Pattern:     fields["key"],
+				URL:         fields["url"],
+				Into:        fields["into"],
+				OnError:     fields["onerror"],
+				RuleOptions: RuleOptions{Under: fields["under"]},
+			}
+		} else {
+			parts := strings.SplitN(flag, ":", 3)
+			if len(parts) != 3 {
+				return nil, fmt.Errorf("%q: must be key:into:url", flag)
+			}
+			rule = HTTPRule{Pattern: parts[0], Into: parts[1], URL: parts[2]}
+		}
+
+		if rule.Pattern == "" || rule.Into == "" || rule.URL == "" {
+			return nil, fmt.Errorf("%q: needs a key, a target key and a URL", flag)
+		}
+		if u, err := url.Parse(strings.ReplaceAll(rule.URL, "{value}", "x")); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("%q: invalid http or https URL", flag)
+		}
+		if rule.OnError == "" {
+			rule.OnError = "skip"
+		}
+		if !containsString(httpFailures, rule.OnError) {
+			return nil, fmt.Errorf("%q: onerror must be one of %s", flag, strings.Join(httpFailures, ", "))
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// fetchJSON requests the rule's URL for a value and decodes the JSON
+// response. Responses are cached by URL, failures included.
+func fetchJSON(ctx context.Context, str string, rule HTTPRule) (interface{}, error) {
+	target := strings.ReplaceAll(rule.URL, "{value}", strings.ReplaceAll(url.QueryEscape(str), "+", "%20"))
+
+	if cached, ok := httpCache.Load(target); ok {
+		result := cached.(httpResult)
+		return result.value, result.err
+	}
+	result := requestJSON(ctx, target)
+	if ctx.Err() != nil {
+		// Not the response's fault, so it is not cached
+		return nil, ctx.Err()
+	}
+	httpCache.Store(target, result)
+	return result.value, result.err
+}
+
+func requestJSON(ctx context.Context, target string) httpResult {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return httpResult{err: err}
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return httpResult{err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return httpResult{err: fmt.Errorf("%s: %s", target, resp.Status)}
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return httpResult{err: fmt.Errorf("%s: %v", target, err)}
+	}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return httpResult{err: fmt.Errorf("%s: invalid JSON response: %v", target, err)}
+	}
+	return httpResult{value: doc}
+}
+
+// httpEnrichValue returns the response to insert for value and whether to
+// insert it at all, applying the rule's failure policy; error returns the
+// error that stops the run. Null, objects and arrays are not looked up.
+func httpEnrichValue(ctx context.Context, value interface{}, rule HTTPRule) (interface{}, bool, error) {
+	str, ok := formatScalar(value)
+	if !ok || value == nil {
+		return nil, false, nil
+	}
+
+	doc, err := fetchJSON(ctx, str, rule)
+	if err == nil {
+		return doc, true, nil
+	}
+	if ctx.Err() != nil {
+		return nil, false, nil
+	}
+
+	switch rule.OnError {
+	case "null":
+		return nil, true, nil
+	case "error":
+		return nil, false, fmt.Errorf("Error in httpenrich %s: %v", rule.Pattern, err)
+	}
+	return nil, false, nil
+}
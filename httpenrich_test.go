@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHTTPEnrich(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path == "/accounts/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"id": "` + strings.TrimPrefix(r.URL.Path, "/accounts/") + `", "tier": "gold"}`))
+	}))
+	defer server.Close()
+
+	rules, err := parseHTTPRules([]string{
+		"account_id:account:" + server.URL + "/accounts/{value}",
+		"key=owner_id into=owner url=" + server.URL + "/accounts/{value} onerror=null",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := []interface{}{
+		map[string]interface{}{"account_id": "a 1", "owner_id": "missing"},
+		map[string]interface{}{"account_id": "a 1"},
+		map[string]interface{}{"account_id": "missing"},
+	}
+	result := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, &Transformations{HTTPEnrich: rules}, 1)
+
+	account := map[string]interface{}{"id": "a 1", "tier": "gold"}
+	expected := []interface{}{
+		map[string]interface{}{"account_id": "a 1", "account": account, "owner_id": "missing", "owner": nil},
+		map[string]interface{}{"account_id": "a 1", "account": account},
+		map[string]interface{}{"account_id": "missing"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("Expected responses to be cached, got %d requests", n)
+	}
+
+	// A failed request stops processing with an error
+	rules, err = parseHTTPRules([]string{"key=account_id into=account url=" + server.URL + "/accounts/{value} onerror=error"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline, err := NewPipeline(&Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, &Transformations{HTTPEnrich: rules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	processed, err := pipeline.Process(input, "test")
+	if err == nil || !strings.Contains(err.Error(), "404 Not Found") || processed != nil {
+		t.Errorf("Expected a failed request to stop processing, got %v, %v", processed, err)
+	}
+}
+
+func TestHTTPEnrichInvalid(t *testing.T) {
+	for _, flag := range []string{
+		"account_id:account",
+		"account_id:account:ftp://example.com/{value}",
+		"key=id into=account url=https://example.com/{value} onerror=retry",
+	} {
+		if _, err := parseHTTPRules([]string{flag}); err == nil {
+			t.Errorf("Expected an error for %s", flag)
+		}
+	}
+}
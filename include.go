@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// loadConfig reads and decodes a config file along with the files it
+// includes, relative to its own directory. Included files are layered in
+// order underneath the including one, so later definitions override earlier
+// ones.
+func loadConfig(filename string) (*Config, error) {
+	return loadIncludedConfig(filename, nil)
+}
+
+// loadIncludedConfig loads a config file included through chain, the files
+// including it, outermost first.
+func loadIncludedConfig(filename string, chain []string) (*Config, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading config file: %v", err)
+	}
+	for i, including := range chain {
+		if including == abs {
+			cycle := append(append([]string(nil), chain[i:]...), abs)
+			return nil, fmt.Errorf("Error in config file %s: include cycle %s", filename, strings.Join(cycle, " -> "))
+		}
+	}
+
+	config, err := readConfigFile(filename)
+	if err != nil || len(config.Include) == 0 {
+		return config, err
+	}
+
+	merged := &Config{}
+	for _, include := range config.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(filename), include)
+		}
+		included, err := loadIncludedConfig(include, append(chain, abs))
+		if err != nil {
+			return nil, err
+		}
+		merged = merged.layer(included)
+	}
+	return merged.layer(config), nil
+}
+
+// layer returns c with over layered on top: options of over override those
+// of c, its rules follow them, and its profiles and stages replace those of
+// the same name, other stages being added after those of c. Vars and
+// patterns are overridden like options.
+func (c *Config) layer(over *Config) *Config {
+	result := &Config{
+		Vars:     make(map[string]interface{}, len(c.Vars)+len(over.Vars)),
+		Options:  make(map[string]interface{}, len(c.Options)+len(over.Options)),
+		Rules:    append(append([]ConfigRule(nil), c.Rules...), over.Rules...),
+		Profiles: make(map[string]Profile, len(c.Profiles)+len(over.Profiles)),
+		Stages:   append([]Stage(nil), c.Stages...),
+		Patterns: make(map[string]string, len(c.Patterns)+len(over.Patterns)),
+	}
+	for name, pattern := range c.Patterns {
+		result.Patterns[name] = pattern
+	}
+	for name, pattern := range over.Patterns {
+		result.Patterns[name] = pattern
+	}
+	for name, value := range c.Vars {
+		result.Vars[name] = value
+	}
+	for name, value := range over.Vars {
+		result.Vars[name] = value
+	}
+	for key, value := range c.Options {
+		result.Options[key] = value
+	}
+	for key, value := range over.Options {
+		result.Options[key] = value
+	}
+	for name, profile := range c.Profiles {
+		result.Profiles[name] = profile
+	}
+	for name, profile := range over.Profiles {
+		result.Profiles[name] = profile
+	}
+
+	stages := make(map[string]int, len(result.Stages))
+	for i, stage := range result.Stages {
+		stages[stage.Name] = i
+	}
+	for _, stage := range over.Stages {
+		if i, ok := stages[stage.Name]; ok {
+			result.Stages[i] = stage
+		} else {
+			result.Stages = append(result.Stages, stage)
+		}
+	}
+	return result
+}
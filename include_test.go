@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigInclude(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"shared/pii-rules.json": `{
+  "options": {"minkeylen": 2, "dropkey": ["ssn"]},
+  "rules": [{"maskval": "email:***"}],
+  "profiles": {"dev": {"options": {"minkeylen": 1}}},
+  "stages": [{"name": "mask", "rules": [{"maskval": "phone:***"}]}]
+}`,
+		"project.json": `{
+  "include": ["shared/pii-rules.json"],
+  "options": {"minkeylen": 3},
+  "rules": [{"maskval": "name:***"}],
+  "stages": [
+    {"name": "mask", "rules": [{"maskval": "phone:[phone]"}]},
+    {"name": "project", "options": {"dropkey": ["internal"]}}
+  ]
+}`,
+		"cycle-a.json": `{"include": ["cycle-b.json"]}`,
+		"cycle-b.json": `{"include": ["cycle-a.json"]}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+	}
+
+	config, err := loadConfig(filepath.Join(dir, "project.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Options["minkeylen"] != 3.0 || !reflect.DeepEqual(config.Options["dropkey"], []interface{}{"ssn"}) {
+		t.Errorf("Expected project options layered over the shared ones, got %v", config.Options)
+	}
+	if len(config.Rules) != 2 || config.Rules[0].Value != "email:***" || config.Rules[1].Value != "name:***" {
+		t.Errorf("Expected shared rules ahead of project rules, got %v", config.Rules)
+	}
+	if _, ok := config.Profiles["dev"]; !ok {
+		t.Errorf("Expected the shared profile to be kept, got %v", config.Profiles)
+	}
+	if len(config.Stages) != 2 || config.Stages[0].Rules[0].Value != "phone:[phone]" || config.Stages[1].Name != "project" {
+		t.Errorf("Expected the project mask stage to replace the shared one, got %v", config.Stages)
+	}
+
+	_, err = loadConfig(filepath.Join(dir, "cycle-a.json"))
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("Expected an include cycle error, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// JoinRule enriches the object elements of arrays of keys matching Pattern
+// with the record of File whose Remote field equals their Local field. The
+// record is added under As, or merged into the element without it, the
+// element's own fields winning. Elements without a match are kept, with As
+// set to null: a left join.
+type JoinRule struct {
+	Pattern string
+	File    string
+	Local   string
+	Remote  string
+	As      string
+	table   map[string]interface{}
+	RuleOptions
+}
+
+// parseJoinRules parses join rules, key:with=file:on=field[:as=name] or the
+// field form with key, with, on, as and under, and loads their files. The
+// field can be local=remote when the two sides name it differently.
+func parseJoinRules(flags []string) ([]JoinRule, error) {
+	var rules []JoinRule
+	for _, flag := range flags {
+		fields, ok := parseRuleFields(flag, "key", "with", "on", "as", "under")
+		if !ok {
+			parts := strings.Split(flag, ":")
+			fields = map[string]string{"key": parts[0]}
+			for _, part := range parts[1:] {
+				name, value, found := strings.Cut(part, "=")
+				if !found || (name != "with" && name != "on" && name != "as") {
+					return nil, fmt.Errorf("%q: must be key:with=file:on=field[:as=name]", flag)
+				}
+				fields[name] = value
+			}
+		}
+		if fields["key"] == "" || fields["with"] == "" || fields["on"] == "" {
+			return nil, fmt.Errorf("%q: needs a key, a with file and an on field", flag)
+		}
+
+		rule := JoinRule{
+			Pattern:     fields["key"],
+			File:        fields["with"],
+			As:          fields["as"],
+			RuleOptions: RuleOptions{Under: fields["under"]},
+		}
+		rule.Local, rule.Remote, _ = strings.Cut(fields["on"], "=")
+		if rule.Remote == "" {
+			rule.Remote = rule.Local
+		}
+		table, err := loadLookupTable(rule.File, rule.Remote, "")
+		if err != nil {
+			return nil, err
+		}
+		rule.table = table
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// joinArray returns arr with the rule's records joined into its object
+// elements. Other elements are left alone.
+func joinArray(arr []interface{}, rule JoinRule) []interface{} {
+	result := make([]interface{}, len(arr))
+	for i, item := range arr {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			result[i] = item
+			continue
+		}
+		var record interface{}
+		if key, ok := formatScalar(obj[rule.Local]); ok && obj[rule.Local] != nil {
+			record = rule.table[key]
+		}
+
+		joined := make(map[string]interface{}, len(obj)+1)
+		if fields, ok := record.(map[string]interface{}); ok && rule.As == "" {
+			for k, v := range fields {
+				joined[k] = v
+			}
+		}
+		for k, v := range obj {
+			joined[k] = v
+		}
+		if rule.As != "" {
+			joined[rule.As] = record
+		}
+		result[i] = joined
+	}
+	return result
+}
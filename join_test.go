@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestJoin(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "departments.json")
+	if err := os.WriteFile(file, []byte(`[{"id": 1, "name": "Sales"}, {"id": 2, "name": "Ops"}]`), 0644); err != nil {
+		t.Fatalf("Failed to write departments: %v", err)
+	}
+	sales := map[string]interface{}{"id": 1.0, "name": "Sales"}
+	input := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"name": "ann", "dept_id": 1.0},
+			map[string]interface{}{"name": "bob", "dept_id": 9.0},
+			"noise",
+		},
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{"-join", "users:with=" + file + ":on=dept_id=id:as=department"})
+	expected := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"name": "ann", "dept_id": 1.0, "department": sales},
+			map[string]interface{}{"name": "bob", "dept_id": 9.0, "department": nil},
+			"noise",
+		},
+	}
+	if result := processDocument(input, "", filters, transforms); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected users left-joined with departments, got %v", result)
+	}
+
+	filters, transforms, _ = parseArgs("test", []string{"-join", "key=users with=" + file + " on=dept_id=id"})
+	first := processDocument(input, "", filters, transforms).(map[string]interface{})["users"].([]interface{})[0]
+	if !reflect.DeepEqual(first, map[string]interface{}{"name": "ann", "dept_id": 1.0, "id": 1.0}) {
+		t.Errorf("Expected department merged with the user's own fields winning, got %v", first)
+	}
+
+	for _, flag := range []string{"users", "users:with=" + file, "users:on=id", "users:with=" + file + ":on=id:into=x"} {
+		if _, err := parseJoinRules([]string{flag}); err == nil {
+			t.Errorf("Expected -join %q to be rejected", flag)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+// Limits are safety limits for untrusted input. Zero means no limit.
+type Limits struct {
+	// Timeout bounds the time spent processing the document
+	Timeout time.Duration
+	// MaxDepth rejects input nested more deeply than this
+	MaxDepth int
+	// MaxOutputBytes rejects output larger than this, in total over all
+	// files of split output
+	MaxOutputBytes int64
+}
+
+// registerLimitFlags adds the limit flags to a command's flag set.
+func registerLimitFlags(limits *Limits) func(*flag.FlagSet) {
+	return func(fs *flag.FlagSet) {
+		fs.DurationVar(&limits.Timeout, "timeout", 0, "Stop processing after this long, e.g. 30s")
+		fs.IntVar(&limits.MaxDepth, "max-depth-hard", 0, "Reject input nested more than n levels deep")
+		fs.Int64Var(&limits.MaxOutputBytes, "max-output-bytes", 0, "Reject output larger than n bytes")
+	}
+}
+
+// checkDepth returns an error if doc has objects or arrays nested more than
+// MaxDepth levels deep. It walks the document without recursion, so that
+// pathological nesting cannot exhaust the stack.
+func (l *Limits) checkDepth(doc interface{}) error {
+	if l.MaxDepth <= 0 {
+		return nil
+	}
+	type entry struct {
+		value interface{}
+		depth int
+	}
+	stack := []entry{{doc, 0}}
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch v := e.value.(type) {
+		case map[string]interface{}:
+			if e.depth+1 > l.MaxDepth {
+				return fmt.Errorf("Input nested more than %d levels deep (-max-depth-hard)", l.MaxDepth)
+			}
+			for _, item := range v {
+				stack = append(stack, entry{item, e.depth + 1})
+			}
+		case []interface{}:
+			if e.depth+1 > l.MaxDepth {
+				return fmt.Errorf("Input nested more than %d levels deep (-max-depth-hard)", l.MaxDepth)
+			}
+			for _, item := range v {
+				stack = append(stack, entry{item, e.depth + 1})
+			}
+		}
+	}
+	return nil
+}
+
+// checkJSONDepth is checkDepth for JSON input, scanning the text before it
+// is decoded, so that deeply nested input is rejected before the decoder
+// builds a tree of it. Malformed JSON is left to the decoder to report.
+func (l *Limits) checkJSONDepth(data []byte) error {
+	if l.MaxDepth <= 0 {
+		return nil
+	}
+	depth := 0
+	inString, escaped := false, false
+	for _, c := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			escaped = c == '\\'
+			inString = c != '"'
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			if depth++; depth > l.MaxDepth {
+				return fmt.Errorf("Input nested more than %d levels deep (-max-depth-hard)", l.MaxDepth)
+			}
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+	return nil
+}
+
+// checkOutputSize returns an error if size bytes of output exceed
+// MaxOutputBytes.
+func (l *Limits) checkOutputSize(size int64) error {
+	if l.MaxOutputBytes > 0 && size > l.MaxOutputBytes {
+		return fmt.Errorf("Output of %d bytes exceeds -max-output-bytes %d; nothing written", size, l.MaxOutputBytes)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	doc := map[string]interface{}{
+		"a": map[string]interface{}{"b": []interface{}{1.0, map[string]interface{}{"c": 1.0}}},
+		"d": 1.0,
+	}
+
+	if err := (&Limits{MaxDepth: 4}).checkDepth(doc); err != nil {
+		t.Errorf("Expected a document 4 levels deep to pass, got %v", err)
+	}
+	if err := (&Limits{MaxDepth: 3}).checkDepth(doc); err == nil {
+		t.Error("Expected a document 4 levels deep to exceed a limit of 3")
+	}
+	if err := (&Limits{}).checkDepth(doc); err != nil {
+		t.Errorf("Expected no limit by default, got %v", err)
+	}
+
+	// Nesting far beyond what recursion would handle comfortably
+	var deep interface{} = 1.0
+	for i := 0; i < 100000; i++ {
+		deep = []interface{}{deep}
+	}
+	if err := (&Limits{MaxDepth: 1000}).checkDepth(deep); err == nil {
+		t.Error("Expected pathological nesting to be rejected")
+	}
+
+	// JSON is checked before it is decoded, ignoring brackets in strings
+	text := []byte(`{"a": {"b": [1, {"c": "[{\"[{"}]}, "d": 1}`)
+	if err := (&Limits{MaxDepth: 4}).checkJSONDepth(text); err != nil {
+		t.Errorf("Expected JSON 4 levels deep to pass, got %v", err)
+	}
+	if err := (&Limits{MaxDepth: 3}).checkJSONDepth(text); err == nil {
+		t.Error("Expected JSON 4 levels deep to exceed a limit of 3")
+	}
+	filename := filepath.Join(t.TempDir(), "deep.json")
+	if err := os.WriteFile(filename, []byte(strings.Repeat("[", 100000)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := readInput(filename, &FormatOptions{InFormat: "json"}, &Limits{MaxDepth: 1000})
+	if err == nil || !strings.Contains(err.Error(), "-max-depth-hard") {
+		t.Errorf("Expected deep JSON to be rejected before decoding, got %v", err)
+	}
+
+	limits := &Limits{MaxOutputBytes: 10}
+	if err := limits.checkOutputSize(10); err != nil {
+		t.Errorf("Expected output at the limit to pass, got %v", err)
+	}
+	if err := limits.checkOutputSize(11); err == nil {
+		t.Error("Expected output over the limit to be rejected")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+)
+
+// lineageKey is the field added to each output record holding its lineage ID.
+const lineageKey = "_lineage"
+
+// processRecords processes each record of a document separately and tags it
+// with a lineage ID. A top-level array holds one record per element; any other
+// document is a single record at offset 0.
+func processRecords(data interface{}, source string, filters *Filters, transforms *Transformations) interface{} {
+	items, ok := data.([]interface{})
+	if !ok {
+		id := lineageID(data, source, 0, transforms.Lineage)
+		return tagLineage(processJSON(data, filters, transforms, 1), id)
+	}
+
+	var result []interface{}
+	for i, item := range items {
+		id := lineageID(item, source, i, transforms.Lineage)
+
+		// Process the element as a one-element array so array filters and
+		// depth counting behave exactly as for the whole document
+		processed := processJSON([]interface{}{item}, filters, transforms, 1).([]interface{})
+		for _, record := range processed {
+			result = append(result, tagLineage(record, id))
+		}
+	}
+	return result
+}
+
+// removedRecords is removedDocument for documents processed by record: what
+// the filters remove from each record carries the record's lineage ID, so
+// that rejects can be traced back to their source. Records with nothing
+// removed are left out.
+func removedRecords(data interface{}, source string, filters *Filters, transforms *Transformations) interface{} {
+	items, ok := data.([]interface{})
+	if !ok {
+		removed := removedDocument(data, filters, transforms)
+		if obj, ok := removed.(map[string]interface{}); ok && len(obj) > 0 {
+			return tagLineage(removed, lineageID(data, source, 0, transforms.Lineage))
+		}
+		return removed
+	}
+
+	result := []interface{}{}
+	for i, item := range items {
+		id := lineageID(item, source, i, transforms.Lineage)
+		if removed, ok := removedJSON([]interface{}{item}, filters, transforms, 1); ok {
+			for _, record := range removed.([]interface{}) {
+				result = append(result, tagLineage(record, id))
+			}
+		}
+	}
+	return result
+}
+
+// recordLineage returns the lineage ID of the record of doc that path, as
+// listed by the paths subcommand, lies in, or "" if it has none.
+func recordLineage(doc interface{}, path string) string {
+	record := doc
+	if items, ok := doc.([]interface{}); ok {
+		var i int
+		if _, err := fmt.Sscanf(path, "$[%d]", &i); err != nil || i < 0 || i >= len(items) {
+			return ""
+		}
+		record = items[i]
+	}
+	obj, _ := record.(map[string]interface{})
+	id, _ := obj[lineageKey].(string)
+	return id
+}
+
+// lineageID returns the stable ID for a record: the value of the configured ID
+// field when the record has one, otherwise the source file and record offset.
+func lineageID(record interface{}, source string, offset int, rule *LineageRule) string {
+	if rule.Field != "" {
+		if obj, ok := record.(map[string]interface{}); ok && obj[rule.Field] != nil {
+			if id, ok := formatScalar(obj[rule.Field]); ok {
+				return id
+			}
+		}
+	}
+	return fmt.Sprintf("%s#%d", source, offset)
+}
+
+// tagLineage adds the lineage ID to object records. Scalars and arrays have
+// nowhere to carry it and are returned unchanged. The record is copied, as
+// untouched records are shared with the input.
+func tagLineage(record interface{}, id string) interface{} {
+	obj, ok := record.(map[string]interface{})
+	if !ok {
+		return record
+	}
+	tagged := make(map[string]interface{}, len(obj)+1)
+	for key, value := range obj {
+		tagged[key] = value
+	}
+	tagged[lineageKey] = id
+	return tagged
+}
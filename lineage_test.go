@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestLineage(t *testing.T) {
+	input := []interface{}{
+		map[string]interface{}{"id": 7.0, "name": "first"},
+		map[string]interface{}{"name": "second"},
+		map[string]interface{}{"id": "abc", "name": "third"},
+	}
+
+	transforms := &Transformations{
+		Lineage: &LineageRule{Field: "id"},
+	}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}
+
+	result := processDocument(input, "events.json", filters, transforms)
+	records, ok := result.([]interface{})
+	if !ok {
+		t.Fatalf("Expected result to be an array, got %T", result)
+	}
+
+	expected := []string{"7", "events.json#1", "abc"}
+	for i, id := range expected {
+		record := records[i].(map[string]interface{})
+		if record[lineageKey] != id {
+			t.Errorf("Expected record %d to have lineage %s, got %v", i, id, record[lineageKey])
+		}
+		if _, exists := input[i].(map[string]interface{})[lineageKey]; exists {
+			t.Errorf("Expected input record %d to be left unmodified", i)
+		}
+	}
+}
+
+func TestLineageSingleDocument(t *testing.T) {
+	input := createTestInput()
+
+	transforms := &Transformations{
+		Lineage: &LineageRule{},
+	}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}
+
+	result := processDocument(input, "input.json", filters, transforms)
+	resultMap, ok := result.(map[string]interface{})
+	if !ok {
+		t.Fatal("Result is not a map")
+	}
+
+	if resultMap[lineageKey] != "input.json#0" {
+		t.Errorf("Expected lineage input.json#0, got %v", resultMap[lineageKey])
+	}
+}
+
+func TestLineageRejects(t *testing.T) {
+	input := []interface{}{
+		map[string]interface{}{"name": "a", "ssn": "123"},
+		map[string]interface{}{"name": "b"},
+		map[string]interface{}{"name": "c", "ssn": "456"},
+	}
+	expected := []interface{}{
+		map[string]interface{}{"ssn": "123", lineageKey: "in.json#0"},
+		map[string]interface{}{"ssn": "456", lineageKey: "in.json#2"},
+	}
+
+	// Removed output
+	filters, transforms, _ := parseArgs("test", []string{"-lineage", "-dropkey", "ssn"})
+	if removed := removedRecords(input, "in.json", filters, transforms); !reflect.DeepEqual(removed, expected) {
+		t.Errorf("Expected removed values tagged with their record, got %v", removed)
+	}
+
+	// Inverted output
+	filters, transforms, _ = parseArgs("test", []string{"-lineage", "-dropkey", "ssn", "-invert"})
+	if result := processDocument(input, "in.json", filters, transforms); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected inverted output tagged with its record, got %v", result)
+	}
+
+	// Assertion violations
+	filters, transforms, _ = parseArgs("test", []string{"-lineage"})
+	assertions := &Assertions{Absent: []*regexp.Regexp{regexp.MustCompile("^456$")}}
+	violations := assertions.check(processDocument(input, "in.json", filters, transforms))
+	if want := []string{"$[2].ssn (record in.json#2): value matches ^456$"}; !reflect.DeepEqual(violations, want) {
+		t.Errorf("Expected the violation to name its record, got %v", violations)
+	}
+}
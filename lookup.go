@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// lookupMissing lists the behaviors for values missing from a lookup table.
+var lookupMissing = []string{"keep", "null", "error"}
+
+// parseLookupRules parses lookup rules, key:file:from:to[:missing] or the
+// field form with key, file, from, to, missing, into and under, and loads
+// their tables.
+func parseLookupRules(flags []string) ([]LookupRule, error) {
+	var rules []LookupRule
+	for _, flag := range flags {
+		var rule LookupRule
+		if fields, ok := parseRuleFields(flag, "key", "file", "from", "to", "missing", "into", "under"); ok {
+			rule = LookupRule{
+				Pattern:     fields["key"],
+				File:        fields["file"],
+				From:        fields["from"],
+				To:          fields["to"],
+				Missing:     fields["missing"],
+				Into:        fields["into"],
+				RuleOptions: RuleOptions{Under: fields["under"]},
+			}
+		} else {
+			parts := strings.Split(flag, ":")
+			if len(parts) < 2 || len(parts) > 5 {
+				return nil, fmt.Errorf("%q: must be key:file[:from:to[:missing]]", flag)
+			}
+			rule = LookupRule{Pattern: parts[0], File: parts[1]}
+			if len(parts) >= 4 {
+				rule.From, rule.To = parts[2], parts[3]
+			} else if len(parts) == 3 {
+				return nil, fmt.Errorf("%q: from needs a to column", flag)
+			}
+			if len(parts) == 5 {
+				rule.Missing = parts[4]
+			}
+		}
+
+		if rule.Pattern == "" || rule.File == "" {
+			return nil, fmt.Errorf("%q: needs a key and a file", flag)
+		}
+		if rule.Missing == "" {
+			rule.Missing = "keep"
+		}
+		if !containsString(lookupMissing, rule.Missing) {
+			return nil, fmt.Errorf("%q: missing must be one of %s", flag, strings.Join(lookupMissing, ", "))
+		}
+
+		table, err := loadLookupTable(rule.File, rule.From, rule.To)
+		if err != nil {
+			return nil, err
+		}
+		rule.table = table
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// loadLookupTable reads a mapping from a CSV file with a header row, using
+// the from and to columns, or from a JSON file: an array of objects with the
+// from and to fields, or a plain object when from and to are not given.
+// Keys are compared as text, so the number 44 matches the code "44". With
+// from but not to, a JSON table maps to the whole objects.
+func loadLookupTable(filename, from, to string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading lookup table: %v", err)
+	}
+
+	table := make(map[string]interface{})
+	if strings.EqualFold(filepath.Ext(filename), ".csv") {
+		if from == "" || to == "" {
+			return nil, fmt.Errorf("Lookup table %s: CSV tables need from and to columns", filename)
+		}
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing lookup table %s: %v", filename, err)
+		}
+		if len(records) == 0 {
+			return table, nil
+		}
+		fromCol, toCol := -1, -1
+		for i, name := range records[0] {
+			switch name {
+			case from:
+				fromCol = i
+			case to:
+				toCol = i
+			}
+		}
+		if fromCol < 0 || toCol < 0 {
+			return nil, fmt.Errorf("Lookup table %s has no %s or %s column", filename, from, to)
+		}
+		for _, record := range records[1:] {
+			if _, exists := table[record[fromCol]]; !exists {
+				table[record[fromCol]] = record[toCol]
+			}
+		}
+		return table, nil
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, jsonParseError(data, "lookup table "+filename, err)
+	}
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		if from == "" {
+			return v, nil
+		}
+	case []interface{}:
+		if from == "" {
+			break
+		}
+		for _, item := range v {
+			obj, ok := item.(map[string]interface{})
+			if !ok || obj[from] == nil {
+				continue
+			}
+			key, ok := formatScalar(obj[from])
+			if !ok {
+				continue
+			}
+			if _, exists := table[key]; exists {
+				continue
+			}
+			if to == "" {
+				table[key] = obj
+			} else {
+				table[key] = obj[to]
+			}
+		}
+		return table, nil
+	}
+	return nil, fmt.Errorf("Lookup table %s must be an array of objects with from and to fields, or an object without them", filename)
+}
+
+// lookupValue returns the table entry for a scalar value. Values missing
+// from the table are kept or turned into null, as the rule says, or return
+// the error that stops the run.
+func lookupValue(value interface{}, rule LookupRule) (interface{}, error) {
+	key, ok := formatScalar(value)
+	if !ok || value == nil {
+		return value, nil
+	}
+	if mapped, exists := rule.table[key]; exists {
+		return mapped, nil
+	}
+
+	switch rule.Missing {
+	case "null":
+		return nil, nil
+	case "error":
+		return nil, fmt.Errorf("Error in lookup %s: %q is not in %s", rule.Pattern, key, rule.File)
+	}
+	return value, nil
+}
+
+// enrichObject adds the looked-up values of enriching lookup rules and the
+// responses of httpenrich rules to obj under their into key, leaving the
+// original values in place. obj is copied first if anything is added.
+func enrichObject(obj map[string]interface{}, transforms *Transformations) map[string]interface{} {
+	result := obj
+	set := func(key string, value interface{}) {
+		if sameValue(result, obj) {
+			result = make(map[string]interface{}, len(obj)+1)
+			for k, item := range obj {
+				result[k] = item
+			}
+		}
+		result[key] = value
+	}
+
+	for key, value := range obj {
+		for _, rule := range transforms.Lookup {
+			if rule.Into != "" && matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+				looked, err := lookupValue(value, rule)
+				if err != nil {
+					transforms.stop(err)
+					return obj
+				}
+				set(rule.Into, looked)
+			}
+		}
+		for _, rule := range transforms.HTTPEnrich {
+			if !matchKey(rule.Pattern, key, transforms.IgnoreKeyCase) {
+				continue
+			}
+			doc, ok, err := httpEnrichValue(transforms.runContext(), value, rule)
+			if err != nil {
+				transforms.stop(err)
+				return obj
+			}
+			if ok {
+				set(rule.Into, doc)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+	csvFile := filepath.Join(dir, "codes.csv")
+	if err := os.WriteFile(csvFile, []byte("code,name\nDE,Germany\nFR,France\n44,United Kingdom\n"), 0644); err != nil {
+		t.Fatalf("Failed to write table: %v", err)
+	}
+	jsonFile := filepath.Join(dir, "status.json")
+	if err := os.WriteFile(jsonFile, []byte(`{"1": "active", "2": "closed"}`), 0644); err != nil {
+		t.Fatalf("Failed to write table: %v", err)
+	}
+
+	rules, err := parseLookupRules([]string{
+		"country:" + csvFile + ":code:name",
+		"dial:" + csvFile + ":code:name:null",
+		"status:" + jsonFile,
+		"key=region file=" + csvFile + " from=code to=name into=region_name",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := map[string]interface{}{
+		"country": "DE",
+		"dial":    44.0,
+		"status":  2.0,
+		"region":  "FR",
+		"other":   []interface{}{map[string]interface{}{"country": "XX", "dial": "XX"}},
+	}
+	result := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, &Transformations{Lookup: rules}, 1)
+
+	expected := map[string]interface{}{
+		"country":     "Germany",
+		"dial":        "United Kingdom",
+		"status":      "closed",
+		"region":      "FR",
+		"region_name": "France",
+		"other":       []interface{}{map[string]interface{}{"country": "XX", "dial": nil}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+	if _, exists := input["region_name"]; exists {
+		t.Error("Expected the input to be left unmodified")
+	}
+
+	// A value missing from the table stops processing with an error, in place
+	// and when enriching alike
+	for _, flag := range []string{
+		"country:" + csvFile + ":code:name:error",
+		"key=country file=" + csvFile + " from=code to=name missing=error into=country_name",
+	} {
+		rules, err := parseLookupRules([]string{flag})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pipeline, err := NewPipeline(&Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, &Transformations{Lookup: rules})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := pipeline.Process(map[string]interface{}{"country": "XX"}, "test")
+		if err == nil || !strings.Contains(err.Error(), `"XX" is not in`) || result != nil {
+			t.Errorf("%s: expected a missing value error and no result, got %v, %v", flag, result, err)
+		}
+	}
+}
+
+func TestLookupInvalid(t *testing.T) {
+	csvFile := filepath.Join(t.TempDir(), "codes.csv")
+	if err := os.WriteFile(csvFile, []byte("code,name\n"), 0644); err != nil {
+		t.Fatalf("Failed to write table: %v", err)
+	}
+
+	for _, flag := range []string{
+		"country:" + csvFile,
+		"country:" + csvFile + ":code:label",
+		"country:" + csvFile + ":code:name:skip",
+		"country:missing.csv:code:name",
+	} {
+		if _, err := parseLookupRules([]string{flag}); err == nil {
+			t.Errorf("Expected an error for %s", flag)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathStep is one step of a mask path: an object key, which may use * and ?,
+// or an array index, with Index -1 for every element.
+type pathStep struct {
+	Key     string
+	Index   int
+	IsIndex bool
+}
+
+// isMaskPath reports whether a rule pattern is a path expression such as
+// $.users[*].phone rather than a key name.
+func isMaskPath(pattern string) bool {
+	return strings.HasPrefix(pattern, "$.") || strings.HasPrefix(pattern, "$[")
+}
+
+// parseMaskPath parses a path expression in the notation the paths
+// subcommand lists: .name or ["name"] for a key, [n] for an array index and
+// [*] or [] for every element.
+func parseMaskPath(str string) ([]pathStep, error) {
+	var steps []pathStep
+	rest := strings.TrimPrefix(str, "$")
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			if end == 1 {
+				return nil, fmt.Errorf("empty key in path %q", str)
+			}
+			steps = append(steps, pathStep{Key: rest[1:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if strings.HasPrefix(rest, `["`) {
+				// Quoted keys may contain ] themselves
+				end = strings.Index(rest, `"]`) + 1
+			}
+			if end <= 0 {
+				return nil, fmt.Errorf("unclosed [ in path %q", str)
+			}
+			step, err := parseBracketStep(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("%v in path %q", err, str)
+			}
+			steps = append(steps, step)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected %q in path %q", rest[0], str)
+		}
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("path %q selects the whole document", str)
+	}
+	return steps, nil
+}
+
+// parseBracketStep parses what is between the brackets of a path step.
+func parseBracketStep(str string) (pathStep, error) {
+	if str == "" || str == "*" {
+		return pathStep{Index: -1, IsIndex: true}, nil
+	}
+	if strings.HasPrefix(str, `"`) {
+		key, err := strconv.Unquote(str)
+		return pathStep{Key: key}, err
+	}
+	i, err := strconv.Atoi(str)
+	if err != nil || i < 0 {
+		return pathStep{}, fmt.Errorf("invalid array index %q", str)
+	}
+	return pathStep{Index: i, IsIndex: true}, nil
+}
+
+// updatePath returns doc with every value path selects replaced by what fn
+// returns for it. Like updatePointer, it copies the objects and arrays it
+// changes rather than modifying them.
+func updatePath(doc interface{}, path []pathStep, ignoreCase bool, fn func(value interface{}) interface{}) interface{} {
+	if len(path) == 0 {
+		return fn(doc)
+	}
+	step, rest := path[0], path[1:]
+
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		if step.IsIndex {
+			return doc
+		}
+		var result map[string]interface{}
+		for key, item := range v {
+			if !matchKey(step.Key, key, ignoreCase) {
+				continue
+			}
+			if result == nil {
+				result = make(map[string]interface{}, len(v))
+				for k, value := range v {
+					result[k] = value
+				}
+			}
+			result[key] = updatePath(item, rest, ignoreCase, fn)
+		}
+		if result == nil {
+			return doc
+		}
+		return result
+
+	case []interface{}:
+		if !step.IsIndex || step.Index >= len(v) {
+			return doc
+		}
+		result := append([]interface{}(nil), v...)
+		for i, item := range v {
+			if step.Index < 0 || step.Index == i {
+				result[i] = updatePath(item, rest, ignoreCase, fn)
+			}
+		}
+		return result
+
+	default:
+		return doc
+	}
+}
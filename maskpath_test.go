@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMaskPath(t *testing.T) {
+	input := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"id": 1.0, "phone": "555-1234"},
+			map[string]interface{}{"id": 2.0, "phone": "555-9876"},
+		},
+		"order": map[string]interface{}{"id": 10.0, "phone": "555-0000"},
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{"-maskval", "$.users[*].id:***", "-maskval", `$["order"].phone:#:structure`})
+	expected := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"id": "***", "phone": "555-1234"},
+			map[string]interface{}{"id": "***", "phone": "555-9876"},
+		},
+		"order": map[string]interface{}{"id": 10.0, "phone": "###-####"},
+	}
+	if result := processDocument(input, "", filters, transforms); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected only the values at the paths masked, got %v", result)
+	}
+	if input["order"].(map[string]interface{})["phone"] != "555-0000" {
+		t.Error("Expected the input to be left unchanged")
+	}
+
+	filters, transforms, _ = parseArgs("test", []string{"-maskval", "$.users[1].ph*:***"})
+	users := processDocument(input, "", filters, transforms).(map[string]interface{})["users"].([]interface{})
+	if users[0].(map[string]interface{})["phone"] != "555-1234" || users[1].(map[string]interface{})["phone"] != "***" {
+		t.Errorf("Expected only the second user's phone masked, got %v", users)
+	}
+
+	for _, path := range []string{"$", "$.", "$.users[x]", "$.users[*", "$users"} {
+		if _, err := parseMaskPath(path); err == nil {
+			t.Errorf("Expected path %q to be rejected", path)
+		}
+	}
+}
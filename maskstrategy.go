@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maskModes are the modes a MaskRule may have.
+var maskModes = map[string]bool{
+	"": true, "length": true, "structure": true, "hash": true, "keep-last": true, "null": true,
+}
+
+// parseMaskStrategy parses the strategy of a mask rule, literal, hash,
+// keep-last:N, same-length or null, into its mode and the number of
+// characters keep-last keeps. An unknown strategy is returned as the mode,
+// for NewPipeline to reject.
+func parseMaskStrategy(strategy string) (string, int) {
+	switch strategy {
+	case "literal":
+		return "", 0
+	case "same-length":
+		return "length", 0
+	case "hash", "null":
+		return strategy, 0
+	}
+	if n, ok := strings.CutPrefix(strategy, "keep-last:"); ok {
+		if keep, err := strconv.Atoi(n); err == nil && keep >= 0 {
+			return "keep-last", keep
+		}
+	}
+	return strategy, 0
+}
+
+// hashMask returns the hex SHA-256 hash of a value, so that masked values can
+// still be compared and joined.
+func hashMask(str string) string {
+	sum := sha256.Sum256([]byte(str))
+	return hex.EncodeToString(sum[:])
+}
+
+// keepLast replaces all but the last keep characters of str with maskRune.
+func keepLast(str string, keep int, maskRune rune) string {
+	n := utf8.RuneCountInString(str) - keep
+	if n <= 0 {
+		return str
+	}
+	var masked strings.Builder
+	for i := range str {
+		if n == 0 {
+			masked.WriteString(str[i:])
+			break
+		}
+		masked.WriteRune(maskRune)
+		n--
+	}
+	return masked.String()
+}
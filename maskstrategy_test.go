@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMaskStrategies(t *testing.T) {
+	input := map[string]interface{}{
+		"ssn":   "123-45-6789",
+		"email": "ada@example.com",
+		"phone": "555-1234",
+		"card":  "4111",
+		"token": "secret",
+		"pin":   1234.0,
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{
+		"-maskval", "ssn:strategy=keep-last:4",
+		"-maskval", "email:strategy=hash",
+		"-maskval", "phone:#:strategy=same-length",
+		"-maskval", "key=card strategy=keep-last:6",
+		"-maskval", "token:strategy=null",
+		"-maskval", "key=pin mask=[pin] strategy=literal",
+	})
+	expected := map[string]interface{}{
+		"ssn":   "*******6789",
+		"email": hashMask("ada@example.com"),
+		"phone": "########",
+		"card":  "4111",
+		"token": nil,
+		"pin":   "[pin]",
+	}
+	if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected each key masked by its strategy, got %v", result)
+	}
+	if hash := hashMask("ada@example.com"); hash != "b5fc85e55755f9e0d030a10ab4429b6b2944855f9a0d60077fe832becbc41d72" {
+		t.Errorf("Expected the hash strategy to give the SHA-256 hex digest, got %s", hash)
+	}
+
+	for _, strategy := range []string{"keep-last:x", "redact"} {
+		filters, transforms, _ = parseArgs("test", []string{"-maskval", "ssn:strategy=" + strategy})
+		if _, err := NewPipeline(filters, transforms); err == nil {
+			t.Errorf("Expected strategy %q to be rejected", strategy)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// nonFiniteActions lists the policies for NaN and infinite numbers, which
+// JSON cannot represent.
+var nonFiniteActions = []string{"drop", "null", "clamp", "error"}
+
+// ValuePolicy says what happens to a null or empty string value once all
+// transformations have run: Action "keep" leaves it, "drop" removes the key
+// or array element, and "default" replaces it with Value.
+type ValuePolicy struct {
+	Action string
+	Value  interface{}
+}
+
+// parseValuePolicy parses drop, keep or default:<value>.
+func parseValuePolicy(flag string) (*ValuePolicy, error) {
+	switch {
+	case flag == "drop" || flag == "keep":
+		return &ValuePolicy{Action: flag}, nil
+	case strings.HasPrefix(flag, "default:"):
+		return &ValuePolicy{Action: "default", Value: parseValue(strings.TrimPrefix(flag, "default:"))}, nil
+	}
+	return nil, fmt.Errorf("%q: must be drop, keep or default:<value>", flag)
+}
+
+// applyValuePolicies applies the -nulls, -emptystrings and -nonfinite
+// policies to a transformed value. It reports false if the value is to be
+// dropped.
+func (t *Transformations) applyValuePolicies(value interface{}) (interface{}, bool) {
+	var policy *ValuePolicy
+	switch v := value.(type) {
+	case nil:
+		policy = t.Nulls
+	case string:
+		if v == "" {
+			policy = t.EmptyStrings
+		}
+	case float64:
+		if t.NonFinite != "" && (math.IsNaN(v) || math.IsInf(v, 0)) {
+			return t.applyNonFinite(v)
+		}
+	}
+	if bound, name := t.violatedBound(value); bound != nil {
+		value, keep, err := bound.applyPolicy(value, name)
+		if err != nil {
+			t.stop(err)
+		}
+		return value, keep
+	}
+	if policy == nil {
+		return value, true
+	}
+
+	switch policy.Action {
+	case "drop":
+		return nil, false
+	case "default":
+		return policy.Value, true
+	}
+	return value, true
+}
+
+// applyNonFinite applies the -nonfinite policy to a NaN or infinite number.
+// clamp turns infinities into the -boundnum limits, or the largest finite
+// numbers without them, and NaN into null. error stops the run.
+func (t *Transformations) applyNonFinite(num float64) (interface{}, bool) {
+	switch t.NonFinite {
+	case "drop":
+		return nil, false
+	case "clamp":
+		if math.IsNaN(num) {
+			return nil, true
+		}
+		min, max := -math.MaxFloat64, math.MaxFloat64
+		if t.BoundNum != nil {
+			min, max = t.BoundNum.Min, t.BoundNum.Max
+		}
+		if num > 0 {
+			return max, true
+		}
+		return min, true
+	case "error":
+		t.stop(fmt.Errorf("Error: %v cannot be written as JSON", num))
+		return nil, false
+	}
+	return nil, true
+}
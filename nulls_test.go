@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValuePolicies(t *testing.T) {
+	input := map[string]interface{}{
+		"a":    nil,
+		"b":    "",
+		"c":    "x",
+		"list": []interface{}{nil, "", "y"},
+	}
+
+	tests := []struct {
+		nulls, emptyStrings string
+		expected            map[string]interface{}
+	}{
+		{"drop", "keep", map[string]interface{}{"b": "", "c": "x", "list": []interface{}{"", "y"}}},
+		{"default:0", "drop", map[string]interface{}{"a": 0.0, "c": "x", "list": []interface{}{0.0, "y"}}},
+		{"keep", "default:n/a", map[string]interface{}{"a": nil, "b": "n/a", "c": "x", "list": []interface{}{nil, "n/a", "y"}}},
+	}
+	for _, tt := range tests {
+		filters, transforms, _ := parseArgs("test", []string{"-nulls", tt.nulls, "-emptystrings", tt.emptyStrings})
+		result := processJSON(input, filters, transforms, 1)
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("-nulls %s -emptystrings %s: expected %v, got %v", tt.nulls, tt.emptyStrings, tt.expected, result)
+		}
+	}
+
+	// The policy applies after -defaultval and before -novaltype, whatever
+	// the flag order
+	filters, transforms, _ := parseArgs("test", []string{"-novaltype", "null", "-nulls", "default:none", "-defaultval", "string:empty"})
+	expected := map[string]interface{}{"a": "none", "b": "empty", "c": "x", "list": []interface{}{"none", "empty", "y"}}
+	if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+
+	for _, flag := range []string{"", "remove", "default"} {
+		if _, err := parseValuePolicy(flag); err == nil {
+			t.Errorf("Expected an error for %q", flag)
+		}
+	}
+}
+
+func TestNonFinite(t *testing.T) {
+	input := map[string]interface{}{
+		"nan":  math.NaN(),
+		"inf":  math.Inf(1),
+		"ninf": math.Inf(-1),
+		"ok":   1.5,
+		"list": []interface{}{math.Inf(1), 2.0},
+	}
+
+	tests := []struct {
+		args     []string
+		expected map[string]interface{}
+	}{
+		{[]string{"-nonfinite", "drop"}, map[string]interface{}{"ok": 1.5, "list": []interface{}{2.0}}},
+		{[]string{"-nonfinite", "null"}, map[string]interface{}{"nan": nil, "inf": nil, "ninf": nil, "ok": 1.5, "list": []interface{}{nil, 2.0}}},
+		{[]string{"-nonfinite", "clamp"}, map[string]interface{}{
+			"nan": nil, "inf": math.MaxFloat64, "ninf": -math.MaxFloat64, "ok": 1.5, "list": []interface{}{math.MaxFloat64, 2.0},
+		}},
+		{[]string{"-nonfinite", "clamp", "-boundnum", "0:100"}, map[string]interface{}{
+			"nan": nil, "inf": 100.0, "ninf": 0.0, "ok": 1.5, "list": []interface{}{100.0, 2.0},
+		}},
+	}
+	for _, tt := range tests {
+		filters, transforms, _ := parseArgs("test", tt.args)
+		result := processJSON(input, filters, transforms, 1)
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("%v: expected %v, got %v", tt.args, tt.expected, result)
+		}
+		if _, err := json.Marshal(result); err != nil {
+			t.Errorf("%v: %v", tt.args, err)
+		}
+	}
+
+	// error stops processing rather than writing the document
+	filters, transforms, _ := parseArgs("test", []string{"-nonfinite", "error"})
+	pipeline, err := NewPipeline(filters, transforms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := pipeline.Process(input, "test")
+	if err == nil || !strings.Contains(err.Error(), "cannot be written as JSON") || result != nil {
+		t.Errorf("Expected a non-finite number to stop processing, got %v, %v", result, err)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Parquet physical types, as numbered in the format's Thrift definitions.
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+)
+
+// parquetColumn is a column of Parquet output with its values, nil for
+// nulls: bools, int64s, float64s or strings, as its type says.
+type parquetColumn struct {
+	Name   string
+	Type   int32
+	Values []interface{}
+}
+
+// encodeParquet writes a processed document, an object or an array of
+// objects, as a Parquet file of one row group, with a nullable column per
+// key, nested keys joined with dots as in CSV output. Column types are
+// inferred from the values: BOOLEAN, INT64 for whole numbers, DOUBLE, and
+// UTF-8 BYTE_ARRAY for anything else, arrays and mixed values as text.
+// Pages are PLAIN-encoded and uncompressed.
+func encodeParquet(doc interface{}) ([]byte, error) {
+	records, names, err := flatRecords(doc, "Parquet")
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("Parquet output requires records with at least one field")
+	}
+
+	columns := make([]parquetColumn, len(names))
+	for i, name := range names {
+		columns[i] = parquetColumnOf(name, records)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("PAR1")
+	offsets := make([]int64, len(columns))
+	sizes := make([]int64, len(columns))
+	for i, column := range columns {
+		page := column.page()
+		header := &thriftWriter{}
+		header.begin()
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(len(page)))
+		header.structField(5)
+		header.i32(1, int32(len(records)))
+		header.i32(2, 0) // PLAIN values
+		header.i32(3, 3) // RLE definition levels
+		header.i32(4, 3) // RLE repetition levels
+		header.end()
+		header.end()
+
+		offsets[i] = int64(buf.Len())
+		sizes[i] = int64(header.Len() + len(page))
+		buf.Write(header.Bytes())
+		buf.Write(page)
+	}
+
+	footer := &thriftWriter{}
+	footer.begin()
+	footer.i32(1, 1)
+	footer.list(2, thriftStruct, len(columns)+1)
+	footer.begin()
+	footer.str(4, "schema")
+	footer.i32(5, int32(len(columns)))
+	footer.end()
+	for _, column := range columns {
+		footer.begin()
+		footer.i32(1, column.Type)
+		footer.i32(3, 1) // OPTIONAL
+		footer.str(4, column.Name)
+		if column.Type == parquetByteArray {
+			footer.i32(6, 0) // UTF8
+		}
+		footer.end()
+	}
+	footer.i64(3, int64(len(records)))
+	footer.list(4, thriftStruct, 1)
+	footer.begin()
+	footer.list(1, thriftStruct, len(columns))
+	var total int64
+	for i, column := range columns {
+		footer.begin()
+		footer.i64(2, offsets[i])
+		footer.structField(3)
+		footer.i32(1, column.Type)
+		footer.list(2, thriftI32, 2)
+		footer.varint(0) // PLAIN
+		footer.varint(3) // RLE
+		footer.list(3, thriftBinary, 1)
+		footer.stringValue(column.Name)
+		footer.i32(4, 0) // UNCOMPRESSED
+		footer.i64(5, int64(len(records)))
+		footer.i64(6, sizes[i])
+		footer.i64(7, sizes[i])
+		footer.i64(9, offsets[i])
+		footer.end()
+		footer.end()
+		total += sizes[i]
+	}
+	footer.i64(2, total)
+	footer.i64(3, int64(len(records)))
+	footer.end()
+	footer.str(6, "filter")
+	footer.end()
+
+	buf.Write(footer.Bytes())
+	binary.Write(&buf, binary.LittleEndian, uint32(footer.Len()))
+	buf.WriteString("PAR1")
+	return buf.Bytes(), nil
+}
+
+// parquetColumnOf infers the type of a column from its values in records
+// and converts them to it.
+func parquetColumnOf(name string, records []map[string]interface{}) parquetColumn {
+	columnType := int32(-1)
+	for _, record := range records {
+		var valueType int32
+		switch v := record[name].(type) {
+		case nil:
+			continue
+		case bool:
+			valueType = parquetBoolean
+		case float64:
+			valueType = parquetDouble
+			if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+				valueType = parquetInt64
+			}
+		default:
+			valueType = parquetByteArray
+		}
+		switch {
+		case columnType < 0 || columnType == valueType:
+			columnType = valueType
+		case (columnType == parquetInt64 || columnType == parquetDouble) && (valueType == parquetInt64 || valueType == parquetDouble):
+			columnType = parquetDouble
+		default:
+			columnType = parquetByteArray
+		}
+	}
+	if columnType < 0 {
+		columnType = parquetByteArray
+	}
+
+	column := parquetColumn{Name: name, Type: columnType, Values: make([]interface{}, len(records))}
+	for i, record := range records {
+		value := record[name]
+		switch {
+		case value == nil:
+		case columnType == parquetInt64:
+			column.Values[i] = int64(value.(float64))
+		case columnType == parquetByteArray:
+			column.Values[i] = csvField(value)
+		default:
+			column.Values[i] = value
+		}
+	}
+	return column
+}
+
+// page returns the data of the column's page: the definition levels,
+// marking the values that are not null, then those values.
+func (c parquetColumn) page() []byte {
+	var levels bytes.Buffer
+	for i := 0; i < len(c.Values); {
+		// A run of equal levels, 1 for a value or 0 for a null, of one bit each
+		j := i
+		for j < len(c.Values) && (c.Values[j] == nil) == (c.Values[i] == nil) {
+			j++
+		}
+		levels.Write(binary.AppendUvarint(nil, uint64(j-i)<<1))
+		if c.Values[i] == nil {
+			levels.WriteByte(0)
+		} else {
+			levels.WriteByte(1)
+		}
+		i = j
+	}
+
+	var page bytes.Buffer
+	binary.Write(&page, binary.LittleEndian, uint32(levels.Len()))
+	page.Write(levels.Bytes())
+	var bits []byte
+	n := 0
+	for _, value := range c.Values {
+		switch v := value.(type) {
+		case bool:
+			if n%8 == 0 {
+				bits = append(bits, 0)
+			}
+			if v {
+				bits[n/8] |= 1 << (n % 8)
+			}
+			n++
+		case int64:
+			binary.Write(&page, binary.LittleEndian, v)
+		case float64:
+			binary.Write(&page, binary.LittleEndian, v)
+		case string:
+			binary.Write(&page, binary.LittleEndian, uint32(len(v)))
+			page.WriteString(v)
+		}
+	}
+	page.Write(bits)
+	return page.Bytes()
+}
+
+// Thrift compact protocol types used by the Parquet metadata.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter writes Thrift structs in the compact protocol, for the
+// Parquet page headers and footer.
+type thriftWriter struct {
+	bytes.Buffer
+	// fields holds the last field ID written in each open struct
+	fields []int16
+}
+
+// begin starts a struct, as a list element or the outermost struct.
+func (w *thriftWriter) begin() {
+	w.fields = append(w.fields, 0)
+}
+
+// end ends the innermost open struct.
+func (w *thriftWriter) end() {
+	w.WriteByte(0)
+	w.fields = w.fields[:len(w.fields)-1]
+}
+
+func (w *thriftWriter) field(id int16, fieldType byte) {
+	last := &w.fields[len(w.fields)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		w.WriteByte(fieldType)
+		w.varint(int64(id))
+	}
+	*last = id
+}
+
+// varint writes an integer zigzag-encoded, as a list element or field value.
+func (w *thriftWriter) varint(n int64) {
+	w.Write(binary.AppendUvarint(nil, uint64(n<<1^n>>63)))
+}
+
+// stringValue writes a string, as a list element or field value.
+func (w *thriftWriter) stringValue(s string) {
+	w.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	w.WriteString(s)
+}
+
+func (w *thriftWriter) i32(id int16, n int32) {
+	w.field(id, thriftI32)
+	w.varint(int64(n))
+}
+
+func (w *thriftWriter) i64(id int16, n int64) {
+	w.field(id, thriftI64)
+	w.varint(n)
+}
+
+func (w *thriftWriter) str(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.stringValue(s)
+}
+
+// list starts a list field of n elements, written next.
+func (w *thriftWriter) list(id int16, elemType byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.WriteByte(byte(n)<<4 | elemType)
+	} else {
+		w.WriteByte(0xf0 | elemType)
+		w.Write(binary.AppendUvarint(nil, uint64(n)))
+	}
+}
+
+// structField starts a struct field, ended with end.
+func (w *thriftWriter) structField(id int16) {
+	w.field(id, thriftStruct)
+	w.begin()
+}
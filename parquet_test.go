@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// thriftReader decodes Thrift compact structs into maps of field ID to
+// value, to read back Parquet metadata.
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	u := r.uvarint()
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (r *thriftReader) value(valueType byte) interface{} {
+	switch valueType {
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.uvarint())
+		r.pos += n
+		return string(r.data[r.pos-n : r.pos])
+	case thriftList:
+		header := r.data[r.pos]
+		r.pos++
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = r.value(header & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		fields := make(map[int16]interface{})
+		var last int16
+		for {
+			header := r.data[r.pos]
+			r.pos++
+			if header == 0 {
+				return fields
+			}
+			id := last + int16(header>>4)
+			if header>>4 == 0 {
+				id = int16(r.zigzag())
+			}
+			fields[id] = r.value(header & 0x0f)
+			last = id
+		}
+	}
+	panic("unexpected Thrift type")
+}
+
+// parquetRecords is the document of the Parquet tests, with a column of
+// each type, nulls, a nested key and an array.
+var parquetRecords = []interface{}{
+	map[string]interface{}{"id": 1.0, "name": "ann", "active": true, "score": 0.5, "tags": []interface{}{"a"}},
+	map[string]interface{}{"id": 2.0, "active": false, "score": 2.0, "address": map[string]interface{}{"city": "Oslo"}},
+	map[string]interface{}{"id": 3.0, "name": nil},
+}
+
+func TestEncodeParquet(t *testing.T) {
+	data, err := encodeParquet(parquetRecords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+		t.Fatalf("Expected the Parquet magic at both ends")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := (&thriftReader{data: data[len(data)-8-footerLen : len(data)-8]}).value(thriftStruct).(map[int16]interface{})
+	if footer[3] != int64(3) {
+		t.Errorf("Expected 3 rows, got %v", footer[3])
+	}
+
+	var names []string
+	var types []int64
+	for _, element := range footer[2].([]interface{})[1:] {
+		fields := element.(map[int16]interface{})
+		names = append(names, fields[4].(string))
+		types = append(types, fields[1].(int64))
+	}
+	if expected := []string{"active", "id", "name", "score", "tags", "address.city"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected columns %v, got %v", expected, names)
+	}
+	if expected := []int64{parquetBoolean, parquetInt64, parquetByteArray, parquetDouble, parquetByteArray, parquetByteArray}; !reflect.DeepEqual(types, expected) {
+		t.Errorf("Expected column types %v, got %v", expected, types)
+	}
+
+	expected := [][]interface{}{
+		{true, false, nil},
+		{int64(1), int64(2), int64(3)},
+		{"ann", nil, nil},
+		{0.5, 2.0, nil},
+		{`["a"]`, nil, nil},
+		{nil, "Oslo", nil},
+	}
+	chunks := footer[4].([]interface{})[0].(map[int16]interface{})[1].([]interface{})
+	for i, chunk := range chunks {
+		meta := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+		r := &thriftReader{data: data, pos: int(meta[9].(int64))}
+		header := r.value(thriftStruct).(map[int16]interface{})
+		if header[1] != int64(0) || header[5].(map[int16]interface{})[1] != int64(3) {
+			t.Errorf("Expected a data page of 3 values, got %v", header)
+		}
+
+		// Definition levels, in RLE runs, then the values that are not null
+		end := r.pos + 4 + int(binary.LittleEndian.Uint32(data[r.pos:]))
+		r.pos += 4
+		var defined []bool
+		for r.pos < end {
+			run := int(r.uvarint() >> 1)
+			for j := 0; j < run; j++ {
+				defined = append(defined, data[r.pos] == 1)
+			}
+			r.pos++
+		}
+		values := make([]interface{}, len(defined))
+		n := 0
+		for j := range values {
+			if !defined[j] {
+				continue
+			}
+			switch types[i] {
+			case parquetBoolean:
+				values[j] = data[end+n/8]>>(n%8)&1 == 1
+				n++
+			case parquetInt64:
+				values[j] = int64(binary.LittleEndian.Uint64(data[r.pos:]))
+				r.pos += 8
+			case parquetDouble:
+				values[j] = math.Float64frombits(binary.LittleEndian.Uint64(data[r.pos:]))
+				r.pos += 8
+			case parquetByteArray:
+				size := int(binary.LittleEndian.Uint32(data[r.pos:]))
+				values[j] = string(data[r.pos+4 : r.pos+4+size])
+				r.pos += 4 + size
+			}
+		}
+		if !reflect.DeepEqual(values, expected[i]) {
+			t.Errorf("Expected column %s to hold %v, got %v", names[i], expected[i], values)
+		}
+	}
+
+	if _, err := encodeParquet([]interface{}{"x"}); err == nil {
+		t.Error("Expected an array of scalars to be rejected")
+	}
+}
+
+// TestParquetFixture checks that encodeParquet still writes
+// testdata/records.parquet byte for byte.
+func TestParquetFixture(t *testing.T) {
+	data, err := encodeParquet(parquetRecords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture, err := os.ReadFile(filepath.Join("testdata", "records.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, fixture) {
+		t.Fatal("Expected the output to match testdata/records.parquet; check a new fixture with testdata/read_parquet.py")
+	}
+}
+
+// TestParquetFixturePyarrow checks, where pyarrow is installed, that pyarrow
+// reads testdata/records.parquet back as testdata/records.json.
+func TestParquetFixturePyarrow(t *testing.T) {
+	if exec.Command("python3", "-c", "import pyarrow.parquet").Run() != nil {
+		t.Skip("pyarrow is not installed")
+	}
+	out, err := exec.Command("python3", filepath.Join("testdata", "read_parquet.py"), filepath.Join("testdata", "records.parquet")).Output()
+	if err != nil {
+		t.Fatalf("pyarrow failed to read the fixture: %v", err)
+	}
+	expected, err := os.ReadFile(filepath.Join("testdata", "records.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows, expectedRows interface{}
+	if err := json.Unmarshal(out, &rows); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(expected, &expectedRows); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rows, expectedRows) {
+		t.Errorf("Expected pyarrow to read %v, got %v", expectedRows, rows)
+	}
+}
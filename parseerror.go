@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// snippetContext is the number of bytes shown on either side of a parse
+// error, so that errors in long single-line documents stay readable.
+const snippetContext = 40
+
+// jsonParseError describes a JSON decoding error with its line and column
+// and the offending content, marked with a caret. what names the document,
+// e.g. "config file rules.json".
+func jsonParseError(data []byte, what string, err error) error {
+	offset, ok := jsonErrorOffset(data, err)
+	if !ok {
+		return fmt.Errorf("Error parsing %s: %v", what, err)
+	}
+	line, column, snippet, caret := locateOffset(data, offset)
+	return fmt.Errorf("Error parsing %s at line %d, column %d: %v\n\t%s\n\t%s^",
+		what, line, column, err, snippet, strings.Repeat(" ", caret))
+}
+
+// jsonErrorOffset returns the byte offset at which decoding failed. Errors of
+// the other codecs carry no offset, so the data is decoded again with
+// encoding/json to find it.
+func jsonErrorOffset(data []byte, err error) (int64, bool) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		// The offset is just past the offending byte, or at the end of
+		// truncated input
+		if syntaxErr.Offset >= int64(len(data)) && strings.HasPrefix(syntaxErr.Error(), "unexpected end") {
+			return int64(len(data)), true
+		}
+		return max(syntaxErr.Offset-1, 0), true
+	case errors.As(err, &typeErr):
+		return typeErr.Offset, true
+	}
+
+	var doc interface{}
+	if stdErr := json.Unmarshal(data, &doc); errors.As(stdErr, &syntaxErr) {
+		return jsonErrorOffset(data, stdErr)
+	}
+	return 0, false
+}
+
+// locateOffset returns the 1-based line and column (in characters) of a byte
+// offset, the part of its line around it and the column of the offset within
+// that part.
+func locateOffset(data []byte, offset int64) (line, column int, snippet string, caret int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	pos := int(offset)
+	start := bytes.LastIndexByte(data[:pos], '\n') + 1
+	end := len(data)
+	if i := bytes.IndexByte(data[pos:], '\n'); i >= 0 {
+		end = pos + i
+	}
+	line = bytes.Count(data[:start], []byte{'\n'}) + 1
+	column = utf8.RuneCount(data[start:pos]) + 1
+
+	from, to := start, end
+	prefix, suffix := "", ""
+	if pos-from > snippetContext {
+		from, prefix = pos-snippetContext, "…"
+		for from < pos && !utf8.RuneStart(data[from]) {
+			from++
+		}
+	}
+	if to-pos > snippetContext {
+		to, suffix = pos+snippetContext, "…"
+		for to > pos && !utf8.RuneStart(data[to]) {
+			to--
+		}
+	}
+	snippet = prefix + strings.TrimRight(string(data[from:to]), "\r") + suffix
+	caret = utf8.RuneCountInString(prefix) + utf8.RuneCount(data[from:pos])
+	return line, column, snippet, caret
+}
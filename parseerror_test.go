@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJSONParseError(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"{\n  \"a\": 1,\n  \"b\": 2,}\n", "at line 3, column 10: invalid character '}' looking for beginning of object key string\n\t  \"b\": 2,}\n\t         ^"},
+		{`{"ä": tru}`, "at line 1, column 10: invalid character '}' in literal true (expecting 'e')\n\t{\"ä\": tru}\n\t         ^"},
+		{`{"a": [1, 2`, "at line 1, column 12: unexpected end of JSON input"},
+		{`{"id": "` + strings.Repeat("x", 100) + `" "next": 1}`, "at line 1, column 111: invalid character '\"' after object key:value pair\n\t…" + strings.Repeat("x", 38) + `" "next": 1}` + "\n\t" + strings.Repeat(" ", 41) + "^"},
+	}
+	for _, tt := range tests {
+		for _, name := range []string{"std", "jsoniter"} {
+			if err := setCodec(name); err != nil {
+				t.Fatal(err)
+			}
+			var doc interface{}
+			err := codec.Unmarshal([]byte(tt.input), &doc)
+			if err == nil {
+				t.Fatalf("Expected %q not to parse", tt.input)
+			}
+			msg := jsonParseError([]byte(tt.input), "JSON in in.json", err).Error()
+			if name == "std" && !strings.Contains(msg, tt.expected) {
+				t.Errorf("Expected %q to contain %q", msg, tt.expected)
+			}
+			if !strings.HasPrefix(msg, "Error parsing JSON in in.json at line ") {
+				t.Errorf("%s: expected a location, got %q", name, msg)
+			}
+		}
+	}
+	setCodec("std")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParseNumRule converts the numeric strings of keys matching Pattern, written
+// with the digit grouping and decimal mark of Locale, into numbers.
+type ParseNumRule struct {
+	Pattern string
+	Locale  string
+	RuleOptions
+}
+
+// numberLocale is how a locale writes numbers: the thousands separators it
+// accepts and its decimal mark.
+type numberLocale struct {
+	groups  string
+	decimal string
+}
+
+// numberLocales are the locales of -parsenum, en being the default.
+var numberLocales = map[string]numberLocale{
+	"en": {groups: ",", decimal: "."},
+	"de": {groups: ".", decimal: ","},
+	"fr": {groups: " \u00a0\u202f", decimal: ","},
+	"ch": {groups: "'’", decimal: "."},
+	"in": {groups: ",", decimal: "."},
+}
+
+// numberPatterns caches the regular expression of each locale.
+var numberPatterns = make(map[string]*regexp.Regexp)
+
+func init() {
+	for name, locale := range numberLocales {
+		group := "[" + regexp.QuoteMeta(locale.groups) + "]"
+		grouping := `\d{1,3}(` + group + `\d{3})+`
+		if name == "in" {
+			// Indian grouping puts separators every two digits above
+			// the thousands
+			grouping = `\d{1,2}(` + group + `\d{2})*` + group + `\d{3}`
+		}
+		numberPatterns[name] = regexp.MustCompile(`^[-+]?(\d+|` + grouping + `)(` + regexp.QuoteMeta(locale.decimal) + `\d+)?$`)
+	}
+}
+
+// parseParseNumRules parses -parsenum rules of the form key or key:locale.
+func parseParseNumRules(flags []string) ([]ParseNumRule, error) {
+	var rules []ParseNumRule
+	for _, flag := range flags {
+		rule := ParseNumRule{Pattern: flag, Locale: "en"}
+		if fields, ok := parseRuleFields(flag, "key", "locale", "under"); ok {
+			rule = ParseNumRule{Pattern: fields["key"], Locale: fields["locale"], RuleOptions: RuleOptions{Under: fields["under"]}}
+			if rule.Locale == "" {
+				rule.Locale = "en"
+			}
+		} else if i := strings.LastIndex(flag, ":"); i >= 0 {
+			rule.Pattern, rule.Locale = flag[:i], flag[i+1:]
+		}
+		if _, ok := numberLocales[rule.Locale]; !ok {
+			return nil, fmt.Errorf("%q: unknown locale %q", flag, rule.Locale)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// parseLocaleNumber returns the number a string writes in the locale, and
+// false if it is not a number written that way.
+func parseLocaleNumber(str, locale string) (float64, bool) {
+	str = strings.TrimSpace(str)
+	if !numberPatterns[locale].MatchString(str) {
+		return 0, false
+	}
+	format := numberLocales[locale]
+	for _, r := range format.groups {
+		str = strings.ReplaceAll(str, string(r), "")
+	}
+	num, err := strconv.ParseFloat(strings.Replace(str, format.decimal, ".", 1), 64)
+	return num, err == nil
+}
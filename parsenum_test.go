@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNum(t *testing.T) {
+	input := map[string]interface{}{
+		"amount":   "1.234,56",
+		"discount": "-0,5",
+		"count":    "12",
+		"ref":      "1.2.3",
+		"note":     "about 5",
+		"price":    "1,234.50",
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{
+		"-parsenum", "price",
+		"-parsenum", "*:de",
+		"-minnum", "0",
+	})
+	expected := map[string]interface{}{
+		"amount": 1234.56,
+		"count":  12.0,
+		"ref":    "1.2.3",
+		"note":   "about 5",
+		"price":  1234.5,
+	}
+	if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected numeric strings converted for the numeric filters, got %v", result)
+	}
+
+	tests := []struct {
+		str, locale string
+		num         float64
+		ok          bool
+	}{
+		{"1,234,567.8", "en", 1234567.8, true},
+		{"1,23,4.5", "en", 0, false},
+		{"1 234,5", "fr", 1234.5, true},
+		{"1 234", "fr", 1234, true},
+		{"1'234.5", "ch", 1234.5, true},
+		{"12,34,567", "in", 1234567, true},
+		{"1.234", "de", 1234, true},
+		{"1,2", "de", 1.2, true},
+		{"", "en", 0, false},
+	}
+	for _, test := range tests {
+		if num, ok := parseLocaleNumber(test.str, test.locale); num != test.num || ok != test.ok {
+			t.Errorf("parseLocaleNumber(%q, %s) = %v, %v, expected %v, %v", test.str, test.locale, num, ok, test.num, test.ok)
+		}
+	}
+
+	if _, err := parseParseNumRules([]string{"amount:xx"}); err == nil {
+		t.Error("Expected an unknown locale to be rejected")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// PathCount is the number of values of one type found at a key path.
+type PathCount struct {
+	Path  string
+	Type  string
+	Count int
+}
+
+// runPaths implements the paths subcommand, which lists every distinct key
+// path of the processed input files with its value types and their number
+// of occurrences, to help write rules for an unfamiliar payload.
+func runPaths(arguments []string) {
+	filters, transforms, args := parseArgs("paths", arguments)
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s paths [options] input.json...\n", os.Args[0])
+		os.Exit(2)
+	}
+	pipeline, err := NewPipeline(filters, transforms)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	counts := make(map[PathCount]int)
+	for _, filename := range args {
+		data, err := readJSON(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		processed, err := pipeline.Process(data, filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		walkPaths(processed, "$", func(path string, value interface{}) {
+			counts[PathCount{Path: path, Type: getValueType(value)}]++
+		})
+	}
+
+	inventory := pathInventory(counts)
+	width := 0
+	for _, entry := range inventory {
+		width = max(width, len(entry.Path))
+	}
+	for _, entry := range inventory {
+		fmt.Printf("%-*s  %-6s  ×%d\n", width, entry.Path, entry.Type, entry.Count)
+	}
+}
+
+// walkPaths calls fn for every value of a document, containers included,
+// with its key path. Array elements share the path of their array with []
+// appended, e.g. $.users[].address.zip.
+func walkPaths(value interface{}, path string, fn func(path string, value interface{})) {
+	fn(path, value)
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			walkPaths(item, joinPath(path, key), fn)
+		}
+	case []interface{}:
+		for _, item := range v {
+			walkPaths(item, path+"[]", fn)
+		}
+	}
+}
+
+// pathInventory turns path and type counts, keyed with a zero Count, into
+// a list ordered by path and type.
+func pathInventory(counts map[PathCount]int) []PathCount {
+	inventory := make([]PathCount, 0, len(counts))
+	for entry, count := range counts {
+		entry.Count = count
+		inventory = append(inventory, entry)
+	}
+	sort.Slice(inventory, func(i, j int) bool {
+		if inventory[i].Path != inventory[j].Path {
+			return inventory[i].Path < inventory[j].Path
+		}
+		return inventory[i].Type < inventory[j].Type
+	})
+	return inventory
+}
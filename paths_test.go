@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPathInventory(t *testing.T) {
+	doc := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"name": "a", "address": map[string]interface{}{"zip": "1"}},
+			map[string]interface{}{"name": "b", "address": map[string]interface{}{"zip": 2.0}},
+			map[string]interface{}{"name": nil, "my key": true},
+		},
+	}
+
+	counts := make(map[PathCount]int)
+	walkPaths(doc, "$", func(path string, value interface{}) {
+		counts[PathCount{Path: path, Type: getValueType(value)}]++
+	})
+	expected := []PathCount{
+		{"$", "object", 1},
+		{"$.users", "array", 1},
+		{"$.users[]", "object", 3},
+		{"$.users[].address", "object", 2},
+		{"$.users[].address.zip", "number", 1},
+		{"$.users[].address.zip", "string", 1},
+		{"$.users[].name", "null", 1},
+		{"$.users[].name", "string", 2},
+		{`$.users[]["my key"]`, "bool", 1},
+	}
+	if inventory := pathInventory(counts); !reflect.DeepEqual(inventory, expected) {
+		t.Errorf("Expected %v, got %v", expected, inventory)
+	}
+}
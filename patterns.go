@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// lookupPattern returns the regular expression of a named pattern: one the
+// config defines, or else a built-in one.
+func lookupPattern(name string, patterns map[string]*regexp.Regexp) (*regexp.Regexp, bool) {
+	if re, ok := patterns[name]; ok {
+		return re, true
+	}
+	re, ok := patternClasses[name]
+	return re, ok
+}
+
+// compilePatterns compiles the named patterns of a config, checking that
+// each is a valid regular expression.
+func compilePatterns(patterns map[string]string) (map[string]*regexp.Regexp, error) {
+	compiled := make(map[string]*regexp.Regexp, len(patterns))
+	for name, pattern := range patterns {
+		if name == "" {
+			return nil, fmt.Errorf("pattern with an empty name")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %v", name, err)
+		}
+		compiled[name] = re
+	}
+	return compiled, nil
+}
+
+// setPatterns compiles the named patterns of a config and makes them
+// available to the filters, including those of array filters, and to the
+// transformations.
+func setPatterns(filters *Filters, transforms *Transformations, patterns map[string]string) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+	compiled, err := compilePatterns(patterns)
+	if err != nil {
+		return err
+	}
+	filters.Patterns = compiled
+	transforms.Patterns = compiled
+	for _, rule := range transforms.ArrayFilter {
+		if rule.filters != nil {
+			rule.filters.Patterns = compiled
+		}
+	}
+	return nil
+}
+
+// masksValue reports whether the value is one the rule masks: any value,
+// unless the rule names a pattern the value must be a string matching.
+func (r *MaskRule) masksValue(value interface{}, patterns map[string]*regexp.Regexp) bool {
+	if r.Value == "" {
+		return true
+	}
+	str, ok := value.(string)
+	return ok && hasPattern(str, r.Value, patterns)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNamedPatterns(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "patterns.json")
+	config := `{
+  "patterns": {"order_id": "^ORD-\\d+$"},
+  "rules": [
+    {"replaceval": "order_id:[order]"},
+    {"maskval": "value=emailaddr mask=[email]"}
+  ]
+}`
+	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"ref":     "ORD-1042",
+		"note":    "see ORD-1042",
+		"contact": "ada@example.com",
+		"handle":  "@ada",
+		"host":    "10.0.0.1",
+	}
+	filters, transforms, _ := parseArgs("test", []string{"-config", configFile})
+	expected := map[string]interface{}{
+		"ref":     "[order]",
+		"note":    "see ORD-1042",
+		"contact": "[email]",
+		"handle":  "@ada",
+		"host":    "10.0.0.1",
+	}
+	if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected named patterns to select the values, got %v", result)
+	}
+
+	// Values are filtered once replaced, so check the filter on its own
+	filters, _, _ = parseArgs("test", []string{"-config", configFile, "-strpattern", "order_id"})
+	if !shouldIncludeValue("ORD-7", filters) || shouldIncludeValue("ORD-7b", filters) {
+		t.Error("Expected -strpattern to accept config patterns")
+	}
+
+	for name, value := range map[string]string{
+		"uuid": "123e4567-e89b-12d3-a456-426614174000",
+		"ipv4": "192.168.0.255",
+		"ipv6": "2001:db8::1",
+		"iban": "DE89370400440532013000",
+	} {
+		if !matchesStringPattern(value, name, nil) {
+			t.Errorf("Expected %s to match the built-in %s pattern", value, name)
+		}
+	}
+	if matchesStringPattern("256.1.1.1", "ipv4", nil) || matchesStringPattern("a@b", "emailaddr", nil) {
+		t.Error("Expected built-in patterns to reject malformed values")
+	}
+
+	if !matchesStringPattern("contact: a@b.com", "email", nil) {
+		t.Error("Expected email to match an address within other text")
+	}
+
+	if _, err := compilePatterns(map[string]string{"bad": "("}); err == nil {
+		t.Error("Expected an invalid pattern to be rejected")
+	}
+	transforms = &Transformations{MaskVal: []MaskRule{{Pattern: "*", Value: "nosuch"}}}
+	if _, err := NewPipeline(&Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms); err == nil {
+		t.Error("Expected an unknown mask pattern to be rejected")
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// Pipeline is a prepared set of filters and transformations. Preparing it
+// parses every condition and compiles every pattern the rules use into the
+// rules themselves, so that traversal only evaluates them and invalid ones
+// are reported before any input is read.
+type Pipeline struct {
+	Filters    *Filters
+	Transforms *Transformations
+}
+
+// NewPipeline prepares filters and transformations for processing, storing
+// the compiled conditions and patterns on their rules.
+func NewPipeline(filters *Filters, transforms *Transformations) (*Pipeline, error) {
+	for i := range transforms.CondReplace {
+		rule := &transforms.CondReplace[i]
+		expr, err := parseReplaceCondition(rule.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid -condreplace: %v", err)
+		}
+		rule.expr = expr
+	}
+	for _, rule := range transforms.MaskVal {
+		if !maskModes[rule.Mode] {
+			return nil, fmt.Errorf("Invalid -maskval strategy %q for %s", rule.Mode, rule.Pattern)
+		}
+		if _, ok := lookupPattern(rule.Value, transforms.Patterns); rule.Value != "" && !ok {
+			return nil, fmt.Errorf("Invalid -maskval: unknown pattern %q", rule.Value)
+		}
+	}
+	if len(transforms.Pseudonymize) > 0 && transforms.PseudonymSalt == "" {
+		return nil, fmt.Errorf("-pseudonymize requires a secret -pseudonymize-salt")
+	}
+	for i := range transforms.RenameKeyDepth {
+		rule := &transforms.RenameKeyDepth[i]
+		if rule.Key == "" {
+			continue
+		}
+		re, err := regexp.Compile(rule.Key)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid -renamekeydepth key: %v", err)
+		}
+		rule.re = re
+	}
+	for i := range transforms.ArrayWhere {
+		rule := &transforms.ArrayWhere[i]
+		condition, err := parseWhen(rule.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid -arraywhere: %v", err)
+		}
+		rule.condition = condition
+	}
+	for _, opts := range transforms.ruleOptions() {
+		if opts.When == "" {
+			continue
+		}
+		when, err := parseWhen(opts.When)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid when clause: %v", err)
+		}
+		opts.when = when
+	}
+	return &Pipeline{Filters: filters, Transforms: transforms}, nil
+}
+
+// Process applies the pipeline to a document read from source. A rule that
+// stops the run, such as a -boundnum policy=error, returns its error instead.
+func (p *Pipeline) Process(data interface{}, source string) (interface{}, error) {
+	return p.ProcessContext(context.Background(), data, source)
+}
+
+// ProcessContext is like Process, but stops when ctx is canceled, along with
+// any execval commands and httpenrich requests in flight, and then returns
+// the context's error instead of a partly processed document.
+func (p *Pipeline) ProcessContext(ctx context.Context, data interface{}, source string) (interface{}, error) {
+	return p.run(ctx, func(transforms *Transformations) interface{} {
+		return processDocument(data, source, p.Filters, transforms)
+	})
+}
+
+// RemovedContext returns what the filters remove from a document read from
+// source, as -removed-out writes it, stopping like ProcessContext.
+func (p *Pipeline) RemovedContext(ctx context.Context, data interface{}, source string) (interface{}, error) {
+	return p.run(ctx, func(transforms *Transformations) interface{} {
+		if transforms.Lineage != nil {
+			return removedRecords(data, source, p.Filters, transforms)
+		}
+		return removedDocument(data, p.Filters, transforms)
+	})
+}
+
+// run calls process with the transformations bound to a context that rules
+// can stop, returning the error they stopped with or the error of ctx.
+func (p *Pipeline) run(ctx context.Context, process func(*Transformations) interface{}) (interface{}, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	transforms := *p.Transforms
+	transforms.ctx, transforms.cancel = ctx, cancel
+	result := process(&transforms)
+	if ctx.Err() != nil {
+		return nil, context.Cause(ctx)
+	}
+	return result, nil
+}
+
+// stop ends processing with err, for rules whose failure must not let the
+// document be written: the rest of the document is skipped as on
+// cancellation, and ProcessContext returns err.
+func (t *Transformations) stop(err error) {
+	if t.cancel == nil {
+		panic(fmt.Sprintf("processing stopped outside a pipeline: %v", err))
+	}
+	t.cancel(err)
+}
+
+// runContext returns the context processing runs in.
+func (t *Transformations) runContext() context.Context {
+	if t.ctx == nil {
+		return context.Background()
+	}
+	return t.ctx
+}
+
+// ruleOptions returns the options of every keyed rule.
+func (t *Transformations) ruleOptions() []*RuleOptions {
+	var opts []*RuleOptions
+	opts = appendRuleOptions(opts, t.ReplaceVal)
+	opts = appendRuleOptions(opts, t.ReplaceKey)
+	opts = appendRuleOptions(opts, t.DefaultVal)
+	opts = appendRuleOptions(opts, t.RenameKeyDepth)
+	opts = appendRuleOptions(opts, t.MaskVal)
+	opts = appendRuleOptions(opts, t.CondReplace)
+	opts = appendRuleOptions(opts, t.StringOps)
+	opts = appendRuleOptions(opts, t.EncodeVal)
+	opts = appendRuleOptions(opts, t.DecodeVal)
+	opts = appendRuleOptions(opts, t.SplitVal)
+	opts = appendRuleOptions(opts, t.JoinVal)
+	opts = appendRuleOptions(opts, t.ArrayWhere)
+	opts = appendRuleOptions(opts, t.ArrayUniqueBy)
+	opts = appendRuleOptions(opts, t.ArrayFlatten)
+	opts = appendRuleOptions(opts, t.ArraySample)
+	opts = appendRuleOptions(opts, t.ArrayToMap)
+	opts = appendRuleOptions(opts, t.GroupBy)
+	opts = appendRuleOptions(opts, t.Join)
+	opts = appendRuleOptions(opts, t.ArrayIntersect)
+	opts = appendRuleOptions(opts, t.ArraySubtract)
+	opts = appendRuleOptions(opts, t.Pseudonymize)
+	opts = appendRuleOptions(opts, t.MapToArray)
+	opts = appendRuleOptions(opts, t.ExecVal)
+	opts = appendRuleOptions(opts, t.Lookup)
+	opts = appendRuleOptions(opts, t.HTTPEnrich)
+	opts = appendRuleOptions(opts, t.ScaleNum)
+	opts = appendRuleOptions(opts, t.ParseNum)
+	return opts
+}
+
+func appendRuleOptions[T any, P ruleWithOptions[T]](opts []*RuleOptions, rules []T) []*RuleOptions {
+	for i := range rules {
+		opts = append(opts, P(&rules[i]).options())
+	}
+	return opts
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewPipelineRejectsInvalidRules(t *testing.T) {
+	tests := map[string]*Transformations{
+		"condreplace pattern":  {CondReplace: parseCondReplaceRules([]string{`value matches "[a-":x`})},
+		"condreplace operator": {CondReplace: parseCondReplaceRules([]string{"name:x"})},
+		"arraywhere":           {ArrayWhere: parseArrayWhereRules([]string{`orders:status matches "("`})},
+		"when": {MaskVal: []MaskRule{{Pattern: "email", Mask: "***",
+			RuleOptions: RuleOptions{When: "country"}}}},
+	}
+	for name, transforms := range tests {
+		if _, err := NewPipeline(&Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	transforms := &Transformations{
+		CondReplace: parseCondReplaceRules([]string{`value matches "^a":x`}),
+		ArrayWhere:  parseArrayWhereRules([]string{`orders:status=="shipped"`}),
+	}
+	pipeline, err := NewPipeline(&Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := pipeline.Process(map[string]interface{}{"name": "alice"}, "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.(map[string]interface{})["name"] != "x" {
+		t.Errorf("Expected the condition to apply, got %v", result)
+	}
+
+	if _, err := parseFilterExpr(`value matches "[a-"`); err == nil {
+		t.Error("Expected an error for an invalid pattern in a filter expression")
+	}
+}
+
+func TestNewPipelineCompilesRules(t *testing.T) {
+	transforms := &Transformations{
+		CondReplace:    parseCondReplaceRules([]string{`value matches "^a":x`}),
+		ArrayWhere:     parseArrayWhereRules([]string{`orders:status=="shipped"`}),
+		RenameKeyDepth: []RenameDepthRule{{Depth: 1, Key: "^id$", Prefix: "user_"}},
+		MaskVal: []MaskRule{{Pattern: "email", Mask: "***",
+			RuleOptions: RuleOptions{When: `country=="EU"`}}},
+	}
+	if _, err := NewPipeline(&Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms); err != nil {
+		t.Fatal(err)
+	}
+	if transforms.CondReplace[0].expr == nil || transforms.ArrayWhere[0].condition == nil ||
+		transforms.RenameKeyDepth[0].re == nil || transforms.MaskVal[0].when == nil {
+		t.Fatal("Expected the pipeline to hold the compiled conditions and patterns")
+	}
+
+	// Processing evaluates the compiled matchers, not the rule text
+	transforms.CondReplace[0].Condition = "not a condition"
+	transforms.RenameKeyDepth[0].Key = "("
+	input := map[string]interface{}{"id": "alice"}
+	expected := map[string]interface{}{"user_id": "x"}
+	if result := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestProcessContext(t *testing.T) {
+	pipeline, err := NewPipeline(&Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, &Transformations{MaskVal: []MaskRule{{Pattern: "ssn", Mask: "***"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := map[string]interface{}{"ssn": "123"}
+
+	result, err := pipeline.ProcessContext(context.Background(), input, "test.json")
+	if err != nil || result.(map[string]interface{})["ssn"] != "***" {
+		t.Errorf("Expected the document to be processed, got %v (%v)", result, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if result, err := pipeline.ProcessContext(ctx, input, "test.json"); !errors.Is(err, context.Canceled) || result != nil {
+		t.Errorf("Expected a canceled run to return no document, got %v (%v)", result, err)
+	}
+}
+
+func TestProcessContextStopsCommands(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep not available")
+	}
+	pipeline, err := NewPipeline(&Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, &Transformations{ExecVal: parseExecRules([]string{"id:sleep 5"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := pipeline.ProcessContext(ctx, map[string]interface{}{"id": "1"}, "test.json"); err == nil {
+		t.Error("Expected the run to be canceled")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the command to be killed, took %v", elapsed)
+	}
+}
+
+func BenchmarkPipeline(b *testing.B) {
+	records := make([]interface{}, 1000)
+	for i := range records {
+		records[i] = map[string]interface{}{
+			"name":   "Alice Example",
+			"email":  "alice@example.com",
+			"status": "shipped",
+			"total":  float64(i),
+		}
+	}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999, StrPattern: []string{"lower"}}
+	transforms := &Transformations{
+		ReplaceVal:  parseReplaceRules([]string{"upper:X"}),
+		CondReplace: parseCondReplaceRules([]string{`value matches "^ship":SHIPPED`}),
+	}
+	pipeline, err := NewPipeline(filters, transforms)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pipeline.Process(records, "bench.json")
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"plugin"
+	"strings"
+)
+
+// Transformer is a custom transformation loaded with -plugin. Transform is
+// called for every object member after the built-in transformations, with
+// the member's JSONPath-style path, e.g. $.users[0].id, its key and its value.
+// It returns the new value and true, or false to leave the value as it is.
+type Transformer interface {
+	Transform(path string, key string, value interface{}) (interface{}, bool)
+}
+
+// loadPlugin opens a Go plugin built with -buildmode=plugin. The plugin must
+// export a variable named Transformer whose type has the Transform method.
+// Files ending in .wasm are loaded as WebAssembly plugins instead.
+func loadPlugin(filename string) (Transformer, error) {
+	if strings.EqualFold(filepath.Ext(filename), ".wasm") {
+		return loadWASMPlugin(filename)
+	}
+
+	p, err := plugin.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading plugin: %v", err)
+	}
+	sym, err := p.Lookup("Transformer")
+	if err != nil {
+		return nil, fmt.Errorf("Plugin %s does not export Transformer", filename)
+	}
+
+	// Looking up a variable yields a pointer to it
+	switch t := sym.(type) {
+	case Transformer:
+		return t, nil
+	case *Transformer:
+		return *t, nil
+	}
+	return nil, fmt.Errorf("Plugin %s: Transformer has no method Transform(string, string, interface{}) (interface{}, bool)", filename)
+}
+
+// applyPlugins passes a value through each plugin in turn. A failing
+// WebAssembly plugin stops the run, so that values it should have scrubbed
+// are never written as is.
+func (t *Transformations) applyPlugins(path, key string, value interface{}) interface{} {
+	for _, p := range t.Plugins {
+		w, isWASM := p.(*wasmTransformer)
+		if !isWASM {
+			if transformed, ok := p.Transform(path, key, value); ok {
+				value = transformed
+			}
+			continue
+		}
+		transformed, ok, err := w.call(path, key, value)
+		if err != nil {
+			t.stop(fmt.Errorf("Error in plugin %s at %s: %v", w.filename, path, err))
+			return value
+		}
+		if ok {
+			value = transformed
+		}
+	}
+	return value
+}
+
+// tracksPath reports whether paths are tracked, which is only needed for
+// plugins and scripts.
+func (t *Transformations) tracksPath() bool {
+	return len(t.Plugins) > 0 || t.Script != nil
+}
+
+// withPath returns a copy of the transformations for the value at path.
+func (t *Transformations) withPath(path string) *Transformations {
+	child := *t
+	child.Path = path
+	return &child
+}
+
+// memberPath returns the path of the member key of the current object.
+func (t *Transformations) memberPath(key string) string {
+	if t.Path == "" {
+		return joinPath("$", key)
+	}
+	return joinPath(t.Path, key)
+}
+
+// elementPath returns the path of element i of the current array.
+func (t *Transformations) elementPath(i int) string {
+	if t.Path == "" {
+		return indexPath("$", i)
+	}
+	return indexPath(t.Path, i)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// scrubIDs replaces internal IDs and records the paths it was called with.
+type scrubIDs struct {
+	paths []string
+}
+
+func (s *scrubIDs) Transform(path, key string, value interface{}) (interface{}, bool) {
+	s.paths = append(s.paths, path)
+	if str, ok := value.(string); ok && strings.HasPrefix(str, "int-") {
+		return "scrubbed", true
+	}
+	return nil, false
+}
+
+func TestPluginTransform(t *testing.T) {
+	input := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"id": "int-42", "name": "alice"},
+		},
+		"owner": "int-7",
+	}
+
+	scrub := &scrubIDs{}
+	transforms := &Transformations{
+		Plugins: []Transformer{scrub},
+		StringOps: []StringOpRule{
+			{Pattern: "name", Op: "upper"},
+		},
+	}
+	result := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1)
+
+	expected := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"id": "scrubbed", "name": "ALICE"},
+		},
+		"owner": "scrubbed",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+
+	seen := make(map[string]bool)
+	for _, path := range scrub.paths {
+		seen[path] = true
+	}
+	for _, path := range []string{"$.users", "$.owner", "$.users[0].id", "$.users[0].name"} {
+		if !seen[path] {
+			t.Errorf("Expected the plugin to be called for %s, got %v", path, scrub.paths)
+		}
+	}
+}
+
+func TestLoadPluginMissing(t *testing.T) {
+	if _, err := loadPlugin("does-not-exist.so"); err == nil {
+		t.Error("Expected an error for a missing plugin file")
+	}
+}
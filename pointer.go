@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PointerRule applies a maskval, replaceval, replacekey, defaultval or
+// dropkey rule to the single value an RFC 6901 JSON Pointer such as
+// /meta/profile/id addresses, instead of to every key matching a name.
+// Pointer rules apply to the input document ahead of the other rules.
+// A mask or scale rule may have a Path such as $.users[*].phone instead,
+// applying to every value it selects.
+type PointerRule struct {
+	// Op is mask, scale, replace, rename, default or drop
+	Op      string
+	Pointer []string
+	Path    []pathStep
+	// IgnoreCase makes the keys of Path match regardless of case
+	IgnoreCase bool
+	Mask       MaskRule
+	Scale      ScaleRule
+	// Value is the replacement or default value, or the new key of a rename
+	Value interface{}
+}
+
+// parsePointer splits a JSON Pointer into its unescaped reference tokens.
+func parsePointer(str string) ([]string, error) {
+	if !strings.HasPrefix(str, "/") {
+		return nil, fmt.Errorf("JSON Pointer must start with /")
+	}
+	tokens := strings.Split(str[1:], "/")
+	for i, token := range tokens {
+		if strings.Contains(strings.ReplaceAll(strings.ReplaceAll(token, "~0", ""), "~1", ""), "~") {
+			return nil, fmt.Errorf("invalid escape in JSON Pointer token %q", token)
+		}
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// isPointer reports whether a rule pattern is a JSON Pointer rather than a
+// key name.
+func isPointer(pattern string) bool {
+	return strings.HasPrefix(pattern, "/")
+}
+
+// extractPointerRules moves the rules whose pattern is a JSON Pointer, and the
+// maskval and scalenum rules whose pattern is a path, out of the key-matching
+// rules into transforms.Pointers, in the order maskval, scalenum, replaceval,
+// replacekey, defaultval, dropkey.
+func extractPointerRules(filters *Filters, transforms *Transformations) error {
+	var rules []PointerRule
+	add := func(op, pattern string, opts RuleOptions, rule PointerRule) error {
+		if opts.When != "" || opts.Under != "" {
+			return fmt.Errorf("%s rule %q: JSON Pointer rules cannot have a when or under clause", op, pattern)
+		}
+		pointer, err := parsePointer(pattern)
+		if err != nil {
+			return fmt.Errorf("%s rule %q: %v", op, pattern, err)
+		}
+		rule.Op, rule.Pointer = op, pointer
+		rules = append(rules, rule)
+		return nil
+	}
+	addPath := func(op, pattern string, opts RuleOptions, rule PointerRule) error {
+		if opts.When != "" || opts.Under != "" {
+			return fmt.Errorf("%s rule %q: path rules cannot have a when or under clause", op, pattern)
+		}
+		path, err := parseMaskPath(pattern)
+		if err != nil {
+			return fmt.Errorf("%s rule %q: %v", op, pattern, err)
+		}
+		rule.Op, rule.Path, rule.IgnoreCase = op, path, transforms.IgnoreKeyCase
+		rules = append(rules, rule)
+		return nil
+	}
+
+	var maskVal []MaskRule
+	for _, rule := range transforms.MaskVal {
+		var err error
+		switch {
+		case isMaskPath(rule.Pattern):
+			err = addPath("mask", rule.Pattern, rule.RuleOptions, PointerRule{Mask: rule})
+		case isPointer(rule.Pattern):
+			err = add("mask", rule.Pattern, rule.RuleOptions, PointerRule{Mask: rule})
+		default:
+			maskVal = append(maskVal, rule)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	var scaleNum []ScaleRule
+	for _, rule := range transforms.ScaleNum {
+		var err error
+		switch {
+		case isMaskPath(rule.Pattern):
+			err = addPath("scale", rule.Pattern, rule.RuleOptions, PointerRule{Scale: rule})
+		case isPointer(rule.Pattern):
+			err = add("scale", rule.Pattern, rule.RuleOptions, PointerRule{Scale: rule})
+		default:
+			scaleNum = append(scaleNum, rule)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	var replaceVal, replaceKey []ReplaceRule
+	for _, rule := range transforms.ReplaceVal {
+		if !isPointer(rule.Pattern) {
+			replaceVal = append(replaceVal, rule)
+		} else if err := add("replace", rule.Pattern, rule.RuleOptions, PointerRule{Value: rule.Replacement}); err != nil {
+			return err
+		}
+	}
+	for _, rule := range transforms.ReplaceKey {
+		if !isPointer(rule.Pattern) {
+			replaceKey = append(replaceKey, rule)
+		} else if err := add("rename", rule.Pattern, rule.RuleOptions, PointerRule{Value: rule.Replacement}); err != nil {
+			return err
+		}
+	}
+	var defaultVal []DefaultRule
+	for _, rule := range transforms.DefaultVal {
+		if !isPointer(rule.Type) {
+			defaultVal = append(defaultVal, rule)
+		} else if err := add("default", rule.Type, rule.RuleOptions, PointerRule{Value: rule.Value}); err != nil {
+			return err
+		}
+	}
+	var dropKeys []string
+	for _, pattern := range filters.DropKeys {
+		if !isPointer(pattern) {
+			dropKeys = append(dropKeys, pattern)
+		} else if err := add("drop", pattern, RuleOptions{}, PointerRule{}); err != nil {
+			return err
+		}
+	}
+
+	if len(rules) == 0 {
+		return nil
+	}
+	transforms.MaskVal, transforms.ReplaceVal, transforms.ReplaceKey = maskVal, replaceVal, replaceKey
+	transforms.ScaleNum = scaleNum
+	transforms.DefaultVal, filters.DropKeys = defaultVal, dropKeys
+	transforms.Pointers = append(transforms.Pointers, rules...)
+	return nil
+}
+
+// applyPointerRules applies the pointer rules to a document in order.
+// Pointers to values that do not exist are ignored, apart from defaults,
+// which create their field along with any missing objects above it.
+func applyPointerRules(doc interface{}, rules []PointerRule) interface{} {
+	for _, rule := range rules {
+		if rule.Path != nil {
+			doc = updatePath(doc, rule.Path, rule.IgnoreCase, func(value interface{}) interface{} {
+				if rule.Op == "scale" {
+					return scaleValue(value, rule.Scale)
+				}
+				return applyMask(value, rule.Mask)
+			})
+			continue
+		}
+		if len(rule.Pointer) == 0 {
+			continue
+		}
+		switch rule.Op {
+		case "rename":
+			parent, last := rule.Pointer[:len(rule.Pointer)-1], rule.Pointer[len(rule.Pointer)-1]
+			newKey, _ := formatScalar(rule.Value)
+			doc = updatePointer(doc, parent, false, func(value interface{}, exists bool) (interface{}, bool) {
+				obj, ok := value.(map[string]interface{})
+				if !ok {
+					return value, exists
+				}
+				item, found := obj[last]
+				if !found {
+					return value, exists
+				}
+				renamed := make(map[string]interface{}, len(obj))
+				for key, v := range obj {
+					if key != last {
+						renamed[key] = v
+					}
+				}
+				renamed[newKey] = item
+				return renamed, true
+			})
+		default:
+			doc = updatePointer(doc, rule.Pointer, rule.Op == "default", func(value interface{}, exists bool) (interface{}, bool) {
+				switch rule.Op {
+				case "mask":
+					if exists {
+						return applyMask(value, rule.Mask), true
+					}
+				case "scale":
+					if exists {
+						return scaleValue(value, rule.Scale), true
+					}
+				case "replace":
+					if exists {
+						return rule.Value, true
+					}
+				case "default":
+					if !exists || value == nil {
+						return rule.Value, true
+					}
+				case "drop":
+					return nil, false
+				}
+				return value, exists
+			})
+		}
+	}
+	return doc
+}
+
+// updatePointer returns doc with the value at pointer replaced by what fn
+// returns for it, or removed if fn does not keep it. Objects and arrays along
+// the pointer are copied rather than modified, as they may be shared with the
+// input. A - token appends to an array. With create, missing objects along
+// the pointer are added; otherwise a missing value leaves doc as it is.
+func updatePointer(doc interface{}, pointer []string, create bool, fn func(value interface{}, exists bool) (interface{}, bool)) interface{} {
+	if len(pointer) == 0 {
+		value, _ := fn(doc, true)
+		return value
+	}
+	token, rest := pointer[0], pointer[1:]
+
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		child, exists := v[token]
+		if !exists && len(rest) > 0 {
+			if !create {
+				return doc
+			}
+			child = map[string]interface{}{}
+		}
+		var value interface{}
+		keep := true
+		if len(rest) == 0 {
+			value, keep = fn(child, exists)
+			if !keep && !exists {
+				return doc
+			}
+		} else {
+			value = updatePointer(child, rest, create, fn)
+		}
+		result := make(map[string]interface{}, len(v)+1)
+		for key, item := range v {
+			result[key] = item
+		}
+		if keep {
+			result[token] = value
+		} else {
+			delete(result, token)
+		}
+		return result
+
+	case []interface{}:
+		if token == "-" {
+			if len(rest) > 0 {
+				return doc
+			}
+			value, keep := fn(nil, false)
+			if !keep {
+				return doc
+			}
+			return append(append([]interface{}(nil), v...), value)
+		}
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 || i >= len(v) || (len(token) > 1 && token[0] == '0') {
+			return doc
+		}
+		result := append([]interface{}(nil), v...)
+		if len(rest) > 0 {
+			result[i] = updatePointer(v[i], rest, create, fn)
+			return result
+		}
+		value, keep := fn(v[i], true)
+		if !keep {
+			return append(result[:i], result[i+1:]...)
+		}
+		result[i] = value
+		return result
+
+	default:
+		return doc
+	}
+}
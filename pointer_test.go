@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePointer(t *testing.T) {
+	tokens, err := parsePointer("/meta/a~1b/m~0n/0")
+	if err != nil || !reflect.DeepEqual(tokens, []string{"meta", "a/b", "m~n", "0"}) {
+		t.Errorf("Expected unescaped tokens, got %q, %v", tokens, err)
+	}
+	if _, err := parsePointer("meta/id"); err == nil {
+		t.Error("Expected a pointer without a leading / to be rejected")
+	}
+	if _, err := parsePointer("/a~2"); err == nil {
+		t.Error("Expected an invalid escape to be rejected")
+	}
+}
+
+func TestPointerRules(t *testing.T) {
+	filters, transforms, _ := parseArgs("test", []string{
+		"-maskval", "/meta/profile/id:***",
+		"-maskval", "password:***",
+		"-replaceval", "/users/1/name:anon",
+		"-replacekey", "/meta/profile:account",
+		"-defaultval", "/meta/region:eu",
+		"-dropkey", "/users/0",
+		"-addfield", "/tags/-:sanitized",
+	})
+	if len(transforms.Pointers) != 5 || len(transforms.MaskVal) != 1 || len(filters.DropKeys) != 0 {
+		t.Fatalf("Expected pointer rules to be split from key rules, got %v", transforms.Pointers)
+	}
+	pipeline, err := NewPipeline(filters, transforms)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := map[string]interface{}{
+		"meta": map[string]interface{}{
+			"profile": map[string]interface{}{"id": "p-1", "password": "x"},
+			"id":      "not-me",
+		},
+		"users": []interface{}{"first", map[string]interface{}{"name": "Bob"}},
+		"tags":  []interface{}{"a"},
+	}
+	expected := map[string]interface{}{
+		"meta": map[string]interface{}{
+			"account": map[string]interface{}{"id": "***", "password": "***"},
+			"id":      "not-me",
+			"region":  "eu",
+		},
+		"users": []interface{}{map[string]interface{}{"name": "anon"}},
+		"tags":  []interface{}{"a", "sanitized"},
+	}
+	if result, _ := pipeline.Process(input, "test"); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+	if input["meta"].(map[string]interface{})["profile"].(map[string]interface{})["id"] != "p-1" {
+		t.Error("Expected the input to be left unmodified")
+	}
+
+	// Pointers to missing values change nothing
+	doc := map[string]interface{}{"a": 1.0}
+	if result := applyPointerRules(doc, []PointerRule{{Op: "drop", Pointer: []string{"b", "c"}}}); !reflect.DeepEqual(result, doc) {
+		t.Errorf("Expected a missing pointer to be ignored, got %v", result)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// presetFiles holds the built-in rulesets, config files shipped with the
+// tool and selected with -preset.
+//
+//go:embed presets/*.json
+var presetFiles embed.FS
+
+// presetNames returns the names of the built-in rulesets in order.
+func presetNames() []string {
+	entries, _ := fs.ReadDir(presetFiles, "presets")
+	var names []string
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), path.Ext(entry.Name())))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadPreset decodes the named built-in ruleset.
+func loadPreset(name string) (*Config, error) {
+	data, err := presetFiles.ReadFile("presets/" + name + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("Unknown -preset %q: must be one of %s", name, strings.Join(presetNames(), ", "))
+	}
+	var config Config
+	if err := decodeConfig(data, &config); err != nil {
+		return nil, jsonParseError(data, "preset "+name, err)
+	}
+	return &config, nil
+}
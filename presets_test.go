@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPresets(t *testing.T) {
+	for _, name := range presetNames() {
+		if _, err := loadPreset(name); err != nil {
+			t.Errorf("Expected preset %s to load, got %v", name, err)
+		}
+	}
+	if _, err := loadPreset("nope"); err == nil {
+		t.Error("Expected an unknown preset to be rejected")
+	}
+}
+
+func TestTerraformStatePreset(t *testing.T) {
+	var state interface{}
+	if err := json.Unmarshal([]byte(`{
+		"version": 4,
+		"outputs": {
+			"db_password": {"value": "hunter2", "type": "string", "sensitive": true},
+			"conn": {"value": {"host": "db", "user": "admin"}, "type": ["object", {}], "sensitive": true},
+			"url": {"value": "https://app.example.com", "type": "string"}
+		},
+		"resources": [{
+			"mode": "managed",
+			"type": "aws_db_instance",
+			"instances": [{
+				"attributes": {
+					"username": "admin",
+					"password": "hunter2",
+					"port": 5432,
+					"kube_config": [{"client_key": "k"}],
+					"tags": {"auth_token": "t"},
+					"endpoint": "db.internal",
+					"ingress": [{"cidr": "10.0.0.0/8"}, {"cidr": "192.168.0.0/16"}],
+					"labels": {"team": "core", "owner": "ann"}
+				},
+				"sensitive_attributes": [
+					[{"type": "get_attr", "value": "password"}],
+					[{"type": "get_attr", "value": "endpoint"}],
+					[{"type": "get_attr", "value": "ingress"}, {"type": "index", "value": {"value": 1, "type": "number"}}, {"type": "get_attr", "value": "cidr"}],
+					[{"type": "get_attr", "value": "labels"}, {"type": "index", "value": {"value": "owner", "type": "string"}}],
+					[{"type": "get_attr", "value": "missing"}]
+				],
+				"private": "eyJzY2hlbWEiOjF9"
+			}]
+		}]
+	}`), &state); err != nil {
+		t.Fatal(err)
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{"-preset", "terraform-state"})
+	result := processDocument(state, "terraform.tfstate", filters, transforms).(map[string]interface{})
+
+	outputs := result["outputs"].(map[string]interface{})
+	for name, expected := range map[string]interface{}{
+		"db_password": "(sensitive)",
+		"conn":        "(sensitive)",
+		"url":         "https://app.example.com",
+	} {
+		if value := outputs[name].(map[string]interface{})["value"]; !reflect.DeepEqual(value, expected) {
+			t.Errorf("Expected output %s to be %v, got %v", name, expected, value)
+		}
+	}
+
+	instance := result["resources"].([]interface{})[0].(map[string]interface{})["instances"].([]interface{})[0].(map[string]interface{})
+	expected := map[string]interface{}{
+		"username":    "admin",
+		"password":    "(sensitive)",
+		"port":        5432.0,
+		"kube_config": "(sensitive)",
+		"tags":        map[string]interface{}{"auth_token": "(sensitive)"},
+		"endpoint":    "(sensitive)",
+		"ingress": []interface{}{
+			map[string]interface{}{"cidr": "10.0.0.0/8"},
+			map[string]interface{}{"cidr": "(sensitive)"},
+		},
+		"labels": map[string]interface{}{"team": "core", "owner": "(sensitive)"},
+	}
+	if !reflect.DeepEqual(instance["attributes"], expected) {
+		t.Errorf("Expected sensitive attributes masked, got %v", instance["attributes"])
+	}
+	if instance["private"] != "(sensitive)" {
+		t.Errorf("Expected the provider's private data masked, got %v", instance["private"])
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// loadProtoType finds the message type named typeName in a compiled
+// FileDescriptorSet, as written by protoc --descriptor_set_out
+// --include_imports.
+func loadProtoType(descFile, typeName string) (protoreflect.MessageDescriptor, error) {
+	data, err := os.ReadFile(descFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading descriptor set: %v", err)
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("Error parsing descriptor set %s: %v", descFile, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading descriptor set %s: %v", descFile, err)
+	}
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(typeName))
+	if err != nil {
+		return nil, fmt.Errorf("Message type %s not found in %s", typeName, descFile)
+	}
+	msg, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message type", typeName)
+	}
+	return msg, nil
+}
+
+// decodeProto parses a binary protobuf message into the generic tree through
+// its JSON mapping, keeping the field names of the .proto file.
+func decodeProto(data []byte, desc protoreflect.MessageDescriptor) (interface{}, error) {
+	msg := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("Error parsing protobuf %s: %v", desc.FullName(), err)
+	}
+
+	jsonData, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("Error converting protobuf %s: %v", desc.FullName(), err)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(jsonData, &doc); err != nil {
+		return nil, fmt.Errorf("Error converting protobuf %s: %v", desc.FullName(), err)
+	}
+	return doc, nil
+}
+
+// encodeProto writes a processed document as a binary protobuf message. The
+// document must still fit the message type: renamed fields or values whose
+// type changed, e.g. masked numbers, are reported as errors.
+func encodeProto(doc interface{}, desc protoreflect.MessageDescriptor) ([]byte, error) {
+	jsonData, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshaling JSON: %v", err)
+	}
+
+	msg := dynamicpb.NewMessage(desc)
+	if err := protojson.Unmarshal(jsonData, msg); err != nil {
+		return nil, fmt.Errorf("Output does not fit protobuf %s: %v", desc.FullName(), err)
+	}
+	output, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("Error writing protobuf %s: %v", desc.FullName(), err)
+	}
+	return output, nil
+}
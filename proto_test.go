@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func writeTestDescriptorSet(t *testing.T) string {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Type:   typ.Enum(),
+			Label:  label.Enum(),
+		}
+	}
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	set := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{{
+			Name:    proto.String("event.proto"),
+			Package: proto.String("test.pkg"),
+			Syntax:  proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Event"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("user_email", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional),
+					field("count", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, optional),
+					field("tags", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_LABEL_REPEATED),
+				},
+			}},
+		}},
+	}
+
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "set.pb")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProtoRoundTrip(t *testing.T) {
+	desc, err := loadProtoType(writeTestDescriptorSet(t), "test.pkg.Event")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := map[string]interface{}{
+		"user_email": "alice@example.com",
+		"count":      3.0,
+		"tags":       []interface{}{"a", "b"},
+	}
+	data, err := encodeProto(doc, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeProto(data, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, doc) {
+		t.Fatalf("Expected %v, got %v", doc, decoded)
+	}
+
+	transforms := &Transformations{MaskVal: parseMaskRules([]string{"user_email:***"})}
+	result := processJSON(decoded, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1)
+	if _, err := encodeProto(result, desc); err != nil {
+		t.Errorf("Expected a masked string field to encode, got %v", err)
+	}
+
+	transforms = &Transformations{MaskVal: parseMaskRules([]string{"count:***"})}
+	result = processJSON(decoded, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1)
+	if _, err := encodeProto(result, desc); err == nil {
+		t.Error("Expected an error for a masked numeric field")
+	}
+
+	if _, err := loadProtoType(writeTestDescriptorSet(t), "test.pkg.Missing"); err == nil {
+		t.Error("Expected an error for an unknown message type")
+	}
+}
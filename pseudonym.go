@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// PseudonymRule replaces the string values of keys matching Pattern with a
+// fake value of Kind derived from an HMAC of the value, so that a value
+// maps to the same fake one wherever and whenever it is pseudonymized with
+// the same salt. Kind is name, first, last, email, phone or username, or
+// empty to tell an email or phone number from a name by the value.
+type PseudonymRule struct {
+	Pattern string
+	Kind    string
+	RuleOptions
+}
+
+// pseudonymKinds lists the kinds of fake values.
+var pseudonymKinds = []string{"name", "first", "last", "email", "phone", "username"}
+
+// pseudonymFirstNames and pseudonymLastNames have 256 names each, so that a
+// byte of the HMAC picks one evenly.
+var pseudonymFirstNames = []string{
+	"Aaron", "Abigail", "Adam", "Adrian", "Aisha", "Alan", "Albert", "Alex",
+	"Alice", "Alicia", "Amanda", "Amber", "Amelia", "Amir", "Amy", "Ana",
+	"Andrea", "Andrew", "Angela", "Anna", "Anthony", "Antonio", "Arthur", "Asha",
+	"Ava", "Barbara", "Beatrice", "Ben", "Benjamin", "Bianca", "Brandon", "Brenda",
+	"Brian", "Bruno", "Caleb", "Camila", "Carl", "Carla", "Carlos", "Carmen",
+	"Caroline", "Catherine", "Cecilia", "Charles", "Charlotte", "Chen", "Chloe", "Chris",
+	"Christina", "Claire", "Clara", "Daniel", "Daniela", "David", "Deborah", "Dennis",
+	"Diana", "Diego", "Dmitri", "Dominic", "Donna", "Dorothy", "Dylan", "Edward",
+	"Elena", "Eli", "Elijah", "Elizabeth", "Ella", "Emily", "Emma", "Eric",
+	"Erik", "Esther", "Ethan", "Eva", "Evelyn", "Fatima", "Felix", "Fernando",
+	"Fiona", "Frances", "Francis", "Frank", "Gabriel", "Gabriela", "George", "Georgia",
+	"Gerald", "Gloria", "Grace", "Greg", "Hana", "Hannah", "Harold", "Harry",
+	"Heather", "Helen", "Henry", "Hugo", "Ian", "Ibrahim", "Ingrid", "Irene",
+	"Isaac", "Isabel", "Isabella", "Ivan", "Jack", "Jacob", "Jade", "James",
+	"Jamie", "Jane", "Janet", "Jason", "Javier", "Jean", "Jennifer", "Jeremy",
+	"Jessica", "Joan", "Joel", "John", "Jonas", "Jordan", "Jorge", "Jose",
+	"Joseph", "Joshua", "Joyce", "Juan", "Julia", "Julian", "Justin", "Karen",
+	"Karl", "Kate", "Katherine", "Keith", "Kenji", "Kevin", "Kim", "Kyle",
+	"Laura", "Lauren", "Layla", "Leah", "Leo", "Leon", "Liam", "Lily",
+	"Linda", "Lisa", "Logan", "Lucas", "Lucy", "Luis", "Luna", "Madison",
+	"Magnus", "Maria", "Mark", "Marta", "Martin", "Mary", "Mason", "Matteo",
+	"Matthew", "Maya", "Mei", "Melissa", "Mia", "Michael", "Michelle", "Miguel",
+	"Mila", "Nadia", "Nancy", "Naomi", "Nathan", "Nicholas", "Nicole", "Nina",
+	"Noah", "Nora", "Olga", "Oliver", "Olivia", "Omar", "Oscar", "Pablo",
+	"Pamela", "Patricia", "Patrick", "Paul", "Paula", "Pedro", "Peter", "Philip",
+	"Priya", "Quinn", "Rachel", "Rafael", "Rahul", "Ravi", "Rebecca", "Richard",
+	"Rita", "Robert", "Roger", "Rosa", "Ruby", "Ruth", "Ryan", "Samuel",
+	"Sandra", "Sara", "Scott", "Sean", "Sebastian", "Sharon", "Simon", "Sofia",
+	"Sophie", "Stefan", "Stephanie", "Steven", "Susan", "Tanya", "Teresa", "Thomas",
+	"Timothy", "Tina", "Tom", "Tyler", "Valentina", "Vanessa", "Victor", "Victoria",
+	"Vincent", "Walter", "Wendy", "William", "Xavier", "Yara", "Yasmin", "Yuki",
+	"Yusuf", "Zara", "Zoe", "Aditya", "Agnes", "Alma", "Anders", "Astrid",
+}
+
+var pseudonymLastNames = []string{
+	"Abbott", "Adams", "Ahmed", "Alvarez", "Anderson", "Andersen", "Bailey", "Baker",
+	"Banks", "Barnes", "Becker", "Bell", "Bennett", "Berg", "Bishop", "Black",
+	"Blake", "Brooks", "Brown", "Bryant", "Burke", "Butler", "Campbell", "Carter",
+	"Castillo", "Castro", "Chen", "Clark", "Cole", "Coleman", "Collins", "Cook",
+	"Cooper", "Cruz", "Dahl", "Daniels", "Davies", "Davis", "Diaz", "Dixon",
+	"Doyle", "Duncan", "Edwards", "Ellis", "Evans", "Fischer", "Fisher", "Fleming",
+	"Flores", "Ford", "Foster", "Fox", "Francis", "Fraser", "Fuchs", "Garcia",
+	"Gibson", "Gomez", "Gonzalez", "Gordon", "Graham", "Grant", "Gray", "Green",
+	"Griffin", "Gupta", "Hall", "Hamilton", "Hansen", "Harper", "Harris", "Hart",
+	"Hayes", "Henderson", "Hernandez", "Hill", "Hoffman", "Holmes", "Howard", "Hughes",
+	"Hunt", "Ibrahim", "Ito", "Jackson", "James", "Jensen", "Jimenez", "Johnson",
+	"Jones", "Jordan", "Kaur", "Keller", "Kelly", "Kennedy", "Khan", "Kim",
+	"King", "Klein", "Knight", "Koch", "Kowalski", "Kumar", "Lambert", "Lang",
+	"Larsen", "Lawrence", "Lee", "Lewis", "Lim", "Lindberg", "Lopez", "Lund",
+	"Marshall", "Martin", "Martinez", "Mason", "Meyer", "Miller", "Mitchell", "Moore",
+	"Morales", "Moreno", "Morgan", "Morris", "Muller", "Murphy", "Murray", "Nakamura",
+	"Nelson", "Nguyen", "Nielsen", "Novak", "Olsen", "Ortiz", "Owens", "Palmer",
+	"Park", "Parker", "Patel", "Pearson", "Perez", "Perry", "Peters", "Phillips",
+	"Pierce", "Powell", "Price", "Quinn", "Ramirez", "Ramos", "Reed", "Reyes",
+	"Reynolds", "Richards", "Richardson", "Rivera", "Roberts", "Robinson", "Rodriguez", "Rogers",
+	"Romero", "Rossi", "Russell", "Ryan", "Sanchez", "Sanders", "Santos", "Sato",
+	"Schmidt", "Schneider", "Schulz", "Scott", "Shaw", "Silva", "Simmons", "Singh",
+	"Smith", "Snyder", "Stewart", "Stone", "Sullivan", "Suzuki", "Tanaka", "Taylor",
+	"Thomas", "Thompson", "Torres", "Tran", "Turner", "Vargas", "Vasquez", "Wagner",
+	"Walker", "Wallace", "Walsh", "Wang", "Ward", "Warren", "Watson", "Weber",
+	"Webb", "Wells", "West", "White", "Williams", "Wilson", "Wolf", "Wong",
+	"Wood", "Wright", "Wu", "Yamamoto", "Young", "Zhang", "Zimmerman", "Ali",
+	"Arnold", "Austin", "Bauer", "Berger", "Brandt", "Carlsson", "Chavez", "Costa",
+	"Dunn", "Eriksson", "Ferrari", "Freeman", "Fuller", "Gallagher", "Hale", "Hartmann",
+	"Hoang", "Horvat", "Jansen", "Kaiser", "Kovacs", "Lehmann", "Lindqvist", "Marino",
+	"Medina", "Mendez", "Nowak", "Obi", "Okafor", "Petrov", "Quintero", "Rocha",
+	"Saito", "Sherman", "Sousa", "Vogel", "Wolff", "Yilmaz", "Zhou", "Zeller",
+}
+
+// pseudonymDomains are reserved for examples, so fake emails reach no one.
+var pseudonymDomains = []string{"example.com", "example.net", "example.org"}
+
+// parsePseudonymRules parses pseudonymize rules, key[:kind] or the field
+// form with key, kind and under.
+func parsePseudonymRules(flags []string) ([]PseudonymRule, error) {
+	var rules []PseudonymRule
+	for _, flag := range flags {
+		var rule PseudonymRule
+		if fields, ok := parseRuleFields(flag, "key", "kind", "under"); ok {
+			rule = PseudonymRule{Pattern: fields["key"], Kind: fields["kind"], RuleOptions: RuleOptions{Under: fields["under"]}}
+		} else {
+			rule.Pattern, rule.Kind, _ = strings.Cut(flag, ":")
+		}
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("%q: missing key", flag)
+		}
+		if rule.Kind != "" && !containsString(pseudonymKinds, rule.Kind) {
+			return nil, fmt.Errorf("%q: kind must be one of %s", flag, strings.Join(pseudonymKinds, ", "))
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// pseudonymize returns the fake value of the rule's kind for str. The HMAC
+// is of the value alone, so an email address gets the same fake one under
+// any key. Beyond the names, more of its bits go into a middle initial for
+// names and six digits for emails and usernames, which keeps distinct values
+// from sharing a fake one: names have about 1.7 million fake values, emails
+// 2*10^11 and usernames 6.6*10^10.
+func pseudonymize(str string, rule PseudonymRule, salt string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(str))
+	sum := mac.Sum(nil)
+	first := pseudonymFirstNames[sum[0]]
+	last := pseudonymLastNames[sum[1]]
+	initial := 'A' + rune(sum[2]%26)
+	number := binary.BigEndian.Uint32(sum[3:7]) % 1000000
+
+	kind := rule.Kind
+	if kind == "" {
+		switch {
+		case patternClasses["emailaddr"].MatchString(str):
+			kind = "email"
+		case patternClasses["phone"].MatchString(str):
+			kind = "phone"
+		default:
+			kind = "name"
+		}
+	}
+
+	switch kind {
+	case "first":
+		return first
+	case "last":
+		return last
+	case "email":
+		domain := pseudonymDomains[int(sum[7])%len(pseudonymDomains)]
+		return fmt.Sprintf("%s.%s%06d@%s", strings.ToLower(first), strings.ToLower(last), number, domain)
+	case "username":
+		return fmt.Sprintf("%s%s%06d", strings.ToLower(first), strings.ToLower(last), number)
+	case "phone":
+		// Keep the layout of the number, replacing each digit
+		digits := []byte(str)
+		n := 0
+		for i, c := range digits {
+			if c >= '0' && c <= '9' {
+				digits[i] = '0' + sum[8+n%(len(sum)-8)]%10
+				n++
+			}
+		}
+		return string(digits)
+	}
+	return fmt.Sprintf("%s %c. %s", first, initial, last)
+}
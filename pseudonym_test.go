@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+func TestPseudonymize(t *testing.T) {
+	input := map[string]interface{}{
+		"name":    "Jane Doe",
+		"email":   "jane.doe@corp.example",
+		"contact": "+1 (555) 010-7788",
+		"login":   "jdoe",
+		"id":      7.0,
+	}
+	args := []string{
+		"-pseudonymize", "name",
+		"-pseudonymize", "email",
+		"-pseudonymize", "contact",
+		"-pseudonymize", "login:username",
+		"-pseudonymize", "id",
+		"-pseudonymize-salt", "s3cret",
+	}
+	filters, transforms, _ := parseArgs("test", args)
+	result := processDocument(input, "", filters, transforms).(map[string]interface{})
+
+	shapes := map[string]string{
+		"name":    `^[A-Z][a-z]+ [A-Z]\. [A-Z][a-z]+$`,
+		"email":   `^[a-z]+\.[a-z]+[0-9]{6}@example\.(com|net|org)$`,
+		"contact": `^\+[0-9] \([0-9]{3}\) [0-9]{3}-[0-9]{4}$`,
+		"login":   `^[a-z]+[0-9]{6}$`,
+	}
+	for key, shape := range shapes {
+		value, _ := result[key].(string)
+		if value == input[key] || !regexp.MustCompile(shape).MatchString(value) {
+			t.Errorf("Expected %s pseudonymized as %s, got %q", key, shape, value)
+		}
+	}
+	if result["id"] != 7.0 {
+		t.Errorf("Expected non-string values left alone, got %v", result["id"])
+	}
+
+	// The same value maps to the same fake one, under any key and run
+	filters, transforms, _ = parseArgs("test", args)
+	again := processDocument(map[string]interface{}{"author": map[string]interface{}{"email": "jane.doe@corp.example"}}, "", filters, transforms)
+	if author := again.(map[string]interface{})["author"].(map[string]interface{}); author["email"] != result["email"] {
+		t.Errorf("Expected the same fake email, got %v and %v", author["email"], result["email"])
+	}
+
+	// Another salt gives other fake values
+	other := pseudonymize("jane.doe@corp.example", PseudonymRule{}, "other")
+	if other == result["email"] {
+		t.Errorf("Expected a different fake email for another salt, got %q", other)
+	}
+
+	// Distinct values rarely share a fake one
+	seen := make(map[string]bool)
+	for i := 0; i < 10000; i++ {
+		fake := pseudonymize(fmt.Sprintf("user%d@corp.example", i), PseudonymRule{}, "s3cret")
+		if seen[fake] {
+			t.Errorf("Expected distinct fake emails for 10000 addresses, got %q twice", fake)
+		}
+		seen[fake] = true
+	}
+
+	rules, err := parsePseudonymRules([]string{"under=staff key=name kind=first"})
+	if err != nil || len(rules) != 1 || rules[0].Kind != "first" || rules[0].Under != "staff" {
+		t.Errorf("Expected the field form parsed, got %+v, %v", rules, err)
+	}
+	if _, err := parsePseudonymRules([]string{"name:ssn"}); err == nil {
+		t.Errorf("Expected an unknown kind rejected")
+	}
+
+	_, transforms, _ = parseArgs("test", []string{"-pseudonymize", "name"})
+	if _, err := NewPipeline(&Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms); err == nil {
+		t.Errorf("Expected -pseudonymize without a salt rejected")
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+// removedDocument returns the parts of a document that the filters remove,
+// in the structure of the input: removed members keep their original key and
+// value, and objects and arrays with removed members inside them are kept
+// with just those. A document with nothing removed gives an empty object or
+// array.
+func removedDocument(data interface{}, filters *Filters, transforms *Transformations) interface{} {
+	if removed, ok := removedJSON(data, filters, transforms, 1); ok {
+		return removed
+	}
+	switch data.(type) {
+	case map[string]interface{}:
+		return map[string]interface{}{}
+	case []interface{}:
+		return []interface{}{}
+	}
+	return nil
+}
+
+// removedJSON mirrors processJSON, collecting what it leaves out. It reports
+// false if nothing is removed from data.
+func removedJSON(data interface{}, filters *Filters, transforms *Transformations, depth int) (interface{}, bool) {
+	if transforms.aboveDepthRoot() {
+		depth = 0
+	}
+	switch v := data.(type) {
+	case map[string]interface{}:
+		scoped := transforms.scopedTo(v)
+		removed := make(map[string]interface{})
+		for key, value := range v {
+			_, newValue, include, final, partial := processMember(key, value, filters, scoped, depth)
+			if partial && !holdsMember(processJSON(newValue, filters, transforms.descend(key), depth+1)) {
+				include = false
+			}
+			if !include {
+				removed[key] = value
+			} else if !final {
+				if part, ok := removedJSON(newValue, filters, transforms.descend(key), depth+1); ok {
+					removed[key] = part
+				}
+			}
+		}
+		return removed, len(removed) > 0
+
+	case []interface{}:
+		scoped := transforms.scopedTo(nil)
+		var removed []interface{}
+		for i, item := range v {
+			_, include, final := processElement(i, item, filters, transforms, scoped, depth)
+			if !include {
+				removed = append(removed, item)
+			} else if !final {
+				elem := transforms
+				if transforms.tracksPath() {
+					elem = transforms.withPath(transforms.elementPath(i))
+				}
+				if part, ok := removedJSON(item, filters, elem, depth+1); ok {
+					removed = append(removed, part)
+				}
+			}
+		}
+		return removed, len(removed) > 0
+	}
+	return nil, false
+}
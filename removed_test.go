@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRemovedDocument(t *testing.T) {
+	input := map[string]interface{}{
+		"name": "Ann",
+		"ssn":  "123-45-6789",
+		"tmp":  nil,
+		"items": []interface{}{
+			map[string]interface{}{"id": 1.0, "secret": "x"},
+			map[string]interface{}{"id": 2.0},
+			"",
+		},
+		"meta": map[string]interface{}{"tmp": 1.0, "ok": true},
+	}
+	filters, transforms, _ := parseArgs("test", []string{"-dropkey", "tmp", "-dropkey", "secret", "-emptystrings", "drop", "-replacekey", "name:fullname"})
+
+	expected := map[string]interface{}{
+		"tmp":   nil,
+		"items": []interface{}{map[string]interface{}{"secret": "x"}, ""},
+		"meta":  map[string]interface{}{"tmp": 1.0},
+	}
+	if result := removedDocument(input, filters, transforms); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+
+	filters, transforms, _ = parseArgs("test", []string{"-dropkey", "other"})
+	if result := removedDocument(input, filters, transforms); !reflect.DeepEqual(result, map[string]interface{}{}) {
+		t.Errorf("Expected an empty object, got %v", result)
+	}
+	if result := removedDocument([]interface{}{1.0}, filters, transforms); !reflect.DeepEqual(result, []interface{}{}) {
+		t.Errorf("Expected an empty array, got %v", result)
+	}
+}
+
+func TestInvert(t *testing.T) {
+	input := []interface{}{
+		map[string]interface{}{"name": "Ann", "ssn": "123-45-6789", "note": "call 555-12-3456"},
+		map[string]interface{}{"name": "Bob"},
+	}
+	filters, transforms, _ := parseArgs("test", []string{"-invert", "-nostrpattern", "num", "-maskval", "name:***"})
+
+	expected := []interface{}{
+		map[string]interface{}{"ssn": "123-45-6789", "note": "call 555-12-3456"},
+	}
+	if result := processDocument(input, "in.json", filters, transforms); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
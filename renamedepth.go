@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// parseDepthRange parses a depth such as 2, or a range of depths such as 2-4,
+// returning 0 as the maximum for a single depth.
+func parseDepthRange(str string) (int, int, error) {
+	from, to, isRange := strings.Cut(str, "-")
+	depth, err := strconv.Atoi(from)
+	if err != nil || !isRange {
+		return depth, 0, err
+	}
+	maxDepth, err := strconv.Atoi(to)
+	if err != nil {
+		return 0, 0, err
+	}
+	if maxDepth < depth {
+		return 0, 0, fmt.Errorf("depth range %s is reversed", str)
+	}
+	return depth, maxDepth, nil
+}
+
+// renames reports whether the rule applies to key at depth. The key pattern
+// is the one NewPipeline compiled, or else compiled on the spot.
+func (r *RenameDepthRule) renames(key string, depth int) bool {
+	if depth != r.Depth && (r.MaxDepth <= r.Depth || depth < r.Depth || depth > r.MaxDepth) {
+		return false
+	}
+	if r.Key == "" {
+		return true
+	}
+	re := r.re
+	if re == nil {
+		var err error
+		if re, err = regexp.Compile(r.Key); err != nil {
+			return false
+		}
+	}
+	return re.MatchString(key)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenameKeyDepthRanges(t *testing.T) {
+	input := map[string]interface{}{
+		"id": 1.0,
+		"user": map[string]interface{}{
+			"user_id": 2.0,
+			"name":    "Ada",
+			"address": map[string]interface{}{"city": "London", "zip_code": "N1"},
+		},
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{
+		"-renamekeydepth", "2-3:x_",
+		"-renamekeydepth", `depth=1-2 key=_id$ suffix=_ref`,
+	})
+	expected := map[string]interface{}{
+		"id": 1.0,
+		"user": map[string]interface{}{
+			"x_user_id_ref": 2.0,
+			"x_name":        "Ada",
+			"x_address":     map[string]interface{}{"x_city": "London", "x_zip_code": "N1"},
+		},
+	}
+	if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected keys renamed by depth range and key pattern, got %v", result)
+	}
+
+	for _, str := range []string{"x", "2-", "4-2"} {
+		if _, _, err := parseDepthRange(str); err == nil {
+			t.Errorf("Expected depth %q to be rejected", str)
+		}
+	}
+
+	transforms = &Transformations{RenameKeyDepth: []RenameDepthRule{{Depth: 1, Key: "("}}}
+	if _, err := NewPipeline(filters, transforms); err == nil {
+		t.Error("Expected an invalid key pattern to be rejected")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sampleSeed makes arraysample reproducible when set with -seed; otherwise
+// every run draws a different sample.
+var sampleSeed *uint64
+
+// parseSampleRules parses arraysample rules, key:10% or key:100, or the field
+// form with key, size and under.
+func parseSampleRules(flags []string) ([]SampleRule, error) {
+	var rules []SampleRule
+	for _, flag := range flags {
+		var pattern, size, under string
+		if fields, ok := parseRuleFields(flag, "key", "size", "under"); ok {
+			pattern, size, under = fields["key"], fields["size"], fields["under"]
+		} else if i := strings.LastIndex(flag, ":"); i >= 0 {
+			pattern, size = flag[:i], flag[i+1:]
+		}
+		if pattern == "" || size == "" {
+			return nil, fmt.Errorf("%q: must be key:n or key:n%%", flag)
+		}
+
+		rule := SampleRule{Pattern: pattern, RuleOptions: RuleOptions{Under: under}}
+		if percent, ok := strings.CutSuffix(size, "%"); ok {
+			p, err := strconv.ParseFloat(percent, 64)
+			if err != nil || p < 0 || p > 100 {
+				return nil, fmt.Errorf("%q: percentage must be between 0 and 100", flag)
+			}
+			rule.Percent = p
+		} else {
+			n, err := strconv.Atoi(size)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("%q: count must be a non-negative integer", flag)
+			}
+			rule.Count, rule.Percent = n, -1
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// sampleArray keeps a random subset of the elements of arr, in their
+// original order. With -seed the subset only depends on the seed, the key
+// and the array's contents, so a rerun keeps the same elements whatever
+// order the document is processed in.
+func sampleArray(key string, arr []interface{}, rule SampleRule) []interface{} {
+	n := rule.Count
+	if rule.Percent >= 0 {
+		n = int(math.Round(float64(len(arr)) * rule.Percent / 100))
+	}
+	if n >= len(arr) {
+		return arr
+	}
+
+	var rng *rand.Rand
+	if sampleSeed != nil {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte(compactJSON(arr)))
+		rng = rand.New(rand.NewPCG(*sampleSeed, h.Sum64()))
+	} else {
+		rng = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+
+	picked := rng.Perm(len(arr))[:n]
+	sort.Ints(picked)
+	result := make([]interface{}, n)
+	for i, index := range picked {
+		result[i] = arr[index]
+	}
+	return result
+}
+
+// setSampleSeed sets sampleSeed from the -seed flag.
+func setSampleSeed(value string) error {
+	seed, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("must be a non-negative integer")
+	}
+	sampleSeed = &seed
+	return nil
+}
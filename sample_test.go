@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestArraySample(t *testing.T) {
+	seed := uint64(42)
+	sampleSeed = &seed
+	defer func() { sampleSeed = nil }()
+
+	var items []interface{}
+	for i := 0; i < 50; i++ {
+		items = append(items, float64(i))
+	}
+	input := map[string]interface{}{
+		"events": items,
+		"small":  []interface{}{1.0, 2.0},
+		"other":  items,
+	}
+
+	rules, err := parseSampleRules([]string{"events:10%", "key=small size=5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transforms := &Transformations{ArraySample: rules}
+	result := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1).(map[string]interface{})
+
+	sample := result["events"].([]interface{})
+	if len(sample) != 5 {
+		t.Fatalf("Expected 5 elements, got %v", sample)
+	}
+	for i := 1; i < len(sample); i++ {
+		if sample[i].(float64) <= sample[i-1].(float64) {
+			t.Errorf("Expected the original order, got %v", sample)
+		}
+	}
+	if len(result["small"].([]interface{})) != 2 || len(result["other"].([]interface{})) != 50 {
+		t.Errorf("Expected small and unmatched arrays to be kept, got %v", result)
+	}
+
+	again := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1).(map[string]interface{})
+	if !reflect.DeepEqual(again["events"], sample) {
+		t.Errorf("Expected the same sample with the same seed, got %v and %v", sample, again["events"])
+	}
+
+	for _, flag := range []string{"events", "events:101%", "events:-1", "events:x", ":10"} {
+		if _, err := parseSampleRules([]string{flag}); err == nil {
+			t.Errorf("Expected an error for %q", flag)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ScaleRule applies arithmetic to the numbers of keys matching Pattern, for
+// unit conversions: Op is one of * / + - and Operand its right-hand side.
+// Numbers in an array value are scaled too.
+type ScaleRule struct {
+	Pattern string
+	Op      string
+	Operand float64
+	RuleOptions
+}
+
+// parseScaleRules parses -scalenum rules of the form key:<op><number>, e.g.
+// price_cents:/100 or temp:+273.15.
+func parseScaleRules(flags []string) ([]ScaleRule, error) {
+	var rules []ScaleRule
+	for _, flag := range flags {
+		var pattern, operation string
+		var opts RuleOptions
+		if fields, ok := parseRuleFields(flag, "key", "op", "under"); ok {
+			pattern, operation, opts = fields["key"], fields["op"], RuleOptions{Under: fields["under"]}
+		} else {
+			i := strings.LastIndex(flag, ":")
+			if i < 0 {
+				return nil, fmt.Errorf("%q: must be key:<op><number>", flag)
+			}
+			pattern, operation = flag[:i], flag[i+1:]
+		}
+		if operation == "" || !strings.Contains("*/+-", operation[:1]) {
+			return nil, fmt.Errorf("%q: operation must start with *, /, + or -", flag)
+		}
+		operand, err := strconv.ParseFloat(operation[1:], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: invalid number %q", flag, operation[1:])
+		}
+		if operation[0] == '/' && operand == 0 {
+			return nil, fmt.Errorf("%q: division by zero", flag)
+		}
+		rules = append(rules, ScaleRule{Pattern: pattern, Op: operation[:1], Operand: operand, RuleOptions: opts})
+	}
+	return rules, nil
+}
+
+// scaleValue applies the rule to a number, or to the numbers of an array,
+// leaving other values as they are.
+func scaleValue(value interface{}, rule ScaleRule) interface{} {
+	switch v := value.(type) {
+	case float64:
+		switch rule.Op {
+		case "*":
+			return v * rule.Operand
+		case "/":
+			return v / rule.Operand
+		case "+":
+			return v + rule.Operand
+		case "-":
+			return v - rule.Operand
+		}
+	case []interface{}:
+		scaled := make([]interface{}, len(v))
+		for i, item := range v {
+			scaled[i] = scaleValue(item, rule)
+		}
+		return scaled
+	}
+	return value
+}
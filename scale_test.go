@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScaleNum(t *testing.T) {
+	input := map[string]interface{}{
+		"price_cents": 1999.0,
+		"temp_c":      20.0,
+		"readings":    []interface{}{10.0, "n/a", 30.0},
+		"sensor":      map[string]interface{}{"temp_c": 25.0},
+		"label":       "temp_c",
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{
+		"-scalenum", "price_cents:/100",
+		"-scalenum", "temp_c:*1.8", "-scalenum", "temp_c:+32",
+		"-scalenum", "$.readings:-10",
+		"-scalenum", "label:*2",
+	})
+	expected := map[string]interface{}{
+		"price_cents": 19.99,
+		"temp_c":      68.0,
+		"readings":    []interface{}{0.0, "n/a", 20.0},
+		"sensor":      map[string]interface{}{"temp_c": 77.0},
+		"label":       "temp_c",
+	}
+	if result := processDocument(input, "", filters, transforms); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected numbers scaled in rule order, got %v", result)
+	}
+
+	filters, transforms, _ = parseArgs("test", []string{"-scalenum", "/sensor/temp_c:+273.15"})
+	sensor := processDocument(input, "", filters, transforms).(map[string]interface{})["sensor"]
+	if !reflect.DeepEqual(sensor, map[string]interface{}{"temp_c": 298.15}) {
+		t.Errorf("Expected only the pointed-to number scaled, got %v", sensor)
+	}
+
+	for _, flag := range []string{"temp", "temp:%2", "temp:*x", "temp:/0"} {
+		if _, err := parseScaleRules([]string{flag}); err == nil {
+			t.Errorf("Expected -scalenum %q to be rejected", flag)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// SchemaChange describes a key path added, removed or changed in type
+// between two documents.
+type SchemaChange struct {
+	Op   string // "+" added, "-" removed, "~" type changed
+	Path string
+	Old  string
+	New  string
+}
+
+// runSchemaDiff implements the schema-diff subcommand. Both documents are
+// processed with the ruleset and their key paths and value types compared,
+// ignoring the values themselves. The exit code follows diff: 0 when the
+// shapes match, 1 when they differ, 2 on error.
+func runSchemaDiff(arguments []string) {
+	filters, transforms, args := parseArgs("schema-diff", arguments)
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s schema-diff [options] a.json b.json\n", os.Args[0])
+		os.Exit(2)
+	}
+	pipeline, err := NewPipeline(filters, transforms)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	var schemas [2]map[string]string
+	for i, filename := range args {
+		data, err := readJSON(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		processed, err := pipeline.Process(data, filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		schemas[i] = documentSchema(processed)
+	}
+
+	changes := diffSchemas(schemas[0], schemas[1])
+	for _, change := range changes {
+		fmt.Println(formatSchemaChange(change))
+	}
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+}
+
+// documentSchema maps each key path of a document to its value types,
+// joined with | when a path has several, e.g. "null|string".
+func documentSchema(doc interface{}) map[string]string {
+	types := make(map[string]map[string]bool)
+	walkPaths(doc, "$", func(path string, value interface{}) {
+		if types[path] == nil {
+			types[path] = make(map[string]bool)
+		}
+		types[path][getValueType(value)] = true
+	})
+
+	schema := make(map[string]string, len(types))
+	for path, set := range types {
+		names := make([]string, 0, len(set))
+		for name := range set {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		schema[path] = strings.Join(names, "|")
+	}
+	return schema
+}
+
+// diffSchemas compares two schemas and returns their differences in path
+// order.
+func diffSchemas(a, b map[string]string) []SchemaChange {
+	var changes []SchemaChange
+	for path, old := range a {
+		if typ, ok := b[path]; !ok {
+			changes = append(changes, SchemaChange{Op: "-", Path: path, Old: old})
+		} else if typ != old {
+			changes = append(changes, SchemaChange{Op: "~", Path: path, Old: old, New: typ})
+		}
+	}
+	for path, typ := range b {
+		if _, ok := a[path]; !ok {
+			changes = append(changes, SchemaChange{Op: "+", Path: path, New: typ})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func formatSchemaChange(change SchemaChange) string {
+	switch change.Op {
+	case "-":
+		return fmt.Sprintf("- %s: %s", change.Path, change.Old)
+	case "+":
+		return fmt.Sprintf("+ %s: %s", change.Path, change.New)
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", change.Path, change.Old, change.New)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchemaDiff(t *testing.T) {
+	a := map[string]interface{}{
+		"id":    1.0,
+		"email": "a@example.com",
+		"tags":  []interface{}{"x"},
+		"zip":   "0150",
+	}
+	b := map[string]interface{}{
+		"id":    "1",
+		"email": "b@example.com",
+		"tags":  []interface{}{"y", nil},
+		"phone": "555",
+	}
+
+	expected := []SchemaChange{
+		{Op: "~", Path: "$.id", Old: "number", New: "string"},
+		{Op: "+", Path: "$.phone", New: "string"},
+		{Op: "~", Path: "$.tags[]", Old: "string", New: "null|string"},
+		{Op: "-", Path: "$.zip", Old: "string"},
+	}
+	if changes := diffSchemas(documentSchema(a), documentSchema(b)); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %v, got %v", expected, changes)
+	}
+
+	// Rules apply before the comparison
+	filters, transforms, _ := parseArgs("schema-diff", []string{"-dropkey", "zip", "-dropkey", "phone", "-dropkey", "tags", "-dropkey", "id"})
+	pipeline, err := NewPipeline(filters, transforms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	processedA, _ := pipeline.Process(a, "a.json")
+	processedB, _ := pipeline.Process(b, "b.json")
+	if changes := diffSchemas(documentSchema(processedA), documentSchema(processedB)); len(changes) != 0 {
+		t.Errorf("Expected no changes, got %v", changes)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// Script is a Starlark transform loaded with -script. The script defines
+//
+//	def transform(path, key, value, depth):
+//
+// which is called for every object member after the built-in
+// transformations and plugins. It returns keep() or None to keep the member,
+// drop() to remove it, or replace(v) to substitute its value.
+type Script struct {
+	filename  string
+	transform starlark.Callable
+}
+
+// scriptDecision is the result of keep(), drop() and replace(v).
+type scriptDecision struct {
+	action string
+	value  starlark.Value
+}
+
+func (d *scriptDecision) String() string        { return d.action + "()" }
+func (d *scriptDecision) Type() string          { return "decision" }
+func (d *scriptDecision) Freeze()               {}
+func (d *scriptDecision) Truth() starlark.Bool  { return starlark.True }
+func (d *scriptDecision) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: decision") }
+
+// scriptBuiltins are predeclared in transform scripts.
+var scriptBuiltins = starlark.StringDict{
+	"keep": starlark.NewBuiltin("keep", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+			return nil, err
+		}
+		return &scriptDecision{action: "keep"}, nil
+	}),
+	"drop": starlark.NewBuiltin("drop", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+			return nil, err
+		}
+		return &scriptDecision{action: "drop"}, nil
+	}),
+	"replace": starlark.NewBuiltin("replace", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var value starlark.Value
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &value); err != nil {
+			return nil, err
+		}
+		return &scriptDecision{action: "replace", value: value}, nil
+	}),
+}
+
+// loadScript runs a Starlark script and looks up its transform function.
+func loadScript(filename string) (*Script, error) {
+	thread := &starlark.Thread{Name: "load " + filename}
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, filename, nil, scriptBuiltins)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading script: %v", err)
+	}
+
+	transform, ok := globals["transform"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("Script %s does not define a transform function", filename)
+	}
+	return &Script{filename: filename, transform: transform}, nil
+}
+
+// decide calls the script for an object member and returns its new value and
+// whether it is kept. A failing script returns the error that stops the run,
+// so that values it should have dropped are never written as is.
+func (s *Script) decide(path, key string, value interface{}, depth int) (interface{}, bool, error) {
+	result, keep, err := s.call(path, key, value, depth)
+	if err != nil {
+		return nil, false, fmt.Errorf("Error in script %s at %s: %v", s.filename, path, err)
+	}
+	return result, keep, nil
+}
+
+func (s *Script) call(path, key string, value interface{}, depth int) (interface{}, bool, error) {
+	arg, err := toStarlark(value)
+	if err != nil {
+		return nil, false, err
+	}
+
+	thread := &starlark.Thread{Name: path}
+	args := starlark.Tuple{starlark.String(path), starlark.String(key), arg, starlark.MakeInt(depth)}
+	result, err := starlark.Call(thread, s.transform, args, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch r := result.(type) {
+	case starlark.NoneType:
+		return value, true, nil
+	case *scriptDecision:
+		switch r.action {
+		case "drop":
+			return nil, false, nil
+		case "replace":
+			replaced, err := fromStarlark(r.value)
+			if err != nil {
+				return nil, false, err
+			}
+			return replaced, true, nil
+		}
+		return value, true, nil
+	}
+	return nil, false, fmt.Errorf("transform returned %s; want keep(), drop(), replace(v) or None", result.Type())
+}
+
+// toStarlark converts a JSON value for a script.
+func toStarlark(value interface{}) (starlark.Value, error) {
+	switch v := value.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case float64:
+		return starlark.Float(v), nil
+	case string:
+		return starlark.String(v), nil
+	case []interface{}:
+		items := make([]starlark.Value, len(v))
+		for i, item := range v {
+			converted, err := toStarlark(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = converted
+		}
+		return starlark.NewList(items), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		dict := starlark.NewDict(len(v))
+		for _, key := range keys {
+			converted, err := toStarlark(v[key])
+			if err != nil {
+				return nil, err
+			}
+			dict.SetKey(starlark.String(key), converted)
+		}
+		return dict, nil
+	default:
+		return nil, fmt.Errorf("cannot pass %T to a script", value)
+	}
+}
+
+// fromStarlark converts a value returned by a script back to JSON. Integers
+// become float64 like every other JSON number.
+func fromStarlark(value starlark.Value) (interface{}, error) {
+	switch v := value.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int, starlark.Float:
+		f, _ := starlark.AsFloat(v)
+		return f, nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Indexable:
+		// Lists and tuples
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			converted, err := fromStarlark(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			items[i] = converted
+		}
+		return items, nil
+	case *starlark.Dict:
+		obj := make(map[string]interface{}, v.Len())
+		for _, item := range v.Items() {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("dict key %s is not a string", item[0])
+			}
+			converted, err := fromStarlark(item[1])
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = converted
+		}
+		return obj, nil
+	default:
+		return nil, fmt.Errorf("cannot use %s as a JSON value", value.Type())
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeScript(t *testing.T, src string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "transform.star")
+	if err := os.WriteFile(filename, []byte(src), 0644); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	return filename
+}
+
+func TestScriptTransform(t *testing.T) {
+	script, err := loadScript(writeScript(t, `
+def transform(path, key, value, depth):
+    if key.startswith("_"):
+        return drop()
+    if path == "$.user.id":
+        return replace("id-" + str(int(value)))
+    if key == "tags" and depth == 2:
+        return replace([tag.upper() for tag in value])
+    return keep()
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := map[string]interface{}{
+		"_internal": true,
+		"user": map[string]interface{}{
+			"id":   42.0,
+			"tags": []interface{}{"a", "b"},
+			"name": "alice",
+		},
+	}
+	result := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, &Transformations{Script: script}, 1)
+
+	expected := map[string]interface{}{
+		"user": map[string]interface{}{
+			"id":   "id-42",
+			"tags": []interface{}{"A", "B"},
+			"name": "alice",
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestScriptErrors(t *testing.T) {
+	if _, err := loadScript(writeScript(t, "x = 1\n")); err == nil {
+		t.Error("Expected an error for a script without transform")
+	}
+
+	script, err := loadScript(writeScript(t, "def transform(path, key, value, depth):\n    return 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := script.call("$.a", "a", "x", 1); err == nil {
+		t.Error("Expected an error for an invalid decision")
+	}
+
+	// A failing script stops processing with an error
+	pipeline, err := NewPipeline(&Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, &Transformations{Script: script})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := pipeline.Process(map[string]interface{}{"a": "x"}, "test")
+	if err == nil || !strings.Contains(err.Error(), "Error in script") || result != nil {
+		t.Errorf("Expected a failing script to stop processing, got %v, %v", result, err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// SourceInfo describes the input file a document was read from. When clauses
+// see its fields as $file, $dir, $base, $stem and $ext, e.g.
+// $stem=="eu-users", and output file name templates as {{.Stem}} and so on.
+type SourceInfo struct {
+	// Path is the file name as given
+	Path string
+	Dir  string
+	Base string
+	// Stem is the base name without its extension
+	Stem string
+	Ext  string
+	// Date and Time are the processing time, as 2006-01-02 and
+	// 20060102T150405Z
+	Date string
+	Time string
+}
+
+// newSourceInfo returns the metadata of the input file path.
+func newSourceInfo(path string) *SourceInfo {
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	return &SourceInfo{
+		Path: path,
+		Dir:  filepath.Dir(path),
+		Base: base,
+		Stem: strings.TrimSuffix(base, ext),
+		Ext:  ext,
+		Date: processingTime.Format(time.DateOnly),
+		Time: processingTime.Format("20060102T150405Z"),
+	}
+}
+
+// field returns the value of a $name when clause field, which is null when
+// the source is unknown.
+func (s *SourceInfo) field(name string) interface{} {
+	if s == nil {
+		return nil
+	}
+	switch name {
+	case "$file":
+		return s.Path
+	case "$dir":
+		return s.Dir
+	case "$base":
+		return s.Base
+	case "$stem":
+		return s.Stem
+	case "$ext":
+		return s.Ext
+	default:
+		return nil
+	}
+}
+
+// expandOutputName renders an output file name template such as
+// sanitized/{{.Stem}}-{{.Date}}.json for the source. Names without {{ are
+// returned as they are.
+func expandOutputName(name string, source *SourceInfo) (string, error) {
+	if !strings.Contains(name, "{{") {
+		return name, nil
+	}
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(name)
+	if err != nil {
+		return "", fmt.Errorf("Invalid output file name template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, source); err != nil {
+		return "", fmt.Errorf("Invalid output file name template: %v", err)
+	}
+	return buf.String(), nil
+}
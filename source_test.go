@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSourceConditions(t *testing.T) {
+	transforms := &Transformations{
+		MaskVal: []MaskRule{
+			{Pattern: "email", Mask: "***", RuleOptions: RuleOptions{When: `$stem == "eu-users"`}},
+		},
+	}
+	filters := &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}
+	input := map[string]interface{}{"email": "a@example.com"}
+
+	result := processDocument(input, "exports/eu-users.json", filters, transforms)
+	if expected := map[string]interface{}{"email": "***"}; !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected the EU file to be masked, got %v", result)
+	}
+	result = processDocument(input, "exports/us-users.json", filters, transforms)
+	if !reflect.DeepEqual(result, input) {
+		t.Errorf("Expected other files to be left alone, got %v", result)
+	}
+}
+
+func TestExpandOutputName(t *testing.T) {
+	defer func(saved time.Time) { processingTime = saved }(processingTime)
+	processingTime = time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	source := newSourceInfo("in/users.v2.json")
+	name, err := expandOutputName("sanitized/{{.Stem}}-{{.Date}}{{.Ext}}", source)
+	if err != nil || name != "sanitized/users.v2-2026-01-02.json" {
+		t.Errorf("Expected the templated name, got %q, %v", name, err)
+	}
+	if name, err := expandOutputName("out.json", source); err != nil || name != "out.json" {
+		t.Errorf("Expected a plain name unchanged, got %q, %v", name, err)
+	}
+	if _, err := expandOutputName("{{.Nope}}.json", source); err == nil {
+		t.Error("Expected an unknown field to be rejected")
+	}
+}
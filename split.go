@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// outputPart is one of the files a split document is written to.
+type outputPart struct {
+	Filename string
+	Value    interface{}
+}
+
+// splitOutput splits a processed document into parts for -split-by-key or
+// -chunk-size. File names come from the template, where {key} is replaced by
+// the top-level key and {n} by the 1-based chunk number; by default they are
+// the output file name with -{key} or -{n} before the extension.
+func splitOutput(result interface{}, outputFile string, opts *FormatOptions) ([]outputPart, error) {
+	template := opts.SplitTemplate
+	if template == "" {
+		placeholder := "{n}"
+		if opts.SplitByKey {
+			placeholder = "{key}"
+		}
+		ext := filepath.Ext(outputFile)
+		template = strings.TrimSuffix(outputFile, ext) + "-" + placeholder + ext
+	}
+
+	var parts []outputPart
+	if opts.SplitByKey {
+		obj, ok := result.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("-split-by-key requires an object, got %s", getValueType(result))
+		}
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			// Keys must not reach outside the output directory
+			name := strings.NewReplacer("/", "_", "\\", "_").Replace(key)
+			if name == "" || name == "." || name == ".." {
+				name = "_" + name
+			}
+			parts = append(parts, outputPart{strings.ReplaceAll(template, "{key}", name), obj[key]})
+		}
+		return parts, nil
+	}
+
+	arr, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("-chunk-size requires an array, got %s", getValueType(result))
+	}
+	for start := 0; start < len(arr); start += opts.ChunkSize {
+		end := start + opts.ChunkSize
+		if end > len(arr) {
+			end = len(arr)
+		}
+		n := strconv.Itoa(len(parts) + 1)
+		parts = append(parts, outputPart{strings.ReplaceAll(template, "{n}", n), arr[start:end]})
+	}
+	return parts, nil
+}
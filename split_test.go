@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitOutput(t *testing.T) {
+	doc := map[string]interface{}{"users": []interface{}{1.0}, "../orders": "x"}
+	parts, err := splitOutput(doc, "out/export.json", &FormatOptions{SplitByKey: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []outputPart{
+		{"out/export-.._orders.json", "x"},
+		{"out/export-users.json", []interface{}{1.0}},
+	}
+	if !reflect.DeepEqual(parts, expected) {
+		t.Errorf("Expected %v, got %v", expected, parts)
+	}
+
+	arr := []interface{}{1.0, 2.0, 3.0, 4.0, 5.0}
+	parts, err = splitOutput(arr, "export.json", &FormatOptions{ChunkSize: 2, SplitTemplate: "chunk_{n}.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []outputPart{
+		{"chunk_1.json", []interface{}{1.0, 2.0}},
+		{"chunk_2.json", []interface{}{3.0, 4.0}},
+		{"chunk_3.json", []interface{}{5.0}},
+	}
+	if !reflect.DeepEqual(parts, expected) {
+		t.Errorf("Expected %v, got %v", expected, parts)
+	}
+
+	if _, err := splitOutput(arr, "export.json", &FormatOptions{SplitByKey: true}); err == nil {
+		t.Error("Expected an error splitting an array by key")
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// tableFormats are the output formats writing rows of a table: sql, as
+// CREATE TABLE and INSERT statements, and sqlite, into a database file.
+var tableFormats = []string{"sql", "sqlite"}
+
+// sqlTable is a processed document laid out as the rows of a table.
+type sqlTable struct {
+	Columns []string
+	// Types are the column types: INTEGER, REAL or TEXT
+	Types []string
+	Rows  [][]interface{}
+}
+
+// tableRows lays out an object, or an array of objects, as rows with a
+// column for each key, nested keys joined with dots as in CSV output.
+// Columns are in order of first appearance. Booleans become 1 and 0, arrays
+// JSON text, and a column of whole numbers INTEGER. A column with nothing
+// but nulls is TEXT, the type that takes any value.
+func tableRows(doc interface{}) (*sqlTable, error) {
+	records, columns, err := flatRecords(doc, "SQL")
+	if err != nil {
+		return nil, err
+	}
+	table := &sqlTable{Columns: columns}
+
+	for _, column := range table.Columns {
+		columnType, typed := "INTEGER", false
+		for _, record := range records {
+			switch v := record[column].(type) {
+			case nil:
+				continue
+			case bool:
+			case float64:
+				if v != math.Trunc(v) || math.IsInf(v, 0) {
+					columnType = "REAL"
+				}
+			default:
+				columnType = "TEXT"
+			}
+			typed = true
+			if columnType == "TEXT" {
+				break
+			}
+		}
+		if !typed {
+			columnType = "TEXT"
+		}
+		table.Types = append(table.Types, columnType)
+	}
+
+	for _, record := range records {
+		row := make([]interface{}, len(table.Columns))
+		for i, column := range table.Columns {
+			row[i] = sqlValue(record[column], table.Types[i])
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table, nil
+}
+
+// sqlValue converts a value for a column of the given type. NaN has no SQL
+// form and becomes NULL.
+func sqlValue(value interface{}, columnType string) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	case float64:
+		if math.IsNaN(v) {
+			return nil
+		}
+		if columnType == "INTEGER" {
+			return int64(v)
+		}
+		return v
+	case string:
+		return v
+	}
+	return compactJSON(value)
+}
+
+// quoteIdentifier quotes a table or column name for SQL.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// createTableSQL returns the statement creating the table if it does not
+// exist yet.
+func (t *sqlTable) createTableSQL(name string) string {
+	columns := make([]string, len(t.Columns))
+	for i, column := range t.Columns {
+		columns[i] = quoteIdentifier(column) + " " + t.Types[i]
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", quoteIdentifier(name), strings.Join(columns, ", "))
+}
+
+// insertSQL returns the start of the statement inserting a row, up to the
+// values.
+func (t *sqlTable) insertSQL(name string) string {
+	columns := make([]string, len(t.Columns))
+	for i, column := range t.Columns {
+		columns[i] = quoteIdentifier(column)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES ", quoteIdentifier(name), strings.Join(columns, ", "))
+}
+
+// encodeSQL writes a processed document as a CREATE TABLE statement and an
+// INSERT statement per row.
+func encodeSQL(doc interface{}, name string) ([]byte, error) {
+	table, err := tableRows(doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(table.Columns) == 0 {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(table.createTableSQL(name) + ";\n")
+	insert := table.insertSQL(name)
+	for _, row := range table.Rows {
+		literals := make([]string, len(row))
+		for i, value := range row {
+			literals[i] = sqlLiteral(value)
+		}
+		buf.WriteString(insert + "(" + strings.Join(literals, ", ") + ");\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// sqlLiteral writes a row value as an SQL literal.
+func sqlLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		// SQLite reads numbers too large for a double as infinity
+		if math.IsInf(v, 1) {
+			return "9e999"
+		} else if math.IsInf(v, -1) {
+			return "-9e999"
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return "'" + strings.ReplaceAll(value.(string), "'", "''") + "'"
+}
+
+// writeSQLite inserts a processed document into a table of a SQLite
+// database file, creating the file and table if needed and adding columns
+// the table lacks. It returns the number of rows inserted, all of them or
+// none.
+func writeSQLite(doc interface{}, filename, name string) (int, error) {
+	table, err := tableRows(doc)
+	if err != nil {
+		return 0, err
+	}
+	if len(table.Columns) == 0 {
+		return 0, nil
+	}
+
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		return 0, fmt.Errorf("Error opening SQLite database: %v", err)
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("Error writing SQLite database: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(table.createTableSQL(name)); err != nil {
+		return 0, fmt.Errorf("Error creating table %s: %v", name, err)
+	}
+	existing, err := tableColumns(tx, name)
+	if err != nil {
+		return 0, err
+	}
+	for i, column := range table.Columns {
+		if existing[column] {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", quoteIdentifier(name), quoteIdentifier(column), table.Types[i])); err != nil {
+			return 0, fmt.Errorf("Error adding column %s to table %s: %v", column, name, err)
+		}
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(table.Columns)), ", ")
+	insert, err := tx.Prepare(table.insertSQL(name) + "(" + placeholders + ")")
+	if err != nil {
+		return 0, fmt.Errorf("Error writing table %s: %v", name, err)
+	}
+	defer insert.Close()
+	for _, row := range table.Rows {
+		if _, err := insert.Exec(row...); err != nil {
+			return 0, fmt.Errorf("Error writing table %s: %v", name, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("Error writing SQLite database: %v", err)
+	}
+	return len(table.Rows), nil
+}
+
+// tableColumns returns the names of the columns of a table.
+func tableColumns(tx *sql.Tx, name string) (map[string]bool, error) {
+	rows, err := tx.Query("SELECT name FROM pragma_table_info(?)", name)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading table %s: %v", name, err)
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, fmt.Errorf("Error reading table %s: %v", name, err)
+		}
+		columns[column] = true
+	}
+	return columns, rows.Err()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeSQL(t *testing.T) {
+	doc := []interface{}{
+		map[string]interface{}{"id": 1.0, "name": "O'Brien", "active": true},
+		map[string]interface{}{"id": 2.0, "score": 0.5, "tags": []interface{}{"a"}, "address": map[string]interface{}{"city": "Oslo"}},
+	}
+	output, err := encodeSQL(doc, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `CREATE TABLE IF NOT EXISTS "users" ("active" INTEGER, "id" INTEGER, "name" TEXT, "address.city" TEXT, "score" REAL, "tags" TEXT);
+INSERT INTO "users" ("active", "id", "name", "address.city", "score", "tags") VALUES (1, 1, 'O''Brien', NULL, NULL, NULL);
+INSERT INTO "users" ("active", "id", "name", "address.city", "score", "tags") VALUES (NULL, 2, NULL, 'Oslo', 0.5, '["a"]');
+`
+	if string(output) != expected {
+		t.Errorf("Expected a table and INSERT statements, got:\n%s", output)
+	}
+
+	// A column of nulls is TEXT, whatever the values later written to it; a
+	// null ahead of a number does not make the column TEXT
+	table, err := tableRows([]interface{}{
+		map[string]interface{}{"deleted_at": nil, "id": nil},
+		map[string]interface{}{"deleted_at": nil, "id": 2.0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"TEXT", "INTEGER"}; !reflect.DeepEqual(table.Types, expected) {
+		t.Errorf("Expected types %v for %v, got %v", expected, table.Columns, table.Types)
+	}
+
+	if _, err := encodeSQL([]interface{}{1.0}, "users"); err == nil {
+		t.Error("Expected an array of scalars to be rejected")
+	}
+}
+
+func TestWriteSQLite(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "out.db")
+	if n, err := writeSQLite([]interface{}{
+		map[string]interface{}{"id": 1.0, "email": "***"},
+		map[string]interface{}{"id": 2.0, "email": nil},
+	}, file, "users"); err != nil || n != 2 {
+		t.Fatalf("Expected 2 rows written, got %d, %v", n, err)
+	}
+	if _, err := writeSQLite(map[string]interface{}{"id": 3.0, "plan": "pro"}, file, "users"); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT id, email, plan FROM users ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var result [][]interface{}
+	for rows.Next() {
+		var id int64
+		var email, plan sql.NullString
+		if err := rows.Scan(&id, &email, &plan); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, []interface{}{id, email.String, plan.String})
+	}
+	expected := [][]interface{}{{int64(1), "***", ""}, {int64(2), "", ""}, {int64(3), "", "pro"}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected the rows of both writes, with the added column, got %v", result)
+	}
+}
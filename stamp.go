@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"runtime/debug"
+	"sort"
+	"time"
+)
+
+// version is the tool version, set at build time with
+// -ldflags "-X main.version=v1.2.3"; otherwise the module version is used.
+var version = ""
+
+// toolVersion returns the version reported in provenance stamps.
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// StampRule adds a provenance object at Path to every output record.
+type StampRule struct {
+	Path []string
+	// RulesetHash identifies the rules and options the output was made with
+	RulesetHash string
+}
+
+// rulesetHash hashes the rule flags set on fs, by the command line or the
+// config file options, together with the config rules. Only flags named in
+// ruleFlags count, so output formatting does not change the hash. Config
+// stages count too.
+func rulesetHash(fs *flag.FlagSet, ruleFlags map[string]bool, config *Config) string {
+	var set [][2]string
+	fs.Visit(func(f *flag.Flag) {
+		if ruleFlags[f.Name] {
+			set = append(set, [2]string{f.Name, f.Value.String()})
+		}
+	})
+	sort.Slice(set, func(i, j int) bool { return set[i][0] < set[j][0] })
+
+	ruleset := struct {
+		Flags  [][2]string  `json:"flags"`
+		Rules  []ConfigRule `json:"rules"`
+		Stages []Stage      `json:"stages,omitempty"`
+	}{Flags: set}
+	if config != nil {
+		ruleset.Rules = config.Rules
+		ruleset.Stages = config.Stages
+	}
+	data, _ := json.Marshal(ruleset)
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// ruleCounts returns the number of rules of each kind in use.
+func (t *Transformations) ruleCounts() map[string]int {
+	counts := map[string]int{
+		"replaceval":     len(t.ReplaceVal),
+		"replacekey":     len(t.ReplaceKey),
+		"defaultval":     len(t.DefaultVal),
+		"arrayfilter":    len(t.ArrayFilter),
+		"renamekeydepth": len(t.RenameKeyDepth),
+		"maskval":        len(t.MaskVal),
+		"condreplace":    len(t.CondReplace),
+		"stringops":      len(t.StringOps),
+		"splitval":       len(t.SplitVal),
+		"joinval":        len(t.JoinVal),
+		"encodeval":      len(t.EncodeVal),
+		"decodeval":      len(t.DecodeVal),
+		"arraywhere":     len(t.ArrayWhere),
+		"arrayuniqueby":  len(t.ArrayUniqueBy),
+		"arrayflatten":   len(t.ArrayFlatten),
+		"arraysample":    len(t.ArraySample),
+		"arraytomap":     len(t.ArrayToMap),
+		"maptoarray":     len(t.MapToArray),
+		"groupby":        len(t.GroupBy),
+		"join":           len(t.Join),
+		"arrayintersect": len(t.ArrayIntersect),
+		"arraysubtract":  len(t.ArraySubtract),
+		"pseudonymize":   len(t.Pseudonymize),
+		"execval":        len(t.ExecVal),
+		"lookup":         len(t.Lookup),
+		"httpenrich":     len(t.HTTPEnrich),
+		"scalenum":       len(t.ScaleNum),
+		"parsenum":       len(t.ParseNum),
+		"addfield":       len(t.AddFields),
+		"aggregate":      len(t.Aggregates),
+		"plugin":         len(t.Plugins),
+		"stage":          len(t.Stages),
+		"pointer":        len(t.Pointers),
+	}
+	for kind, n := range counts {
+		if n == 0 {
+			delete(counts, kind)
+		}
+	}
+	return counts
+}
+
+// stampDocument adds the provenance object to each record of a processed
+// document.
+func stampDocument(doc interface{}, rule *StampRule, transforms *Transformations) interface{} {
+	counts := make(map[string]interface{})
+	for kind, n := range transforms.ruleCounts() {
+		counts[kind] = float64(n)
+	}
+	stamp := map[string]interface{}{
+		"version":   toolVersion(),
+		"ruleset":   rule.RulesetHash,
+		"timestamp": processingTime.Format(time.RFC3339),
+		"rules":     counts,
+	}
+	return mapRecords(doc, func(record map[string]interface{}) map[string]interface{} {
+		return setField(record, rule.Path, stamp)
+	})
+}
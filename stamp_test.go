@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestStamp(t *testing.T) {
+	filters, transforms, _ := parseArgs("test", []string{"-stamp", "-maskval", "email:***", "-dropkey", "tmp"})
+	if transforms.Stamp == nil {
+		t.Fatal("Expected -stamp to set a stamp rule")
+	}
+
+	input := map[string]interface{}{"email": "a@example.com", "tmp": 1.0}
+	result := processDocument(input, "in.json", filters, transforms).(map[string]interface{})
+
+	stamp, ok := result["_filtering"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected a _filtering object, got %v", result)
+	}
+	if !strings.HasPrefix(stamp["ruleset"].(string), "sha256:") {
+		t.Errorf("Expected a ruleset hash, got %v", stamp["ruleset"])
+	}
+	if stamp["version"] == "" || stamp["timestamp"] == "" {
+		t.Errorf("Expected version and timestamp, got %v", stamp)
+	}
+	if counts := stamp["rules"].(map[string]interface{}); counts["maskval"] != 1.0 || len(counts) != 1 {
+		t.Errorf("Expected rule counts {maskval: 1}, got %v", counts)
+	}
+	if _, exists := result["tmp"]; exists {
+		t.Error("Expected the rules to apply as usual")
+	}
+}
+
+func TestRulesetHash(t *testing.T) {
+	var indent string
+	register := func(fs *flag.FlagSet) {
+		fs.StringVar(&indent, "indent", "2", "")
+	}
+	hash := func(args ...string) string {
+		_, transforms, _ := parseArgs("test", append([]string{"-stamp"}, args...), register)
+		return transforms.Stamp.RulesetHash
+	}
+
+	base := hash("-maskval", "email:***")
+	if hash("-maskval", "email:***", "-indent", "4", "-stamppath", "$.meta") != base {
+		t.Error("Expected output options not to change the ruleset hash")
+	}
+	if hash("-maskval", "email:###") == base {
+		t.Error("Expected a different rule to change the ruleset hash")
+	}
+
+	_, transforms, _ := parseArgs("test", []string{"-stamp", "-stamppath", "$.meta.provenance"})
+	result := processDocument([]interface{}{map[string]interface{}{}}, "in.json", &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms).([]interface{})
+	meta := result[0].(map[string]interface{})["meta"].(map[string]interface{})
+	if _, ok := meta["provenance"]; !ok {
+		t.Errorf("Expected the stamp at -stamppath in each record, got %v", result)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"os"
+	"sort"
+)
+
+// PathStats summarizes the values found at one key path.
+type PathStats struct {
+	Count    int     `json:"count"`
+	Nulls    int     `json:"nulls"`
+	NullRate float64 `json:"null_rate"`
+	// Distinct estimates the number of distinct scalar values
+	Distinct int          `json:"distinct"`
+	Numbers  *NumberStats `json:"numbers,omitempty"`
+	Strings  *LengthStats `json:"string_lengths,omitempty"`
+
+	sum      float64
+	lengths  map[int]int
+	distinct *hyperLogLog
+}
+
+// NumberStats summarizes the numbers at a path.
+type NumberStats struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Mean  float64 `json:"mean"`
+}
+
+// LengthStats is the distribution of the lengths of the strings at a path.
+type LengthStats struct {
+	Count int     `json:"count"`
+	Min   int     `json:"min"`
+	P50   int     `json:"p50"`
+	P90   int     `json:"p90"`
+	P99   int     `json:"p99"`
+	Max   int     `json:"max"`
+	Mean  float64 `json:"mean"`
+}
+
+// runStats implements the stats subcommand, which applies the ruleset to
+// the input files and writes statistics for every key path as JSON, to help
+// choose bounds and filter thresholds.
+func runStats(arguments []string) {
+	filters, transforms, args := parseArgs("stats", arguments)
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s stats [options] input.json...\n", os.Args[0])
+		os.Exit(2)
+	}
+	pipeline, err := NewPipeline(filters, transforms)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	stats := make(map[string]*PathStats)
+	for _, filename := range args {
+		data, err := readJSON(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		processed, err := pipeline.Process(data, filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		collectStats(stats, processed, filters.LenUnit)
+	}
+
+	output, err := codec.MarshalIndent(finishStats(stats), "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshaling JSON: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(output))
+}
+
+// collectStats adds the values of a document to the statistics per path.
+// String lengths are counted in lenUnit.
+func collectStats(stats map[string]*PathStats, doc interface{}, lenUnit string) {
+	walkPaths(doc, "$", func(path string, value interface{}) {
+		s := stats[path]
+		if s == nil {
+			s = &PathStats{lengths: make(map[int]int), distinct: newHyperLogLog()}
+			stats[path] = s
+		}
+		s.Count++
+
+		switch v := value.(type) {
+		case nil:
+			s.Nulls++
+		case float64:
+			if s.Numbers == nil {
+				s.Numbers = &NumberStats{Min: v, Max: v}
+			}
+			s.Numbers.Count++
+			s.Numbers.Min = math.Min(s.Numbers.Min, v)
+			s.Numbers.Max = math.Max(s.Numbers.Max, v)
+			s.sum += v
+		case string:
+			s.lengths[stringLength(v, lenUnit)]++
+		}
+		if str, ok := formatScalar(value); ok {
+			s.distinct.add(getValueType(value) + ":" + str)
+		}
+	})
+}
+
+// finishStats computes the rates, means and distributions of collected
+// statistics.
+func finishStats(stats map[string]*PathStats) map[string]*PathStats {
+	for _, s := range stats {
+		s.NullRate = float64(s.Nulls) / float64(s.Count)
+		s.Distinct = s.distinct.estimate()
+		if s.Numbers != nil {
+			s.Numbers.Mean = s.sum / float64(s.Numbers.Count)
+		}
+		if len(s.lengths) > 0 {
+			s.Strings = lengthStats(s.lengths)
+		}
+	}
+	return stats
+}
+
+// lengthStats computes the distribution of string lengths from their counts.
+func lengthStats(lengths map[int]int) *LengthStats {
+	values := make([]int, 0, len(lengths))
+	ls := &LengthStats{}
+	total := 0
+	for length, count := range lengths {
+		values = append(values, length)
+		ls.Count += count
+		total += length * count
+	}
+	sort.Ints(values)
+	ls.Min, ls.Max = values[0], values[len(values)-1]
+	ls.Mean = float64(total) / float64(ls.Count)
+
+	// percentile returns the smallest length at or below which a fraction
+	// p of the strings lie
+	percentile := func(p float64) int {
+		rank := int(math.Ceil(p * float64(ls.Count)))
+		seen := 0
+		for _, length := range values {
+			seen += lengths[length]
+			if seen >= rank {
+				return length
+			}
+		}
+		return ls.Max
+	}
+	ls.P50, ls.P90, ls.P99 = percentile(0.5), percentile(0.9), percentile(0.99)
+	return ls
+}
+
+// hyperLogLogBits is the number of hash bits selecting a register; 2^10
+// registers estimate distinct counts within about 3%.
+const hyperLogLogBits = 10
+
+// hyperLogLog estimates the number of distinct strings added to it in
+// constant memory.
+type hyperLogLog struct {
+	registers [1 << hyperLogLogBits]uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{}
+}
+
+func (h *hyperLogLog) add(str string) {
+	hash := fnv.New64a()
+	hash.Write([]byte(str))
+	x := hash.Sum64()
+	// fnv mixes its last bytes poorly into the high bits
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+
+	index := x >> (64 - hyperLogLogBits)
+	rank := uint8(bits.LeadingZeros64(x<<hyperLogLogBits|1<<(hyperLogLogBits-1))) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+func (h *hyperLogLog) estimate() int {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Pow(2, -float64(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// Linear counting is more accurate for small sets
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(math.Round(estimate))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	doc := []interface{}{
+		map[string]interface{}{"age": 30.0, "name": "Ann", "zip": nil},
+		map[string]interface{}{"age": 40.0, "name": "Robert", "zip": "0150"},
+		map[string]interface{}{"age": 20.0, "name": "Ann", "zip": nil},
+		map[string]interface{}{"age": 30.0, "name": "Jo", "zip": nil},
+	}
+	stats := make(map[string]*PathStats)
+	collectStats(stats, doc, "bytes")
+	finishStats(stats)
+
+	age := stats["$[].age"]
+	if age.Count != 4 || age.Distinct != 3 || *age.Numbers != (NumberStats{Count: 4, Min: 20, Max: 40, Mean: 30}) {
+		t.Errorf("Unexpected age statistics: %+v %+v", age, age.Numbers)
+	}
+	name := stats["$[].name"]
+	if name.Distinct != 3 || *name.Strings != (LengthStats{Count: 4, Min: 2, P50: 3, P90: 6, P99: 6, Max: 6, Mean: 3.5}) {
+		t.Errorf("Unexpected name statistics: %+v %+v", name, name.Strings)
+	}
+	if zip := stats["$[].zip"]; zip.Nulls != 3 || zip.NullRate != 0.75 || zip.Numbers != nil {
+		t.Errorf("Unexpected zip statistics: %+v", zip)
+	}
+}
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{10, 1000, 100000} {
+		h := newHyperLogLog()
+		for i := 0; i < n; i++ {
+			h.add(fmt.Sprintf("value-%d", i))
+			h.add(fmt.Sprintf("value-%d", i/2))
+		}
+		if got := h.estimate(); math.Abs(float64(got-n))/float64(n) > 0.1 {
+			t.Errorf("Expected about %d distinct values, estimated %d", n, got)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+# Prints the rows of a Parquet file as a JSON array of objects, as read by
+# pyarrow, for TestParquetFixture.
+import json
+import sys
+
+import pyarrow.parquet as pq
+
+json.dump(pq.read_table(sys.argv[1]).to_pylist(), sys.stdout)
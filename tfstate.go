@@ -0,0 +1,75 @@
+package main
+
+// maskSensitiveAttributes replaces, with mask, the values of every Terraform
+// state instance that its sensitive_attributes list: paths into its
+// attributes such as [{"type": "get_attr", "value": "password"}], with index
+// steps for list elements and map keys. Paths it cannot follow are skipped.
+// Like updatePath, it copies what it changes rather than modifying it.
+func maskSensitiveAttributes(doc interface{}, mask string) interface{} {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = maskSensitiveAttributes(item, mask)
+		}
+		paths, _ := v["sensitive_attributes"].([]interface{})
+		if _, ok := v["attributes"].(map[string]interface{}); !ok || len(paths) == 0 {
+			return result
+		}
+		for _, path := range paths {
+			steps, ok := terraformPath(path)
+			if !ok {
+				continue
+			}
+			result["attributes"] = updatePath(result["attributes"], steps, false, func(interface{}) interface{} {
+				return mask
+			})
+		}
+		return result
+
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = maskSensitiveAttributes(item, mask)
+		}
+		return result
+	}
+	return doc
+}
+
+// terraformPath converts a path of sensitive_attributes into path steps.
+func terraformPath(path interface{}) ([]pathStep, bool) {
+	items, ok := path.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, false
+	}
+	var steps []pathStep
+	for _, item := range items {
+		step, _ := item.(map[string]interface{})
+		switch step["type"] {
+		case "get_attr":
+			name, ok := step["value"].(string)
+			if !ok {
+				return nil, false
+			}
+			steps = append(steps, pathStep{Key: name})
+		case "index":
+			// Index values are typed: {"value": 0, "type": "number"}
+			index, _ := step["value"].(map[string]interface{})
+			switch value := index["value"].(type) {
+			case float64:
+				if value < 0 || value != float64(int(value)) {
+					return nil, false
+				}
+				steps = append(steps, pathStep{Index: int(value), IsIndex: true})
+			case string:
+				steps = append(steps, pathStep{Key: value})
+			default:
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+	}
+	return steps, true
+}
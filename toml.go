@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// decodeTOML parses a TOML document into the same generic tree as JSON.
+// Integers become float64 and date-times strings in their TOML form.
+func decodeTOML(data []byte) (interface{}, error) {
+	var doc map[string]interface{}
+	if err := toml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("Error parsing TOML: %v", err)
+	}
+	return fromTOML(doc), nil
+}
+
+func fromTOML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = fromTOML(item)
+		}
+		return v
+	case []map[string]interface{}:
+		arr := make([]interface{}, len(v))
+		for i, item := range v {
+			arr[i] = fromTOML(item)
+		}
+		return arr
+	case []interface{}:
+		for i, item := range v {
+			v[i] = fromTOML(item)
+		}
+		return v
+	case int64:
+		return float64(v)
+	case time.Time:
+		// The decoder marks local date-times, dates and times with these zones
+		switch v.Location().String() {
+		case "datetime-local":
+			return v.Format("2006-01-02T15:04:05.999999999")
+		case "date-local":
+			return v.Format("2006-01-02")
+		case "time-local":
+			return v.Format("15:04:05.999999999")
+		default:
+			return v.Format(time.RFC3339Nano)
+		}
+	default:
+		return v
+	}
+}
+
+// encodeTOML writes a processed document as TOML. The document must be an
+// object. Whole numbers are written as integers, and nulls, which TOML cannot
+// represent, are left out.
+func encodeTOML(doc interface{}) ([]byte, error) {
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("TOML output requires an object, got %s", getValueType(doc))
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(toTOML(obj)); err != nil {
+		return nil, fmt.Errorf("Error writing TOML: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func toTOML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		table := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if item != nil {
+				table[key] = toTOML(item)
+			}
+		}
+		return table
+	case []interface{}:
+		arr := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			if item != nil {
+				arr = append(arr, toTOML(item))
+			}
+		}
+		return arr
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTOMLRoundTrip(t *testing.T) {
+	input := []byte(`title = "app"
+port = 8080
+ratio = 0.5
+released = 2024-01-02
+
+[database]
+user = "admin"
+password = "hunter2"
+
+[[servers]]
+name = "alpha"
+
+[[servers]]
+name = "beta"
+`)
+
+	doc, err := decodeTOML(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"title":    "app",
+		"port":     8080.0,
+		"ratio":    0.5,
+		"released": "2024-01-02",
+		"database": map[string]interface{}{"user": "admin", "password": "hunter2"},
+		"servers": []interface{}{
+			map[string]interface{}{"name": "alpha"},
+			map[string]interface{}{"name": "beta"},
+		},
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Fatalf("Expected %v, got %v", expected, doc)
+	}
+
+	transforms := &Transformations{MaskVal: parseMaskRules([]string{"password:***"})}
+	result := processJSON(doc, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, transforms, 1)
+	result.(map[string]interface{})["missing"] = nil
+
+	output, err := encodeTOML(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTrip, err := decodeTOML(output)
+	if err != nil {
+		t.Fatalf("Could not parse the TOML output: %v\n%s", err, output)
+	}
+	expected["database"].(map[string]interface{})["password"] = "***"
+	if !reflect.DeepEqual(roundTrip, expected) {
+		t.Errorf("Expected %v, got %v", expected, roundTrip)
+	}
+
+	if _, err := encodeTOML([]interface{}{1.0}); err == nil {
+		t.Error("Expected an error for a top-level array")
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TruncateRule replaces the objects and arrays whose members would lie
+// deeper than Depth with Placeholder.
+type TruncateRule struct {
+	Depth       int
+	Placeholder interface{}
+}
+
+// parseTruncateRule parses N[:placeholder]. The placeholder is JSON, such as
+// {"_truncated": true}, or else taken as a string; it is "…" by default.
+func parseTruncateRule(flag string) (*TruncateRule, error) {
+	depthStr, placeholder, hasPlaceholder := strings.Cut(flag, ":")
+	depth, err := strconv.Atoi(depthStr)
+	if err != nil || depth < 1 {
+		return nil, fmt.Errorf("%q: depth must be a positive integer", flag)
+	}
+
+	rule := &TruncateRule{Depth: depth, Placeholder: "…"}
+	if hasPlaceholder {
+		var value interface{}
+		if err := json.Unmarshal([]byte(placeholder), &value); err == nil {
+			rule.Placeholder = value
+		} else {
+			rule.Placeholder = placeholder
+		}
+	}
+	return rule, nil
+}
+
+// truncates reports whether data is an object or array with members that
+// the rule truncates at depth. Empty ones are kept, as nothing is lost.
+func (r *TruncateRule) truncates(data interface{}, depth int) bool {
+	if r == nil || depth <= r.Depth {
+		return false
+	}
+	switch v := data.(type) {
+	case map[string]interface{}:
+		return len(v) > 0
+	case []interface{}:
+		return len(v) > 0
+	}
+	return false
+}
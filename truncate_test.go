@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTruncateDepth(t *testing.T) {
+	input := map[string]interface{}{
+		"id": 1.0,
+		"user": map[string]interface{}{
+			"name":    "Ann",
+			"address": map[string]interface{}{"city": "Oslo"},
+			"tags":    []interface{}{"a", "b"},
+			"empty":   map[string]interface{}{},
+		},
+	}
+
+	tests := []struct {
+		flag     string
+		expected map[string]interface{}
+	}{
+		{"1", map[string]interface{}{"id": 1.0, "user": "…"}},
+		{"2:[cut]", map[string]interface{}{
+			"id": 1.0,
+			"user": map[string]interface{}{
+				"name":    "Ann",
+				"address": "[cut]",
+				"tags":    "[cut]",
+				"empty":   map[string]interface{}{},
+			},
+		}},
+		{`1:{"_truncated": true}`, map[string]interface{}{"id": 1.0, "user": map[string]interface{}{"_truncated": true}}},
+		{"3", input},
+	}
+	for _, tt := range tests {
+		rule, err := parseTruncateRule(tt.flag)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.flag, err)
+		}
+		result := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, &Transformations{Truncate: rule}, 1)
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.flag, tt.expected, result)
+		}
+	}
+
+	for _, flag := range []string{"", "0", "x:…", "-1"} {
+		if _, err := parseTruncateRule(flag); err == nil {
+			t.Errorf("Expected an error for %q", flag)
+		}
+	}
+}
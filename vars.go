@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseSetVars parses -set flags of the form name=value.
+func parseSetVars(flags []string) (map[string]string, error) {
+	vars := make(map[string]string, len(flags))
+	for _, flag := range flags {
+		name, value, ok := strings.Cut(flag, "=")
+		if !ok || !configVariable.MatchString("${"+name+"}") {
+			return nil, fmt.Errorf("%q: must be name=value", flag)
+		}
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+// checkVars reports config vars whose values are not scalars.
+func (c *Config) checkVars() error {
+	for name, value := range c.Vars {
+		if _, ok := formatScalar(value); !ok || value == nil {
+			return fmt.Errorf("var %q must be a string, number or boolean", name)
+		}
+	}
+	return nil
+}
+
+// varLookup looks names up in the -set values first, then in the config
+// vars, and then with next.
+func (c *Config) varLookup(set map[string]string, next func(string) (string, bool)) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		if value, ok := set[name]; ok {
+			return value, true
+		}
+		if value, ok := c.Vars[name]; ok {
+			str, _ := formatScalar(value)
+			return str, true
+		}
+		return next(name)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigVars(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "rules.json")
+	config := `{
+  "vars": {"mask": "***", "min": 3},
+  "options": {"minkeylen": "${min}"},
+  "rules": [{"maskval": "email:${mask}"}, {"replaceval": "upper:${env}"}]
+}`
+	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	t.Setenv("env", "staging")
+
+	filters, transforms, _ := parseArgs("test", []string{"-config", configFile})
+	if filters.MinKeyLen != 3 {
+		t.Errorf("Expected minkeylen from the var default, got %d", filters.MinKeyLen)
+	}
+	if len(transforms.MaskVal) != 1 || transforms.MaskVal[0].Mask != "***" {
+		t.Errorf("Expected the mask from the var default, got %v", transforms.MaskVal)
+	}
+	if len(transforms.ReplaceVal) != 1 || transforms.ReplaceVal[0].Replacement != "staging" {
+		t.Errorf("Expected an undeclared var from the environment, got %v", transforms.ReplaceVal)
+	}
+
+	_, transforms, _ = parseArgs("test", []string{"-config", configFile, "-set", "mask=[redacted]", "-set", "env=prod"})
+	if transforms.MaskVal[0].Mask != "[redacted]" || transforms.ReplaceVal[0].Replacement != "prod" {
+		t.Errorf("Expected -set to override the vars, got %v and %v", transforms.MaskVal, transforms.ReplaceVal)
+	}
+
+	if _, err := parseSetVars([]string{"no-equals"}); err == nil {
+		t.Error("Expected a -set without = to be rejected")
+	}
+	if _, err := parseSetVars([]string{"bad name=1"}); err == nil || !strings.Contains(err.Error(), "name=value") {
+		t.Errorf("Expected an invalid var name to be rejected, got %v", err)
+	}
+	if err := (&Config{Vars: map[string]interface{}{"list": []interface{}{}}}).checkVars(); err == nil {
+		t.Error("Expected a non-scalar var to be rejected")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// wasmTransformer runs a WebAssembly plugin. The module exports its memory
+// and two functions:
+//
+//	alloc(size i32) i32                  returns a buffer of size bytes
+//	transform(ptr i32, len i32) i64      transforms one value
+//
+// transform receives {"path": ..., "key": ..., "value": ...} as JSON in a
+// buffer from alloc and returns the location of the new value as JSON,
+// packed as ptr<<32 | len; a length of 0 leaves the value as it is.
+type wasmTransformer struct {
+	filename  string
+	module    api.Module
+	alloc     api.Function
+	transform api.Function
+	// mu serializes calls, as a module instance is not safe for concurrent use
+	mu sync.Mutex
+}
+
+// wasmCall is the input of a plugin's transform function.
+type wasmCall struct {
+	Path  string      `json:"path"`
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// loadWASMPlugin compiles and instantiates a WebAssembly plugin. WASI is
+// available to it, so modules built by TinyGo or Rust for wasip1 work too.
+func loadWASMPlugin(filename string) (Transformer, error) {
+	code, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading plugin: %v", err)
+	}
+
+	ctx := context.Background()
+	runtime := wazero.NewRuntime(ctx)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		return nil, fmt.Errorf("Error loading plugin %s: %v", filename, err)
+	}
+	// Reactor modules initialize themselves in _initialize instead of _start
+	config := wazero.NewModuleConfig().WithStartFunctions("_initialize").WithStderr(os.Stderr)
+	module, err := runtime.InstantiateWithConfig(ctx, code, config)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading plugin %s: %v", filename, err)
+	}
+
+	w := &wasmTransformer{
+		filename:  filename,
+		module:    module,
+		alloc:     module.ExportedFunction("alloc"),
+		transform: module.ExportedFunction("transform"),
+	}
+	if w.alloc == nil || w.transform == nil || module.Memory() == nil {
+		return nil, fmt.Errorf("Plugin %s must export memory, alloc and transform", filename)
+	}
+	return w, nil
+}
+
+// Transform calls the plugin's transform function, leaving the value as it
+// is if the plugin fails. applyPlugins calls call instead, so that a failure
+// stops the run.
+func (w *wasmTransformer) Transform(path, key string, value interface{}) (interface{}, bool) {
+	result, ok, err := w.call(path, key, value)
+	if err != nil {
+		return nil, false
+	}
+	return result, ok
+}
+
+func (w *wasmTransformer) call(path, key string, value interface{}) (interface{}, bool, error) {
+	input, err := json.Marshal(wasmCall{Path: path, Key: key, Value: value})
+	if err != nil {
+		return nil, false, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ctx := context.Background()
+	results, err := w.alloc.Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, false, err
+	}
+	ptr := uint32(results[0])
+	if !w.module.Memory().Write(ptr, input) {
+		return nil, false, fmt.Errorf("alloc returned a buffer outside memory")
+	}
+
+	results, err = w.transform.Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return nil, false, err
+	}
+	outPtr, outLen := uint32(results[0]>>32), uint32(results[0])
+	if outLen == 0 {
+		return nil, false, nil
+	}
+	output, ok := w.module.Memory().Read(outPtr, outLen)
+	if !ok {
+		return nil, false, fmt.Errorf("transform returned a result outside memory")
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, false, fmt.Errorf("invalid result: %v", err)
+	}
+	return result, true, nil
+}
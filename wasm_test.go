@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// constantWASM is a minimal plugin that replaces every value with "wasm":
+//
+//	(module
+//	  (memory (export "memory") 1)
+//	  (data (i32.const 0) "\"wasm\"")
+//	  (func (export "alloc") (param i32) (result i32) i32.const 1024)
+//	  (func (export "transform") (param i32 i32) (result i64) i64.const 6))
+var constantWASM = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// types
+	0x01, 0x0c, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e,
+	// functions
+	0x03, 0x03, 0x02, 0x00, 0x01,
+	// memory
+	0x05, 0x03, 0x01, 0x00, 0x01,
+	// exports
+	0x07, 0x1e, 0x03,
+	0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+	0x05, 'a', 'l', 'l', 'o', 'c', 0x00, 0x00,
+	0x09, 't', 'r', 'a', 'n', 's', 'f', 'o', 'r', 'm', 0x00, 0x01,
+	// code
+	0x0a, 0x0c, 0x02,
+	0x05, 0x00, 0x41, 0x80, 0x08, 0x0b,
+	0x04, 0x00, 0x42, 0x06, 0x0b,
+	// data
+	0x0b, 0x0c, 0x01, 0x00, 0x41, 0x00, 0x0b, 0x06, '"', 'w', 'a', 's', 'm', '"',
+}
+
+func TestWASMPlugin(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "constant.wasm")
+	if err := os.WriteFile(filename, constantWASM, 0644); err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+
+	p, err := loadPlugin(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := map[string]interface{}{"id": "int-42", "count": 3.0}
+	result := processJSON(input, &Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, &Transformations{Plugins: []Transformer{p}}, 1)
+
+	expected := map[string]interface{}{"id": "wasm", "count": "wasm"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestWASMPluginFailure(t *testing.T) {
+	// The same plugin, returning wasm!! instead, which is not JSON
+	invalid := bytes.Replace(constantWASM, []byte(`"wasm"`), []byte("wasm!!"), 1)
+	filename := filepath.Join(t.TempDir(), "invalid.wasm")
+	if err := os.WriteFile(filename, invalid, 0644); err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+
+	p, err := loadPlugin(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline, err := NewPipeline(&Filters{MaxDepth: 999999, MaxKeyLen: 999999, MaxStrLen: 999999}, &Transformations{Plugins: []Transformer{p}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := pipeline.Process(map[string]interface{}{"id": "int-42"}, "test")
+	if err == nil || !strings.Contains(err.Error(), "invalid result") || result != nil {
+		t.Errorf("Expected a failing plugin to stop processing, got %v, %v", result, err)
+	}
+}
+
+func TestWASMPluginMissingExports(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "empty.wasm")
+	if err := os.WriteFile(filename, []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}, 0644); err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+	if _, err := loadPlugin(filename); err == nil {
+		t.Error("Expected an error for a module without the plugin exports")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WhereClause selects object array elements whose Field equals Value.
+type WhereClause struct {
+	Field string
+	Value interface{}
+}
+
+// parseWhereClauses parses -where flags of the form field=value. Values are
+// read with parseValue, so status=active compares with a string, count=3
+// with a number and done=true with a boolean.
+func parseWhereClauses(flags []string) ([]WhereClause, error) {
+	var clauses []WhereClause
+	for _, flag := range flags {
+		field, value, ok := strings.Cut(flag, "=")
+		if !ok || field == "" {
+			return nil, fmt.Errorf("%q: must be field=value", flag)
+		}
+		clauses = append(clauses, WhereClause{Field: field, Value: parseValue(value)})
+	}
+	return clauses, nil
+}
+
+// matchesWhere reports whether obj satisfies every -where clause. A missing
+// field compares as null.
+func (f *Filters) matchesWhere(obj map[string]interface{}) bool {
+	for _, clause := range f.Where {
+		value, ok := obj[clause.Field]
+		if !ok && f.IgnoreKeyCase {
+			for key, v := range obj {
+				if strings.EqualFold(key, clause.Field) {
+					value = v
+					break
+				}
+			}
+		}
+		if !compareValues(value, "==", clause.Value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWhere(t *testing.T) {
+	input := []interface{}{
+		map[string]interface{}{"id": 1.0, "status": "active", "tier": 2.0},
+		map[string]interface{}{"id": 2.0, "status": "inactive", "tier": 2.0},
+		map[string]interface{}{"id": 3.0, "status": "active", "tier": "2"},
+		map[string]interface{}{"id": 4.0, "Status": "active", "tier": 2.0},
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{"-where", "status=active", "-where", "tier=2"})
+	expected := []interface{}{input[0]}
+	if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected the active tier 2 record, got %v", result)
+	}
+
+	filters.IgnoreKeyCase = true
+	expected = []interface{}{input[0], input[3]}
+	if result := processJSON(input, filters, transforms, 1); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected -ignorekeycase to match Status, got %v", result)
+	}
+
+	clauses, err := parseWhereClauses([]string{"deleted_at=null", "note=a=b"})
+	if err != nil || clauses[0].Value != nil || clauses[1].Value != "a=b" {
+		t.Errorf("Expected typed values split at the first =, got %v, %v", clauses, err)
+	}
+	if _, err := parseWhereClauses([]string{"status"}); err == nil {
+		t.Error("Expected a clause without = to be rejected")
+	}
+}
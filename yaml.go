@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlStream is the input of a YAML file holding several documents, such as
+// a Kubernetes manifest or Helm output. Each document is processed on its
+// own and written back in order, separated by ---.
+type yamlStream []interface{}
+
+// decodeYAML parses a YAML file into the same generic tree as JSON. A file
+// with several documents gives a yamlStream of them; empty documents stay in
+// it as nulls.
+func decodeYAML(data []byte) (interface{}, error) {
+	var docs yamlStream
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc interface{}
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Error parsing YAML document %d: %v", len(docs)+1, err)
+		}
+		value, err := fromYAML(doc)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing YAML document %d: %v", len(docs)+1, err)
+		}
+		docs = append(docs, value)
+	}
+	switch len(docs) {
+	case 0:
+		return nil, nil
+	case 1:
+		return docs[0], nil
+	}
+	return docs, nil
+}
+
+// fromYAML converts a decoded YAML value into JSON types: numbers become
+// float64 and timestamps strings in RFC 3339 form. Mappings must have
+// scalar keys, which become their text.
+func fromYAML(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			converted, err := fromYAML(item)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = converted
+		}
+		return v, nil
+	case map[interface{}]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			name, ok := formatScalar(key)
+			if !ok {
+				return nil, fmt.Errorf("mapping key %v is not a scalar", key)
+			}
+			converted, err := fromYAML(item)
+			if err != nil {
+				return nil, err
+			}
+			obj[name] = converted
+		}
+		return obj, nil
+	case []interface{}:
+		for i, item := range v {
+			converted, err := fromYAML(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	default:
+		return v, nil
+	}
+}
+
+// encodeYAML writes a processed document as YAML, or each document of a
+// yamlStream separated by ---.
+func encodeYAML(doc interface{}) ([]byte, error) {
+	docs, ok := doc.(yamlStream)
+	if !ok {
+		docs = yamlStream{doc}
+	}
+	var buf bytes.Buffer
+	for i, item := range docs {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		if item == nil {
+			continue
+		}
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(item); err != nil {
+			return nil, fmt.Errorf("Error writing YAML: %v", err)
+		}
+		encoder.Close()
+	}
+	return buf.Bytes(), nil
+}
+
+// processYAMLStream applies the pipeline to every document of a YAML
+// stream, with the same query, limits and assertions as a single document.
+// The context's error is returned as it is when processing is stopped.
+func processYAMLStream(ctx context.Context, pipeline *Pipeline, docs yamlStream, source string, format *FormatOptions, limits *Limits, assertions *Assertions) (yamlStream, error) {
+	result := make(yamlStream, len(docs))
+	var violations []string
+	for i, doc := range docs {
+		// Empty documents only keep their place in the stream
+		if doc == nil {
+			continue
+		}
+		if err := limits.checkDepth(doc); err != nil {
+			return nil, fmt.Errorf("document %d: %v", i+1, err)
+		}
+		processed, err := pipeline.ProcessContext(ctx, doc, source)
+		if err != nil {
+			return nil, err
+		}
+		if processed, err = applyQuery(processed, format); err != nil {
+			return nil, fmt.Errorf("document %d: %v", i+1, err)
+		}
+		for _, violation := range assertions.check(processed) {
+			violations = append(violations, fmt.Sprintf("document %d: %s", i+1, violation))
+		}
+		result[i] = processed
+	}
+
+	if len(violations) > 0 {
+		return nil, fmt.Errorf("Assertion failed: %s\n%d assertion failures; no output written", strings.Join(violations, "\nAssertion failed: "), len(violations))
+	}
+	return result, nil
+}
+
+// runYAMLStream processes the documents of a multi-document YAML input file
+// and writes them as a YAML stream to outputFile, or - for stdout.
+func runYAMLStream(ctx context.Context, docs yamlStream, inputFile, outputFile string, pipeline *Pipeline, format *FormatOptions, limits *Limits, assertions *Assertions) {
+	if format.SplitByKey || format.ChunkSize > 0 || format.RemovedOut != "" || format.OutFormat != "yaml" || format.Template != nil {
+		fmt.Fprintf(os.Stderr, "Multi-document YAML input is written as YAML and cannot be combined with split output, -removed-out, -template or another -outformat\n")
+		os.Exit(2)
+	}
+
+	docs, err := processYAMLStream(ctx, pipeline, docs, inputFile, format, limits, assertions)
+	exitOnProcessError(err, limits)
+
+	output, err := encodeYAML(docs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if err := limits.checkOutputSize(int64(len(output))); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if outputFile == "-" {
+		os.Stdout.Write(output)
+		return
+	}
+	if err := writeFileAtomic(outputFile, output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output file: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Processed YAML written to %s\n", outputFile)
+}
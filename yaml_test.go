@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestYAMLStream(t *testing.T) {
+	input := []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+data:
+  password: aHVudGVyMg==
+---
+---
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  replicas: 3
+  containers:
+    - name: app
+      env:
+        - name: TOKEN
+          value: abc
+`)
+
+	doc, err := decodeYAML(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, ok := doc.(yamlStream)
+	if !ok || len(docs) != 3 || docs[1] != nil {
+		t.Fatalf("Expected three documents, the second empty, got %v", doc)
+	}
+	spec := docs[2].(map[string]interface{})["spec"].(map[string]interface{})
+	if spec["replicas"] != 3.0 {
+		t.Errorf("Expected integers read as numbers, got %v", spec["replicas"])
+	}
+
+	filters, transforms, _ := parseArgs("test", []string{"-maskval", "password:***", "-maskval", "value:***"})
+	pipeline, err := NewPipeline(filters, transforms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	format := &FormatOptions{InFormat: "yaml", OutFormat: "yaml"}
+	processed, err := processYAMLStream(context.Background(), pipeline, docs, "cluster.yaml", format, &Limits{}, &Assertions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := encodeYAML(processed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `apiVersion: v1
+data:
+  password: '***'
+kind: Secret
+metadata:
+  name: db
+---
+---
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  containers:
+    - env:
+        - name: TOKEN
+          value: '***'
+      name: app
+  replicas: 3
+`
+	if string(output) != expected {
+		t.Errorf("Expected each document processed and separated, got:\n%s", output)
+	}
+
+	single, err := decodeYAML([]byte("a: 1\n"))
+	if err != nil || !reflect.DeepEqual(single, map[string]interface{}{"a": 1.0}) {
+		t.Errorf("Expected a single document read as it is, got %v, %v", single, err)
+	}
+	if _, err := decodeYAML([]byte("a: [1\n")); err == nil {
+		t.Error("Expected invalid YAML to be rejected")
+	}
+}